@@ -9,11 +9,26 @@ import (
 
 const (
 	// CNI commands.
-	Cmd       = "CNI_COMMAND"
-	CmdAdd    = "ADD"
-	CmdGet    = "GET"
-	CmdDel    = "DEL"
-	CmdUpdate = "UPDATE"
+	Cmd        = "CNI_COMMAND"
+	CmdAdd     = "ADD"
+	CmdGet     = "GET"
+	CmdCheck   = "CHECK"
+	CmdDel     = "DEL"
+	CmdUpdate  = "UPDATE"
+	CmdVersion = "VERSION"
+
+	// Environment variable that selects the persistent store backend.
+	StoreBackendEnv = "AZURE_CNI_STORE_BACKEND"
+
+	// Environment variable that selects the log format, "text" or "json".
+	LogFormatEnv = "AZURE_CNI_LOG_FORMAT"
+
+	// Environment variable that makes plugins print the changes they would make instead of making them.
+	// It is passed to delegated plugins, so that they do not persist their state either.
+	DryRunEnv = "AZURE_CNI_DRY_RUN"
+
+	// Environment variable that passes the correlation ID of a command to delegated plugins.
+	CorrelationIDEnv = "AZURE_CNI_CORRELATION_ID"
 
 	// CNI errors.
 	ErrRuntime = 100
@@ -29,6 +44,7 @@ var supportedVersions = []string{"0.1.0", "0.2.0", "0.3.0", "0.3.1", "0.4.0"}
 type PluginApi interface {
 	Add(args *cniSkel.CmdArgs) error
 	Get(args *cniSkel.CmdArgs) error
+	Check(args *cniSkel.CmdArgs) error
 	Delete(args *cniSkel.CmdArgs) error
 	Update(args *cniSkel.CmdArgs) error
 }
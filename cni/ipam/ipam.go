@@ -25,7 +25,8 @@ const (
 )
 
 var (
-	ipv4DefaultRouteDstPrefix = net.IPNet{net.IPv4zero, net.IPv4Mask(0, 0, 0, 0)}
+	ipv4DefaultRouteDstPrefix = net.IPNet{IP: net.IPv4zero, Mask: net.IPv4Mask(0, 0, 0, 0)}
+	ipv6DefaultRouteDstPrefix = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
 )
 
 // IpamPlugin represents the CNI IPAM plugin.
@@ -115,6 +116,20 @@ func (plugin *ipamPlugin) Configure(stdinData []byte) (*cni.NetworkConfig, error
 		plugin.SetOption(common.OptIpamQueryInterval, i)
 	}
 
+	// Set configuration file of the file environment.
+	if nwCfg.Ipam.ConfigFile != "" {
+		plugin.SetOption(common.OptIpamConfigFile, nwCfg.Ipam.ConfigFile)
+	}
+
+	// Set address reuse cooldown.
+	if nwCfg.Ipam.ReuseCooldown != "" {
+		i, _ := strconv.Atoi(nwCfg.Ipam.ReuseCooldown)
+		plugin.SetOption(common.OptIpamReuseCooldown, i)
+	}
+
+	// Set container runtime queried to reclaim addresses.
+	plugin.SetOption(common.OptIpamContainerRuntime, nwCfg.Ipam.ContainerRuntime)
+
 	err = plugin.am.StartSource(plugin.Options)
 	if err != nil {
 		return nil, err
@@ -128,6 +143,21 @@ func (plugin *ipamPlugin) Configure(stdinData []byte) (*cni.NetworkConfig, error
 	return nwCfg, nil
 }
 
+// getAddressOptions returns the options identifying the owner of the addresses allocated for a CNI command.
+func getAddressOptions(args *cniSkel.CmdArgs) map[string]string {
+	options := map[string]string{
+		ipam.OptAddressContainerID: args.ContainerID,
+		ipam.OptAddressNetNsPath:   args.Netns,
+	}
+
+	if podCfg, err := cni.ParseCniArgs(args.Args); err == nil {
+		options[ipam.OptAddressPodName] = string(podCfg.K8S_POD_NAME)
+		options[ipam.OptAddressPodNamespace] = string(podCfg.K8S_POD_NAMESPACE)
+	}
+
+	return options
+}
+
 //
 // CNI implementation
 // https://github.com/containernetworking/cni/blob/master/SPEC.md
@@ -138,6 +168,8 @@ func (plugin *ipamPlugin) Add(args *cniSkel.CmdArgs) error {
 	var result *cniTypesCurr.Result
 	var err error
 
+	cni.SetLogFields(args, cni.CmdAdd)
+
 	log.Printf("[cni-ipam] Processing ADD command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
 
@@ -179,7 +211,8 @@ func (plugin *ipamPlugin) Add(args *cniSkel.CmdArgs) error {
 	}
 
 	// Allocate an address for the endpoint.
-	address, err := plugin.am.RequestAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, nwCfg.Ipam.Address, nil)
+	addressOptions := getAddressOptions(args)
+	address, err := plugin.am.RequestAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.Subnet, nwCfg.Ipam.Address, addressOptions)
 	if err != nil {
 		err = plugin.Errorf("Failed to allocate address: %v", err)
 		return err
@@ -231,6 +264,78 @@ func (plugin *ipamPlugin) Add(args *cniSkel.CmdArgs) error {
 		result.DNS.Nameservers = append(result.DNS.Nameservers, dnsServer.String())
 	}
 
+	// Allocate an IPv6 address for dual-stack networks.
+	if nwCfg.EnableDualStack {
+		// Check if an IPv6 address pool is specified.
+		if nwCfg.Ipam.SubnetV6 == "" {
+			var poolID string
+			var subnet string
+
+			options := make(map[string]string)
+			options[ipam.OptInterfaceName] = nwCfg.Master
+
+			poolID, subnet, err = plugin.am.RequestPool(nwCfg.Ipam.AddrSpace, "", "", options, true)
+			if err != nil {
+				err = plugin.Errorf("Failed to allocate IPv6 pool: %v", err)
+				return err
+			}
+
+			// On failure, release the address pool.
+			defer func() {
+				if err != nil && poolID != "" {
+					log.Printf("[cni-ipam] Releasing pool %v.", poolID)
+					plugin.am.ReleasePool(nwCfg.Ipam.AddrSpace, poolID)
+				}
+			}()
+
+			nwCfg.Ipam.SubnetV6 = subnet
+			log.Printf("[cni-ipam] Allocated address poolID %v with subnet %v.", poolID, subnet)
+		}
+
+		var addressV6 string
+		var ipAddressV6 *net.IPNet
+		var apInfoV6 *ipam.AddressPoolInfo
+
+		addressV6, err = plugin.am.RequestAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6, "", addressOptions)
+		if err != nil {
+			err = plugin.Errorf("Failed to allocate IPv6 address: %v", err)
+			return err
+		}
+
+		// On failure, release the address.
+		defer func() {
+			if err != nil && addressV6 != "" {
+				log.Printf("[cni-ipam] Releasing address %v.", addressV6)
+				plugin.am.ReleaseAddress(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6, addressV6, nil)
+			}
+		}()
+
+		log.Printf("[cni-ipam] Allocated address %v.", addressV6)
+
+		ipAddressV6, err = platform.ConvertStringToIPNet(addressV6)
+		if err != nil {
+			err = plugin.Errorf("Failed to parse address: %v", err)
+			return err
+		}
+
+		apInfoV6, err = plugin.am.GetPoolInfo(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6)
+		if err != nil {
+			err = plugin.Errorf("Failed to get pool information: %v", err)
+			return err
+		}
+
+		result.IPs = append(result.IPs, &cniTypesCurr.IPConfig{
+			Version: "6",
+			Address: *ipAddressV6,
+			Gateway: apInfoV6.Gateway,
+		})
+
+		result.Routes = append(result.Routes, &cniTypes.Route{
+			Dst: ipv6DefaultRouteDstPrefix,
+			GW:  apInfoV6.Gateway,
+		})
+	}
+
 	// Convert result to the requested CNI version.
 	res, err := result.GetAsVersion(nwCfg.CNIVersion)
 	if err != nil {
@@ -255,10 +360,69 @@ func (plugin *ipamPlugin) Get(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
+// Check handles CNI check commands. The addresses reported by the runtime must still be allocated.
+func (plugin *ipamPlugin) Check(args *cniSkel.CmdArgs) error {
+	var err error
+
+	cni.SetLogFields(args, cni.CmdCheck)
+
+	log.Printf("[cni-ipam] Processing CHECK command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
+		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
+
+	defer func() { log.Printf("[cni-ipam] CHECK command completed with err:%v.", err) }()
+
+	// Parse network configuration from stdin.
+	nwCfg, err := plugin.Configure(args.StdinData)
+	if err != nil {
+		err = plugin.Errorf("Failed to parse network configuration: %v", err)
+		return err
+	}
+
+	prevResult, err := nwCfg.GetPrevResult()
+	if err != nil {
+		err = plugin.Errorf("Failed to parse prevResult: %v", err)
+		return err
+	}
+
+	if prevResult == nil {
+		return nil
+	}
+
+	for _, ipconfig := range prevResult.IPs {
+		if !plugin.isAddressAllocated(nwCfg.Ipam.AddrSpace, ipconfig.Address.IP) {
+			err = plugin.Errorf("IP address %v in prevResult is not allocated", ipconfig.Address.String())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isAddressAllocated returns whether an address of an address space is allocated.
+func (plugin *ipamPlugin) isAddressAllocated(asId string, address net.IP) bool {
+	for _, as := range plugin.am.GetAddressSpaceDetails() {
+		if as.Id != asId {
+			continue
+		}
+
+		for _, ap := range as.Pools {
+			for _, ar := range ap.Addresses {
+				if ar.Address == address.String() && (ar.InUse || ar.ID != "") {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
 // Delete handles CNI delete commands.
 func (plugin *ipamPlugin) Delete(args *cniSkel.CmdArgs) error {
 	var err error
 
+	cni.SetLogFields(args, cni.CmdDel)
+
 	log.Printf("[cni-ipam] Processing DEL command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
 
@@ -286,6 +450,15 @@ func (plugin *ipamPlugin) Delete(args *cniSkel.CmdArgs) error {
 			err = plugin.Errorf("Failed to release pool: %v", err)
 			return err
 		}
+
+		// Release the IPv6 pool of dual-stack networks.
+		if nwCfg.Ipam.SubnetV6 != "" {
+			err := plugin.am.ReleasePool(nwCfg.Ipam.AddrSpace, nwCfg.Ipam.SubnetV6)
+			if err != nil {
+				err = plugin.Errorf("Failed to release IPv6 pool: %v", err)
+				return err
+			}
+		}
 	}
 
 	return nil
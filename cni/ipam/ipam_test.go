@@ -11,6 +11,9 @@ import (
 	"testing"
 
 	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/ipam"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
 )
 
 var plugin *ipamPlugin
@@ -94,3 +97,57 @@ func TestAddSuccess(t *testing.T) {
 
 func TestDelSuccess(t *testing.T) {
 }
+
+func TestCheck(t *testing.T) {
+	poolID, _, err := plugin.am.RequestPool(ipam.LocalDefaultAddressSpaceId, "", "", nil, false)
+	if err != nil {
+		t.Fatalf("RequestPool failed, err:%v.", err)
+	}
+	defer plugin.am.ReleasePool(ipam.LocalDefaultAddressSpaceId, poolID)
+
+	address, err := plugin.am.RequestAddress(ipam.LocalDefaultAddressSpaceId, poolID, "10.0.0.5", nil)
+	if err != nil {
+		t.Fatalf("RequestAddress failed, err:%v.", err)
+	}
+	defer plugin.am.ReleaseAddress(ipam.LocalDefaultAddressSpaceId, poolID, address, nil)
+
+	tests := []struct {
+		name       string
+		prevResult string
+		expectErr  bool
+	}{
+		{
+			name:       "no prevResult",
+			prevResult: "",
+			expectErr:  false,
+		},
+		{
+			name:       "allocated address",
+			prevResult: `,"prevResult":{"cniVersion":"0.4.0","ips":[{"version":"4","address":"10.0.0.5/16"}]}`,
+			expectErr:  false,
+		},
+		{
+			name:       "address not allocated",
+			prevResult: `,"prevResult":{"cniVersion":"0.4.0","ips":[{"version":"4","address":"10.0.0.6/16"}]}`,
+			expectErr:  true,
+		},
+		{
+			name:       "address not in any pool",
+			prevResult: `,"prevResult":{"cniVersion":"0.4.0","ips":[{"version":"4","address":"192.168.0.5/16"}]}`,
+			expectErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		args := &cniSkel.CmdArgs{
+			ContainerID: "check-container",
+			IfName:      "eth0",
+			StdinData: []byte(`{"cniVersion":"0.4.0","name":"azure","type":"azure-vnet",` +
+				`"ipam":{"type":"azure-vnet-ipam"}` + tt.prevResult + `}`),
+		}
+
+		if err := plugin.Check(args); (err != nil) != tt.expectErr {
+			t.Errorf("%s: Check returned err:%v, expected error:%v.", tt.name, err, tt.expectErr)
+		}
+	}
+}
@@ -26,6 +26,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The network configuration selects the store backend and log format.
+	// Invalid configurations are reported by the command.
+	nwCfg, _ := ipamPlugin.ReadNetworkConfig()
+	if nwCfg != nil {
+		config.StoreBackend = nwCfg.StoreBackend
+	}
+
+	cni.SetLogFormat(nwCfg)
+
 	if err := ipamPlugin.Plugin.InitializeKeyValueStore(&config); err != nil {
 		fmt.Printf("Failed to initialize key-value store of ipam plugin, err:%v.\n", err)
 		os.Exit(1)
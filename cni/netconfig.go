@@ -10,6 +10,8 @@ import (
 	"github.com/Azure/azure-container-networking/network/policy"
 
 	cniTypes "github.com/containernetworking/cni/pkg/types"
+	cniTypesCurr "github.com/containernetworking/cni/pkg/types/current"
+	cniVers "github.com/containernetworking/cni/pkg/version"
 )
 
 const (
@@ -31,6 +33,16 @@ type PortMapping struct {
 type RuntimeConfig struct {
 	PortMappings []PortMapping    `json:"portMappings,omitempty"`
 	DNS          RuntimeDNSConfig `json:"dns,omitempty"`
+	Bandwidth    *BandwidthEntry  `json:"bandwidth,omitempty"`
+}
+
+// https://github.com/containernetworking/plugins/tree/master/plugins/meta/bandwidth
+// Rates are in bits per second and bursts in bits.
+type BandwidthEntry struct {
+	IngressRate  uint64 `json:"ingressRate,omitempty"`
+	IngressBurst uint64 `json:"ingressBurst,omitempty"`
+	EgressRate   uint64 `json:"egressRate,omitempty"`
+	EgressBurst  uint64 `json:"egressBurst,omitempty"`
 }
 
 // https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/dockershim/network/cni/cni.go#L104
@@ -42,30 +54,40 @@ type RuntimeDNSConfig struct {
 
 // NetworkConfig represents Azure CNI plugin network configuration.
 type NetworkConfig struct {
-	CNIVersion                 string   `json:"cniVersion"`
-	Name                       string   `json:"name"`
-	Type                       string   `json:"type"`
-	Mode                       string   `json:"mode"`
-	Master                     string   `json:"master"`
-	Bridge                     string   `json:"bridge,omitempty"`
-	LogLevel                   string   `json:"logLevel,omitempty"`
-	LogTarget                  string   `json:"logTarget,omitempty"`
-	InfraVnetAddressSpace      string   `json:"infraVnetAddressSpace,omitempty"`
-	PodNamespaceForDualNetwork []string `json:"podNamespaceForDualNetwork,omitempty"`
-	MultiTenancy               bool     `json:"multiTenancy,omitempty"`
-	EnableSnatOnHost           bool     `json:"enableSnatOnHost,omitempty"`
-	EnableExactMatchForPodName bool     `json:"enableExactMatchForPodName,omitempty"`
-	CNSUrl                     string   `json:"cnsurl,omitempty"`
+	CNIVersion                 string          `json:"cniVersion"`
+	Name                       string          `json:"name"`
+	Type                       string          `json:"type"`
+	Mode                       string          `json:"mode"`
+	Master                     string          `json:"master"`
+	Bridge                     string          `json:"bridge,omitempty"`
+	LogLevel                   string          `json:"logLevel,omitempty"`
+	LogTarget                  string          `json:"logTarget,omitempty"`
+	LogFormat                  string          `json:"logFormat,omitempty"`
+	StoreBackend               string          `json:"storeBackend,omitempty"`
+	InfraVnetAddressSpace      string          `json:"infraVnetAddressSpace,omitempty"`
+	PodNamespaceForDualNetwork []string        `json:"podNamespaceForDualNetwork,omitempty"`
+	MultiTenancy               bool            `json:"multiTenancy,omitempty"`
+	EnableSnatOnHost           bool            `json:"enableSnatOnHost,omitempty"`
+	EnableExactMatchForPodName bool            `json:"enableExactMatchForPodName,omitempty"`
+	EnableDualStack            bool            `json:"enableDualStack,omitempty"`
+	MTU                        int             `json:"mtu,omitempty"`
+	Offload                    map[string]bool `json:"offload,omitempty"`
+	CNSUrl                     string          `json:"cnsurl,omitempty"`
 	Ipam                       struct {
-		Type          string `json:"type"`
-		Environment   string `json:"environment,omitempty"`
-		AddrSpace     string `json:"addressSpace,omitempty"`
-		Subnet        string `json:"subnet,omitempty"`
-		Address       string `json:"ipAddress,omitempty"`
-		QueryInterval string `json:"queryInterval,omitempty"`
+		Type             string `json:"type"`
+		Environment      string `json:"environment,omitempty"`
+		AddrSpace        string `json:"addressSpace,omitempty"`
+		Subnet           string `json:"subnet,omitempty"`
+		SubnetV6         string `json:"subnetV6,omitempty"`
+		Address          string `json:"ipAddress,omitempty"`
+		QueryInterval    string `json:"queryInterval,omitempty"`
+		ConfigFile       string `json:"configFile,omitempty"`
+		ReuseCooldown    string `json:"reuseCooldown,omitempty"`
+		ContainerRuntime string `json:"containerRuntime,omitempty"`
 	}
-	DNS            cniTypes.DNS  `json:"dns"`
-	RuntimeConfig  RuntimeConfig `json:"runtimeConfig"`
+	DNS            cniTypes.DNS           `json:"dns"`
+	RuntimeConfig  RuntimeConfig          `json:"runtimeConfig"`
+	RawPrevResult  map[string]interface{} `json:"prevResult,omitempty"`
 	AdditionalArgs []KVPair
 }
 
@@ -119,6 +141,26 @@ func GetPoliciesFromNwCfg(kvp []KVPair) []policy.Policy {
 	return policies
 }
 
+// GetPrevResult returns the result of the previous plugin invocation passed in the network config.
+// It returns nil if the runtime did not supply one.
+func (nwcfg *NetworkConfig) GetPrevResult() (*cniTypesCurr.Result, error) {
+	if nwcfg.RawPrevResult == nil {
+		return nil, nil
+	}
+
+	bytes, err := json.Marshal(nwcfg.RawPrevResult)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := cniVers.NewResult(nwcfg.CNIVersion, bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return cniTypesCurr.NewResultFromResult(res)
+}
+
 // Serialize marshals a network configuration to bytes.
 func (nwcfg *NetworkConfig) Serialize() []byte {
 	bytes, _ := json.Marshal(nwcfg)
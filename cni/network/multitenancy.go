@@ -86,8 +86,8 @@ func getContainerNetworkConfigurationInternal(
 	subnetPrefix := common.GetInterfaceSubnetWithSpecificIp(networkConfig.PrimaryInterfaceIdentifier)
 	if subnetPrefix == nil {
 		errBuf := fmt.Sprintf("Interface not found for this ip %v", networkConfig.PrimaryInterfaceIdentifier)
-		log.Printf(errBuf)
-		return nil, nil, net.IPNet{}, fmt.Errorf(errBuf)
+		log.Printf("%s", errBuf)
+		return nil, nil, net.IPNet{}, fmt.Errorf("%s", errBuf)
 	}
 
 	return convertToCniResult(networkConfig, ifName), networkConfig, *subnetPrefix, nil
@@ -210,7 +210,7 @@ func GetMultiTenancyCNIResult(
 
 		if checkIfSubnetOverlaps(enableInfraVnet, nwCfg, cnsNetworkConfig) {
 			buf := fmt.Sprintf("InfraVnet %v overlaps with customerVnet %+v", nwCfg.InfraVnetAddressSpace, cnsNetworkConfig.CnetAddressSpace)
-			log.Printf(buf)
+			log.Printf("%s", buf)
 			err = errors.New(buf)
 			return nil, nil, net.IPNet{}, nil, err
 		}
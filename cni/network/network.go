@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"os"
 
 	"github.com/Azure/azure-container-networking/cni"
 	"github.com/Azure/azure-container-networking/cns"
@@ -24,13 +25,15 @@ import (
 const (
 	dockerNetworkOption = "com.docker.network.generic"
 	opModeTransparent   = "transparent"
-	// Supported IP version. Currently support only IPv4
-	ipVersion = "4"
+	// Supported IP versions.
+	ipVersion   = "4"
+	ipVersionV6 = "6"
 )
 
 // CNI Operation Types
 const (
 	CNI_ADD    = "ADD"
+	CNI_CHECK  = "CHECK"
 	CNI_DEL    = "DEL"
 	CNI_UPDATE = "UPDATE"
 )
@@ -129,6 +132,43 @@ func (plugin *netPlugin) findMasterInterface(nwCfg *cni.NetworkConfig, subnetPre
 	return ""
 }
 
+// getIPConfigForFamily returns the first IP configuration in the result with the given address family.
+func getIPConfigForFamily(result *cniTypesCurr.Result, family platform.AddressFamily) *cniTypesCurr.IPConfig {
+	for _, ipconfig := range result.IPs {
+		if platform.GetAddressFamily(&ipconfig.Address.IP) == family {
+			return ipconfig
+		}
+	}
+
+	return nil
+}
+
+// getSubnetPrefixForFamily returns the prefix of the network subnet with the given address family.
+func getSubnetPrefixForFamily(nwInfo *network.NetworkInfo, family platform.AddressFamily) string {
+	for _, subnet := range nwInfo.Subnets {
+		if subnet.Family == family {
+			return subnet.Prefix.String()
+		}
+	}
+
+	return ""
+}
+
+// releaseAddress calls into IPAM plugin to release the address from the subnet of its address family.
+func (plugin *netPlugin) releaseAddress(nwCfg *cni.NetworkConfig, address net.IP) error {
+	subnet := nwCfg.Ipam.Subnet
+	if platform.GetAddressFamily(&address) == platform.AfINET6 {
+		subnet = nwCfg.Ipam.SubnetV6
+	}
+
+	ipamCfg := *nwCfg
+	ipamCfg.Ipam.Subnet = subnet
+	ipamCfg.Ipam.SubnetV6 = ""
+	ipamCfg.Ipam.Address = address.String()
+
+	return plugin.DelegateDel(nwCfg.Ipam.Type, &ipamCfg)
+}
+
 // GetEndpointID returns a unique endpoint ID based on the CNI args.
 func GetEndpointID(args *cniSkel.CmdArgs) string {
 	infraEpId, _ := network.ConstructEndpointID(args.ContainerID, args.Netns, args.IfName)
@@ -146,15 +186,15 @@ func (plugin *netPlugin) getPodInfo(args string) (string, string, error) {
 	k8sNamespace := string(podCfg.K8S_POD_NAMESPACE)
 	if len(k8sNamespace) == 0 {
 		errMsg := "Pod Namespace not specified in CNI Args"
-		log.Printf(errMsg)
-		return "", "", plugin.Errorf(errMsg)
+		log.Printf("%s", errMsg)
+		return "", "", plugin.Errorf("%s", errMsg)
 	}
 
 	k8sPodName := string(podCfg.K8S_POD_NAME)
 	if len(k8sPodName) == 0 {
 		errMsg := "Pod Name not specified in CNI Args"
-		log.Printf(errMsg)
-		return "", "", plugin.Errorf(errMsg)
+		log.Printf("%s", errMsg)
+		return "", "", plugin.Errorf("%s", errMsg)
 	}
 
 	return k8sPodName, k8sNamespace, nil
@@ -178,21 +218,23 @@ func (plugin *netPlugin) setCNIReportDetails(nwCfg *cni.NetworkConfig, opType st
 //
 
 // Add handles CNI add commands.
-func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
+func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) (err error) {
 	var (
 		result           *cniTypesCurr.Result
 		azIpamResult     *cniTypesCurr.Result
-		err              error
 		vethName         string
 		nwCfg            *cni.NetworkConfig
 		epInfo           *network.EndpointInfo
 		iface            *cniTypesCurr.Interface
 		subnetPrefix     net.IPNet
+		subnetV6         *network.SubnetInfo
 		cnsNetworkConfig *cns.GetNetworkContainerResponse
 		enableInfraVnet  bool
 		nwDNSInfo        network.DNSInfo
 	)
 
+	cni.SetLogFields(args, cni.CmdAdd)
+
 	log.Printf("[cni-net] Processing ADD command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
 
@@ -230,7 +272,11 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 
 		if err == nil && res != nil {
 			// Output the result to stdout.
-			res.Print()
+			var mtu int
+			if epInfo != nil {
+				mtu = epInfo.MTU
+			}
+			err = printResult(res, args.IfName, mtu)
 		}
 
 		log.Printf("[cni-net] ADD command completed with result:%+v err:%v.", result, err)
@@ -245,15 +291,15 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	k8sContainerID := args.ContainerID
 	if len(k8sContainerID) == 0 {
 		errMsg := "Container ID not specified in CNI Args"
-		log.Printf(errMsg)
-		return plugin.Errorf(errMsg)
+		log.Printf("%s", errMsg)
+		return plugin.Errorf("%s", errMsg)
 	}
 
 	k8sIfName := args.IfName
 	if len(k8sIfName) == 0 {
 		errMsg := "Interfacename not specified in CNI Args"
-		log.Printf(errMsg)
-		return plugin.Errorf(errMsg)
+		log.Printf("%s", errMsg)
+		return plugin.Errorf("%s", errMsg)
 	}
 
 	for _, ns := range nwCfg.PodNamespaceForDualNetwork {
@@ -298,7 +344,7 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		 */
 		epInfo, _ := plugin.nm.GetEndpointInfo(networkId, endpointId)
 		if epInfo != nil {
-			resultConsAdd, errConsAdd := handleConsecutiveAdd(args.ContainerID, endpointId, nwInfo, nwCfg)
+			resultConsAdd, errConsAdd := handleConsecutiveAdd(args.ContainerID, endpointId, epInfo, nwInfo, nwCfg)
 			if errConsAdd != nil {
 				log.Printf("handleConsecutiveAdd failed with error %v", errConsAdd)
 				result = resultConsAdd
@@ -328,17 +374,33 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			subnetPrefix = result.IPs[0].Address
 			iface := &cniTypesCurr.Interface{Name: args.IfName}
 			result.Interfaces = append(result.Interfaces, iface)
+
+			// Derive the IPv6 subnet prefix of dual-stack networks.
+			if ipconfigV6 := getIPConfigForFamily(result, platform.AfINET6); ipconfigV6 != nil {
+				subnetPrefixV6 := ipconfigV6.Address
+				subnetPrefixV6.IP = subnetPrefixV6.IP.Mask(subnetPrefixV6.Mask)
+				subnetV6 = &network.SubnetInfo{
+					Family:  platform.AfINET6,
+					Prefix:  subnetPrefixV6,
+					Gateway: ipconfigV6.Gateway,
+				}
+			}
 		}
 
 		ipconfig := result.IPs[0]
 		gateway := ipconfig.Gateway
 
-		// On failure, call into IPAM plugin to release the address and address pool.
+		// On failure, call into IPAM plugin to release the addresses and address pools.
 		defer func() {
 			if err != nil {
 				nwCfg.Ipam.Subnet = subnetPrefix.String()
-				nwCfg.Ipam.Address = ipconfig.Address.IP.String()
-				plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
+				if subnetV6 != nil {
+					nwCfg.Ipam.SubnetV6 = subnetV6.Prefix.String()
+				}
+
+				for _, ipconfig := range result.IPs {
+					plugin.releaseAddress(nwCfg, ipconfig.Address.IP)
+				}
 
 				nwCfg.Ipam.Address = ""
 				plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
@@ -390,6 +452,11 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			EnableSnatOnHost: nwCfg.EnableSnatOnHost,
 			DNS:              nwDNSInfo,
 			Policies:         policies,
+			MTU:              nwCfg.MTU,
+		}
+
+		if subnetV6 != nil {
+			nwInfo.Subnets = append(nwInfo.Subnets, *subnetV6)
 		}
 
 		nwInfo.Options = make(map[string]interface{})
@@ -409,6 +476,15 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 			log.Printf("[cni-net] Found network %v with subnet %v.", networkId, subnetPrefix)
 			nwCfg.Ipam.Subnet = subnetPrefix
 
+			if nwCfg.EnableDualStack {
+				nwCfg.Ipam.SubnetV6 = getSubnetPrefixForFamily(nwInfo, platform.AfINET6)
+				if nwCfg.Ipam.SubnetV6 == "" {
+					// Do not allocate a new IPv6 pool for a network created without one.
+					log.Printf("[cni-net] Network %v has no IPv6 subnet, allocating IPv4 address only.", networkId)
+					nwCfg.EnableDualStack = false
+				}
+			}
+
 			// Call into IPAM plugin to allocate an address for the endpoint.
 			result, err = plugin.DelegateAdd(nwCfg.Ipam.Type, nwCfg)
 			if err != nil {
@@ -416,15 +492,15 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 				return err
 			}
 
-			ipconfig := result.IPs[0]
 			iface := &cniTypesCurr.Interface{Name: args.IfName}
 			result.Interfaces = append(result.Interfaces, iface)
 
-			// On failure, call into IPAM plugin to release the address.
+			// On failure, call into IPAM plugin to release the addresses.
 			defer func() {
 				if err != nil {
-					nwCfg.Ipam.Address = ipconfig.Address.IP.String()
-					plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
+					for _, ipconfig := range result.IPs {
+						plugin.releaseAddress(nwCfg, ipconfig.Address.IP)
+					}
 				}
 			}()
 		}
@@ -450,6 +526,8 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		PODName:            k8sPodName,
 		PODNameSpace:       k8sNamespace,
 		SkipHotAttachEp:    false, // Hot attach at the time of endpoint creation
+		MTU:                nwCfg.MTU,
+		Offload:            nwCfg.Offload,
 	}
 
 	epPolicies := getPoliciesFromRuntimeCfg(nwCfg)
@@ -457,6 +535,9 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 		epInfo.Policies = append(epInfo.Policies, epPolicy)
 	}
 
+	epInfo.PortMappings = getPortMappingsFromRuntimeCfg(nwCfg)
+	epInfo.Bandwidth = getBandwidthFromRuntimeCfg(nwCfg)
+
 	// Populate addresses.
 	for _, ipconfig := range result.IPs {
 		epInfo.IPAddresses = append(epInfo.IPAddresses, ipconfig.Address)
@@ -500,6 +581,44 @@ func (plugin *netPlugin) Add(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
+// printResult outputs a result to stdout. The MTU of the container interface is added to the
+// interfaces of the result, as defined by later versions of the CNI specification.
+func printResult(res cniTypes.Result, ifName string, mtu int) error {
+	if mtu == 0 {
+		return res.Print()
+	}
+
+	data, err := addInterfaceMTU(res, ifName, mtu)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// addInterfaceMTU returns the JSON encoding of a result with the MTU of the named interface.
+func addInterfaceMTU(res cniTypes.Result, ifName string, mtu int) ([]byte, error) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	interfaces, _ := raw["interfaces"].([]interface{})
+	for _, iface := range interfaces {
+		if i, ok := iface.(map[string]interface{}); ok && i["name"] == ifName {
+			i["mtu"] = mtu
+		}
+	}
+
+	return json.MarshalIndent(raw, "", "    ")
+}
+
 // Get handles CNI Get commands.
 func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
 	var (
@@ -577,8 +696,15 @@ func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
 			Address:   ipAddresses,
 		}
 
-		if epInfo.Gateways != nil {
-			ipConfig.Gateway = epInfo.Gateways[0]
+		if ipAddresses.IP.To4() == nil {
+			ipConfig.Version = ipVersionV6
+		}
+
+		for _, gateway := range epInfo.Gateways {
+			if platform.GetAddressFamily(&gateway) == platform.GetAddressFamily(&ipAddresses.IP) {
+				ipConfig.Gateway = gateway
+				break
+			}
 		}
 
 		result.IPs = append(result.IPs, ipConfig)
@@ -594,6 +720,94 @@ func (plugin *netPlugin) Get(args *cniSkel.CmdArgs) error {
 	return nil
 }
 
+// Check handles CNI check commands.
+// It verifies that the endpoint programmed by ADD is still present and unchanged.
+func (plugin *netPlugin) Check(args *cniSkel.CmdArgs) error {
+	var (
+		err          error
+		nwCfg        *cni.NetworkConfig
+		prevResult   *cniTypesCurr.Result
+		epInfo       *network.EndpointInfo
+		k8sPodName   string
+		k8sNamespace string
+		networkId    string
+	)
+
+	log.Printf("[cni-net] Processing CHECK command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
+		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
+
+	defer func() { log.Printf("[cni-net] CHECK command completed with err:%v.", err) }()
+
+	// Parse network configuration from stdin.
+	if nwCfg, err = cni.ParseNetworkConfig(args.StdinData); err != nil {
+		err = plugin.Errorf("Failed to parse network configuration: %v.", err)
+		return err
+	}
+
+	log.Printf("[cni-net] Read network configuration %+v.", nwCfg)
+
+	plugin.setCNIReportDetails(nwCfg, CNI_CHECK, "")
+
+	// Parse Pod arguments.
+	if k8sPodName, k8sNamespace, err = plugin.getPodInfo(args.Args); err != nil {
+		return err
+	}
+
+	// Initialize values from network config.
+	if networkId, err = getNetworkName(k8sPodName, k8sNamespace, args.IfName, nwCfg); err != nil {
+		err = plugin.Errorf("Failed to extract network name from network config: %v", err)
+		return err
+	}
+
+	endpointId := GetEndpointID(args)
+
+	// Query the network.
+	if _, err = plugin.nm.GetNetworkInfo(networkId); err != nil {
+		err = plugin.Errorf("Failed to query network: %v", err)
+		return err
+	}
+
+	// Query the endpoint.
+	if epInfo, err = plugin.nm.GetEndpointInfo(networkId, endpointId); err != nil {
+		err = plugin.Errorf("Failed to query endpoint: %v", err)
+		return err
+	}
+
+	// The addresses reported by the runtime must match the ones allocated to the endpoint.
+	if prevResult, err = nwCfg.GetPrevResult(); err != nil {
+		err = plugin.Errorf("Failed to parse prevResult: %v", err)
+		return err
+	}
+
+	if prevResult != nil {
+		for _, ipconfig := range prevResult.IPs {
+			found := false
+			for _, ipAddr := range epInfo.IPAddresses {
+				if ipAddr.IP.Equal(ipconfig.Address.IP) {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				err = plugin.Errorf("IP address %v in prevResult is not assigned to endpoint %v", ipconfig.Address.String(), endpointId)
+				return err
+			}
+		}
+	}
+
+	// Compare the endpoint with the live state.
+	if err = plugin.nm.CheckEndpoint(networkId, endpointId, args.IfName); err != nil {
+		err = plugin.Errorf("Endpoint check failed: %v", err)
+		return err
+	}
+
+	msg := fmt.Sprintf("CNI CHECK succeeded : IP:%+v podname %v namespace %v", epInfo.IPAddresses, k8sPodName, k8sNamespace)
+	plugin.setCNIReportDetails(nwCfg, CNI_CHECK, msg)
+
+	return nil
+}
+
 // Delete handles CNI delete commands.
 func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 	var (
@@ -606,6 +820,8 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 		epInfo       *network.EndpointInfo
 	)
 
+	cni.SetLogFields(args, cni.CmdDel)
+
 	log.Printf("[cni-net] Processing DEL command with args {ContainerID:%v Netns:%v IfName:%v Args:%v Path:%v}.",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path)
 
@@ -658,9 +874,10 @@ func (plugin *netPlugin) Delete(args *cniSkel.CmdArgs) error {
 	if !nwCfg.MultiTenancy {
 		// Call into IPAM plugin to release the endpoint's addresses.
 		nwCfg.Ipam.Subnet = nwInfo.Subnets[0].Prefix.String()
+		nwCfg.Ipam.SubnetV6 = getSubnetPrefixForFamily(nwInfo, platform.AfINET6)
 		for _, address := range epInfo.IPAddresses {
 			nwCfg.Ipam.Address = address.IP.String()
-			err = plugin.DelegateDel(nwCfg.Ipam.Type, nwCfg)
+			err = plugin.releaseAddress(nwCfg, address.IP)
 			if err != nil {
 				err = plugin.Errorf("Failed to release address: %v", err)
 				return err
@@ -738,15 +955,15 @@ func (plugin *netPlugin) Update(args *cniSkel.CmdArgs) error {
 	k8sNamespace := string(podCfg.K8S_POD_NAMESPACE)
 	if len(k8sNamespace) == 0 {
 		errMsg := "Required parameter Pod Namespace not specified in CNI Args during UPDATE"
-		log.Printf(errMsg)
-		return plugin.Errorf(errMsg)
+		log.Printf("%s", errMsg)
+		return plugin.Errorf("%s", errMsg)
 	}
 
 	k8sPodName := string(podCfg.K8S_POD_NAME)
 	if len(k8sPodName) == 0 {
 		errMsg := "Required parameter Pod Name not specified in CNI Args during UPDATE"
-		log.Printf(errMsg)
-		return plugin.Errorf(errMsg)
+		log.Printf("%s", errMsg)
+		return plugin.Errorf("%s", errMsg)
 	}
 
 	// Initialize values from network config.
@@ -755,8 +972,8 @@ func (plugin *netPlugin) Update(args *cniSkel.CmdArgs) error {
 	// Query the network.
 	if _, err = plugin.nm.GetNetworkInfo(networkID); err != nil {
 		errMsg := fmt.Sprintf("Failed to query network during CNI UPDATE: %v", err)
-		log.Printf(errMsg)
-		return plugin.Errorf(errMsg)
+		log.Printf("%s", errMsg)
+		return plugin.Errorf("%s", errMsg)
 	}
 
 	// Query the existing endpoint since this is an update.
@@ -773,20 +990,20 @@ func (plugin *netPlugin) Update(args *cniSkel.CmdArgs) error {
 	log.Printf("Going to collect target routes for [name=%v, namespace=%v] from CNS.", k8sPodName, k8sNamespace)
 	if cnsClient, err = cnsclient.NewCnsClient(nwCfg.CNSUrl); err != nil {
 		log.Printf("Initializing CNS client error in CNI Update%v", err)
-		log.Printf(err.Error())
-		return plugin.Errorf(err.Error())
+		log.Printf("%v", err)
+		return plugin.Errorf("%v", err)
 	}
 
 	// create struct with info for target POD
 	podInfo := cns.KubernetesPodInfo{PodName: k8sPodName, PodNamespace: k8sNamespace}
 	if orchestratorContext, err = json.Marshal(podInfo); err != nil {
 		log.Printf("Marshalling KubernetesPodInfo failed with %v", err)
-		return plugin.Errorf(err.Error())
+		return plugin.Errorf("%v", err)
 	}
 
 	if targetNetworkConfig, err = cnsClient.GetNetworkConfiguration(orchestratorContext); err != nil {
 		log.Printf("GetNetworkConfiguration failed with %v", err)
-		return plugin.Errorf(err.Error())
+		return plugin.Errorf("%v", err)
 	}
 
 	log.Printf("Network config received from cns for [name=%v, namespace=%v] is as follows -> %+v", k8sPodName, k8sNamespace, targetNetworkConfig)
@@ -18,8 +18,14 @@ const (
 	infraInterface = "eth2"
 )
 
-// handleConsecutiveAdd is a dummy function for Linux platform.
-func handleConsecutiveAdd(containerId, endpointId string, nwInfo *network.NetworkInfo, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error) {
+// handleConsecutiveAdd replaces the hostPort mappings of the existing endpoint with the ones of network config.
+func handleConsecutiveAdd(containerId, endpointId string, epInfo *network.EndpointInfo, nwInfo *network.NetworkInfo, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error) {
+	epInfo.PortMappings = getPortMappingsFromRuntimeCfg(nwCfg)
+	if err := network.SetupPortMappings(epInfo); err != nil {
+		log.Printf("[cni-net] Failed to setup port mappings of endpoint %v, err:%v.", endpointId, err)
+		return nil, err
+	}
+
 	return nil, nil
 }
 
@@ -111,6 +117,36 @@ func getPoliciesFromRuntimeCfg(nwCfg *cni.NetworkConfig) []policy.Policy {
 	return nil
 }
 
+// getPortMappingsFromRuntimeCfg returns hostPort mappings from network config.
+func getPortMappingsFromRuntimeCfg(nwCfg *cni.NetworkConfig) []network.PortMapping {
+	var portMappings []network.PortMapping
+	for _, mapping := range nwCfg.RuntimeConfig.PortMappings {
+		portMappings = append(portMappings, network.PortMapping{
+			HostPort:      mapping.HostPort,
+			ContainerPort: mapping.ContainerPort,
+			Protocol:      mapping.Protocol,
+			HostIP:        mapping.HostIp,
+		})
+	}
+
+	return portMappings
+}
+
+// getBandwidthFromRuntimeCfg returns bandwidth limits from network config.
+func getBandwidthFromRuntimeCfg(nwCfg *cni.NetworkConfig) *network.BandwidthLimits {
+	bw := nwCfg.RuntimeConfig.Bandwidth
+	if bw == nil || (bw.IngressRate == 0 && bw.EgressRate == 0) {
+		return nil
+	}
+
+	return &network.BandwidthLimits{
+		IngressRate:  bw.IngressRate,
+		IngressBurst: bw.IngressBurst,
+		EgressRate:   bw.EgressRate,
+		EgressBurst:  bw.EgressBurst,
+	}
+}
+
 func updateSubnetPrefix(cnsNetworkConfig *cns.GetNetworkContainerResponse, subnetPrefix *net.IPNet) error {
 	return nil
 }
@@ -0,0 +1,115 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/cni"
+	"github.com/Azure/azure-container-networking/network"
+	"github.com/Azure/azure-container-networking/telemetry"
+
+	cniSkel "github.com/containernetworking/cni/pkg/skel"
+)
+
+// fakeNetworkManager serves endpoints from memory. Methods not used by the tests are not implemented.
+type fakeNetworkManager struct {
+	network.NetworkManager
+	endpoints map[string]*network.EndpointInfo
+	checkErr  error
+}
+
+func (nm *fakeNetworkManager) GetNetworkInfo(networkId string) (*network.NetworkInfo, error) {
+	return &network.NetworkInfo{Id: networkId}, nil
+}
+
+func (nm *fakeNetworkManager) GetEndpointInfo(networkId string, endpointId string) (*network.EndpointInfo, error) {
+	epInfo, ok := nm.endpoints[endpointId]
+	if !ok {
+		return nil, fmt.Errorf("Endpoint not found")
+	}
+
+	return epInfo, nil
+}
+
+func (nm *fakeNetworkManager) CheckEndpoint(networkId string, endpointId string, ifName string) error {
+	return nm.checkErr
+}
+
+func (nm *fakeNetworkManager) GetNumberOfEndpoints(ifName string, networkId string) int {
+	return len(nm.endpoints)
+}
+
+func TestCheck(t *testing.T) {
+	cniPlugin, err := cni.NewPlugin("azure-vnet", "")
+	if err != nil {
+		t.Fatalf("NewPlugin failed, err:%v.", err)
+	}
+
+	args := &cniSkel.CmdArgs{
+		ContainerID: "12345678-check",
+		Netns:       "/var/run/netns/check",
+		IfName:      "eth0",
+		Args:        "K8S_POD_NAMESPACE=default;K8S_POD_NAME=check",
+	}
+	endpointId := GetEndpointID(args)
+
+	_, ipNet, _ := net.ParseCIDR("10.240.0.0/16")
+	ipNet.IP = net.ParseIP("10.240.0.5")
+	epInfo := &network.EndpointInfo{Id: endpointId, IPAddresses: []net.IPNet{*ipNet}}
+
+	prevResult := func(address string) string {
+		return `,"prevResult":{"cniVersion":"0.4.0","ips":[{"version":"4","address":"` + address + `"}]}`
+	}
+
+	tests := []struct {
+		name       string
+		endpoints  map[string]*network.EndpointInfo
+		prevResult string
+		checkErr   error
+		expectErr  bool
+	}{
+		{
+			name:       "missing endpoint",
+			endpoints:  map[string]*network.EndpointInfo{},
+			prevResult: prevResult("10.240.0.5/16"),
+			expectErr:  true,
+		},
+		{
+			name:       "mismatched IP",
+			endpoints:  map[string]*network.EndpointInfo{endpointId: epInfo},
+			prevResult: prevResult("10.240.0.6/16"),
+			expectErr:  true,
+		},
+		{
+			name:       "matching result",
+			endpoints:  map[string]*network.EndpointInfo{endpointId: epInfo},
+			prevResult: prevResult("10.240.0.5/16"),
+			expectErr:  false,
+		},
+		{
+			name:       "endpoint drifted from live state",
+			endpoints:  map[string]*network.EndpointInfo{endpointId: epInfo},
+			prevResult: prevResult("10.240.0.5/16"),
+			checkErr:   fmt.Errorf("veth not found"),
+			expectErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		plugin := &netPlugin{
+			Plugin: cniPlugin,
+			nm:     &fakeNetworkManager{endpoints: tt.endpoints, checkErr: tt.checkErr},
+			report: &telemetry.CNIReport{},
+		}
+
+		args.StdinData = []byte(`{"cniVersion":"0.4.0","name":"azure","type":"azure-vnet"` + tt.prevResult + `}`)
+
+		if err := plugin.Check(args); (err != nil) != tt.expectErr {
+			t.Errorf("%s: Check returned err:%v, expected error:%v.", tt.name, err, tt.expectErr)
+		}
+	}
+}
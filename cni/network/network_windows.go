@@ -23,7 +23,7 @@ import (
  * We can delete this if statement once they fix it.
  * Issue link: https://github.com/kubernetes/kubernetes/issues/57253
  */
-func handleConsecutiveAdd(containerId, endpointId string, nwInfo *network.NetworkInfo, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error) {
+func handleConsecutiveAdd(containerId, endpointId string, epInfo *network.EndpointInfo, nwInfo *network.NetworkInfo, nwCfg *cni.NetworkConfig) (*cniTypesCurr.Result, error) {
 	hnsEndpoint, err := hcsshim.GetHNSEndpointByName(endpointId)
 	if hnsEndpoint != nil {
 		log.Printf("[net] Found existing endpoint through hcsshim: %+v", hnsEndpoint)
@@ -219,6 +219,18 @@ func getPoliciesFromRuntimeCfg(nwCfg *cni.NetworkConfig) []policy.Policy {
 	return policies
 }
 
+// getPortMappingsFromRuntimeCfg returns hostPort mappings from network config.
+// Port mappings are applied through NAT policies on Windows platform.
+func getPortMappingsFromRuntimeCfg(nwCfg *cni.NetworkConfig) []network.PortMapping {
+	return nil
+}
+
+// getBandwidthFromRuntimeCfg returns bandwidth limits from network config.
+// Bandwidth shaping is not supported on Windows platform.
+func getBandwidthFromRuntimeCfg(nwCfg *cni.NetworkConfig) *network.BandwidthLimits {
+	return nil
+}
+
 func getCustomDNS(nwCfg *cni.NetworkConfig) network.DNSInfo {
 	log.Printf("[net] RuntimeConfigs: %+v", nwCfg.RuntimeConfig)
 
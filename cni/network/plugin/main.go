@@ -6,7 +6,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"reflect"
 	"time"
@@ -17,6 +16,7 @@ import (
 	acn "github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/rules"
 	"github.com/Azure/azure-container-networking/telemetry"
 	"github.com/containernetworking/cni/pkg/skel"
 )
@@ -42,6 +42,13 @@ var args = acn.ArgumentList{
 		Type:         "bool",
 		DefaultValue: false,
 	},
+	{
+		Name:         acn.OptDryRun,
+		Shorthand:    acn.OptDryRunAlias,
+		Description:  "Print the interfaces, addresses, routes and rules that would be changed to stderr instead of changing them, and do not save state",
+		Type:         "bool",
+		DefaultValue: false,
+	},
 }
 
 // Prints version information.
@@ -72,27 +79,7 @@ func validateConfig(jsonBytes []byte) error {
 	return nil
 }
 
-func getCmdArgsFromEnv() (string, *skel.CmdArgs, error) {
-	log.Printf("Going to read from stdin")
-	stdinData, err := ioutil.ReadAll(os.Stdin)
-	if err != nil {
-		return "", nil, fmt.Errorf("error reading from stdin: %v", err)
-	}
-
-	cmdArgs := &skel.CmdArgs{
-		ContainerID: os.Getenv("CNI_CONTAINERID"),
-		Netns:       os.Getenv("CNI_NETNS"),
-		IfName:      os.Getenv("CNI_IFNAME"),
-		Args:        os.Getenv("CNI_ARGS"),
-		Path:        os.Getenv("CNI_PATH"),
-		StdinData:   stdinData,
-	}
-
-	cmd := os.Getenv("CNI_COMMAND")
-	return cmd, cmdArgs, nil
-}
-
-func handleIfCniUpdate(update func(*skel.CmdArgs) error) (bool, error) {
+func handleIfCniUpdate(getCmdArgs func() (*skel.CmdArgs, error), update func(*skel.CmdArgs) error) (bool, error) {
 	isupdate := true
 
 	if os.Getenv("CNI_COMMAND") != cni.CmdUpdate {
@@ -101,7 +88,7 @@ func handleIfCniUpdate(update func(*skel.CmdArgs) error) (bool, error) {
 
 	log.Printf("CNI UPDATE received.")
 
-	_, cmdArgs, err := getCmdArgsFromEnv()
+	cmdArgs, err := getCmdArgs()
 	if err != nil {
 		log.Printf("Received error while retrieving cmds from environment: %+v", err)
 		return isupdate, err
@@ -135,13 +122,36 @@ func main() {
 		os.Exit(0)
 	}
 
+	if dryRun := acn.GetArg(acn.OptDryRun).(bool); dryRun {
+		cni.SetDryRun()
+	}
+
+	// Dry-run mode is also inherited from the environment.
+	if cni.IsDryRun() {
+		platform.SetDryRun(os.Stderr)
+		rules.SetBackend(rules.NewRecordingBackend(os.Stderr))
+	}
+
 	var (
 		config common.PluginConfig
 		err    error
 	)
 
+	netPlugin, err := network.NewPlugin(name, &config)
+	if err != nil {
+		fmt.Printf("Failed to create network plugin, err:%v.\n", err)
+		return
+	}
+
+	// The network configuration selects the store backend and log format.
+	nwCfg, nwCfgErr := netPlugin.ReadNetworkConfig()
+	if nwCfg != nil {
+		config.StoreBackend = nwCfg.StoreBackend
+	}
+
 	log.SetName(name)
 	log.SetLevel(log.LevelInfo)
+	cni.SetLogFormat(nwCfg)
 	if err = log.SetTarget(log.TargetLogfile); err != nil {
 		fmt.Printf("Failed to setup cni logging: %v\n", err)
 		return
@@ -149,6 +159,10 @@ func main() {
 
 	defer log.Close()
 
+	if nwCfgErr != nil {
+		log.Printf("Failed to read network configuration, err:%v.", nwCfgErr)
+	}
+
 	config.Version = version
 	reportManager := &telemetry.ReportManager{
 		HostNetAgentURL: hostNetAgentURL,
@@ -171,12 +185,6 @@ func main() {
 	cniReport.GetReport(pluginName, version, ipamQueryURL)
 	startTime := time.Now().UnixNano() / int64(time.Millisecond)
 
-	netPlugin, err := network.NewPlugin(name, &config)
-	if err != nil {
-		log.Printf("Failed to create network plugin, err:%v.\n", err)
-		return
-	}
-
 	netPlugin.SetCNIReport(cniReport)
 
 	// CNI Acquires lock
@@ -215,7 +223,7 @@ func main() {
 		panic("network plugin start fatal error")
 	}
 
-	handled, err := handleIfCniUpdate(netPlugin.Update)
+	handled, err := handleIfCniUpdate(netPlugin.GetCmdArgs, netPlugin.Update)
 	if handled == true {
 		log.Printf("CNI UPDATE finished.")
 	} else if err = netPlugin.Execute(cni.PluginApi(netPlugin)); err != nil {
@@ -5,9 +5,12 @@ package cni
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
@@ -24,7 +27,9 @@ import (
 // Plugin is the parent class for CNI plugins.
 type Plugin struct {
 	*common.Plugin
-	version string
+	version   string
+	stdinData []byte
+	stdinRead bool
 }
 
 // NewPlugin creates a new CNI plugin.
@@ -54,6 +59,99 @@ func (plugin *Plugin) Uninitialize() {
 	plugin.Plugin.Uninitialize()
 }
 
+// ReadNetworkConfig reads the network configuration passed on stdin ahead of the command, so that
+// it can configure the plugin before the command is executed. The configuration is kept for the
+// command. Returns nil for commands without a network configuration.
+func (plugin *Plugin) ReadNetworkConfig() (*NetworkConfig, error) {
+	if command := os.Getenv(Cmd); command == "" || command == CmdVersion {
+		return nil, nil
+	}
+
+	stdinData, err := plugin.readStdin()
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseNetworkConfig(stdinData)
+}
+
+// GetCmdArgs returns the arguments of the command passed in the environment and on stdin.
+func (plugin *Plugin) GetCmdArgs() (*cniSkel.CmdArgs, error) {
+	stdinData, err := plugin.readStdin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cniSkel.CmdArgs{
+		ContainerID: os.Getenv("CNI_CONTAINERID"),
+		Netns:       os.Getenv("CNI_NETNS"),
+		IfName:      os.Getenv("CNI_IFNAME"),
+		Args:        os.Getenv("CNI_ARGS"),
+		Path:        os.Getenv("CNI_PATH"),
+		StdinData:   stdinData,
+	}, nil
+}
+
+// readStdin reads stdin on first use and returns the data read.
+func (plugin *Plugin) readStdin() ([]byte, error) {
+	if !plugin.stdinRead {
+		stdinData, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading from stdin: %v", err)
+		}
+
+		plugin.stdinData = stdinData
+		plugin.stdinRead = true
+	}
+
+	return plugin.stdinData, nil
+}
+
+// SetLogFormat sets the log format selected by the environment, or else by the network configuration.
+func SetLogFormat(nwCfg *NetworkConfig) {
+	format := os.Getenv(LogFormatEnv)
+	if format == "" && nwCfg != nil {
+		format = nwCfg.LogFormat
+	}
+
+	if format == common.OptLogFormatJSON {
+		log.SetFormat(log.FormatJSON)
+	}
+}
+
+// SetDryRun makes the plugin and the plugins it delegates to print the changes they would make
+// instead of making them.
+func SetDryRun() {
+	os.Setenv(DryRunEnv, "true")
+}
+
+// IsDryRun returns whether the plugin prints the changes it would make instead of making them.
+func IsDryRun() bool {
+	return os.Getenv(DryRunEnv) != ""
+}
+
+// SetLogFields sets the fields of the structured log records of a command. The correlation ID is inherited
+// from the plugin delegating the command through the environment, or generated and passed on to delegated plugins.
+func SetLogFields(args *cniSkel.CmdArgs, command string) {
+	fields := log.Fields{
+		CorrelationID: os.Getenv(CorrelationIDEnv),
+		ContainerID:   args.ContainerID,
+		Command:       command,
+	}
+
+	if fields.CorrelationID == "" {
+		fields.CorrelationID = log.NewCorrelationID()
+		os.Setenv(CorrelationIDEnv, fields.CorrelationID)
+	}
+
+	if podCfg, err := ParseCniArgs(args.Args); err == nil {
+		fields.PodName = string(podCfg.K8S_POD_NAME)
+		fields.PodNamespace = string(podCfg.K8S_POD_NAMESPACE)
+	}
+
+	log.SetFields(fields)
+}
+
 // Execute executes the CNI command.
 func (plugin *Plugin) Execute(api PluginApi) (err error) {
 	// Recover from panics and convert them to CNI errors.
@@ -78,7 +176,7 @@ func (plugin *Plugin) Execute(api PluginApi) (err error) {
 	pluginInfo := cniVers.PluginSupports(supportedVersions...)
 
 	// Parse args and call the appropriate cmd handler.
-	cniErr := cniSkel.PluginMainWithError(api.Add, api.Get, api.Delete, pluginInfo, plugin.version)
+	cniErr := plugin.dispatch(api, pluginInfo)
 	if cniErr != nil {
 		cniErr.Print()
 		return cniErr
@@ -87,6 +185,152 @@ func (plugin *Plugin) Execute(api PluginApi) (err error) {
 	return nil
 }
 
+// dispatch calls the handler of the command. It follows the dispatcher of the CNI skel package,
+// which cannot be used since it reads stdin itself, while the plugin may have read it already.
+func (plugin *Plugin) dispatch(api PluginApi, pluginInfo cniVers.PluginInfo) *cniTypes.Error {
+	command := os.Getenv(Cmd)
+
+	switch command {
+	case "":
+		// Print the version when no command is set.
+		if plugin.version != "" {
+			fmt.Fprintln(os.Stderr, plugin.version)
+			return nil
+		}
+	case CmdVersion:
+		if err := pluginInfo.Encode(os.Stdout); err != nil {
+			return newError(err.Error())
+		}
+		return nil
+	}
+
+	var missing []string
+	for _, name := range append([]string{Cmd}, requiredEnv[command]...) {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return newError(fmt.Sprintf("required env variables [%s] missing", strings.Join(missing, ",")))
+	}
+
+	args, err := plugin.GetCmdArgs()
+	if err != nil {
+		return newError(err.Error())
+	}
+
+	if err = validateConfig(args.StdinData); err != nil {
+		return newError(err.Error())
+	}
+
+	switch command {
+	case CmdAdd:
+		err = checkVersionAndCall(args, pluginInfo, api.Add)
+	case CmdCheck:
+		err = checkVersionAndCheck(args, pluginInfo, api.Check)
+	case CmdDel:
+		err = checkVersionAndCall(args, pluginInfo, api.Delete)
+	default:
+		return newError(fmt.Sprintf("unknown CNI_COMMAND: %v", command))
+	}
+
+	if err != nil {
+		if cniErr, ok := err.(*cniTypes.Error); ok {
+			return cniErr
+		}
+		return newError(err.Error())
+	}
+
+	return nil
+}
+
+// Environment variables required by each command.
+var requiredEnv = map[string][]string{
+	CmdAdd:   {"CNI_CONTAINERID", "CNI_NETNS", "CNI_IFNAME", "CNI_PATH"},
+	CmdCheck: {"CNI_CONTAINERID", "CNI_NETNS", "CNI_IFNAME", "CNI_PATH"},
+	CmdDel:   {"CNI_CONTAINERID", "CNI_IFNAME", "CNI_PATH"},
+}
+
+// newError creates a CNI error with the given message.
+func newError(msg string) *cniTypes.Error {
+	return &cniTypes.Error{Code: ErrRuntime, Msg: msg}
+}
+
+// validateConfig checks that the network configuration names the network.
+func validateConfig(stdinData []byte) error {
+	var conf struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.Unmarshal(stdinData, &conf); err != nil {
+		return fmt.Errorf("error reading network config: %s", err)
+	}
+
+	if conf.Name == "" {
+		return fmt.Errorf("missing network name")
+	}
+
+	return nil
+}
+
+// checkVersionAndCall calls the handler if the plugin supports the version of the network configuration.
+func checkVersionAndCall(args *cniSkel.CmdArgs, pluginInfo cniVers.PluginInfo, handler func(*cniSkel.CmdArgs) error) error {
+	var decoder cniVers.ConfigDecoder
+	var reconciler cniVers.Reconciler
+
+	configVersion, err := decoder.Decode(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if verErr := reconciler.Check(configVersion, pluginInfo); verErr != nil {
+		return &cniTypes.Error{
+			Code:    cniTypes.ErrIncompatibleCNIVersion,
+			Msg:     "incompatible CNI versions",
+			Details: verErr.Details(),
+		}
+	}
+
+	return handler(args)
+}
+
+// checkVersionAndCheck calls the CHECK handler if the network configuration and the plugin both
+// support CHECK, which was introduced in version 0.4.0.
+func checkVersionAndCheck(args *cniSkel.CmdArgs, pluginInfo cniVers.PluginInfo, handler func(*cniSkel.CmdArgs) error) error {
+	var decoder cniVers.ConfigDecoder
+
+	configVersion, err := decoder.Decode(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	if gtet, err := cniVers.GreaterThanOrEqualTo(configVersion, "0.4.0"); err != nil {
+		return err
+	} else if !gtet {
+		return &cniTypes.Error{
+			Code: cniTypes.ErrIncompatibleCNIVersion,
+			Msg:  "config version does not allow CHECK",
+		}
+	}
+
+	for _, pluginVersion := range pluginInfo.SupportedVersions() {
+		if gtet, err := cniVers.GreaterThanOrEqualTo(pluginVersion, configVersion); err != nil {
+			return err
+		} else if gtet {
+			if err = checkVersionAndCall(args, pluginInfo, handler); err != nil {
+				return newError(err.Error())
+			}
+			return nil
+		}
+	}
+
+	return &cniTypes.Error{
+		Code: cniTypes.ErrIncompatibleCNIVersion,
+		Msg:  "plugin version does not allow CHECK",
+	}
+}
+
 // DelegateAdd calls the given plugin's ADD command and returns the result.
 func (plugin *Plugin) DelegateAdd(pluginName string, nwCfg *NetworkConfig) (*cniTypesCurr.Result, error) {
 	var result *cniTypesCurr.Result
@@ -152,12 +396,23 @@ func (plugin *Plugin) InitializeKeyValueStore(config *common.PluginConfig) error
 	// Create the key value store.
 	if plugin.Store == nil {
 		var err error
-		plugin.Store, err = store.NewJsonFileStore(platform.CNIRuntimePath + plugin.Name + ".json")
+
+		// The backend is set by the network configuration, or else through the environment.
+		if config.StoreBackend == "" {
+			config.StoreBackend = os.Getenv(StoreBackendEnv)
+		}
+
+		plugin.Store, err = common.NewStore(config.StoreBackend, platform.CNIRuntimePath+plugin.Name+".json")
 		if err != nil {
 			log.Printf("[cni] Failed to create store: %v.", err)
 			return err
 		}
 
+		// In dry-run mode, the state is read but not persisted.
+		if IsDryRun() {
+			plugin.Store = store.NewDryRunStore(plugin.Store)
+		}
+
 		// Force unlock the json store if the lock file is left on the node after reboot
 		if lockFileModTime, err := plugin.Store.GetLockFileModificationTime(); err == nil {
 			rebootTime, err := platform.GetLastRebootTime()
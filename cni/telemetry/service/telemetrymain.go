@@ -137,6 +137,20 @@ func main() {
 		time.Sleep(time.Millisecond * 200)
 	}
 
+	if !tb.FdExists && !config.Spool.Disabled {
+		if spool, err := telemetry.NewSpool(config.Spool); err != nil {
+			log.Logf("[Telemetry] Failed to open spool, reports are kept in memory only: %v", err)
+		} else {
+			tb.SetSpool(spool)
+		}
+	}
+
+	if len(config.Sinks) > 0 {
+		sinks := telemetry.NewSinks(config.Sinks)
+		log.Logf("[Telemetry] Sending reports to %d configured sinks", len(sinks))
+		tb.SetSinks(sinks)
+	}
+
 	if config.ReportToHostIntervalInSeconds == 0 {
 		config.ReportToHostIntervalInSeconds = reportToHostIntervalInSeconds
 	}
@@ -3,6 +3,10 @@
 
 package ipam
 
+import (
+	"github.com/Azure/azure-container-networking/ipam"
+)
+
 const (
 	// Libnetwork IPAM plugin endpoint type
 	EndpointType = "IpamDriver"
@@ -16,6 +20,11 @@ const (
 	RequestAddressPath   = "/IpamDriver.RequestAddress"
 	ReleaseAddressPath   = "/IpamDriver.ReleaseAddress"
 
+	// Azure IPAM plugin read-only inspection API paths
+	InspectAddressSpacesPath      = "/AzureIpam.InspectAddressSpaces"
+	InspectOrphanedAddressesPath  = "/AzureIpam.InspectOrphanedAddresses"
+	InspectReclaimedAddressesPath = "/AzureIpam.InspectReclaimedAddresses"
+
 	// Libnetwork IPAM plugin options
 	OptAddressType        = "RequestAddressType"
 	OptAddressTypeGateway = "com.docker.network.gateway"
@@ -108,3 +117,33 @@ type ReleaseAddressRequest struct {
 type ReleaseAddressResponse struct {
 	Err string
 }
+
+// Request sent when inspecting the state of all address spaces.
+type InspectAddressSpacesRequest struct {
+}
+
+// Response sent by plugin when returning the state of all address spaces, pools and addresses.
+type InspectAddressSpacesResponse struct {
+	Err           string
+	AddressSpaces []*ipam.AddressSpaceDetails
+}
+
+// Request sent when inspecting addresses held by IDs with no matching endpoint.
+type InspectOrphanedAddressesRequest struct {
+}
+
+// Response sent by plugin when returning addresses held by IDs with no matching endpoint.
+type InspectOrphanedAddressesResponse struct {
+	Err           string
+	AddressSpaces []*ipam.AddressSpaceDetails
+}
+
+// Request sent when inspecting addresses recently reclaimed from owners that no longer exist.
+type InspectReclaimedAddressesRequest struct {
+}
+
+// Response sent by plugin when returning addresses recently reclaimed from owners that no longer exist.
+type InspectReclaimedAddressesResponse struct {
+	Err       string
+	Addresses []*ipam.ReclaimedAddress
+}
@@ -81,6 +81,9 @@ func (plugin *ipamPlugin) Start(config *common.PluginConfig) error {
 	listener.AddHandler(GetPoolInfoPath, plugin.getPoolInfo)
 	listener.AddHandler(RequestAddressPath, plugin.requestAddress)
 	listener.AddHandler(ReleaseAddressPath, plugin.releaseAddress)
+	listener.AddHandler(InspectAddressSpacesPath, plugin.inspectAddressSpaces)
+	listener.AddHandler(InspectOrphanedAddressesPath, plugin.inspectOrphanedAddresses)
+	listener.AddHandler(InspectReclaimedAddressesPath, plugin.inspectReclaimedAddresses)
 
 	// Plugin is ready to be discovered.
 	err = plugin.EnableDiscovery()
@@ -311,3 +314,46 @@ func (plugin *ipamPlugin) releaseAddress(w http.ResponseWriter, r *http.Request)
 
 	log.Response(plugin.Name, &resp, returnCode, returnStr, err)
 }
+
+//
+// Azure IPAM plugin read-only inspection API
+//
+
+// Handles InspectAddressSpaces requests.
+func (plugin *ipamPlugin) inspectAddressSpaces(w http.ResponseWriter, r *http.Request) {
+	var req InspectAddressSpacesRequest
+
+	log.Request(plugin.Name, &req, nil)
+
+	resp := InspectAddressSpacesResponse{AddressSpaces: plugin.am.GetAddressSpaceDetails()}
+
+	err := plugin.Listener.Encode(w, &resp)
+
+	log.Response(plugin.Name, &resp, returnCode, returnStr, err)
+}
+
+// Handles InspectOrphanedAddresses requests.
+func (plugin *ipamPlugin) inspectOrphanedAddresses(w http.ResponseWriter, r *http.Request) {
+	var req InspectOrphanedAddressesRequest
+
+	log.Request(plugin.Name, &req, nil)
+
+	resp := InspectOrphanedAddressesResponse{AddressSpaces: plugin.am.GetOrphanedAddresses()}
+
+	err := plugin.Listener.Encode(w, &resp)
+
+	log.Response(plugin.Name, &resp, returnCode, returnStr, err)
+}
+
+// Handles InspectReclaimedAddresses requests.
+func (plugin *ipamPlugin) inspectReclaimedAddresses(w http.ResponseWriter, r *http.Request) {
+	var req InspectReclaimedAddressesRequest
+
+	log.Request(plugin.Name, &req, nil)
+
+	resp := InspectReclaimedAddressesResponse{Addresses: plugin.am.GetReclaimedAddresses()}
+
+	err := plugin.Listener.Encode(w, &resp)
+
+	log.Response(plugin.Name, &resp, returnCode, returnStr, err)
+}
@@ -234,6 +234,78 @@ func TestRequestAddress(t *testing.T) {
 	address1 = address.String()
 }
 
+// Tests AzureIpam.InspectAddressSpaces functionality.
+func TestInspectAddressSpaces(t *testing.T) {
+	var resp InspectAddressSpacesResponse
+
+	req, err := http.NewRequest(http.MethodGet, InspectAddressSpacesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	err = decodeResponse(w, &resp)
+
+	if err != nil || resp.Err != "" || len(resp.AddressSpaces) == 0 {
+		t.Fatalf("InspectAddressSpaces response is invalid %+v", resp)
+	}
+
+	var found bool
+	for _, as := range resp.AddressSpaces {
+		for _, ap := range as.Pools {
+			for _, ar := range ap.Addresses {
+				if ar.Address == address1 {
+					found = ar.InUse && !ar.Orphaned
+				}
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("InspectAddressSpaces response does not report address %v in use", address1)
+	}
+}
+
+// Tests AzureIpam.InspectOrphanedAddresses functionality.
+func TestInspectOrphanedAddresses(t *testing.T) {
+	var resp InspectOrphanedAddressesResponse
+
+	req, err := http.NewRequest(http.MethodGet, InspectOrphanedAddressesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	err = decodeResponse(w, &resp)
+
+	if err != nil || resp.Err != "" || len(resp.AddressSpaces) != 0 {
+		t.Errorf("InspectOrphanedAddresses response is invalid %+v", resp)
+	}
+}
+
+// Tests AzureIpam.InspectReclaimedAddresses functionality.
+func TestInspectReclaimedAddresses(t *testing.T) {
+	var resp InspectReclaimedAddressesResponse
+
+	req, err := http.NewRequest(http.MethodGet, InspectReclaimedAddressesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	err = decodeResponse(w, &resp)
+
+	if err != nil || resp.Err != "" || len(resp.Addresses) != 0 {
+		t.Errorf("InspectReclaimedAddresses response is invalid %+v", resp)
+	}
+}
+
 // Tests IpamDriver.ReleaseAddress functionality.
 func TestReleaseAddress(t *testing.T) {
 	var body bytes.Buffer
@@ -0,0 +1,235 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	cnmipam "github.com/Azure/azure-container-networking/cnm/ipam"
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/ipam"
+)
+
+const (
+	// Default URLs of the Azure CNM plugin.
+	defaultLinuxAPIServerURL   = "unix:///run/docker/plugins/azure-vnet.sock"
+	defaultWindowsAPIServerURL = "tcp://localhost:48080"
+
+	requestTimeout = 10 * time.Second
+
+	// Command line options.
+	optOrphaned       = "orphaned"
+	optOrphanedAlias  = "r"
+	optReclaimed      = "reclaimed"
+	optReclaimedAlias = "c"
+	optJson           = "json"
+	optJsonAlias      = "j"
+)
+
+// Version is populated by make during build.
+var version string
+
+// Command line arguments for the IPAM inspection tool.
+var args = common.ArgumentList{
+	{
+		Name:         common.OptAPIServerURL,
+		Shorthand:    common.OptAPIServerURLAlias,
+		Description:  "Set the CNM plugin API server URL",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         optOrphaned,
+		Shorthand:    optOrphanedAlias,
+		Description:  "List only addresses held by IDs with no matching endpoint",
+		Type:         "bool",
+		DefaultValue: false,
+	},
+	{
+		Name:         optReclaimed,
+		Shorthand:    optReclaimedAlias,
+		Description:  "List addresses recently reclaimed from containers that no longer exist",
+		Type:         "bool",
+		DefaultValue: false,
+	},
+	{
+		Name:         optJson,
+		Shorthand:    optJsonAlias,
+		Description:  "Print the raw JSON response",
+		Type:         "bool",
+		DefaultValue: false,
+	},
+	{
+		Name:         common.OptVersion,
+		Shorthand:    common.OptVersionAlias,
+		Description:  "Print version information",
+		Type:         "bool",
+		DefaultValue: false,
+	},
+}
+
+// Prints description and version information.
+func printVersion() {
+	fmt.Printf("Azure CNM IPAM inspection tool\n")
+	fmt.Printf("Version %v\n", version)
+}
+
+// Main is the entry point for the IPAM inspection tool.
+func main() {
+	common.ParseArgs(&args, printVersion)
+
+	apiServerURL := common.GetArg(common.OptAPIServerURL).(string)
+	orphaned := common.GetArg(optOrphaned).(bool)
+	reclaimed := common.GetArg(optReclaimed).(bool)
+	printJson := common.GetArg(optJson).(bool)
+	vers := common.GetArg(common.OptVersion).(bool)
+
+	if vers {
+		printVersion()
+		os.Exit(0)
+	}
+
+	if apiServerURL == "" {
+		if runtime.GOOS == "windows" {
+			apiServerURL = defaultWindowsAPIServerURL
+		} else {
+			apiServerURL = defaultLinuxAPIServerURL
+		}
+	}
+
+	if reclaimed {
+		inspectReclaimedAddresses(apiServerURL, printJson)
+		return
+	}
+
+	path := cnmipam.InspectAddressSpacesPath
+	if orphaned {
+		path = cnmipam.InspectOrphanedAddressesPath
+	}
+
+	var resp cnmipam.InspectAddressSpacesResponse
+	if err := query(apiServerURL, path, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to query IPAM plugin at %v: %v\n", apiServerURL, err)
+		os.Exit(1)
+	}
+
+	if resp.Err != "" {
+		fmt.Fprintf(os.Stderr, "IPAM plugin returned error: %v\n", resp.Err)
+		os.Exit(1)
+	}
+
+	if printJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(resp.AddressSpaces)
+		return
+	}
+
+	printAddressSpaces(resp.AddressSpaces)
+}
+
+// Queries and prints the addresses recently reclaimed by the plugin.
+func inspectReclaimedAddresses(apiServerURL string, printJson bool) {
+	var resp cnmipam.InspectReclaimedAddressesResponse
+	if err := query(apiServerURL, cnmipam.InspectReclaimedAddressesPath, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to query IPAM plugin at %v: %v\n", apiServerURL, err)
+		os.Exit(1)
+	}
+
+	if resp.Err != "" {
+		fmt.Fprintf(os.Stderr, "IPAM plugin returned error: %v\n", resp.Err)
+		os.Exit(1)
+	}
+
+	if printJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(resp.Addresses)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "TIME\tADDRESS SPACE\tPOOL\tADDRESS\tCONTAINER\tPOD\tREASON")
+
+	for _, r := range resp.Addresses {
+		pod := r.Owner.PodName
+		if r.Owner.PodNamespace != "" {
+			pod = r.Owner.PodNamespace + "/" + pod
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			r.Time.Format(time.RFC3339), r.AsId, r.PoolId, r.Address, r.Owner.ContainerID, pod, r.Reason)
+	}
+}
+
+// Sends a request to the plugin listening at the given URL and decodes the response.
+func query(apiServerURL string, path string, response interface{}) error {
+	u, err := url.Parse(apiServerURL)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: requestTimeout}
+	requestURL := "http://" + u.Host + path
+
+	switch u.Scheme {
+	case "tcp", "http":
+	case "unix":
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", u.Path)
+			},
+		}
+		requestURL = "http://unix" + path
+	default:
+		return fmt.Errorf("Unsupported URL scheme %v", u.Scheme)
+	}
+
+	res, err := client.Get(requestURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP error %v", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(response)
+}
+
+// Prints address spaces as a table with one row per address.
+func printAddressSpaces(addressSpaces []*ipam.AddressSpaceDetails) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "ADDRESS SPACE\tPOOL\tINTERFACE\tADDRESS\tIN USE\tID\tCONTAINER\tEPOCH\tORPHANED")
+
+	for _, as := range addressSpaces {
+		for _, ap := range as.Pools {
+			for _, ar := range ap.Addresses {
+				var containerID string
+				if ar.Owner != nil {
+					containerID = ar.Owner.ContainerID
+				}
+
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+					as.Id, ap.Id, ap.IfName, ar.Address, ar.InUse, ar.ID, containerID,
+					ar.Epoch, ar.Orphaned)
+			}
+		}
+	}
+}
@@ -4,8 +4,10 @@
 package network
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/Azure/azure-container-networking/cnm"
 	"github.com/Azure/azure-container-networking/common"
@@ -147,6 +149,14 @@ func (plugin *netPlugin) createNetwork(w http.ResponseWriter, r *http.Request) {
 	options := plugin.ParseOptions(req.Options)
 	if options != nil {
 		nwInfo.Mode, _ = options[modeOption].(string)
+
+		if mtu, ok := options[mtuOption].(string); ok {
+			nwInfo.MTU, err = strconv.Atoi(mtu)
+			if err != nil || nwInfo.MTU < 0 {
+				plugin.SendErrorResponse(w, fmt.Errorf("Invalid MTU %v", mtu))
+				return
+			}
+		}
 	}
 
 	// Populate subnets.
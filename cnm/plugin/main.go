@@ -14,7 +14,6 @@ import (
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
-	"github.com/Azure/azure-container-networking/store"
 )
 
 const (
@@ -36,6 +35,7 @@ var args = common.ArgumentList{
 		ValueMap: map[string]interface{}{
 			common.OptEnvironmentAzure: 0,
 			common.OptEnvironmentMAS:   0,
+			common.OptEnvironmentFile:  0,
 		},
 	},
 	{
@@ -89,6 +89,31 @@ var args = common.ArgumentList{
 		Type:         "int",
 		DefaultValue: "",
 	},
+	{
+		Name:         common.OptIpamConfigFile,
+		Shorthand:    common.OptIpamConfigFileAlias,
+		Description:  "Set the IPAM configuration file of the file environment",
+		Type:         "string",
+		DefaultValue: "",
+	},
+	{
+		Name:         common.OptIpamReuseCooldown,
+		Shorthand:    common.OptIpamReuseCooldownAlias,
+		Description:  "Set the number of seconds before a released address is reused",
+		Type:         "int",
+		DefaultValue: "",
+	},
+	{
+		Name:         common.OptStoreBackend,
+		Shorthand:    common.OptStoreBackendAlias,
+		Description:  "Set the persistent store backend",
+		Type:         "string",
+		DefaultValue: common.OptStoreBackendJson,
+		ValueMap: map[string]interface{}{
+			common.OptStoreBackendJson:    0,
+			common.OptStoreBackendJournal: 0,
+		},
+	},
 	{
 		Name:         common.OptVersion,
 		Shorthand:    common.OptVersionAlias,
@@ -115,6 +140,9 @@ func main() {
 	logTarget := common.GetArg(common.OptLogTarget).(int)
 	ipamQueryUrl, _ := common.GetArg(common.OptIpamQueryUrl).(string)
 	ipamQueryInterval, _ := common.GetArg(common.OptIpamQueryInterval).(int)
+	ipamConfigFile, _ := common.GetArg(common.OptIpamConfigFile).(string)
+	ipamReuseCooldown, _ := common.GetArg(common.OptIpamReuseCooldown).(int)
+	storeBackend := common.GetArg(common.OptStoreBackend).(string)
 	vers := common.GetArg(common.OptVersion).(bool)
 
 	if vers {
@@ -125,6 +153,7 @@ func main() {
 	// Initialize plugin common configuration.
 	var config common.PluginConfig
 	config.Version = version
+	config.StoreBackend = storeBackend
 
 	// Create a channel to receive unhandled errors from the plugins.
 	config.ErrChan = make(chan error, 1)
@@ -150,7 +179,7 @@ func main() {
 	}
 
 	// Create the key value store.
-	config.Store, err = store.NewJsonFileStore(platform.CNMRuntimePath + name + ".json")
+	config.Store, err = common.NewStore(config.StoreBackend, platform.CNMRuntimePath+name+".json")
 	if err != nil {
 		fmt.Printf("Failed to create store: %v\n", err)
 		return
@@ -176,6 +205,8 @@ func main() {
 	ipamPlugin.SetOption(common.OptAPIServerURL, url)
 	ipamPlugin.SetOption(common.OptIpamQueryUrl, ipamQueryUrl)
 	ipamPlugin.SetOption(common.OptIpamQueryInterval, ipamQueryInterval)
+	ipamPlugin.SetOption(common.OptIpamConfigFile, ipamConfigFile)
+	ipamPlugin.SetOption(common.OptIpamReuseCooldown, ipamReuseCooldown)
 
 	// Start plugins.
 	if netPlugin != nil {
@@ -201,7 +232,7 @@ func main() {
 	// Wait until receiving a signal.
 	select {
 	case sig := <-osSignalChannel:
-		log.Printf("Received OS signal <" + sig.String() + ">, shutting down.")
+		log.Printf("Received OS signal <%v>, shutting down.", sig)
 	case err := <-config.ErrChan:
 		log.Printf("Received unhandled plugin error %v, shutting down.", err)
 	}
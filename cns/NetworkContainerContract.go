@@ -1,6 +1,9 @@
 package cns
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Container Network Service DNC Contract
 const (
@@ -29,6 +32,15 @@ const (
 	COW                    = "COW" // Container on Windows
 )
 
+// NetworkContainer States
+const (
+	NetworkContainerStatePending     = "Pending"     // Goal state saved, not yet checked with the host.
+	NetworkContainerStateProgramming = "Programming" // Host has not programmed the requested version yet.
+	NetworkContainerStateReady       = "Ready"       // Host programmed the requested version.
+	NetworkContainerStateFailed      = "Failed"      // Host could not be queried, still retrying.
+	NetworkContainerStateDeleting    = "Deleting"    // Network container is being deleted.
+)
+
 // Orchestrator Types
 const (
 	Kubernetes      = "Kubernetes"
@@ -120,6 +132,9 @@ type GetNetworkContainerStatusResponse struct {
 	NetworkContainerid string
 	Version            string
 	AzureHostVersion   string
+	State              string
+	LastError          string `json:",omitempty"`
+	LastChecked        time.Time
 	Response           Response
 }
 
@@ -18,9 +18,13 @@ const (
 	GetIPAddressUtilizationPath = "/network/ip/utilization"
 	GetUnhealthyIPAddressesPath = "/network/ipaddresses/unhealthy"
 	GetHealthReportPath         = "/network/health"
+	MetricsPath                 = "/metrics"
 	NumberOfCPUCoresPath        = "/hostcpucores"
 	V1Prefix                    = "/v0.1"
 	V2Prefix                    = "/v0.2"
+
+	// CorrelationIDHeader carries the ID correlating the log records of a request across components.
+	CorrelationIDHeader = "X-Ms-Correlation-Request-Id"
 )
 
 // SetEnvironmentRequest describes the Request to set the environment in CNS.
@@ -146,6 +150,22 @@ type NumOfCPUCoresResponse struct {
 	NumOfCPUCores int
 }
 
+// ComponentHealth describes the health of a component CNS depends on.
+type ComponentHealth struct {
+	Healthy bool
+	Message string `json:",omitempty"`
+}
+
+// HealthReportResponse describes the health of CNS and of the components it depends on.
+type HealthReportResponse struct {
+	Response               Response
+	Healthy                bool
+	Store                  ComponentHealth
+	Imds                   ComponentHealth
+	Docker                 ComponentHealth
+	NetworkContainerCounts map[string]int
+}
+
 // OptionMap describes generic options that can be passed to CNS.
 type OptionMap map[string]interface{}
 
@@ -2,78 +2,386 @@ package cnsclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/log"
 )
 
-// CNSClient specifies a client to connect to Ipam Plugin.
+// CNSClient specifies a client to connect to CNS.
 type CNSClient struct {
 	connectionURL string
+	apiPrefix     string
+	httpClient    *http.Client
+	maxRetries    int
+	retryDelay    time.Duration
 }
 
 const (
-	defaultCnsURL = "http://localhost:10090"
+	defaultCnsURL     = "http://localhost:10090"
+	defaultMaxRetries = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	contentTypeJSON   = "application/json"
+
+	// unixSocketHost is the host of requests sent over a unix socket. It is not resolved.
+	unixSocketHost = "http://unix"
 )
 
-// NewCnsClient create a new cns client.
-func NewCnsClient(url string) (*CNSClient, error) {
-	if url == "" {
-		url = defaultCnsURL
+// NewCnsClient create a new cns client. The url is either an http(s) or tcp URL,
+// or a unix URL holding the path of the CNS socket.
+func NewCnsClient(connectionURL string) (*CNSClient, error) {
+	if connectionURL == "" {
+		connectionURL = defaultCnsURL
+	}
+
+	u, err := url.Parse(connectionURL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &CNSClient{
+		connectionURL: connectionURL,
+		httpClient:    &http.Client{},
+		maxRetries:    defaultMaxRetries,
+		retryDelay:    defaultRetryDelay,
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	case "tcp":
+		client.connectionURL = "http://" + u.Host
+	case "unix":
+		socketPath := u.Path
+		client.connectionURL = unixSocketHost
+		client.httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}
+	default:
+		return nil, fmt.Errorf("[Azure CNSClient] Unsupported URL scheme %v", u.Scheme)
 	}
 
-	return &CNSClient{
-		connectionURL: url,
-	}, nil
+	return client, nil
+}
+
+// SetAPIVersion selects the API version of requests, either cns.V1Prefix or cns.V2Prefix.
+// Version 0.1 of the API is served without a prefix.
+func (cnsClient *CNSClient) SetAPIVersion(prefix string) error {
+	switch prefix {
+	case "", cns.V1Prefix:
+		cnsClient.apiPrefix = ""
+	case cns.V2Prefix:
+		cnsClient.apiPrefix = cns.V2Prefix
+	default:
+		return fmt.Errorf("[Azure CNSClient] Unsupported API version %v", prefix)
+	}
+
+	return nil
+}
+
+// SetRetries sets the number of times requests failing with a transport error are retried, and the delay between attempts.
+// Only GET requests are retried after any transport error, other requests only when they could not be sent.
+func (cnsClient *CNSClient) SetRetries(maxRetries int, retryDelay time.Duration) {
+	cnsClient.maxRetries = maxRetries
+	cnsClient.retryDelay = retryDelay
 }
 
 // GetNetworkConfiguration Request to get network config.
 func (cnsClient *CNSClient) GetNetworkConfiguration(orchestratorContext []byte) (*cns.GetNetworkContainerResponse, error) {
-	var body bytes.Buffer
+	req := &cns.GetNetworkContainerRequest{
+		OrchestratorContext: orchestratorContext,
+	}
 
-	httpc := &http.Client{}
-	url := cnsClient.connectionURL + cns.GetNetworkContainerByOrchestratorContext
-	log.Printf("GetNetworkConfiguration url %v", url)
+	return cnsClient.GetNetworkContainerByOrchestratorContext(context.Background(), req)
+}
 
-	payload := &cns.GetNetworkContainerRequest{
-		OrchestratorContext: orchestratorContext,
+// SetEnvironment sets the environment CNS runs in.
+func (cnsClient *CNSClient) SetEnvironment(ctx context.Context, req *cns.SetEnvironmentRequest) error {
+	return cnsClient.post(ctx, cns.SetEnvironmentPath, req, &cns.Response{})
+}
+
+// CreateNetwork creates a network.
+func (cnsClient *CNSClient) CreateNetwork(ctx context.Context, req *cns.CreateNetworkRequest) error {
+	return cnsClient.post(ctx, cns.CreateNetworkPath, req, &cns.Response{})
+}
+
+// DeleteNetwork deletes a network.
+func (cnsClient *CNSClient) DeleteNetwork(ctx context.Context, req *cns.DeleteNetworkRequest) error {
+	return cnsClient.post(ctx, cns.DeleteNetworkPath, req, &cns.Response{})
+}
+
+// CreateHnsNetwork creates an HNS network.
+func (cnsClient *CNSClient) CreateHnsNetwork(ctx context.Context, req *cns.CreateHnsNetworkRequest) error {
+	return cnsClient.post(ctx, cns.CreateHnsNetworkPath, req, &cns.Response{})
+}
+
+// DeleteHnsNetwork deletes an HNS network.
+func (cnsClient *CNSClient) DeleteHnsNetwork(ctx context.Context, req *cns.DeleteHnsNetworkRequest) error {
+	return cnsClient.post(ctx, cns.DeleteHnsNetworkPath, req, &cns.Response{})
+}
+
+// ReserveIPAddress reserves an IP address.
+func (cnsClient *CNSClient) ReserveIPAddress(ctx context.Context, req *cns.ReserveIPAddressRequest) (*cns.ReserveIPAddressResponse, error) {
+	var resp cns.ReserveIPAddressResponse
+	if err := cnsClient.post(ctx, cns.ReserveIPAddressPath, req, &resp); err != nil {
+		return nil, err
 	}
 
-	err := json.NewEncoder(&body).Encode(payload)
-	if err != nil {
-		log.Errorf("encoding json failed with %v", err)
+	return &resp, nil
+}
+
+// ReleaseIPAddress releases an IP address.
+func (cnsClient *CNSClient) ReleaseIPAddress(ctx context.Context, req *cns.ReleaseIPAddressRequest) error {
+	return cnsClient.post(ctx, cns.ReleaseIPAddressPath, req, &cns.Response{})
+}
+
+// GetHostLocalIP returns the host local IP address.
+func (cnsClient *CNSClient) GetHostLocalIP(ctx context.Context) (*cns.HostLocalIPAddressResponse, error) {
+	var resp cns.HostLocalIPAddressResponse
+	if err := cnsClient.get(ctx, cns.GetHostLocalIPPath, &resp); err != nil {
 		return nil, err
 	}
 
-	res, err := httpc.Post(url, "application/json", &body)
-	if err != nil {
-		log.Errorf("[Azure CNSClient] HTTP Post returned error %v", err.Error())
+	return &resp, nil
+}
+
+// GetIPAddressUtilization returns the utilization of IP addresses.
+func (cnsClient *CNSClient) GetIPAddressUtilization(ctx context.Context) (*cns.IPAddressesUtilizationResponse, error) {
+	var resp cns.IPAddressesUtilizationResponse
+	if err := cnsClient.get(ctx, cns.GetIPAddressUtilizationPath, &resp); err != nil {
 		return nil, err
 	}
 
-	defer res.Body.Close()
+	return &resp, nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		errMsg := fmt.Sprintf("[Azure CNSClient] GetNetworkConfiguration invalid http status code: %v", res.StatusCode)
-		log.Errorf(errMsg)
-		return nil, fmt.Errorf(errMsg)
+// GetUnhealthyIPAddresses returns the unhealthy IP addresses.
+func (cnsClient *CNSClient) GetUnhealthyIPAddresses(ctx context.Context) (*cns.GetIPAddressesResponse, error) {
+	var resp cns.GetIPAddressesResponse
+	if err := cnsClient.get(ctx, cns.GetUnhealthyIPAddressesPath, &resp); err != nil {
+		return nil, err
 	}
 
+	return &resp, nil
+}
+
+// CreateOrUpdateNetworkContainer creates or updates a network container.
+func (cnsClient *CNSClient) CreateOrUpdateNetworkContainer(ctx context.Context, req *cns.CreateNetworkContainerRequest) (*cns.CreateNetworkContainerResponse, error) {
+	var resp cns.CreateNetworkContainerResponse
+	if err := cnsClient.post(ctx, cns.CreateOrUpdateNetworkContainer, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// DeleteNetworkContainer deletes a network container.
+func (cnsClient *CNSClient) DeleteNetworkContainer(ctx context.Context, req *cns.DeleteNetworkContainerRequest) (*cns.DeleteNetworkContainerResponse, error) {
+	var resp cns.DeleteNetworkContainerResponse
+	if err := cnsClient.post(ctx, cns.DeleteNetworkContainer, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetNetworkContainerStatus returns the status of a network container.
+func (cnsClient *CNSClient) GetNetworkContainerStatus(ctx context.Context, req *cns.GetNetworkContainerStatusRequest) (*cns.GetNetworkContainerStatusResponse, error) {
+	var resp cns.GetNetworkContainerStatusResponse
+	if err := cnsClient.post(ctx, cns.GetNetworkContainerStatus, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetInterfaceForContainer returns the interface of a network container.
+func (cnsClient *CNSClient) GetInterfaceForContainer(ctx context.Context, req *cns.GetInterfaceForContainerRequest) (*cns.GetInterfaceForContainerResponse, error) {
+	var resp cns.GetInterfaceForContainerResponse
+	if err := cnsClient.post(ctx, cns.GetInterfaceForContainer, req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// SetOrchestratorType sets the orchestrator type of the node.
+func (cnsClient *CNSClient) SetOrchestratorType(ctx context.Context, req *cns.SetOrchestratorTypeRequest) error {
+	return cnsClient.post(ctx, cns.SetOrchestratorType, req, &cns.Response{})
+}
+
+// GetNetworkContainerByOrchestratorContext returns the network container of an orchestrator context.
+func (cnsClient *CNSClient) GetNetworkContainerByOrchestratorContext(ctx context.Context, req *cns.GetNetworkContainerRequest) (*cns.GetNetworkContainerResponse, error) {
 	var resp cns.GetNetworkContainerResponse
+	if err := cnsClient.post(ctx, cns.GetNetworkContainerByOrchestratorContext, req, &resp); err != nil {
+		return nil, err
+	}
 
-	err = json.NewDecoder(res.Body).Decode(&resp)
-	if err != nil {
-		log.Errorf("[Azure CNSClient] Error received while parsing GetNetworkConfiguration response resp:%v err:%v", res.Body, err.Error())
+	return &resp, nil
+}
+
+// AttachContainerToNetwork attaches a container to the network of a network container.
+func (cnsClient *CNSClient) AttachContainerToNetwork(ctx context.Context, req *cns.ConfigureContainerNetworkingRequest) (*cns.AttachContainerToNetworkResponse, error) {
+	var resp cns.AttachContainerToNetworkResponse
+	if err := cnsClient.post(ctx, cns.AttachContainerToNetwork, req, &resp); err != nil {
 		return nil, err
 	}
 
-	if resp.Response.ReturnCode != 0 {
-		log.Errorf("[Azure CNSClient] GetNetworkConfiguration received error response :%v", resp.Response.Message)
-		return nil, fmt.Errorf(resp.Response.Message)
+	return &resp, nil
+}
+
+// DetachContainerFromNetwork detaches a container from the network of a network container.
+func (cnsClient *CNSClient) DetachContainerFromNetwork(ctx context.Context, req *cns.ConfigureContainerNetworkingRequest) (*cns.DetachContainerFromNetworkResponse, error) {
+	var resp cns.DetachContainerFromNetworkResponse
+	if err := cnsClient.post(ctx, cns.DetachContainerFromNetwork, req, &resp); err != nil {
+		return nil, err
 	}
 
 	return &resp, nil
 }
+
+// GetNumberOfCPUCores returns the number of CPU cores of the host.
+func (cnsClient *CNSClient) GetNumberOfCPUCores(ctx context.Context) (*cns.NumOfCPUCoresResponse, error) {
+	var resp cns.NumOfCPUCoresResponse
+	if err := cnsClient.get(ctx, cns.NumberOfCPUCoresPath, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetHealthReport returns the health of CNS and its dependencies.
+func (cnsClient *CNSClient) GetHealthReport(ctx context.Context) (*cns.HealthReportResponse, error) {
+	var resp cns.HealthReportResponse
+	if err := cnsClient.get(ctx, cns.GetHealthReportPath, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetMetrics returns the CNS metrics in the Prometheus text exposition format.
+// Metrics are served without an API version prefix.
+func (cnsClient *CNSClient) GetMetrics(ctx context.Context) ([]byte, error) {
+	return cnsClient.do(ctx, http.MethodGet, cnsClient.connectionURL+cns.MetricsPath, nil)
+}
+
+// get sends a GET request to the given API path and decodes the response.
+func (cnsClient *CNSClient) get(ctx context.Context, path string, resp interface{}) error {
+	return cnsClient.call(ctx, http.MethodGet, path, nil, resp)
+}
+
+// post sends a POST request with the given payload to the given API path and decodes the response.
+func (cnsClient *CNSClient) post(ctx context.Context, path string, req interface{}, resp interface{}) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		log.Errorf("[Azure CNSClient] Encoding request for %v failed with %v", path, err)
+		return err
+	}
+
+	return cnsClient.call(ctx, http.MethodPost, path, payload, resp)
+}
+
+// call sends a request to the given API path, decodes the response and maps its return code to an error.
+func (cnsClient *CNSClient) call(ctx context.Context, method string, path string, payload []byte, resp interface{}) error {
+	requestURL := cnsClient.connectionURL + cnsClient.apiPrefix + path
+	log.Printf("[Azure CNSClient] %v %v", method, requestURL)
+
+	body, err := cnsClient.do(ctx, method, requestURL, payload)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(body, resp); err != nil {
+		log.Errorf("[Azure CNSClient] Error received while parsing %v response resp:%s err:%v", path, body, err)
+		return err
+	}
+
+	if err = getResponseError(body); err != nil {
+		log.Errorf("[Azure CNSClient] %v received error response: %v", path, err)
+		return err
+	}
+
+	return nil
+}
+
+// getCorrelationID returns the correlation ID of the operation a request is sent for.
+// Requests sent without one in their context belong to the operation of the calling process, such as a CNI command.
+func getCorrelationID(ctx context.Context) string {
+	if fields := log.FieldsFromContext(ctx); fields.CorrelationID != "" {
+		return fields.CorrelationID
+	}
+
+	return log.GetFields().CorrelationID
+}
+
+// do sends a request and returns the response body. Requests failing with a transport error are retried
+// if they are idempotent or were never sent, so that a request CNS may have processed is not repeated.
+func (cnsClient *CNSClient) do(ctx context.Context, method string, requestURL string, payload []byte) ([]byte, error) {
+	var res *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, requestURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if payload != nil {
+			req.Header.Set("Content-Type", contentTypeJSON)
+		}
+		if correlationID := getCorrelationID(ctx); correlationID != "" {
+			req.Header.Set(cns.CorrelationIDHeader, correlationID)
+		}
+
+		res, err = cnsClient.httpClient.Do(req)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil || attempt >= cnsClient.maxRetries || (method != http.MethodGet && !isDialError(err)) {
+			log.Errorf("[Azure CNSClient] HTTP %v returned error %v", method, err.Error())
+			return nil, err
+		}
+
+		log.Printf("[Azure CNSClient] HTTP %v returned error %v, retrying.", method, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(cnsClient.retryDelay):
+		}
+	}
+
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		errMsg := fmt.Sprintf("%v %v invalid http status code: %v", method, requestURL, res.StatusCode)
+		log.Errorf("[Azure CNSClient] %v", errMsg)
+		return nil, &HTTPError{StatusCode: res.StatusCode, Message: errMsg}
+	}
+
+	return body, nil
+}
+
+// isDialError returns whether a request failed to connect to CNS, in which case it was never sent.
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
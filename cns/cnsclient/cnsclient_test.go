@@ -0,0 +1,244 @@
+package cnsclient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *CNSClient) {
+	server := httptest.NewServer(handler)
+
+	client, err := NewCnsClient(server.URL)
+	if err != nil {
+		t.Fatalf("NewCnsClient failed with %v", err)
+	}
+
+	return server, client
+}
+
+func TestAPIVersion(t *testing.T) {
+	var path string
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewEncoder(w).Encode(&cns.NumOfCPUCoresResponse{NumOfCPUCores: 4})
+	})
+	defer server.Close()
+
+	tests := []struct {
+		prefix string
+		path   string
+	}{
+		{"", cns.NumberOfCPUCoresPath},
+		{cns.V1Prefix, cns.NumberOfCPUCoresPath},
+		{cns.V2Prefix, cns.V2Prefix + cns.NumberOfCPUCoresPath},
+	}
+
+	for _, test := range tests {
+		if err := client.SetAPIVersion(test.prefix); err != nil {
+			t.Fatalf("SetAPIVersion(%q) failed with %v", test.prefix, err)
+		}
+
+		resp, err := client.GetNumberOfCPUCores(context.Background())
+		if err != nil {
+			t.Fatalf("GetNumberOfCPUCores failed with %v", err)
+		}
+
+		if resp.NumOfCPUCores != 4 || path != test.path {
+			t.Errorf("Unexpected response %+v from path %v, expected path %v", resp, path, test.path)
+		}
+	}
+
+	if err := client.SetAPIVersion("/v9"); err == nil {
+		t.Errorf("SetAPIVersion succeeded for an unsupported version")
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case cns.GetNetworkContainerStatus:
+			json.NewEncoder(w).Encode(&cns.GetNetworkContainerStatusResponse{
+				Response: cns.Response{ReturnCode: cns.UnknownContainerID, Message: "unknown"},
+			})
+		case cns.SetOrchestratorType:
+			json.NewEncoder(w).Encode(&cns.Response{ReturnCode: cns.InvalidParameter, Message: "invalid"})
+		default:
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	})
+	defer server.Close()
+
+	_, err := client.GetNetworkContainerStatus(context.Background(), &cns.GetNetworkContainerStatusRequest{})
+	if !IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	err = client.SetOrchestratorType(context.Background(), &cns.SetOrchestratorTypeRequest{})
+	if returnCode, ok := GetReturnCode(err); !ok || returnCode != cns.InvalidParameter || !IsInvalidParameter(err) {
+		t.Errorf("Expected an invalid parameter error, got %v", err)
+	}
+
+	err = client.CreateNetwork(context.Background(), &cns.CreateNetworkRequest{})
+	if httpErr, ok := err.(*HTTPError); !ok || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an HTTP error, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed with %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client, err := NewCnsClient("tcp://" + addr)
+	if err != nil {
+		t.Fatalf("NewCnsClient failed with %v", err)
+	}
+	client.SetRetries(0, 0)
+
+	if _, err = client.GetHostLocalIP(context.Background()); err == nil {
+		t.Fatalf("GetHostLocalIP succeeded without a server")
+	}
+
+	// Requests fail with a transport error until the server listens.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&cns.HostLocalIPAddressResponse{IPAddress: "10.0.0.4"})
+	}))
+
+	started := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		listener, err := net.Listen("tcp", addr)
+		if err == nil {
+			server.Listener = listener
+			server.Start()
+		}
+		started <- err
+	}()
+
+	client.SetRetries(100, 10*time.Millisecond)
+	resp, err := client.GetHostLocalIP(context.Background())
+	if startErr := <-started; startErr != nil {
+		t.Fatalf("Listen failed with %v", startErr)
+	}
+	defer server.Close()
+
+	if err != nil || resp.IPAddress != "10.0.0.4" {
+		t.Errorf("GetHostLocalIP failed with %v, response %+v", err, resp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = client.GetHostLocalIP(ctx); err == nil {
+		t.Errorf("GetHostLocalIP succeeded with a cancelled context")
+	}
+}
+
+func TestRetryAfterSend(t *testing.T) {
+	// The server receives requests but drops the connection before responding.
+	var requests int32
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	})
+	defer server.Close()
+	client.SetRetries(2, 0)
+
+	// Requests that CNS may have processed are not repeated.
+	if err := client.CreateNetwork(context.Background(), &cns.CreateNetworkRequest{}); err == nil {
+		t.Fatalf("CreateNetwork succeeded with a dropped connection")
+	}
+
+	if count := atomic.LoadInt32(&requests); count != 1 {
+		t.Errorf("CreateNetwork was sent %d times, expected once", count)
+	}
+
+	// Idempotent requests are retried.
+	atomic.StoreInt32(&requests, 0)
+	if _, err := client.GetHostLocalIP(context.Background()); err == nil {
+		t.Fatalf("GetHostLocalIP succeeded with a dropped connection")
+	}
+
+	if count := atomic.LoadInt32(&requests); count != 3 {
+		t.Errorf("GetHostLocalIP was sent %d times, expected 3 times", count)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnsclient")
+	if err != nil {
+		t.Fatalf("TempDir failed with %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "cns.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Listen failed with %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req cns.GetNetworkContainerRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(&cns.GetNetworkContainerResponse{
+			PrimaryInterfaceIdentifier: string(req.OrchestratorContext),
+		})
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client, err := NewCnsClient("unix://" + socketPath)
+	if err != nil {
+		t.Fatalf("NewCnsClient failed with %v", err)
+	}
+
+	resp, err := client.GetNetworkConfiguration([]byte(`"pod"`))
+	if err != nil {
+		t.Fatalf("GetNetworkConfiguration failed with %v", err)
+	}
+
+	if resp.PrimaryInterfaceIdentifier != `"pod"` {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	var correlationID string
+	server, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		correlationID = r.Header.Get(cns.CorrelationIDHeader)
+		json.NewEncoder(w).Encode(&cns.NumOfCPUCoresResponse{NumOfCPUCores: 4})
+	})
+	defer server.Close()
+
+	// Requests carry the correlation ID of their context.
+	ctx := log.NewContext(context.Background(), log.Fields{CorrelationID: "ctx-id"})
+	if _, err := client.GetNumberOfCPUCores(ctx); err != nil || correlationID != "ctx-id" {
+		t.Errorf("Expected correlation ID ctx-id, got %q, err:%v", correlationID, err)
+	}
+
+	// Requests without one carry the correlation ID of the process.
+	log.SetFields(log.Fields{CorrelationID: "process-id"})
+	defer log.SetFields(log.Fields{})
+
+	if _, err := client.GetNumberOfCPUCores(context.Background()); err != nil || correlationID != "process-id" {
+		t.Errorf("Expected correlation ID process-id, got %q, err:%v", correlationID, err)
+	}
+}
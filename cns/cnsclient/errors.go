@@ -0,0 +1,81 @@
+package cnsclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Azure/azure-container-networking/cns"
+)
+
+// HTTPError is returned when CNS responds with an HTTP status other than OK.
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *HTTPError) Error() string {
+	return err.Message
+}
+
+// ResponseError is returned when CNS responds with a return code other than cns.Success.
+type ResponseError struct {
+	ReturnCode int
+	Message    string
+}
+
+func (err *ResponseError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", cns.ReturnCodeToString(err.ReturnCode), err.ReturnCode, err.Message)
+}
+
+// GetReturnCode returns the CNS return code of an error returned by the client.
+func GetReturnCode(err error) (int, bool) {
+	if responseErr, ok := err.(*ResponseError); ok {
+		return responseErr.ReturnCode, true
+	}
+
+	return 0, false
+}
+
+// IsNotFound returns whether an error reports a missing network container or resource.
+func IsNotFound(err error) bool {
+	returnCode, ok := GetReturnCode(err)
+	return ok && (returnCode == cns.NotFound || returnCode == cns.UnknownContainerID)
+}
+
+// IsInvalidParameter returns whether an error reports an invalid request.
+func IsInvalidParameter(err error) bool {
+	returnCode, ok := GetReturnCode(err)
+	return ok && returnCode == cns.InvalidParameter
+}
+
+// IsUnsupportedVerb returns whether an error reports an HTTP method not supported by the handler.
+func IsUnsupportedVerb(err error) bool {
+	returnCode, ok := GetReturnCode(err)
+	return ok && returnCode == cns.UnsupportedVerb
+}
+
+// getResponseError returns the error matching the return code of a response body. Responses either
+// embed a cns.Response or are one.
+func getResponseError(body []byte) error {
+	var resp struct {
+		Response *cns.Response
+	}
+
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+
+	response := resp.Response
+	if response == nil {
+		response = &cns.Response{}
+		if err := json.Unmarshal(body, response); err != nil {
+			return err
+		}
+	}
+
+	if response.ReturnCode != cns.Success {
+		return &ResponseError{ReturnCode: response.ReturnCode, Message: response.Message}
+	}
+
+	return nil
+}
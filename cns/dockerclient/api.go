@@ -3,9 +3,15 @@
 
 package dockerclient
 
+import (
+	"time"
+)
+
 const (
 	createNetworkPath  = "/networks/create"
 	inspectNetworkPath = "/networks/"
+	pingPath           = "/_ping"
+	pingTimeout        = 5 * time.Second
 
 	OptDisableSnat = "DisableSNAT"
 )
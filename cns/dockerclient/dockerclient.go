@@ -72,6 +72,23 @@ func (dockerClient *DockerClient) NetworkExists(networkName string) error {
 	return fmt.Errorf("Unknown return code from docker inspect %d", res.StatusCode)
 }
 
+// Ping checks that the docker daemon can be reached.
+func (dockerClient *DockerClient) Ping() error {
+	client := &http.Client{Timeout: pingTimeout}
+	res, err := client.Get(dockerClient.connectionURL + pingPath)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unknown return code from docker ping %d", res.StatusCode)
+	}
+
+	return nil
+}
+
 // CreateNetwork creates a network using docker network create.
 func (dockerClient *DockerClient) CreateNetwork(networkName string, nicInfo *imdsclient.InterfaceInfo, options map[string]interface{}) error {
 	log.Printf("[Azure CNS] CreateNetwork")
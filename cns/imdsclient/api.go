@@ -5,11 +5,14 @@ package imdsclient
 
 import (
 	"encoding/xml"
+	"time"
 )
 
 const (
 	hostQueryURL                     = "http://168.63.129.16/machine/plugins?comp=nmagent&type=getinterfaceinfov1"
 	hostQueryURLForProgrammedVersion = "http://168.63.129.16/machine/plugins/?comp=nmagent&type=NetworkManagement/interfaces/%s/networkContainers/%s/authenticationToken/%s/api-version/%s"
+	pingTimeout                      = 5 * time.Second
+	hostQueryTimeout                 = 30 * time.Second
 )
 
 // ImdsClient can be used to connect to VM Host agent in Azure.
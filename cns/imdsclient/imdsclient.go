@@ -20,7 +20,9 @@ func (imdsClient *ImdsClient) GetNetworkContainerInfoFromHost(networkContainerID
 		primaryAddress, networkContainerID, authToken, apiVersion)
 
 	log.Printf("[Azure CNS] Going to query Azure Host for container version @\n %v\n", queryURL)
-	jsonResponse, err := http.Get(queryURL)
+	// Bound the query, as network containers are reconciled by polling the host.
+	client := &http.Client{Timeout: hostQueryTimeout}
+	jsonResponse, err := client.Get(queryURL)
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +114,23 @@ func (imdsClient *ImdsClient) GetPrimaryInterfaceInfoFromHost() (*InterfaceInfo,
 	return interfaceInfo, er
 }
 
+// Ping checks that the host agent can be reached.
+func (imdsClient *ImdsClient) Ping() error {
+	client := &http.Client{Timeout: pingTimeout}
+	resp, err := client.Get(hostQueryURL)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected status code from host agent %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
 // GetPrimaryInterfaceInfoFromMemory retrieves subnet and gateway of primary NIC that is saved in memory.
 func (imdsClient *ImdsClient) GetPrimaryInterfaceInfoFromMemory() (*InterfaceInfo, error) {
 	log.Printf("[Azure CNS] GetPrimaryInterfaceInfoFromMemory")
@@ -0,0 +1,95 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+)
+
+const (
+	// Interval at which the components CNS depends on are checked.
+	healthCheckInterval = 30 * time.Second
+)
+
+// componentPinger checks that a component CNS depends on is reachable.
+type componentPinger interface {
+	Ping() error
+}
+
+// healthChecker pings the components CNS depends on in the background, so that health
+// report requests are served from the results of the last check.
+type healthChecker struct {
+	imds         componentPinger
+	docker       componentPinger
+	lock         sync.Mutex
+	imdsHealth   cns.ComponentHealth
+	dockerHealth cns.ComponentHealth
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// newHealthChecker creates a health checker for the given components.
+func newHealthChecker(imds componentPinger, docker componentPinger) *healthChecker {
+	pending := cns.ComponentHealth{Healthy: false, Message: "health check pending"}
+
+	return &healthChecker{
+		imds:         imds,
+		docker:       docker,
+		imdsHealth:   pending,
+		dockerHealth: pending,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// start starts checking in the background.
+func (c *healthChecker) start() {
+	go c.run()
+}
+
+// close stops checking and waits for the pending check to complete.
+func (c *healthChecker) close() {
+	close(c.stop)
+	<-c.done
+}
+
+// Checks components immediately and then periodically until stopped.
+func (c *healthChecker) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		c.check()
+
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check pings the components and records the results.
+func (c *healthChecker) check() {
+	imdsHealth := getComponentHealth(c.imds.Ping())
+	dockerHealth := getComponentHealth(c.docker.Ping())
+
+	c.lock.Lock()
+	c.imdsHealth = imdsHealth
+	c.dockerHealth = dockerHealth
+	c.lock.Unlock()
+}
+
+// getHealth returns the results of the last check.
+func (c *healthChecker) getHealth() (imdsHealth cns.ComponentHealth, dockerHealth cns.ComponentHealth) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.imdsHealth, c.dockerHealth
+}
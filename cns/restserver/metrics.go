@@ -0,0 +1,93 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/metrics"
+)
+
+// CNS metrics.
+var (
+	requestCount = metrics.NewCounter(
+		"cns_requests_total",
+		"The number of requests handled by CNS, by handler and return code.",
+		"handler", "return_code",
+	)
+	requestLatency = metrics.NewHistogram(
+		"cns_request_latency_seconds",
+		"The time taken by CNS to handle requests, by handler.",
+		"handler",
+	)
+)
+
+// responseRecorder keeps a copy of the response body written by a handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(b []byte) (int, error) {
+	recorder.body.Write(b)
+	return recorder.ResponseWriter.Write(b)
+}
+
+// instrumentHandler returns a handler recording the latency and the return code of the given handler.
+func instrumentHandler(path string, handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		handler(recorder, r)
+
+		requestLatency.ObserveSince(start, path)
+		requestCount.Inc(path, strconv.Itoa(getReturnCode(recorder.body.Bytes())))
+	}
+}
+
+// correlateHandler logs requests with the correlation ID sent by the client, or a new one if none was sent.
+// The ID is returned to the client and made available to the handler through the request context.
+func correlateHandler(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		correlationID := r.Header.Get(cns.CorrelationIDHeader)
+		if correlationID == "" {
+			correlationID = log.NewCorrelationID()
+		}
+
+		w.Header().Set(cns.CorrelationIDHeader, correlationID)
+		fields := log.Fields{CorrelationID: correlationID}
+		log.WithFields(fields).Printf("[Azure CNS] %v %v", r.Method, r.URL.Path)
+
+		handler(w, r.WithContext(log.NewContext(r.Context(), fields)))
+	}
+}
+
+// getReturnCode returns the return code of a response body. Responses either embed a
+// cns.Response or are one. Bodies that cannot be decoded are reported as UnexpectedError.
+func getReturnCode(body []byte) int {
+	var resp struct {
+		Response   *cns.Response
+		ReturnCode *int
+	}
+
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return UnexpectedError
+	}
+
+	switch {
+	case resp.Response != nil:
+		return resp.Response.ReturnCode
+	case resp.ReturnCode != nil:
+		return *resp.ReturnCode
+	}
+
+	return UnexpectedError
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package restserver
+
+import (
+	"time"
+
+	"github.com/Azure/azure-container-networking/cns"
+	"github.com/Azure/azure-container-networking/cns/imdsclient"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Interval at which network containers due for a check are reconciled with the host.
+	reconcileInterval = time.Second
+	// Minimum and maximum delay between two checks of the same network container.
+	reconcileMinBackoff = time.Second
+	reconcileMaxBackoff = time.Minute
+	// Number of consecutive failed host queries after which a network container is marked failed.
+	reconcileMaxFailures = 5
+)
+
+// networkContainerHost retrieves the version of network containers programmed by the host.
+type networkContainerHost interface {
+	GetNetworkContainerInfoFromHost(networkContainerID string, primaryAddress string, authToken string, apiVersion string) (*imdsclient.ContainerVersion, error)
+}
+
+// networkContainerReconciler polls the host until it has programmed the version requested for
+// each network container, backing off between checks of the same network container.
+type networkContainerReconciler struct {
+	service *HTTPRestService
+	host    networkContainerHost
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newNetworkContainerReconciler creates a reconciler for the network containers of a service.
+func newNetworkContainerReconciler(service *HTTPRestService, host networkContainerHost) *networkContainerReconciler {
+	return &networkContainerReconciler{
+		service: service,
+		host:    host,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// start starts reconciling in the background.
+func (r *networkContainerReconciler) start() {
+	go r.run()
+}
+
+// close stops reconciling and waits for the pending host query to complete.
+func (r *networkContainerReconciler) close() {
+	close(r.stop)
+	<-r.done
+}
+
+// Reconciles network containers periodically until stopped.
+func (r *networkContainerReconciler) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.reconcile(now)
+		}
+	}
+}
+
+// reconcile checks the network containers due for a check with the host.
+func (r *networkContainerReconciler) reconcile(now time.Time) {
+	for _, status := range r.service.getNetworkContainersToReconcile(now) {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		req := status.CreateNetworkContainerRequest
+		version, err := r.host.GetNetworkContainerInfoFromHost(
+			status.ID,
+			req.PrimaryInterfaceIdentifier,
+			req.AuthorizationToken, swiftAPIVersion)
+
+		r.service.updateNetworkContainerState(status.ID, status.VMVersion, version, err, now)
+	}
+}
+
+// getNetworkContainersToReconcile returns the network containers that are not programmed yet
+// and due for a check.
+func (service *HTTPRestService) getNetworkContainersToReconcile(now time.Time) []containerstatus {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	var statuses []containerstatus
+	for _, status := range service.state.ContainerStatus {
+		switch status.State {
+		case cns.NetworkContainerStatePending, cns.NetworkContainerStateProgramming, cns.NetworkContainerStateFailed:
+			if !now.Before(status.NextCheck) {
+				statuses = append(statuses, status)
+			}
+		}
+	}
+
+	return statuses
+}
+
+// updateNetworkContainerState moves a network container to its next state given the result of
+// querying the host. Results for a version that is no longer requested are ignored.
+func (service *HTTPRestService) updateNetworkContainerState(
+	networkContainerID string, vmVersion string, version *imdsclient.ContainerVersion, err error, now time.Time) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	status, ok := service.state.ContainerStatus[networkContainerID]
+	if !ok || status.VMVersion != vmVersion || status.State == cns.NetworkContainerStateDeleting {
+		return
+	}
+
+	previousState := status.State
+	status.LastChecked = now
+
+	if err != nil {
+		status.LastError = err.Error()
+		status.Failures++
+		if status.Failures >= reconcileMaxFailures {
+			status.State = cns.NetworkContainerStateFailed
+		}
+	} else {
+		status.HostVersion = version.ProgrammedVersion
+		status.LastError = ""
+		status.Failures = 0
+		if status.HostVersion != "" && status.HostVersion == status.VMVersion {
+			status.State = cns.NetworkContainerStateReady
+		} else {
+			status.State = cns.NetworkContainerStateProgramming
+		}
+	}
+
+	if status.State == cns.NetworkContainerStateReady {
+		status.Attempts = 0
+		status.NextCheck = time.Time{}
+	} else {
+		status.Attempts++
+		status.NextCheck = now.Add(getReconcileBackoff(status.Attempts))
+	}
+
+	service.state.ContainerStatus[networkContainerID] = status
+
+	if status.State != previousState {
+		log.Printf("[Azure CNS] Network container %s version %s moved from %s to %s, host version:%s err:%s.",
+			networkContainerID, vmVersion, previousState, status.State, status.HostVersion, status.LastError)
+		service.saveState()
+	}
+}
+
+// getReconcileBackoff returns the delay before the next check of a network container,
+// doubling with each unsuccessful check.
+func getReconcileBackoff(attempts int) time.Duration {
+	backoff := reconcileMinBackoff
+	for i := 1; i < attempts && backoff < reconcileMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > reconcileMaxBackoff {
+		backoff = reconcileMaxBackoff
+	}
+
+	return backoff
+}
+
+// getRestoredNetworkContainerState returns the state of a network container persisted
+// before network container states were tracked.
+func getRestoredNetworkContainerState(status containerstatus) string {
+	if status.HostVersion != "" && status.HostVersion == status.VMVersion {
+		return cns.NetworkContainerStateReady
+	}
+
+	return cns.NetworkContainerStatePending
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/Azure/azure-container-networking/cns/routes"
 	acn "github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/metrics"
 	"github.com/Azure/azure-container-networking/platform"
 	"github.com/Azure/azure-container-networking/store"
 )
@@ -40,12 +41,23 @@ type HTTPRestService struct {
 	dockerClient     *dockerclient.DockerClient
 	imdsClient       *imdsclient.ImdsClient
 	ipamClient       *ipamclient.IpamClient
-	networkContainer *networkcontainers.NetworkContainers
+	networkContainer networkContainerApi
 	routingTable     *routes.RoutingTable
 	store            store.KeyValueStore
 	state            *httpRestServiceState
 	lock             sync.Mutex
 	dncPartitionKey  string
+	reconciler       *networkContainerReconciler
+	healthChecker    *healthChecker
+}
+
+// networkContainerApi programs network containers on the host.
+type networkContainerApi interface {
+	Create(createNetworkContainerRequest cns.CreateNetworkContainerRequest) error
+	Update(createNetworkContainerRequest cns.CreateNetworkContainerRequest, netpluginConfig *networkcontainers.NetPluginConfiguration) error
+	Delete(networkContainerID string) error
+	Attach(podInfo cns.KubernetesPodInfo, dockerContainerid string, netPluginConfig *networkcontainers.NetPluginConfiguration) error
+	Detach(podInfo cns.KubernetesPodInfo, dockerContainerid string, netPluginConfig *networkcontainers.NetPluginConfiguration) error
 }
 
 // containerstatus is used to save status of an existing container
@@ -53,6 +65,12 @@ type containerstatus struct {
 	ID                            string
 	VMVersion                     string
 	HostVersion                   string
+	State                         string
+	LastError                     string
+	LastChecked                   time.Time
+	Failures                      int       // Consecutive failed host queries.
+	Attempts                      int       // Checks since the requested version was saved or last programmed.
+	NextCheck                     time.Time // Time of the next check with the host.
 	CreateNetworkContainerRequest cns.CreateNetworkContainerRequest
 }
 
@@ -137,49 +155,64 @@ func (service *HTTPRestService) Start(config *common.ServiceConfig) error {
 		return err
 	}
 
-	// Add handlers.
+	// Reconcile network containers with the host in the background.
+	service.reconciler = newNetworkContainerReconciler(service, service.imdsClient)
+	service.reconciler.start()
+
+	// Check the components CNS depends on in the background.
+	service.healthChecker = newHealthChecker(service.imdsClient, service.dockerClient)
+	service.healthChecker.start()
+
+	// Add handlers. Requests are counted and timed by handler and return code.
 	listener := service.Listener
+	addHandler := func(path string, handler func(http.ResponseWriter, *http.Request)) {
+		listener.AddHandler(path, instrumentHandler(path, correlateHandler(handler)))
+	}
+
+	listener.AddHandler(cns.MetricsPath, metrics.Handler().ServeHTTP)
 	// default handlers
-	listener.AddHandler(cns.SetEnvironmentPath, service.setEnvironment)
-	listener.AddHandler(cns.CreateNetworkPath, service.createNetwork)
-	listener.AddHandler(cns.DeleteNetworkPath, service.deleteNetwork)
-	listener.AddHandler(cns.ReserveIPAddressPath, service.reserveIPAddress)
-	listener.AddHandler(cns.ReleaseIPAddressPath, service.releaseIPAddress)
-	listener.AddHandler(cns.GetHostLocalIPPath, service.getHostLocalIP)
-	listener.AddHandler(cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
-	listener.AddHandler(cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
-	listener.AddHandler(cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
-	listener.AddHandler(cns.DeleteNetworkContainer, service.deleteNetworkContainer)
-	listener.AddHandler(cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
-	listener.AddHandler(cns.GetInterfaceForContainer, service.getInterfaceForContainer)
-	listener.AddHandler(cns.SetOrchestratorType, service.setOrchestratorType)
-	listener.AddHandler(cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
-	listener.AddHandler(cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
-	listener.AddHandler(cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
-	listener.AddHandler(cns.CreateHnsNetworkPath, service.createHnsNetwork)
-	listener.AddHandler(cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
-	listener.AddHandler(cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
+	addHandler(cns.SetEnvironmentPath, service.setEnvironment)
+	addHandler(cns.CreateNetworkPath, service.createNetwork)
+	addHandler(cns.DeleteNetworkPath, service.deleteNetwork)
+	addHandler(cns.ReserveIPAddressPath, service.reserveIPAddress)
+	addHandler(cns.ReleaseIPAddressPath, service.releaseIPAddress)
+	addHandler(cns.GetHostLocalIPPath, service.getHostLocalIP)
+	addHandler(cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
+	addHandler(cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
+	addHandler(cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
+	addHandler(cns.DeleteNetworkContainer, service.deleteNetworkContainer)
+	addHandler(cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
+	addHandler(cns.GetInterfaceForContainer, service.getInterfaceForContainer)
+	addHandler(cns.SetOrchestratorType, service.setOrchestratorType)
+	addHandler(cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
+	addHandler(cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
+	addHandler(cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
+	addHandler(cns.CreateHnsNetworkPath, service.createHnsNetwork)
+	addHandler(cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
+	addHandler(cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
+	addHandler(cns.GetHealthReportPath, service.getHealthReport)
 
 	// handlers for v0.2
-	listener.AddHandler(cns.V2Prefix+cns.SetEnvironmentPath, service.setEnvironment)
-	listener.AddHandler(cns.V2Prefix+cns.CreateNetworkPath, service.createNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteNetworkPath, service.deleteNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.ReserveIPAddressPath, service.reserveIPAddress)
-	listener.AddHandler(cns.V2Prefix+cns.ReleaseIPAddressPath, service.releaseIPAddress)
-	listener.AddHandler(cns.V2Prefix+cns.GetHostLocalIPPath, service.getHostLocalIP)
-	listener.AddHandler(cns.V2Prefix+cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
-	listener.AddHandler(cns.V2Prefix+cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
-	listener.AddHandler(cns.V2Prefix+cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteNetworkContainer, service.deleteNetworkContainer)
-	listener.AddHandler(cns.V2Prefix+cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
-	listener.AddHandler(cns.V2Prefix+cns.GetInterfaceForContainer, service.getInterfaceForContainer)
-	listener.AddHandler(cns.V2Prefix+cns.SetOrchestratorType, service.setOrchestratorType)
-	listener.AddHandler(cns.V2Prefix+cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
-	listener.AddHandler(cns.V2Prefix+cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.CreateHnsNetworkPath, service.createHnsNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
-	listener.AddHandler(cns.V2Prefix+cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
+	addHandler(cns.V2Prefix+cns.SetEnvironmentPath, service.setEnvironment)
+	addHandler(cns.V2Prefix+cns.CreateNetworkPath, service.createNetwork)
+	addHandler(cns.V2Prefix+cns.DeleteNetworkPath, service.deleteNetwork)
+	addHandler(cns.V2Prefix+cns.ReserveIPAddressPath, service.reserveIPAddress)
+	addHandler(cns.V2Prefix+cns.ReleaseIPAddressPath, service.releaseIPAddress)
+	addHandler(cns.V2Prefix+cns.GetHostLocalIPPath, service.getHostLocalIP)
+	addHandler(cns.V2Prefix+cns.GetIPAddressUtilizationPath, service.getIPAddressUtilization)
+	addHandler(cns.V2Prefix+cns.GetUnhealthyIPAddressesPath, service.getUnhealthyIPAddresses)
+	addHandler(cns.V2Prefix+cns.CreateOrUpdateNetworkContainer, service.createOrUpdateNetworkContainer)
+	addHandler(cns.V2Prefix+cns.DeleteNetworkContainer, service.deleteNetworkContainer)
+	addHandler(cns.V2Prefix+cns.GetNetworkContainerStatus, service.getNetworkContainerStatus)
+	addHandler(cns.V2Prefix+cns.GetInterfaceForContainer, service.getInterfaceForContainer)
+	addHandler(cns.V2Prefix+cns.SetOrchestratorType, service.setOrchestratorType)
+	addHandler(cns.V2Prefix+cns.GetNetworkContainerByOrchestratorContext, service.getNetworkContainerByOrchestratorContext)
+	addHandler(cns.V2Prefix+cns.AttachContainerToNetwork, service.attachNetworkContainerToNetwork)
+	addHandler(cns.V2Prefix+cns.DetachContainerFromNetwork, service.detachNetworkContainerFromNetwork)
+	addHandler(cns.V2Prefix+cns.CreateHnsNetworkPath, service.createHnsNetwork)
+	addHandler(cns.V2Prefix+cns.DeleteHnsNetworkPath, service.deleteHnsNetwork)
+	addHandler(cns.V2Prefix+cns.NumberOfCPUCoresPath, service.getNumberOfCPUCores)
+	addHandler(cns.V2Prefix+cns.GetHealthReportPath, service.getHealthReport)
 
 	log.Printf("[Azure CNS]  Listening.")
 	return nil
@@ -187,6 +220,14 @@ func (service *HTTPRestService) Start(config *common.ServiceConfig) error {
 
 // Stop stops the CNS.
 func (service *HTTPRestService) Stop() {
+	if service.reconciler != nil {
+		service.reconciler.close()
+	}
+
+	if service.healthChecker != nil {
+		service.healthChecker.close()
+	}
+
 	service.Uninitialize()
 	log.Printf("[Azure CNS]  Service stopped.")
 }
@@ -232,7 +273,7 @@ func (service *HTTPRestService) setEnvironment(w http.ResponseWriter, r *http.Re
 
 	var req cns.SetEnvironmentRequest
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 
 	if err != nil {
 		return
@@ -251,7 +292,7 @@ func (service *HTTPRestService) setEnvironment(w http.ResponseWriter, r *http.Re
 	resp := &cns.Response{ReturnCode: 0}
 	err = service.Listener.Encode(w, &resp)
 
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles CreateNetwork requests.
@@ -265,7 +306,7 @@ func (service *HTTPRestService) createNetwork(w http.ResponseWriter, r *http.Req
 	if service.state.Initialized {
 		var req cns.CreateNetworkRequest
 		err = service.Listener.Decode(w, r, &req)
-		log.Request(service.Name, &req, err)
+		log.FromContext(r.Context()).Request(service.Name, &req, err)
 
 		if err != nil {
 			returnMessage = fmt.Sprintf("[Azure CNS] Error. Unable to decode input request.")
@@ -330,7 +371,7 @@ func (service *HTTPRestService) createNetwork(w http.ResponseWriter, r *http.Req
 					}
 				} else {
 					returnMessage = fmt.Sprintf("[Azure CNS] Received a request to create an already existing network %v", req.NetworkName)
-					log.Printf(returnMessage)
+					log.Printf("%s", returnMessage)
 				}
 
 			default:
@@ -355,7 +396,7 @@ func (service *HTTPRestService) createNetwork(w http.ResponseWriter, r *http.Req
 		service.saveState()
 	}
 
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles DeleteNetwork requests.
@@ -366,7 +407,7 @@ func (service *HTTPRestService) deleteNetwork(w http.ResponseWriter, r *http.Req
 	returnCode := 0
 	returnMessage := ""
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 
 	if err != nil {
 		return
@@ -411,7 +452,7 @@ func (service *HTTPRestService) deleteNetwork(w http.ResponseWriter, r *http.Req
 		service.saveState()
 	}
 
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles CreateHnsNetwork requests.
@@ -424,7 +465,7 @@ func (service *HTTPRestService) createHnsNetwork(w http.ResponseWriter, r *http.
 
 	var req cns.CreateHnsNetworkRequest
 	err = service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 
 	if err != nil {
 		returnMessage = fmt.Sprintf("[Azure CNS] Error. Unable to decode input request.")
@@ -461,7 +502,7 @@ func (service *HTTPRestService) createHnsNetwork(w http.ResponseWriter, r *http.
 		service.saveState()
 	}
 
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles deleteHnsNetwork requests.
@@ -474,7 +515,7 @@ func (service *HTTPRestService) deleteHnsNetwork(w http.ResponseWriter, r *http.
 	returnMessage := ""
 
 	err = service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 
 	if err != nil {
 		returnMessage = fmt.Sprintf("[Azure CNS] Error. Unable to decode input request.")
@@ -512,7 +553,7 @@ func (service *HTTPRestService) deleteHnsNetwork(w http.ResponseWriter, r *http.
 		service.saveState()
 	}
 
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles ip reservation requests.
@@ -526,7 +567,7 @@ func (service *HTTPRestService) reserveIPAddress(w http.ResponseWriter, r *http.
 	address := ""
 	err := service.Listener.Decode(w, r, &req)
 
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 
 	if err != nil {
 		return
@@ -590,7 +631,7 @@ func (service *HTTPRestService) reserveIPAddress(w http.ResponseWriter, r *http.
 
 	reserveResp := &cns.ReserveIPAddressResponse{Response: resp, IPAddress: address}
 	err = service.Listener.Encode(w, &reserveResp)
-	log.Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles release ip reservation requests.
@@ -602,7 +643,7 @@ func (service *HTTPRestService) releaseIPAddress(w http.ResponseWriter, r *http.
 	returnCode := 0
 
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 
 	if err != nil {
 		return
@@ -655,13 +696,13 @@ func (service *HTTPRestService) releaseIPAddress(w http.ResponseWriter, r *http.
 	}
 
 	err = service.Listener.Encode(w, &resp)
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Retrieves the host local ip address. Containers can talk to host using this IP address.
 func (service *HTTPRestService) getHostLocalIP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure CNS] getHostLocalIP")
-	log.Request(service.Name, "getHostLocalIP", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getHostLocalIP", nil)
 
 	var found bool
 	var errmsg string
@@ -707,13 +748,13 @@ func (service *HTTPRestService) getHostLocalIP(w http.ResponseWriter, r *http.Re
 
 	err := service.Listener.Encode(w, &hostLocalIPResponse)
 
-	log.Response(service.Name, hostLocalIPResponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, hostLocalIPResponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles ip address utilization requests.
 func (service *HTTPRestService) getIPAddressUtilization(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure CNS] getIPAddressUtilization")
-	log.Request(service.Name, "getIPAddressUtilization", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getIPAddressUtilization", nil)
 
 	returnMessage := ""
 	returnCode := 0
@@ -772,13 +813,13 @@ func (service *HTTPRestService) getIPAddressUtilization(w http.ResponseWriter, r
 	}
 
 	err := service.Listener.Encode(w, &utilResponse)
-	log.Response(service.Name, utilResponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, utilResponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles retrieval of ip addresses that are available to be reserved from ipam driver.
 func (service *HTTPRestService) getAvailableIPAddresses(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure CNS] getAvailableIPAddresses")
-	log.Request(service.Name, "getAvailableIPAddresses", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getAvailableIPAddresses", nil)
 
 	switch r.Method {
 	case "GET":
@@ -789,13 +830,13 @@ func (service *HTTPRestService) getAvailableIPAddresses(w http.ResponseWriter, r
 	ipResp := &cns.GetIPAddressesResponse{Response: resp}
 	err := service.Listener.Encode(w, &ipResp)
 
-	log.Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles retrieval of reserved ip addresses from ipam driver.
 func (service *HTTPRestService) getReservedIPAddresses(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure CNS] getReservedIPAddresses")
-	log.Request(service.Name, "getReservedIPAddresses", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getReservedIPAddresses", nil)
 
 	switch r.Method {
 	case "GET":
@@ -806,13 +847,13 @@ func (service *HTTPRestService) getReservedIPAddresses(w http.ResponseWriter, r
 	ipResp := &cns.GetIPAddressesResponse{Response: resp}
 	err := service.Listener.Encode(w, &ipResp)
 
-	log.Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles retrieval of ghost ip addresses from ipam driver.
 func (service *HTTPRestService) getUnhealthyIPAddresses(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure CNS] getUnhealthyIPAddresses")
-	log.Request(service.Name, "getUnhealthyIPAddresses", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getUnhealthyIPAddresses", nil)
 
 	returnMessage := ""
 	returnCode := 0
@@ -869,13 +910,13 @@ func (service *HTTPRestService) getUnhealthyIPAddresses(w http.ResponseWriter, r
 	}
 
 	err := service.Listener.Encode(w, &ipResp)
-	log.Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // getAllIPAddresses retrieves all ip addresses from ipam driver.
 func (service *HTTPRestService) getAllIPAddresses(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure CNS] getAllIPAddresses")
-	log.Request(service.Name, "getAllIPAddresses", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getAllIPAddresses", nil)
 
 	switch r.Method {
 	case "GET":
@@ -886,23 +927,77 @@ func (service *HTTPRestService) getAllIPAddresses(w http.ResponseWriter, r *http
 	ipResp := &cns.GetIPAddressesResponse{Response: resp}
 	err := service.Listener.Encode(w, &ipResp)
 
-	log.Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, ipResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // Handles health report requests.
 func (service *HTTPRestService) getHealthReport(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure CNS] getHealthReport")
-	log.Request(service.Name, "getHealthReport", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getHealthReport", nil)
+
+	returnMessage := ""
+	returnCode := 0
+
+	var report cns.HealthReportResponse
 
 	switch r.Method {
 	case "GET":
+		report.Store = service.getStoreHealth()
+		report.Imds, report.Docker = service.healthChecker.getHealth()
+		report.NetworkContainerCounts = service.getNetworkContainerCounts()
+
+		// Docker is only used by some orchestrators, so it does not affect overall health.
+		report.Healthy = report.Store.Healthy && report.Imds.Healthy
 	default:
+		returnMessage = "[Azure CNS] Error. getHealthReport did not receive a GET."
+		returnCode = UnsupportedVerb
 	}
 
-	resp := &cns.Response{ReturnCode: 0}
-	err := service.Listener.Encode(w, &resp)
+	report.Response = cns.Response{
+		ReturnCode: returnCode,
+		Message:    returnMessage,
+	}
+
+	err := service.Listener.Encode(w, &report)
+
+	log.FromContext(r.Context()).Response(service.Name, report, report.Response.ReturnCode, ReturnCodeToString(report.Response.ReturnCode), err)
+}
+
+// getStoreHealth checks that CNS state can be read from the persistent store.
+func (service *HTTPRestService) getStoreHealth() cns.ComponentHealth {
+	if service.store == nil {
+		return cns.ComponentHealth{Healthy: false, Message: "store not initialized"}
+	}
+
+	var state json.RawMessage
+	err := service.store.Read(storeKey, &state)
+	if err == store.ErrKeyNotFound {
+		err = nil
+	}
 
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	return getComponentHealth(err)
+}
+
+// getComponentHealth returns the health of a component given the result of its health check.
+func getComponentHealth(err error) cns.ComponentHealth {
+	if err != nil {
+		return cns.ComponentHealth{Healthy: false, Message: err.Error()}
+	}
+
+	return cns.ComponentHealth{Healthy: true}
+}
+
+// getNetworkContainerCounts returns the number of network containers in each state.
+func (service *HTTPRestService) getNetworkContainerCounts() map[string]int {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	counts := make(map[string]int)
+	for _, status := range service.state.ContainerStatus {
+		counts[status.State]++
+	}
+
+	return counts
 }
 
 // saveState writes CNS state to persistent store.
@@ -950,6 +1045,14 @@ func (service *HTTPRestService) restoreState() error {
 		return err
 	}
 
+	// Network containers persisted before their states were tracked.
+	for id, status := range service.state.ContainerStatus {
+		if status.State == "" {
+			status.State = getRestoredNetworkContainerState(status)
+			service.state.ContainerStatus[id] = status
+		}
+	}
+
 	log.Printf("[Azure CNS]  Restored state, %+v\n", service.state)
 	return nil
 }
@@ -997,7 +1100,7 @@ func (service *HTTPRestService) setOrchestratorType(w http.ResponseWriter, r *ht
 	}
 
 	err = service.Listener.Encode(w, &resp)
-	log.Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, resp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 func (service *HTTPRestService) saveNetworkContainerGoalState(req cns.CreateNetworkContainerRequest) (int, string) {
@@ -1015,12 +1118,24 @@ func (service *HTTPRestService) saveNetworkContainerGoalState(req cns.CreateNetw
 		service.state.ContainerStatus = make(map[string]containerstatus)
 	}
 
-	service.state.ContainerStatus[req.NetworkContainerid] =
-		containerstatus{
-			ID:                            req.NetworkContainerid,
-			VMVersion:                     req.Version,
-			CreateNetworkContainerRequest: req,
-			HostVersion:                   hostVersion}
+	status := containerstatus{
+		ID:                            req.NetworkContainerid,
+		VMVersion:                     req.Version,
+		CreateNetworkContainerRequest: req,
+		HostVersion:                   hostVersion,
+		State:                         cns.NetworkContainerStatePending}
+
+	// Keep reconciling the requested version where it left off if it did not change.
+	if ok && existing.VMVersion == req.Version && existing.State != cns.NetworkContainerStateDeleting {
+		status.State = existing.State
+		status.LastError = existing.LastError
+		status.LastChecked = existing.LastChecked
+		status.Failures = existing.Failures
+		status.Attempts = existing.Attempts
+		status.NextCheck = existing.NextCheck
+	}
+
+	service.state.ContainerStatus[req.NetworkContainerid] = status
 
 	switch req.NetworkContainerType {
 	case cns.AzureContainerInstance:
@@ -1060,12 +1175,12 @@ func (service *HTTPRestService) saveNetworkContainerGoalState(req cns.CreateNetw
 
 		default:
 			errMsg := fmt.Sprintf("Unsupported orchestrator type: %s", service.state.OrchestratorType)
-			log.Errorf(errMsg)
+			log.Errorf("%s", errMsg)
 			return UnsupportedOrchestratorType, errMsg
 		}
 	default:
 		errMsg := fmt.Sprintf("Unsupported network container type %s", req.NetworkContainerType)
-		log.Errorf(errMsg)
+		log.Errorf("%s", errMsg)
 		return UnsupportedNetworkContainerType, errMsg
 	}
 
@@ -1081,7 +1196,7 @@ func (service *HTTPRestService) createOrUpdateNetworkContainer(w http.ResponseWr
 	returnCode := 0
 
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
@@ -1140,7 +1255,7 @@ func (service *HTTPRestService) createOrUpdateNetworkContainer(w http.ResponseWr
 
 	reserveResp := &cns.CreateNetworkContainerResponse{Response: resp}
 	err = service.Listener.Encode(w, &reserveResp)
-	log.Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 func (service *HTTPRestService) getNetworkContainerByID(w http.ResponseWriter, r *http.Request) {
@@ -1151,7 +1266,7 @@ func (service *HTTPRestService) getNetworkContainerByID(w http.ResponseWriter, r
 	returnCode := 0
 
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
@@ -1163,7 +1278,7 @@ func (service *HTTPRestService) getNetworkContainerByID(w http.ResponseWriter, r
 
 	reserveResp := &cns.GetNetworkContainerResponse{Response: resp}
 	err = service.Listener.Encode(w, &reserveResp)
-	log.Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 func (service *HTTPRestService) getNetworkContainerResponse(req cns.GetNetworkContainerRequest) cns.GetNetworkContainerResponse {
@@ -1231,7 +1346,7 @@ func (service *HTTPRestService) getNetworkContainerByOrchestratorContext(w http.
 	var req cns.GetNetworkContainerRequest
 
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
@@ -1247,7 +1362,7 @@ func (service *HTTPRestService) getNetworkContainerByOrchestratorContext(w http.
 	getNetworkContainerResponse := service.getNetworkContainerResponse(req)
 	returnCode := getNetworkContainerResponse.Response.ReturnCode
 	err = service.Listener.Encode(w, &getNetworkContainerResponse)
-	log.Response(service.Name, getNetworkContainerResponse, returnCode, ReturnCodeToString(returnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, getNetworkContainerResponse, returnCode, ReturnCodeToString(returnCode), err)
 }
 
 func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r *http.Request) {
@@ -1258,7 +1373,7 @@ func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r
 	returnCode := 0
 
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
@@ -1270,45 +1385,9 @@ func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r
 
 	switch r.Method {
 	case "POST":
-		var containerStatus containerstatus
-		var ok bool
-
-		service.lock.Lock()
-		containerStatus, ok = service.state.ContainerStatus[req.NetworkContainerid]
-		service.lock.Unlock()
-
-		if !ok {
-			log.Printf("Not able to retrieve network container details for this container id %v", req.NetworkContainerid)
-			break
-		}
-
-		if containerStatus.CreateNetworkContainerRequest.NetworkContainerType == cns.WebApps {
-			nc := service.networkContainer
-			if err := nc.Delete(req.NetworkContainerid); err != nil {
-				returnMessage = fmt.Sprintf("[Azure CNS] Error. DeleteNetworkContainer failed %v", err.Error())
-				returnCode = UnexpectedError
-				break
-			}
-		}
-
-		service.lock.Lock()
-		defer service.lock.Unlock()
-
-		if service.state.ContainerStatus != nil {
-			delete(service.state.ContainerStatus, req.NetworkContainerid)
-		}
-
-		if service.state.ContainerIDByOrchestratorContext != nil {
-			for orchestratorContext, networkContainerID := range service.state.ContainerIDByOrchestratorContext {
-				if networkContainerID == req.NetworkContainerid {
-					delete(service.state.ContainerIDByOrchestratorContext, orchestratorContext)
-					break
-				}
-			}
+		if code, message := service.removeNetworkContainer(req.NetworkContainerid); code != 0 {
+			returnCode, returnMessage = code, message
 		}
-
-		service.saveState()
-		break
 	default:
 		returnMessage = "[Azure CNS] Error. DeleteNetworkContainer did not receive a POST."
 		returnCode = InvalidParameter
@@ -1321,7 +1400,63 @@ func (service *HTTPRestService) deleteNetworkContainer(w http.ResponseWriter, r
 
 	reserveResp := &cns.DeleteNetworkContainerResponse{Response: resp}
 	err = service.Listener.Encode(w, &reserveResp)
-	log.Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, reserveResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+}
+
+// removeNetworkContainer deletes a network container and its saved goal state. A network container
+// that fails to be deleted returns to the state it was in before.
+func (service *HTTPRestService) removeNetworkContainer(networkContainerID string) (int, string) {
+	service.lock.Lock()
+	containerStatus, ok := service.state.ContainerStatus[networkContainerID]
+	if ok {
+		// Stop reconciling the network container while it is deleted.
+		deleting := containerStatus
+		deleting.State = cns.NetworkContainerStateDeleting
+		service.state.ContainerStatus[networkContainerID] = deleting
+	}
+	service.lock.Unlock()
+
+	if !ok {
+		log.Printf("Not able to retrieve network container details for this container id %v", networkContainerID)
+		return 0, ""
+	}
+
+	if containerStatus.CreateNetworkContainerRequest.NetworkContainerType == cns.WebApps {
+		if err := service.networkContainer.Delete(networkContainerID); err != nil {
+			service.lock.Lock()
+			current, ok := service.state.ContainerStatus[networkContainerID]
+			if ok && current.State == cns.NetworkContainerStateDeleting {
+				log.Printf("[Azure CNS] Network container %s failed to be deleted, returning to %s.",
+					networkContainerID, containerStatus.State)
+				current.State = containerStatus.State
+				current.LastError = err.Error()
+				service.state.ContainerStatus[networkContainerID] = current
+			}
+			service.lock.Unlock()
+
+			return UnexpectedError, fmt.Sprintf("[Azure CNS] Error. DeleteNetworkContainer failed %v", err.Error())
+		}
+	}
+
+	service.lock.Lock()
+	defer service.lock.Unlock()
+
+	if service.state.ContainerStatus != nil {
+		delete(service.state.ContainerStatus, networkContainerID)
+	}
+
+	if service.state.ContainerIDByOrchestratorContext != nil {
+		for orchestratorContext, id := range service.state.ContainerIDByOrchestratorContext {
+			if id == networkContainerID {
+				delete(service.state.ContainerIDByOrchestratorContext, orchestratorContext)
+				break
+			}
+		}
+	}
+
+	service.saveState()
+
+	return 0, ""
 }
 
 func (service *HTTPRestService) getNetworkContainerStatus(w http.ResponseWriter, r *http.Request) {
@@ -1332,42 +1467,23 @@ func (service *HTTPRestService) getNetworkContainerStatus(w http.ResponseWriter,
 	returnCode := 0
 
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
 
 	service.lock.Lock()
-	defer service.lock.Unlock()
-	var ok bool
-	var containerDetails containerstatus
-
-	containerInfo := service.state.ContainerStatus
-	if containerInfo != nil {
-		containerDetails, ok = containerInfo[req.NetworkContainerid]
-	} else {
-		ok = false
-	}
-
-	var hostVersion string
-	var vmVersion string
-
-	if ok {
-		savedReq := containerDetails.CreateNetworkContainerRequest
-		containerVersion, err := service.imdsClient.GetNetworkContainerInfoFromHost(
-			req.NetworkContainerid,
-			savedReq.PrimaryInterfaceIdentifier,
-			savedReq.AuthorizationToken, swiftAPIVersion)
+	containerDetails, ok := service.state.ContainerStatus[req.NetworkContainerid]
+	service.lock.Unlock()
 
-		if err != nil {
-			returnCode = CallToHostFailed
-			returnMessage = err.Error()
-		} else {
-			hostVersion = containerVersion.ProgrammedVersion
-		}
-	} else {
+	// The network container is reconciled with the host in the background, so that its status
+	// can be polled without querying the host.
+	if !ok {
 		returnMessage = "[Azure CNS] Never received call to create this container."
 		returnCode = UnknownContainerID
+	} else if containerDetails.State == cns.NetworkContainerStateFailed {
+		returnMessage = containerDetails.LastError
+		returnCode = CallToHostFailed
 	}
 
 	resp := cns.Response{
@@ -1378,12 +1494,15 @@ func (service *HTTPRestService) getNetworkContainerStatus(w http.ResponseWriter,
 	networkContainerStatusReponse := cns.GetNetworkContainerStatusResponse{
 		Response:           resp,
 		NetworkContainerid: req.NetworkContainerid,
-		AzureHostVersion:   hostVersion,
-		Version:            vmVersion,
+		AzureHostVersion:   containerDetails.HostVersion,
+		Version:            containerDetails.VMVersion,
+		State:              containerDetails.State,
+		LastError:          containerDetails.LastError,
+		LastChecked:        containerDetails.LastChecked,
 	}
 
 	err = service.Listener.Encode(w, &networkContainerStatusReponse)
-	log.Response(service.Name, networkContainerStatusReponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, networkContainerStatusReponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 func (service *HTTPRestService) getInterfaceForContainer(w http.ResponseWriter, r *http.Request) {
@@ -1394,7 +1513,7 @@ func (service *HTTPRestService) getInterfaceForContainer(w http.ResponseWriter,
 	returnCode := 0
 
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
@@ -1437,7 +1556,7 @@ func (service *HTTPRestService) getInterfaceForContainer(w http.ResponseWriter,
 
 	err = service.Listener.Encode(w, &getInterfaceForContainerResponse)
 
-	log.Response(service.Name, getInterfaceForContainerResponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, getInterfaceForContainerResponse, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 // restoreNetworkState restores Network state that existed before reboot.
@@ -1492,7 +1611,7 @@ func (service *HTTPRestService) attachNetworkContainerToNetwork(w http.ResponseW
 
 	var req cns.ConfigureContainerNetworkingRequest
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
@@ -1500,7 +1619,7 @@ func (service *HTTPRestService) attachNetworkContainerToNetwork(w http.ResponseW
 	resp := service.attachOrDetachHelper(req, attach, r.Method)
 	attachResp := &cns.AttachContainerToNetworkResponse{Response: resp}
 	err = service.Listener.Encode(w, &attachResp)
-	log.Response(service.Name, attachResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, attachResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 func (service *HTTPRestService) detachNetworkContainerFromNetwork(w http.ResponseWriter, r *http.Request) {
@@ -1508,7 +1627,7 @@ func (service *HTTPRestService) detachNetworkContainerFromNetwork(w http.Respons
 
 	var req cns.ConfigureContainerNetworkingRequest
 	err := service.Listener.Decode(w, r, &req)
-	log.Request(service.Name, &req, err)
+	log.FromContext(r.Context()).Request(service.Name, &req, err)
 	if err != nil {
 		return
 	}
@@ -1516,7 +1635,7 @@ func (service *HTTPRestService) detachNetworkContainerFromNetwork(w http.Respons
 	resp := service.attachOrDetachHelper(req, detach, r.Method)
 	detachResp := &cns.DetachContainerFromNetworkResponse{Response: resp}
 	err = service.Listener.Encode(w, &detachResp)
-	log.Response(service.Name, detachResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, detachResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
 
 func (service *HTTPRestService) attachOrDetachHelper(req cns.ConfigureContainerNetworkingRequest, operation, method string) cns.Response {
@@ -1589,7 +1708,7 @@ func (service *HTTPRestService) getNetPluginDetails() *networkcontainers.NetPlug
 // used to enforce per VM delegated NIC limit by DNC.
 func (service *HTTPRestService) getNumberOfCPUCores(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[Azure-CNS] getNumberOfCPUCores")
-	log.Request(service.Name, "getNumberOfCPUCores", nil)
+	log.FromContext(r.Context()).Request(service.Name, "getNumberOfCPUCores", nil)
 
 	var (
 		num        int
@@ -1613,5 +1732,5 @@ func (service *HTTPRestService) getNumberOfCPUCores(w http.ResponseWriter, r *ht
 
 	err := service.Listener.Encode(w, &numOfCPUCoresResp)
 
-	log.Response(service.Name, numOfCPUCoresResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
+	log.FromContext(r.Context()).Response(service.Name, numOfCPUCoresResp, resp.ReturnCode, ReturnCodeToString(resp.ReturnCode), err)
 }
@@ -13,9 +13,12 @@ import (
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-container-networking/cns"
 	"github.com/Azure/azure-container-networking/cns/common"
+	"github.com/Azure/azure-container-networking/cns/imdsclient"
+	"github.com/Azure/azure-container-networking/cns/networkcontainers"
 	acncommon "github.com/Azure/azure-container-networking/common"
 )
 
@@ -696,6 +699,179 @@ func TestGetNetworkContainerStatus(t *testing.T) {
 	}
 }
 
+// Host returning a fixed programmed version or error for network containers.
+type fakeNetworkContainerHost struct {
+	version string
+	err     error
+	queries int
+}
+
+func (host *fakeNetworkContainerHost) GetNetworkContainerInfoFromHost(networkContainerID string, primaryAddress string, authToken string, apiVersion string) (*imdsclient.ContainerVersion, error) {
+	host.queries++
+	if host.err != nil {
+		return nil, host.err
+	}
+
+	return &imdsclient.ContainerVersion{NetworkContainerID: networkContainerID, ProgrammedVersion: host.version}, nil
+}
+
+func TestReconcileNetworkContainers(t *testing.T) {
+	fmt.Println("Test: reconcileNetworkContainers")
+
+	svc := &HTTPRestService{state: &httpRestServiceState{OrchestratorType: cns.Kubernetes}}
+	host := &fakeNetworkContainerHost{version: "1"}
+	r := newNetworkContainerReconciler(svc, host)
+
+	context, _ := json.Marshal(cns.KubernetesPodInfo{PodName: "testpod", PodNamespace: "testpodnamespace"})
+	req := cns.CreateNetworkContainerRequest{
+		Version:              "2",
+		NetworkContainerType: cns.Docker,
+		NetworkContainerid:   "nc",
+		OrchestratorContext:  context,
+	}
+
+	checkState := func(state string, queries int) containerstatus {
+		status := svc.state.ContainerStatus["nc"]
+		if status.State != state || host.queries != queries {
+			t.Fatalf("Expected state %s after %d queries, got %+v after %d queries", state, queries, status, host.queries)
+		}
+		return status
+	}
+
+	if returnCode, message := svc.saveNetworkContainerGoalState(req); returnCode != 0 {
+		t.Fatalf("saveNetworkContainerGoalState failed %d %s", returnCode, message)
+	}
+	checkState(cns.NetworkContainerStatePending, 0)
+
+	// The host has not programmed the requested version yet.
+	now := time.Now()
+	r.reconcile(now)
+	checkState(cns.NetworkContainerStateProgramming, 1)
+
+	// Checks back off.
+	r.reconcile(now)
+	checkState(cns.NetworkContainerStateProgramming, 1)
+
+	now = now.Add(reconcileMinBackoff)
+	r.reconcile(now)
+	status := checkState(cns.NetworkContainerStateProgramming, 2)
+	if status.NextCheck != now.Add(2*reconcileMinBackoff) {
+		t.Errorf("Unexpected next check %v", status.NextCheck)
+	}
+
+	// The network container fails after consecutive failed host queries.
+	host.err = fmt.Errorf("host unreachable")
+	for i := 1; i <= reconcileMaxFailures; i++ {
+		now = now.Add(reconcileMaxBackoff)
+		r.reconcile(now)
+	}
+	status = checkState(cns.NetworkContainerStateFailed, 2+reconcileMaxFailures)
+	if status.LastError != "host unreachable" {
+		t.Errorf("Unexpected last error %s", status.LastError)
+	}
+
+	// Saving the same version again does not reset the state.
+	svc.saveNetworkContainerGoalState(req)
+	checkState(cns.NetworkContainerStateFailed, 2+reconcileMaxFailures)
+
+	// Failed network containers are still reconciled.
+	host.err = nil
+	host.version = "2"
+	now = now.Add(reconcileMaxBackoff)
+	r.reconcile(now)
+	status = checkState(cns.NetworkContainerStateReady, 3+reconcileMaxFailures)
+	if status.LastError != "" || status.HostVersion != "2" {
+		t.Errorf("Unexpected ready network container %+v", status)
+	}
+
+	// Ready network containers are not checked again.
+	now = now.Add(reconcileMaxBackoff)
+	r.reconcile(now)
+	checkState(cns.NetworkContainerStateReady, 3+reconcileMaxFailures)
+
+	// A new version is reconciled from the start.
+	req.Version = "3"
+	svc.saveNetworkContainerGoalState(req)
+	checkState(cns.NetworkContainerStatePending, 3+reconcileMaxFailures)
+
+	if counts := svc.getNetworkContainerCounts(); counts[cns.NetworkContainerStatePending] != 1 {
+		t.Errorf("Unexpected network container counts %+v", counts)
+	}
+}
+
+// Programmer of network containers failing to delete them on request.
+type fakeNetworkContainerApi struct {
+	deleteErr error
+}
+
+func (nc *fakeNetworkContainerApi) Create(req cns.CreateNetworkContainerRequest) error {
+	return nil
+}
+
+func (nc *fakeNetworkContainerApi) Update(req cns.CreateNetworkContainerRequest, netpluginConfig *networkcontainers.NetPluginConfiguration) error {
+	return nil
+}
+
+func (nc *fakeNetworkContainerApi) Delete(networkContainerID string) error {
+	return nc.deleteErr
+}
+
+func (nc *fakeNetworkContainerApi) Attach(podInfo cns.KubernetesPodInfo, dockerContainerid string, netPluginConfig *networkcontainers.NetPluginConfiguration) error {
+	return nil
+}
+
+func (nc *fakeNetworkContainerApi) Detach(podInfo cns.KubernetesPodInfo, dockerContainerid string, netPluginConfig *networkcontainers.NetPluginConfiguration) error {
+	return nil
+}
+
+func TestRemoveNetworkContainer(t *testing.T) {
+	fmt.Println("Test: removeNetworkContainer")
+
+	nc := &fakeNetworkContainerApi{deleteErr: fmt.Errorf("interface busy")}
+	svc := &HTTPRestService{
+		state:            &httpRestServiceState{OrchestratorType: cns.Kubernetes},
+		networkContainer: nc,
+	}
+
+	req := cns.CreateNetworkContainerRequest{
+		Version:              "1",
+		NetworkContainerType: cns.WebApps,
+		NetworkContainerid:   "nc",
+	}
+
+	svc.state.ContainerStatus = map[string]containerstatus{
+		"nc": {
+			ID:                            "nc",
+			VMVersion:                     "1",
+			State:                         cns.NetworkContainerStateProgramming,
+			CreateNetworkContainerRequest: req,
+		},
+	}
+
+	// A network container failing to be deleted returns to its previous state.
+	if returnCode, _ := svc.removeNetworkContainer("nc"); returnCode != UnexpectedError {
+		t.Fatalf("Unexpected return code %d", returnCode)
+	}
+
+	status, ok := svc.state.ContainerStatus["nc"]
+	if !ok || status.State != cns.NetworkContainerStateProgramming || status.LastError != "interface busy" {
+		t.Fatalf("Unexpected network container after failed delete %+v", status)
+	}
+
+	if statuses := svc.getNetworkContainersToReconcile(time.Now()); len(statuses) != 1 {
+		t.Errorf("Network container not reconciled after failed delete %+v", statuses)
+	}
+
+	nc.deleteErr = nil
+	if returnCode, message := svc.removeNetworkContainer("nc"); returnCode != 0 {
+		t.Fatalf("removeNetworkContainer failed %d %s", returnCode, message)
+	}
+
+	if _, ok = svc.state.ContainerStatus["nc"]; ok {
+		t.Errorf("Network container not removed")
+	}
+}
+
 func TestGetInterfaceForNetworkContainer(t *testing.T) {
 	// requires more than 30 seconds to run
 	fmt.Println("Test: TestCreateNetworkContainer")
@@ -749,3 +925,105 @@ func TestGetNumOfCPUCores(t *testing.T) {
 		fmt.Printf("getNumberOfCPUCores Responded with %+v\n", numOfCoresResponse)
 	}
 }
+
+func TestGetHealthReport(t *testing.T) {
+	fmt.Println("Test: getHealthReport")
+
+	req, err := http.NewRequest(http.MethodGet, cns.GetHealthReportPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var healthReport cns.HealthReportResponse
+	err = decodeResponse(w, &healthReport)
+	if err != nil || healthReport.Response.ReturnCode != 0 || healthReport.NetworkContainerCounts == nil {
+		t.Errorf("getHealthReport failed with response %+v", healthReport)
+	} else {
+		fmt.Printf("getHealthReport Responded with %+v\n", healthReport)
+	}
+
+	if healthReport.Healthy && !healthReport.Store.Healthy {
+		t.Errorf("getHealthReport reported healthy with an unhealthy store %+v", healthReport)
+	}
+}
+
+type fakePinger struct {
+	pings int
+	err   error
+}
+
+func (p *fakePinger) Ping() error {
+	p.pings++
+	return p.err
+}
+
+func TestHealthChecker(t *testing.T) {
+	fmt.Println("Test: healthChecker")
+
+	imds := &fakePinger{}
+	docker := &fakePinger{err: fmt.Errorf("docker not running")}
+	checker := newHealthChecker(imds, docker)
+
+	if imdsHealth, _ := checker.getHealth(); imdsHealth.Healthy {
+		t.Errorf("Component reported healthy before being checked %+v", imdsHealth)
+	}
+
+	checker.check()
+
+	imdsHealth, dockerHealth := checker.getHealth()
+	if !imdsHealth.Healthy || dockerHealth.Healthy || dockerHealth.Message != "docker not running" {
+		t.Errorf("Unexpected health imds:%+v docker:%+v", imdsHealth, dockerHealth)
+	}
+
+	// Reading the health does not ping the components again.
+	checker.getHealth()
+	if imds.pings != 1 || docker.pings != 1 {
+		t.Errorf("Components pinged %v and %v times, expected once", imds.pings, docker.pings)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	fmt.Println("Test: metrics")
+
+	req, err := http.NewRequest(http.MethodGet, cns.NumberOfCPUCoresPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := requestCount.Get(cns.NumberOfCPUCoresPath, "0")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	if count := requestCount.Get(cns.NumberOfCPUCoresPath, "0"); count != before+1 {
+		t.Errorf("Request to %s was not counted, expected %v, got %v", cns.NumberOfCPUCoresPath, before+1, count)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, cns.MetricsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	expected := `cns_requests_total{handler="` + cns.NumberOfCPUCoresPath + `",return_code="0"}`
+	if !bytes.Contains(w.Body.Bytes(), []byte(expected)) {
+		t.Errorf("Metrics do not contain %s:\n%s", expected, w.Body.String())
+	}
+}
+
+func TestGetReturnCode(t *testing.T) {
+	testCases := map[string]int{
+		`{"ReturnCode":14,"Message":""}`:          NotFound,
+		`{"Response":{"ReturnCode":2},"Other":1}`: InvalidParameter,
+		`not json`: UnexpectedError,
+	}
+
+	for body, expected := range testCases {
+		if returnCode := getReturnCode([]byte(body)); returnCode != expected {
+			t.Errorf("getReturnCode(%s) returned %d, expected %d", body, returnCode, expected)
+		}
+	}
+}
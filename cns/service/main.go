@@ -18,7 +18,6 @@ import (
 	acn "github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
-	"github.com/Azure/azure-container-networking/store"
 	"github.com/Azure/azure-container-networking/telemetry"
 )
 
@@ -89,6 +88,17 @@ var args = acn.ArgumentList{
 		Type:         "string",
 		DefaultValue: "",
 	},
+	{
+		Name:         acn.OptLogFormat,
+		Shorthand:    acn.OptLogFormatAlias,
+		Description:  "Set the logging format",
+		Type:         "int",
+		DefaultValue: acn.OptLogFormatText,
+		ValueMap: map[string]interface{}{
+			acn.OptLogFormatText: log.FormatText,
+			acn.OptLogFormatJSON: log.FormatJSON,
+		},
+	},
 	{
 		Name:         acn.OptIpamQueryUrl,
 		Shorthand:    acn.OptIpamQueryUrlAlias,
@@ -145,6 +155,17 @@ var args = acn.ArgumentList{
 		Type:         "string",
 		DefaultValue: "",
 	},
+	{
+		Name:         acn.OptStoreBackend,
+		Shorthand:    acn.OptStoreBackendAlias,
+		Description:  "Set the persistent store backend",
+		Type:         "string",
+		DefaultValue: acn.OptStoreBackendJson,
+		ValueMap: map[string]interface{}{
+			acn.OptStoreBackendJson:    0,
+			acn.OptStoreBackendJournal: 0,
+		},
+	},
 	{
 		Name:         acn.OptTelemetry,
 		Shorthand:    acn.OptTelemetryAlias,
@@ -173,12 +194,14 @@ func main() {
 	logLevel := acn.GetArg(acn.OptLogLevel).(int)
 	logTarget := acn.GetArg(acn.OptLogTarget).(int)
 	logDirectory := acn.GetArg(acn.OptLogLocation).(string)
+	logFormat := acn.GetArg(acn.OptLogFormat).(int)
 	ipamQueryUrl, _ := acn.GetArg(acn.OptIpamQueryUrl).(string)
 	ipamQueryInterval, _ := acn.GetArg(acn.OptIpamQueryInterval).(int)
 	startCNM := acn.GetArg(acn.OptStartAzureCNM).(bool)
 	vers := acn.GetArg(acn.OptVersion).(bool)
 	createDefaultExtNetworkType := acn.GetArg(acn.OptCreateDefaultExtNetworkType).(string)
 	telemetryEnabled := acn.GetArg(acn.OptTelemetry).(bool)
+	storeBackend := acn.GetArg(acn.OptStoreBackend).(string)
 
 	if vers {
 		printVersion()
@@ -197,6 +220,7 @@ func main() {
 	// Create logging provider.
 	log.SetName(name)
 	log.SetLevel(logLevel)
+	log.SetFormat(logFormat)
 	if logDirectory != "" {
 		log.SetLogDirectory(logDirectory)
 	}
@@ -222,7 +246,7 @@ func main() {
 	}
 
 	// Create the key value store.
-	config.Store, err = store.NewJsonFileStore(platform.CNMRuntimePath + name + ".json")
+	config.Store, err = acn.NewStore(storeBackend, platform.CNMRuntimePath+name+".json")
 	if err != nil {
 		log.Errorf("Failed to create store: %v\n", err)
 		return
@@ -273,6 +297,7 @@ func main() {
 	if startCNM {
 		var pluginConfig acn.PluginConfig
 		pluginConfig.Version = version
+		pluginConfig.StoreBackend = storeBackend
 
 		// Create a channel to receive unhandled errors from the plugins.
 		pluginConfig.ErrChan = make(chan error, 1)
@@ -292,7 +317,7 @@ func main() {
 		}
 
 		// Create the key value store.
-		pluginConfig.Store, err = store.NewJsonFileStore(platform.CNMRuntimePath + pluginName + ".json")
+		pluginConfig.Store, err = acn.NewStore(pluginConfig.StoreBackend, platform.CNMRuntimePath+pluginName+".json")
 		if err != nil {
 			log.Errorf("Failed to create store: %v\n", err)
 			return
@@ -323,7 +348,7 @@ func main() {
 	// Wait until receiving a signal.
 	select {
 	case sig := <-osSignalChannel:
-		log.Printf("CNS Received OS signal <" + sig.String() + ">, shutting down.")
+		log.Printf("CNS Received OS signal <%v>, shutting down.", sig)
 	case err := <-config.ErrChan:
 		log.Printf("CNS Received unhandled error %v, shutting down.", err)
 	}
@@ -10,6 +10,7 @@ const (
 	OptEnvironmentAlias = "e"
 	OptEnvironmentAzure = "azure"
 	OptEnvironmentMAS   = "mas"
+	OptEnvironmentFile  = "file"
 
 	// API server URL.
 	OptAPIServerURL      = "api-url"
@@ -36,6 +37,12 @@ const (
 	OptLogLocation      = "log-location"
 	OptLogLocationAlias = "o"
 
+	// Logging format.
+	OptLogFormat      = "log-format"
+	OptLogFormatAlias = "lf"
+	OptLogFormatText  = "text"
+	OptLogFormatJSON  = "json"
+
 	// IPAM query URL.
 	OptIpamQueryUrl      = "ipam-query-url"
 	OptIpamQueryUrlAlias = "q"
@@ -44,6 +51,17 @@ const (
 	OptIpamQueryInterval      = "ipam-query-interval"
 	OptIpamQueryIntervalAlias = "i"
 
+	// IPAM configuration file.
+	OptIpamConfigFile      = "ipam-config-file"
+	OptIpamConfigFileAlias = "ipamconfig"
+
+	// IPAM address reuse cooldown.
+	OptIpamReuseCooldown      = "ipam-reuse-cooldown"
+	OptIpamReuseCooldownAlias = "ipamcooldown"
+
+	// IPAM container runtime queried to reclaim addresses of removed containers.
+	OptIpamContainerRuntime = "ipam-container-runtime"
+
 	// Start CNM
 	OptStartAzureCNM      = "start-azure-cnm"
 	OptStartAzureCNMAlias = "startcnm"
@@ -79,4 +97,14 @@ const (
 	// Disable Telemetry
 	OptTelemetry      = "telemetry"
 	OptTelemetryAlias = "dt"
+
+	// Persistent store backend.
+	OptStoreBackend        = "store-backend"
+	OptStoreBackendAlias   = "sb"
+	OptStoreBackendJson    = "json"
+	OptStoreBackendJournal = "journal"
+
+	// Print changes instead of making them.
+	OptDryRun      = "dry-run"
+	OptDryRunAlias = "dr"
 )
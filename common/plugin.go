@@ -27,6 +27,7 @@ type PluginApi interface {
 // Network internal interface.
 type NetApi interface {
 	AddExternalInterface(ifName string, subnet string) error
+	EndpointExists(endpointId string) bool
 }
 
 // IPAM internal interface.
@@ -35,12 +36,13 @@ type IpamApi interface {
 
 // Plugin common configuration.
 type PluginConfig struct {
-	Version  string
-	NetApi   NetApi
-	IpamApi  IpamApi
-	Listener *Listener
-	ErrChan  chan error
-	Store    store.KeyValueStore
+	Version      string
+	NetApi       NetApi
+	IpamApi      IpamApi
+	Listener     *Listener
+	ErrChan      chan error
+	Store        store.KeyValueStore
+	StoreBackend string
 }
 
 // NewPlugin creates a new Plugin object.
@@ -52,6 +54,19 @@ func NewPlugin(name, version string) (*Plugin, error) {
 	}, nil
 }
 
+// NewStore creates a persistent store of the given backend backed by the given file.
+// The JSON file backend is used if no backend is specified.
+func NewStore(backend string, fileName string) (store.KeyValueStore, error) {
+	switch backend {
+	case "", OptStoreBackendJson:
+		return store.NewJsonFileStore(fileName)
+	case OptStoreBackendJournal:
+		return store.NewJournalFileStore(fileName)
+	default:
+		return nil, store.ErrInvalidBackend
+	}
+}
+
 // Initialize initializes the plugin.
 func (plugin *Plugin) Initialize(config *PluginConfig) error {
 	plugin.ErrChan = config.ErrChan
@@ -5,12 +5,11 @@ package ebtables
 
 import (
 	"fmt"
-	"io/ioutil"
 	"net"
-	"os/exec"
 	"strings"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/rules"
 )
 
 const (
@@ -19,82 +18,112 @@ const (
 	Delete = "-D"
 )
 
-// InstallEbtables installs the ebtables package.
-func installEbtables() {
-	version, _ := ioutil.ReadFile("/proc/version")
-	os := strings.ToLower(string(version))
-
-	if strings.Contains(os, "ubuntu") {
-		executeShellCommand("apt-get install ebtables")
-	} else if strings.Contains(os, "redhat") {
-		executeShellCommand("yum install ebtables")
-	} else {
-		log.Printf("Unable to detect OS platform. Please make sure the ebtables package is installed.")
-	}
-}
+const (
+	// Ebtables tables and chains.
+	Nat         = "nat"
+	Prerouting  = "PREROUTING"
+	Postrouting = "POSTROUTING"
+)
 
 // SetSnatForInterface sets a MAC SNAT rule for an interface.
 func SetSnatForInterface(interfaceName string, macAddress net.HardwareAddr, action string) error {
-	command := fmt.Sprintf(
-		"ebtables -t nat %s POSTROUTING -s unicast -o %s -j snat --to-src %s --snat-arp --snat-target ACCEPT",
-		action, interfaceName, macAddress.String())
+	spec := fmt.Sprintf(
+		"-s unicast -o %s -j snat --to-src %s --snat-arp --snat-target ACCEPT",
+		interfaceName, macAddress.String())
 
-	return executeShellCommand(command)
+	return apply(Postrouting, spec, action)
 }
 
 // SetArpReply sets an ARP reply rule for the given target IP address and MAC address.
 func SetArpReply(ipAddress net.IP, macAddress net.HardwareAddr, action string) error {
-	command := fmt.Sprintf(
-		"ebtables -t nat %s PREROUTING -p ARP --arp-op Request --arp-ip-dst %s -j arpreply --arpreply-mac %s --arpreply-target DROP",
-		action, ipAddress, macAddress.String())
+	spec := fmt.Sprintf(
+		"-p ARP --arp-op Request --arp-ip-dst %s -j arpreply --arpreply-mac %s --arpreply-target DROP",
+		ipAddress, macAddress.String())
 
-	return executeShellCommand(command)
+	return apply(Prerouting, spec, action)
 }
 
 // SetDnatForArpReplies sets a MAC DNAT rule for ARP replies received on an interface.
 func SetDnatForArpReplies(interfaceName string, action string) error {
-	command := fmt.Sprintf(
-		"ebtables -t nat %s PREROUTING -p ARP -i %s --arp-op Reply -j dnat --to-dst ff:ff:ff:ff:ff:ff --dnat-target ACCEPT",
-		action, interfaceName)
+	spec := fmt.Sprintf(
+		"-p ARP -i %s --arp-op Reply -j dnat --to-dst ff:ff:ff:ff:ff:ff --dnat-target ACCEPT",
+		interfaceName)
 
-	return executeShellCommand(command)
+	return apply(Prerouting, spec, action)
 }
 
 // SetVepaMode sets the VEPA mode for a bridge and its ports.
 func SetVepaMode(bridgeName string, downstreamIfNamePrefix string, upstreamMacAddress string, action string) error {
 	if !strings.HasPrefix(bridgeName, downstreamIfNamePrefix) {
-		command := fmt.Sprintf(
-			"ebtables -t nat %s PREROUTING -i %s -j dnat --to-dst %s --dnat-target ACCEPT",
-			action, bridgeName, upstreamMacAddress)
+		spec := fmt.Sprintf(
+			"-i %s -j dnat --to-dst %s --dnat-target ACCEPT",
+			bridgeName, upstreamMacAddress)
 
-		err := executeShellCommand(command)
+		err := apply(Prerouting, spec, action)
 		if err != nil {
 			return err
 		}
 	}
 
-	command := fmt.Sprintf(
-		"ebtables -t nat %s PREROUTING -i %s+ -j dnat --to-dst %s --dnat-target ACCEPT",
-		action, downstreamIfNamePrefix, upstreamMacAddress)
+	spec := fmt.Sprintf(
+		"-i %s+ -j dnat --to-dst %s --dnat-target ACCEPT",
+		downstreamIfNamePrefix, upstreamMacAddress)
 
-	return executeShellCommand(command)
+	return apply(Prerouting, spec, action)
 }
 
 // SetDnatForIPAddress sets a MAC DNAT rule for an IP address.
 func SetDnatForIPAddress(interfaceName string, ipAddress net.IP, macAddress net.HardwareAddr, action string) error {
-	command := fmt.Sprintf(
-		"ebtables -t nat %s PREROUTING -p IPv4 -i %s --ip-dst %s -j dnat --to-dst %s --dnat-target ACCEPT",
-		action, interfaceName, ipAddress.String(), macAddress.String())
+	protocol, dstMatch := "IPv4", "--ip-dst"
+	if ipAddress.To4() == nil {
+		protocol, dstMatch = "IPv6", "--ip6-dst"
+	}
+
+	spec := fmt.Sprintf(
+		"-p %s -i %s %s %s -j dnat --to-dst %s --dnat-target ACCEPT",
+		protocol, interfaceName, dstMatch, ipAddress.String(), macAddress.String())
+
+	return apply(Prerouting, spec, action)
+}
+
+// SetVlanDrop sets a rule dropping VLAN tagged frames.
+// The rule is not added again if it already exists.
+func SetVlanDrop(action string) error {
+	rule := newRule(Prerouting, "-p 802_1Q -j DROP")
+
+	if action == Append {
+		if exists, _ := rules.GetBackend().Exists(rule); exists {
+			log.Printf("[ebtables] VLAN drop rule already exists.")
+			return nil
+		}
+	}
+
+	return applyRule(rule, action)
+}
+
+// Creates an ebtables rule in the nat table.
+func newRule(chain string, spec string) *rules.Rule {
+	return &rules.Rule{
+		Type:  rules.Ebtables,
+		Table: Nat,
+		Chain: chain,
+		Spec:  spec,
+	}
+}
 
-	return executeShellCommand(command)
+// Appends or deletes an ebtables rule in the nat table.
+func apply(chain string, spec string, action string) error {
+	return applyRule(newRule(chain, spec), action)
 }
 
-func executeShellCommand(command string) error {
-	log.Debugf("[ebtables] %s", command)
-	cmd := exec.Command("sh", "-c", command)
-	err := cmd.Start()
-	if err != nil {
-		return err
+// Appends or deletes an ebtables rule.
+func applyRule(rule *rules.Rule, action string) error {
+	switch action {
+	case Append:
+		return rules.GetBackend().Add(rule)
+	case Delete:
+		return rules.GetBackend().Delete(rule)
+	default:
+		return fmt.Errorf("Invalid ebtables action %v", action)
 	}
-	return cmd.Wait()
 }
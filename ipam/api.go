@@ -30,4 +30,10 @@ var (
 	OptAddressID          = "azure.address.id"
 	OptAddressType        = "azure.address.type"
 	OptAddressTypeGateway = "gateway"
+
+	// Options identifying the owner of an address.
+	OptAddressContainerID  = "azure.address.containerid"
+	OptAddressNetNsPath    = "azure.address.netns"
+	OptAddressPodName      = "azure.address.podname"
+	OptAddressPodNamespace = "azure.address.podnamespace"
 )
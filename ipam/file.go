@@ -0,0 +1,342 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/common"
+	"github.com/Azure/azure-container-networking/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultLinuxConfigFilePath   = "/etc/kubernetes/azure-vnet-ipam.json"
+	defaultWindowsConfigFilePath = `c:\k\azure-vnet-ipam.json`
+
+	// Maximum number of addresses enumerated from a pool subnet when addresses are not listed.
+	maxPoolSubnetAddresses = 65536
+
+	localScopeName  = "local"
+	globalScopeName = "global"
+)
+
+// Declarative IPAM configuration source, read from a JSON or YAML file.
+type fileSource struct {
+	name         string
+	sink         addressConfigSink
+	filePath     string
+	modTime      time.Time
+	size         int64
+	addrSpaceIds map[string]int
+}
+
+// FileConfig is the format of the IPAM configuration file.
+type FileConfig struct {
+	AddressSpaces []FileAddressSpace `json:"addressSpaces"`
+}
+
+// FileAddressSpace is an address space of the IPAM configuration file.
+// Address spaces default to the local default address space.
+type FileAddressSpace struct {
+	Id    string     `json:"id,omitempty"`
+	Scope string     `json:"scope,omitempty"`
+	Pools []FilePool `json:"pools"`
+}
+
+// FilePool is an address pool of the IPAM configuration file. Addresses and reserved addresses are
+// lists of addresses or address ranges, such as 10.0.0.4-10.0.0.20. When addresses are not listed,
+// every address of the subnet but the network, broadcast and gateway addresses is available.
+type FilePool struct {
+	Subnet    string   `json:"subnet"`
+	Interface string   `json:"interface,omitempty"`
+	Priority  int      `json:"priority,omitempty"`
+	Gateway   string   `json:"gateway,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	Reserved  []string `json:"reserved,omitempty"`
+}
+
+// Creates the file source.
+func newFileSource(options map[string]interface{}) (*fileSource, error) {
+	filePath, _ := options[common.OptIpamConfigFile].(string)
+	if filePath == "" {
+		if runtime.GOOS == windows {
+			filePath = defaultWindowsConfigFilePath
+		} else {
+			filePath = defaultLinuxConfigFilePath
+		}
+	}
+
+	return &fileSource{
+		name:         "File",
+		filePath:     filePath,
+		addrSpaceIds: make(map[string]int),
+	}, nil
+}
+
+// Starts the file source.
+func (s *fileSource) start(sink addressConfigSink) error {
+	s.sink = sink
+	return nil
+}
+
+// Stops the file source.
+func (s *fileSource) stop() {
+	s.sink = nil
+}
+
+// Refreshes configuration. The file is read again only when it has changed since the last refresh.
+func (s *fileSource) refresh() error {
+	info, err := os.Stat(s.filePath)
+	if err != nil {
+		return err
+	}
+
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.filePath)
+	if err != nil {
+		return err
+	}
+
+	config, err := parseFileConfig(data)
+	if err != nil {
+		return err
+	}
+
+	addrSpaces, err := s.newAddressSpaces(config)
+	if err != nil {
+		return err
+	}
+
+	// Address spaces removed from the file are emptied. Pools in use are deleted after they are released.
+	for id, scope := range s.addrSpaceIds {
+		if _, ok := addrSpaces[id]; !ok {
+			as, err := s.sink.newAddressSpace(id, scope)
+			if err != nil {
+				return err
+			}
+			addrSpaces[id] = as
+		}
+	}
+
+	s.addrSpaceIds = make(map[string]int)
+	for id, as := range addrSpaces {
+		if len(as.Pools) > 0 {
+			s.addrSpaceIds[id] = as.Scope
+		}
+
+		if err = s.sink.setAddressSpace(as); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[ipam] Address spaces successfully populated from config file %v.", s.filePath)
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+
+	return nil
+}
+
+// parseFileConfig parses an IPAM configuration file in JSON or YAML format.
+func parseFileConfig(data []byte) (*FileConfig, error) {
+	config := &FileConfig{}
+	if err := yaml.Unmarshal(bytes.TrimSpace(data), config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// newAddressSpaces returns the address spaces of the configuration, keyed by ID.
+func (s *fileSource) newAddressSpaces(config *FileConfig) (map[string]*addressSpace, error) {
+	addrSpaces := make(map[string]*addressSpace)
+
+	for _, fas := range config.AddressSpaces {
+		scope, err := parseScope(fas.Scope)
+		if err != nil {
+			return nil, err
+		}
+
+		id := fas.Id
+		if id == "" {
+			if scope == GlobalScope {
+				id = GlobalDefaultAddressSpaceId
+			} else {
+				id = LocalDefaultAddressSpaceId
+			}
+		}
+
+		as := addrSpaces[id]
+		if as == nil {
+			if as, err = s.sink.newAddressSpace(id, scope); err != nil {
+				return nil, err
+			}
+			addrSpaces[id] = as
+		} else if as.Scope != scope {
+			return nil, fmt.Errorf("Address space %v has conflicting scopes", id)
+		}
+
+		for _, fp := range fas.Pools {
+			if err = populateFilePool(as, &fp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return addrSpaces, nil
+}
+
+// populateFilePool adds a pool of the configuration file to an address space.
+func populateFilePool(as *addressSpace, fp *FilePool) error {
+	_, subnet, err := net.ParseCIDR(fp.Subnet)
+	if err != nil {
+		return fmt.Errorf("Invalid subnet %v: %v", fp.Subnet, err)
+	}
+
+	ap, err := as.newAddressPool(fp.Interface, fp.Priority, subnet)
+	if err != nil {
+		return fmt.Errorf("Failed to create pool %v: %v", fp.Subnet, err)
+	}
+
+	if fp.Gateway != "" {
+		gateway := net.ParseIP(fp.Gateway)
+		if gateway == nil || !subnet.Contains(gateway) {
+			return fmt.Errorf("Invalid gateway %v for subnet %v", fp.Gateway, fp.Subnet)
+		}
+		ap.Gateway = gateway
+	}
+
+	reserved := map[string]bool{ap.Gateway.String(): true}
+	for _, r := range fp.Reserved {
+		addresses, err := parseAddressRange(r, subnet, maxPoolSubnetAddresses)
+		if err != nil {
+			return err
+		}
+		for _, address := range addresses {
+			reserved[address.String()] = true
+		}
+	}
+
+	var addresses []net.IP
+	if len(fp.Addresses) == 0 {
+		addresses, err = parseAddressRange(subnet.String(), subnet, maxPoolSubnetAddresses)
+		if err != nil {
+			return err
+		}
+		// Skip the network and broadcast addresses.
+		if len(addresses) > 2 {
+			addresses = addresses[1 : len(addresses)-1]
+		}
+	} else {
+		for _, a := range fp.Addresses {
+			rangeAddresses, err := parseAddressRange(a, subnet, maxPoolSubnetAddresses)
+			if err != nil {
+				return err
+			}
+			addresses = append(addresses, rangeAddresses...)
+		}
+	}
+
+	for _, address := range addresses {
+		if reserved[address.String()] {
+			continue
+		}
+
+		if _, err = ap.newAddressRecord(&address); err != nil && err != errAddressExists {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseScope returns the scope of an address space. Address spaces are local by default.
+func parseScope(scope string) (int, error) {
+	switch strings.ToLower(scope) {
+	case "", localScopeName:
+		return LocalScope, nil
+	case globalScopeName:
+		return GlobalScope, nil
+	}
+
+	return 0, fmt.Errorf("Invalid address space scope %v", scope)
+}
+
+// parseAddressRange returns the addresses of an address, an address range such as 10.0.0.4-10.0.0.20,
+// or a subnet. All addresses must belong to the given subnet, and there can be at most limit addresses.
+func parseAddressRange(r string, subnet *net.IPNet, limit int) ([]net.IP, error) {
+	var first, last net.IP
+
+	if _, rangeSubnet, err := net.ParseCIDR(r); err == nil {
+		first = rangeSubnet.IP
+		last = make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^rangeSubnet.Mask[i]
+		}
+	} else if bounds := strings.SplitN(r, "-", 2); len(bounds) == 2 {
+		first = net.ParseIP(strings.TrimSpace(bounds[0]))
+		last = net.ParseIP(strings.TrimSpace(bounds[1]))
+	} else {
+		first = net.ParseIP(strings.TrimSpace(r))
+		last = first
+	}
+
+	if first == nil || last == nil || !subnet.Contains(first) || !subnet.Contains(last) {
+		return nil, fmt.Errorf("Invalid address range %v for subnet %v", r, subnet)
+	}
+
+	start, end := ipToInt(first), ipToInt(last)
+	if start.Cmp(end) > 0 {
+		return nil, fmt.Errorf("Invalid address range %v", r)
+	}
+
+	count := new(big.Int).Sub(end, start)
+	if count.Cmp(big.NewInt(int64(limit))) >= 0 {
+		return nil, fmt.Errorf("Address range %v exceeds %v addresses", r, limit)
+	}
+
+	v6 := first.To4() == nil
+	var addresses []net.IP
+	for i := start; i.Cmp(end) <= 0; i = new(big.Int).Add(i, big.NewInt(1)) {
+		addresses = append(addresses, intToIP(i, v6))
+	}
+
+	return addresses, nil
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	if ip4 := ip.To4(); ip4 != nil {
+		return new(big.Int).SetBytes(ip4)
+	}
+
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func intToIP(i *big.Int, v6 bool) net.IP {
+	size := net.IPv4len
+	if v6 {
+		size = net.IPv6len
+	}
+
+	b := i.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+
+	if !v6 {
+		return net.IPv4(ip[0], ip[1], ip[2], ip[3])
+	}
+
+	return ip
+}
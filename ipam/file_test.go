@@ -0,0 +1,131 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/common"
+)
+
+func getPoolAddresses(ap *addressPool) []string {
+	var addresses []string
+	for address := range ap.Addresses {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+func TestFileSourceRefresh(t *testing.T) {
+	data, err := ioutil.ReadFile("testfiles/ipamConfig.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "ipam")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "ipam.yaml")
+	if err = ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	am := &addressManager{AddrSpaces: make(map[string]*addressSpace)}
+	source, _ := newFileSource(map[string]interface{}{common.OptIpamConfigFile: filePath})
+	source.start(am)
+
+	if err = source.refresh(); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	local := am.AddrSpaces[LocalDefaultAddressSpaceId]
+	if local == nil || local.Scope != LocalScope || len(local.Pools) != 2 {
+		t.Fatalf("Unexpected local address space %+v", local)
+	}
+
+	ap := local.Pools["10.0.1.0/24"]
+	expected := []string{"10.0.1.4", "10.0.1.6", "10.0.1.7", "10.0.1.8"}
+	if ap.IfName != "eth0" || !ap.Gateway.Equal(net.ParseIP("10.0.1.254")) ||
+		!reflect.DeepEqual(getPoolAddresses(ap), expected) {
+		t.Errorf("Unexpected pool %+v with addresses %v", ap, getPoolAddresses(ap))
+	}
+
+	ap = local.Pools["10.0.2.0/29"]
+	expected = []string{"10.0.2.2", "10.0.2.3", "10.0.2.4", "10.0.2.5", "10.0.2.6"}
+	if ap.Priority != 1 || !reflect.DeepEqual(getPoolAddresses(ap), expected) {
+		t.Errorf("Unexpected pool %+v with addresses %v", ap, getPoolAddresses(ap))
+	}
+
+	global := am.AddrSpaces["cluster"]
+	if global == nil || global.Scope != GlobalScope {
+		t.Fatalf("Unexpected global address space %+v", global)
+	}
+
+	ap = global.Pools["fd00::/120"]
+	expected = []string{"fd00::4", "fd00::5"}
+	if ap == nil || !ap.IsIPv6 || !reflect.DeepEqual(getPoolAddresses(ap), expected) {
+		t.Errorf("Unexpected pool %+v", ap)
+	}
+
+	// Changes to the file are applied on the next refresh.
+	config := `{"addressSpaces": [{"pools": [{"subnet": "10.0.1.0/24", "addresses": ["10.0.1.9"]}]}]}`
+	if err = ioutil.WriteFile(filePath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filePath, later, later)
+
+	if err = source.refresh(); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	if len(local.Pools) != 1 || !reflect.DeepEqual(getPoolAddresses(local.Pools["10.0.1.0/24"]), []string{"10.0.1.9"}) {
+		t.Errorf("Unexpected local address space after update %+v", local)
+	}
+
+	if len(global.Pools) != 0 {
+		t.Errorf("Unexpected global address space after update %+v", global)
+	}
+}
+
+func TestParseAddressRange(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+
+	tests := []struct {
+		r         string
+		addresses int
+		valid     bool
+	}{
+		{"10.0.0.4", 1, true},
+		{"10.0.0.4-10.0.0.7", 4, true},
+		{"10.0.0.0/30", 4, true},
+		{"10.0.0.7-10.0.0.4", 0, false},
+		{"10.0.1.4", 0, false},
+		{"10.0.0.4-10.0.1.4", 0, false},
+		{"invalid", 0, false},
+	}
+
+	for _, test := range tests {
+		addresses, err := parseAddressRange(test.r, subnet, 16)
+		if (err == nil) != test.valid || len(addresses) != test.addresses {
+			t.Errorf("Unexpected result for %v: %v, %v", test.r, addresses, err)
+		}
+	}
+
+	if _, err := parseAddressRange("10.0.0.0/24", subnet, 16); err == nil {
+		t.Errorf("Address range exceeding the limit was accepted")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"bytes"
+	"container/list"
+	"sort"
+	"time"
+)
+
+// Returns whether an address record is available for allocation.
+func (ar *addressRecord) isFree() bool {
+	return !ar.InUse && ar.ID == ""
+}
+
+// Returns the list of available addresses of the address pool, building it if necessary.
+// Addresses that were never used come first in address order, followed by released addresses,
+// least recently released first.
+func (ap *addressPool) getFreeAddresses() *list.List {
+	if ap.free != nil {
+		return ap.free
+	}
+
+	var records []*addressRecord
+	for _, ar := range ap.Addresses {
+		ar.freeElem = nil
+		if ar.isFree() {
+			records = append(records, ar)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return isFreeBefore(records[i], records[j])
+	})
+
+	ap.free = list.New()
+	for _, ar := range records {
+		ar.freeElem = ap.free.PushBack(ar)
+	}
+
+	return ap.free
+}
+
+// Returns whether an available address comes before another one in the list of available addresses.
+func isFreeBefore(a *addressRecord, b *addressRecord) bool {
+	if !a.ReleaseTime.Equal(b.ReleaseTime) {
+		return a.ReleaseTime.Before(b.ReleaseTime)
+	}
+
+	return bytes.Compare(a.Addr.To16(), b.Addr.To16()) < 0
+}
+
+// Returns the next available address whose cooldown has expired, or nil if there is none.
+func (ap *addressPool) getFreeAddress(cooldown time.Duration, now time.Time) *addressRecord {
+	e := ap.getFreeAddresses().Front()
+	if e == nil {
+		return nil
+	}
+
+	// Addresses are ordered by release time, so no other address is past its cooldown either.
+	ar := e.Value.(*addressRecord)
+	if !ar.ReleaseTime.IsZero() && now.Sub(ar.ReleaseTime) < cooldown {
+		return nil
+	}
+
+	return ar
+}
+
+// Inserts an available address in order in the list of available addresses. Released addresses
+// are the most recently released ones, so the list is searched from the end.
+func (ap *addressPool) addFreeAddress(ar *addressRecord) {
+	if ap.free == nil || ar.freeElem != nil || !ar.isFree() {
+		return
+	}
+
+	for e := ap.free.Back(); e != nil; e = e.Prev() {
+		if !isFreeBefore(ar, e.Value.(*addressRecord)) {
+			ar.freeElem = ap.free.InsertAfter(ar, e)
+			return
+		}
+	}
+
+	ar.freeElem = ap.free.PushFront(ar)
+}
+
+// Removes an allocated or deleted address from the list of available addresses.
+func (ap *addressPool) removeFreeAddress(ar *addressRecord) {
+	if ar.freeElem == nil {
+		return
+	}
+
+	if ap.free != nil {
+		ap.free.Remove(ar.freeElem)
+	}
+	ar.freeElem = nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/store"
+)
+
+// Creates an address pool with the given number of addresses.
+func createFreeListPool(count int) *addressPool {
+	am := &addressManager{AddrSpaces: make(map[string]*addressSpace)}
+	as, _ := am.newAddressSpace(LocalDefaultAddressSpaceId, LocalScope)
+	am.AddrSpaces[as.Id] = as
+
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+	ap, _ := as.newAddressPool("eth0", 0, subnet)
+	for i := count; i > 0; i-- {
+		addr := net.IPv4(10, 0, 0, byte(i))
+		ap.newAddressRecord(&addr)
+	}
+
+	return ap
+}
+
+func requestTestAddress(t *testing.T, ap *addressPool, cooldown time.Duration) string {
+	address, err := ap.requestAddress("", nil, cooldown)
+	if err != nil {
+		t.Fatalf("requestAddress failed, err:%v.", err)
+	}
+
+	addr, _, _ := net.ParseCIDR(address)
+	return addr.String()
+}
+
+// Tests addresses are allocated in address order, and released addresses are reused least recently released first.
+func TestFreeAddressOrder(t *testing.T) {
+	ap := createFreeListPool(4)
+
+	for _, expected := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if address := requestTestAddress(t, ap, 0); address != expected {
+			t.Errorf("Expected address %v, got %v.", expected, address)
+		}
+	}
+
+	ap.releaseAddress("10.0.0.2", nil)
+	ap.releaseAddress("10.0.0.1", nil)
+
+	for _, expected := range []string{"10.0.0.4", "10.0.0.2", "10.0.0.1"} {
+		if address := requestTestAddress(t, ap, 0); address != expected {
+			t.Errorf("Expected address %v, got %v.", expected, address)
+		}
+	}
+
+	if _, err := ap.requestAddress("", nil, 0); err != errNoAvailableAddresses {
+		t.Errorf("Expected errNoAvailableAddresses, got %v.", err)
+	}
+}
+
+// Tests released addresses are not reused before the cooldown expires.
+func TestFreeAddressCooldown(t *testing.T) {
+	ap := createFreeListPool(2)
+
+	requestTestAddress(t, ap, time.Minute)
+	requestTestAddress(t, ap, time.Minute)
+	ap.releaseAddress("10.0.0.1", nil)
+
+	if _, err := ap.requestAddress("", nil, time.Minute); err != errNoAvailableAddresses {
+		t.Errorf("Address was reused during the cooldown, err:%v.", err)
+	}
+
+	// A specific address can still be requested during the cooldown.
+	if _, err := ap.requestAddress("10.0.0.1", nil, time.Minute); err != nil {
+		t.Errorf("requestAddress failed, err:%v.", err)
+	}
+	ap.releaseAddress("10.0.0.1", nil)
+
+	ap.Addresses["10.0.0.1"].ReleaseTime = time.Now().Add(-2 * time.Minute)
+	ap.free = nil
+
+	if address := requestTestAddress(t, ap, time.Minute); address != "10.0.0.1" {
+		t.Errorf("Expected address 10.0.0.1 after the cooldown, got %v.", address)
+	}
+}
+
+// Tests the order of released addresses is restored from the persistent store.
+func TestFreeAddressPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipam")
+	if err != nil {
+		t.Fatalf("TempDir failed, err:%v.", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kvs, err := store.NewJsonFileStore(filepath.Join(dir, "ipam.json"))
+	if err != nil {
+		t.Fatalf("NewJsonFileStore failed, err:%v.", err)
+	}
+
+	ap := createFreeListPool(3)
+	am := &addressManager{AddrSpaces: map[string]*addressSpace{ap.as.Id: ap.as}, store: kvs}
+
+	for i := 0; i < 3; i++ {
+		requestTestAddress(t, ap, 0)
+	}
+	ap.releaseAddress("10.0.0.3", nil)
+	ap.releaseAddress("10.0.0.1", nil)
+
+	if err = am.save(); err != nil {
+		t.Fatalf("save failed, err:%v.", err)
+	}
+
+	restored := &addressManager{AddrSpaces: make(map[string]*addressSpace), store: kvs}
+	if err = restored.restore(); err != nil {
+		t.Fatalf("restore failed, err:%v.", err)
+	}
+
+	ap = restored.AddrSpaces[LocalDefaultAddressSpaceId].Pools["10.0.0.0/24"]
+	for _, expected := range []string{"10.0.0.3", "10.0.0.1"} {
+		if address := requestTestAddress(t, ap, 0); address != expected {
+			t.Errorf("Expected address %v, got %v.", expected, address)
+		}
+	}
+}
+
+// Tests merging an address space updates the list of available addresses in place.
+func TestFreeAddressMerge(t *testing.T) {
+	ap := createFreeListPool(4)
+
+	for i := 0; i < 3; i++ {
+		requestTestAddress(t, ap, 0)
+	}
+	ap.releaseAddress("10.0.0.2", nil)
+	free := ap.getFreeAddresses()
+
+	// The source adds 10.0.0.5 and 10.0.0.6 and no longer has 10.0.0.4.
+	newas, _ := (&addressManager{}).newAddressSpace(LocalDefaultAddressSpaceId, LocalScope)
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+	newap, _ := newas.newAddressPool("eth0", 0, subnet)
+	for _, i := range []byte{6, 1, 2, 3, 5} {
+		addr := net.IPv4(10, 0, 0, i)
+		newap.newAddressRecord(&addr)
+	}
+
+	ap.as.merge(newas)
+
+	if ap.free != free {
+		t.Errorf("List of available addresses was rebuilt by the merge.")
+	}
+
+	for _, expected := range []string{"10.0.0.5", "10.0.0.6", "10.0.0.2"} {
+		if address := requestTestAddress(t, ap, 0); address != expected {
+			t.Errorf("Expected address %v, got %v.", expected, address)
+		}
+	}
+
+	if _, err := ap.requestAddress("", nil, 0); err != errNoAvailableAddresses {
+		t.Errorf("Expected errNoAvailableAddresses, got %v.", err)
+	}
+}
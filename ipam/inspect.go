@@ -0,0 +1,165 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"time"
+)
+
+// AddressSpaceDetails contains the state of an address space and all its pools.
+type AddressSpaceDetails struct {
+	Id    string
+	Scope int
+	Epoch int
+	Pools []*AddressPoolDetails
+}
+
+// AddressPoolDetails contains the state of an address pool and all its addresses.
+type AddressPoolDetails struct {
+	Id        string
+	IfName    string
+	Subnet    string
+	Gateway   string
+	IsIPv6    bool
+	Priority  int
+	RefCount  int
+	Epoch     int
+	Available int
+	Capacity  int
+	Addresses []*AddressRecordDetails
+}
+
+// AddressRecordDetails contains the state of an address.
+// An address is orphaned when its ID does not match any endpoint in the network store.
+type AddressRecordDetails struct {
+	Address   string
+	ID        string `json:",omitempty"`
+	InUse     bool
+	Unhealthy bool `json:",omitempty"`
+	Orphaned  bool `json:",omitempty"`
+	Epoch     int
+	Owner     *AddressOwner `json:",omitempty"`
+	LeaseTime *time.Time    `json:",omitempty"`
+}
+
+// GetAddressSpaceDetails returns the state of all address spaces, sorted by ID.
+func (am *addressManager) GetAddressSpaceDetails() []*AddressSpaceDetails {
+	am.Lock()
+	defer am.Unlock()
+
+	var details []*AddressSpaceDetails
+	for _, as := range am.AddrSpaces {
+		details = append(details, as.getDetails(am.isOrphaned))
+	}
+
+	sort.Slice(details, func(i, j int) bool { return details[i].Id < details[j].Id })
+
+	return details
+}
+
+// GetOrphanedAddresses returns the state of all address spaces, pools and addresses
+// that hold orphaned addresses.
+func (am *addressManager) GetOrphanedAddresses() []*AddressSpaceDetails {
+	var orphaned []*AddressSpaceDetails
+
+	for _, as := range am.GetAddressSpaceDetails() {
+		var pools []*AddressPoolDetails
+		for _, ap := range as.Pools {
+			var addresses []*AddressRecordDetails
+			for _, ar := range ap.Addresses {
+				if ar.Orphaned {
+					addresses = append(addresses, ar)
+				}
+			}
+
+			if len(addresses) > 0 {
+				ap.Addresses = addresses
+				pools = append(pools, ap)
+			}
+		}
+
+		if len(pools) > 0 {
+			as.Pools = pools
+			orphaned = append(orphaned, as)
+		}
+	}
+
+	return orphaned
+}
+
+// Returns whether the address is held by an ID with no matching endpoint in the network store.
+func (am *addressManager) isOrphaned(ar *addressRecord) bool {
+	return ar.ID != "" && am.netApi != nil && !am.netApi.EndpointExists(ar.ID)
+}
+
+// Returns the state of the address space.
+func (as *addressSpace) getDetails(isOrphaned func(*addressRecord) bool) *AddressSpaceDetails {
+	details := &AddressSpaceDetails{
+		Id:    as.Id,
+		Scope: as.Scope,
+		Epoch: as.epoch,
+	}
+
+	for _, ap := range as.Pools {
+		details.Pools = append(details.Pools, ap.getDetails(isOrphaned))
+	}
+
+	sort.Slice(details.Pools, func(i, j int) bool { return details.Pools[i].Id < details.Pools[j].Id })
+
+	return details
+}
+
+// Returns the state of the address pool.
+func (ap *addressPool) getDetails(isOrphaned func(*addressRecord) bool) *AddressPoolDetails {
+	info := ap.getInfo()
+
+	details := &AddressPoolDetails{
+		Id:        ap.Id,
+		IfName:    ap.IfName,
+		Subnet:    ap.Subnet.String(),
+		IsIPv6:    ap.IsIPv6,
+		Priority:  ap.Priority,
+		RefCount:  ap.RefCount,
+		Epoch:     ap.epoch,
+		Available: info.Available,
+		Capacity:  info.Capacity,
+	}
+
+	if ap.Gateway != nil {
+		details.Gateway = ap.Gateway.String()
+	}
+
+	for _, ar := range ap.Addresses {
+		ard := &AddressRecordDetails{
+			Address:   ar.Addr.String(),
+			ID:        ar.ID,
+			InUse:     ar.InUse,
+			Unhealthy: ar.unhealthy,
+			Orphaned:  isOrphaned(ar),
+			Epoch:     ar.epoch,
+		}
+
+		if ar.Owner != nil {
+			owner := *ar.Owner
+			ard.Owner = &owner
+		}
+
+		if !ar.LeaseTime.IsZero() {
+			leaseTime := ar.LeaseTime
+			ard.LeaseTime = &leaseTime
+		}
+
+		details.Addresses = append(details.Addresses, ard)
+	}
+
+	sort.Slice(details.Addresses, func(i, j int) bool {
+		a, b := net.ParseIP(details.Addresses[i].Address), net.ParseIP(details.Addresses[j].Address)
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+
+	return details
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"testing"
+)
+
+// Network store that knows a fixed set of endpoints.
+type testNetApi struct {
+	endpoints map[string]bool
+}
+
+func (n *testNetApi) AddExternalInterface(ifName string, subnet string) error {
+	return nil
+}
+
+func (n *testNetApi) EndpointExists(endpointId string) bool {
+	return n.endpoints[endpointId]
+}
+
+// Tests address details are reported for all addresses, and orphaned addresses are detected.
+func TestGetAddressSpaceDetails(t *testing.T) {
+	am, err := createAddressManager()
+	if err != nil {
+		t.Fatalf("createAddressManager failed, err:%+v.", err)
+	}
+	am.(*addressManager).netApi = &testNetApi{endpoints: map[string]bool{"ep1": true}}
+
+	options := map[string]string{OptAddressID: "ep1", OptAddressContainerID: "c1"}
+	if _, err = am.RequestAddress(LocalDefaultAddressSpaceId, subnet1.String(), addr11.String(), options); err != nil {
+		t.Fatalf("RequestAddress failed, err:%+v.", err)
+	}
+
+	options = map[string]string{OptAddressID: "ep2"}
+	if _, err = am.RequestAddress(LocalDefaultAddressSpaceId, subnet2.String(), addr21.String(), options); err != nil {
+		t.Fatalf("RequestAddress failed, err:%+v.", err)
+	}
+
+	details := am.GetAddressSpaceDetails()
+	if len(details) != 2 || details[1].Id != LocalDefaultAddressSpaceId || len(details[1].Pools) != 2 {
+		t.Fatalf("Unexpected address space details %+v.", details)
+	}
+
+	ap := details[1].Pools[0]
+	if ap.Id != subnet1.String() || len(ap.Addresses) != 2 || ap.Capacity != 2 {
+		t.Fatalf("Unexpected pool details %+v.", ap)
+	}
+
+	// Addresses requested with an ID are held by the ID rather than marked in use.
+	ar := ap.Addresses[0]
+	if ar.Address != addr11.String() || ar.ID != "ep1" || ar.Orphaned ||
+		ar.Owner == nil || ar.Owner.ContainerID != "c1" || ar.LeaseTime == nil {
+		t.Errorf("Unexpected address details %+v.", ar)
+	}
+
+	if ar = ap.Addresses[1]; ar.Address != addr12.String() || ar.InUse || ar.ID != "" || ar.LeaseTime != nil {
+		t.Errorf("Unexpected address details %+v.", ar)
+	}
+
+	orphaned := am.GetOrphanedAddresses()
+	if len(orphaned) != 1 || len(orphaned[0].Pools) != 1 || len(orphaned[0].Pools[0].Addresses) != 1 {
+		t.Fatalf("Unexpected orphaned addresses %+v.", orphaned)
+	}
+
+	if ar = orphaned[0].Pools[0].Addresses[0]; ar.Address != addr21.String() || ar.ID != "ep2" || !ar.Orphaned {
+		t.Errorf("Unexpected orphaned address %+v.", ar)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"os"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Addresses leased more recently are not reclaimed, as their owner may still be being set up.
+	addressLeaseGracePeriod = 5 * time.Minute
+
+	// Interval between two reclaim passes over all address pools.
+	addressReclaimInterval = 5 * time.Minute
+
+	// Number of reclaimed addresses kept for inspection.
+	maxReclaimedAddresses = 64
+
+	// Reasons for reclaiming an address.
+	ReclaimReasonNetNsNotFound    = "NetNsNotFound"
+	ReclaimReasonContainerUnknown = "ContainerUnknown"
+)
+
+// AddressOwner identifies the owner of an address in use.
+type AddressOwner struct {
+	ContainerID  string `json:",omitempty"`
+	NetNsPath    string `json:",omitempty"`
+	PodName      string `json:",omitempty"`
+	PodNamespace string `json:",omitempty"`
+}
+
+// ReclaimedAddress is an address reclaimed from an owner that no longer exists.
+type ReclaimedAddress struct {
+	AsId    string
+	PoolId  string
+	Address string
+	Owner   AddressOwner
+	Reason  string
+	Time    time.Time
+}
+
+// ContainerLookup returns whether a container is known to the container runtime.
+type ContainerLookup func(containerID string) bool
+
+// ReclaimAddresses releases the addresses of owners that no longer exist. An owner no longer exists
+// when its network namespace is not found, or when its container is unknown to the given lookup.
+// Addresses without owner information are never reclaimed.
+func (am *addressManager) ReclaimAddresses(isContainerKnown ContainerLookup) ([]*ReclaimedAddress, error) {
+	am.Lock()
+	defer am.Unlock()
+
+	reclaimed := am.reclaimAddresses(isContainerKnown)
+	if len(reclaimed) == 0 {
+		return nil, nil
+	}
+
+	if err := am.save(); err != nil {
+		return nil, err
+	}
+
+	return reclaimed, nil
+}
+
+// GetReclaimedAddresses returns the most recently reclaimed addresses, oldest first.
+func (am *addressManager) GetReclaimedAddresses() []*ReclaimedAddress {
+	am.Lock()
+	defer am.Unlock()
+
+	return append([]*ReclaimedAddress(nil), am.Reclaimed...)
+}
+
+// Reclaims the addresses of owners that no longer exist from all address pools
+// if addressReclaimInterval elapsed since the last pass.
+func (am *addressManager) reclaimAddressesIfDue() {
+	now := time.Now()
+	if now.Sub(am.LastReclaimTime) < addressReclaimInterval {
+		return
+	}
+	am.LastReclaimTime = now
+
+	if len(am.reclaimAddresses(am.isContainerKnown)) == 0 {
+		return
+	}
+
+	if err := am.save(); err != nil {
+		log.Printf("[ipam] Failed to save reclaimed addresses, err:%v.", err)
+	}
+}
+
+// Reclaims the addresses of owners that no longer exist from all address pools.
+func (am *addressManager) reclaimAddresses(isContainerKnown ContainerLookup) []*ReclaimedAddress {
+	var reclaimed []*ReclaimedAddress
+	for _, as := range am.AddrSpaces {
+		for _, ap := range as.Pools {
+			reclaimed = append(reclaimed, ap.reclaimAddresses(isContainerKnown)...)
+		}
+	}
+
+	am.recordReclaimedAddresses(reclaimed)
+
+	return reclaimed
+}
+
+// Records reclaimed addresses for inspection, keeping the last maxReclaimedAddresses.
+func (am *addressManager) recordReclaimedAddresses(reclaimed []*ReclaimedAddress) {
+	if len(reclaimed) == 0 {
+		return
+	}
+
+	log.Printf("[ipam] Reclaimed %v addresses.", len(reclaimed))
+
+	am.Reclaimed = append(am.Reclaimed, reclaimed...)
+	if len(am.Reclaimed) > maxReclaimedAddresses {
+		am.Reclaimed = am.Reclaimed[len(am.Reclaimed)-maxReclaimedAddresses:]
+	}
+}
+
+// Reclaims the addresses of owners that no longer exist from the address pool.
+func (ap *addressPool) reclaimAddresses(isContainerKnown ContainerLookup) []*ReclaimedAddress {
+	var reclaimed []*ReclaimedAddress
+	now := time.Now()
+
+	for key, ar := range ap.Addresses {
+		reason := getReclaimReason(ar, isContainerKnown, now)
+		if reason == "" {
+			continue
+		}
+
+		log.Printf("[ipam] Reclaiming address %v from owner %+v, reason:%v.", ar.Addr, ar.Owner, reason)
+		reclaimed = append(reclaimed, &ReclaimedAddress{
+			AsId:    ap.as.Id,
+			PoolId:  ap.Id,
+			Address: ar.Addr.String(),
+			Owner:   *ar.Owner,
+			Reason:  reason,
+			Time:    now,
+		})
+
+		if ar.ID != "" {
+			delete(ap.addrsByID, ar.ID)
+			ar.ID = ""
+		}
+		ar.InUse = false
+		ar.Owner = nil
+		ar.LeaseTime = time.Time{}
+		ar.ReleaseTime = now
+
+		// Delete address record if it is no longer available.
+		if ar.epoch < ap.as.epoch {
+			delete(ap.Addresses, key)
+		} else {
+			ap.addFreeAddress(ar)
+		}
+	}
+
+	return reclaimed
+}
+
+// getReclaimReason returns why an address should be reclaimed, or an empty string if it should not.
+func getReclaimReason(ar *addressRecord, isContainerKnown ContainerLookup, now time.Time) string {
+	if (!ar.InUse && ar.ID == "") || ar.Owner == nil || now.Sub(ar.LeaseTime) < addressLeaseGracePeriod {
+		return ""
+	}
+
+	if ar.Owner.NetNsPath != "" {
+		if _, err := os.Stat(ar.Owner.NetNsPath); os.IsNotExist(err) {
+			return ReclaimReasonNetNsNotFound
+		}
+	}
+
+	if isContainerKnown != nil && ar.Owner.ContainerID != "" && !isContainerKnown(ar.Owner.ContainerID) {
+		return ReclaimReasonContainerUnknown
+	}
+
+	return ""
+}
+
+// getAddressOwner returns the owner of an address from request options.
+func getAddressOwner(options map[string]string) *AddressOwner {
+	owner := &AddressOwner{
+		ContainerID:  options[OptAddressContainerID],
+		NetNsPath:    options[OptAddressNetNsPath],
+		PodName:      options[OptAddressPodName],
+		PodNamespace: options[OptAddressPodNamespace],
+	}
+
+	if *owner == (AddressOwner{}) {
+		return nil
+	}
+
+	return owner
+}
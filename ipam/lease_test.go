@@ -0,0 +1,210 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// expireLeases moves the leases of all addresses past the grace period.
+func expireLeases(am AddressManager) {
+	for _, as := range am.(*addressManager).AddrSpaces {
+		for _, ap := range as.Pools {
+			for _, ar := range ap.Addresses {
+				ar.LeaseTime = ar.LeaseTime.Add(-2 * addressLeaseGracePeriod)
+			}
+		}
+	}
+}
+
+// Tests addresses of owners that no longer exist are reclaimed.
+func TestReclaimAddresses(t *testing.T) {
+	am, err := createAddressManager()
+	if err != nil {
+		t.Fatalf("createAddressManager failed, err:%+v.", err)
+	}
+
+	netNsDir, err := ioutil.TempDir("", "netns")
+	if err != nil {
+		t.Fatalf("TempDir failed, err:%+v.", err)
+	}
+	defer os.RemoveAll(netNsDir)
+
+	owners := []map[string]string{
+		{OptAddressContainerID: "c1", OptAddressNetNsPath: netNsDir, OptAddressPodName: "pod1"},
+		{OptAddressContainerID: "c2", OptAddressNetNsPath: netNsDir},
+		{OptAddressContainerID: "c3", OptAddressNetNsPath: filepath.Join(netNsDir, "missing")},
+	}
+
+	addresses := make(map[string]string)
+	for i, owner := range owners {
+		poolId := subnet1.String()
+		if i == 2 {
+			poolId = subnet2.String()
+		}
+
+		address, err := am.RequestAddress(LocalDefaultAddressSpaceId, poolId, "", owner)
+		if err != nil {
+			t.Fatalf("RequestAddress failed, err:%+v.", err)
+		}
+		addresses[owner[OptAddressContainerID]] = address
+	}
+
+	isContainerKnown := func(containerID string) bool { return containerID != "c2" }
+
+	// Addresses are not reclaimed during the grace period.
+	reclaimed, err := am.ReclaimAddresses(isContainerKnown)
+	if err != nil || len(reclaimed) != 0 {
+		t.Fatalf("Unexpected reclaimed addresses %+v, err:%+v.", reclaimed, err)
+	}
+
+	expireLeases(am)
+
+	reclaimed, err = am.ReclaimAddresses(isContainerKnown)
+	if err != nil || len(reclaimed) != 2 {
+		t.Fatalf("Unexpected reclaimed addresses %+v, err:%+v.", reclaimed, err)
+	}
+
+	for _, r := range reclaimed {
+		switch r.Owner.ContainerID {
+		case "c2":
+			if r.Reason != ReclaimReasonContainerUnknown || r.PoolId != subnet1.String() {
+				t.Errorf("Unexpected reclaimed address %+v.", r)
+			}
+		case "c3":
+			if r.Reason != ReclaimReasonNetNsNotFound || r.AsId != LocalDefaultAddressSpaceId {
+				t.Errorf("Unexpected reclaimed address %+v.", r)
+			}
+		default:
+			t.Errorf("Unexpected reclaimed address %+v.", r)
+		}
+	}
+
+	// The address of the remaining owner is still in use.
+	ar := am.(*addressManager).AddrSpaces[LocalDefaultAddressSpaceId].Pools[subnet1.String()].Addresses[addr11.String()]
+	if addresses["c1"] != addr11.String()+"/24" {
+		ar = am.(*addressManager).AddrSpaces[LocalDefaultAddressSpaceId].Pools[subnet1.String()].Addresses[addr12.String()]
+	}
+	if !ar.InUse || ar.Owner == nil || ar.Owner.PodName != "pod1" {
+		t.Errorf("Unexpected address record %+v.", ar)
+	}
+}
+
+// Tests leaked addresses are reclaimed when a pool runs out of addresses.
+func TestRequestAddressReclaimsLeakedAddresses(t *testing.T) {
+	am, err := createAddressManager()
+	if err != nil {
+		t.Fatalf("createAddressManager failed, err:%+v.", err)
+	}
+
+	owner := map[string]string{OptAddressContainerID: "c1", OptAddressNetNsPath: "/proc/0/ns/net/missing"}
+	if _, err = am.RequestAddress(LocalDefaultAddressSpaceId, subnet2.String(), "", owner); err != nil {
+		t.Fatalf("RequestAddress failed, err:%+v.", err)
+	}
+
+	owner = map[string]string{OptAddressContainerID: "c2"}
+	if _, err = am.RequestAddress(LocalDefaultAddressSpaceId, subnet2.String(), "", owner); err != errNoAvailableAddresses {
+		t.Fatalf("RequestAddress succeeded during the grace period, err:%+v.", err)
+	}
+
+	expireLeases(am)
+
+	address, err := am.RequestAddress(LocalDefaultAddressSpaceId, subnet2.String(), "", owner)
+	if err != nil || address != addr21.String()+"/24" {
+		t.Fatalf("RequestAddress failed, address:%v err:%+v.", address, err)
+	}
+
+	ar := am.(*addressManager).AddrSpaces[LocalDefaultAddressSpaceId].Pools[subnet2.String()].Addresses[addr21.String()]
+	if ar.Owner == nil || ar.Owner.ContainerID != "c2" || time.Since(ar.LeaseTime) > time.Minute {
+		t.Errorf("Unexpected address record %+v.", ar)
+	}
+}
+
+// Tests addresses are reclaimed periodically and recorded for inspection.
+func TestReclaimAddressesPeriodically(t *testing.T) {
+	am, err := createAddressManager()
+	if err != nil {
+		t.Fatalf("createAddressManager failed, err:%+v.", err)
+	}
+
+	amImpl := am.(*addressManager)
+	amImpl.isContainerKnown = func(containerID string) bool { return containerID != "c2" }
+
+	for _, containerID := range []string{"c1", "c2"} {
+		owner := map[string]string{OptAddressContainerID: containerID}
+		if _, err = am.RequestAddress(LocalDefaultAddressSpaceId, subnet1.String(), "", owner); err != nil {
+			t.Fatalf("RequestAddress failed, err:%+v.", err)
+		}
+	}
+
+	expireLeases(am)
+
+	// No pass runs before the reclaim interval elapses.
+	owner := map[string]string{OptAddressContainerID: "c3"}
+	if _, err = am.RequestAddress(LocalDefaultAddressSpaceId, subnet2.String(), "", owner); err != nil {
+		t.Fatalf("RequestAddress failed, err:%+v.", err)
+	}
+
+	if reclaimed := am.GetReclaimedAddresses(); len(reclaimed) != 0 {
+		t.Fatalf("Unexpected reclaimed addresses %+v.", reclaimed)
+	}
+
+	amImpl.LastReclaimTime = amImpl.LastReclaimTime.Add(-addressReclaimInterval)
+
+	owner = map[string]string{OptAddressContainerID: "c4"}
+	if _, err = am.RequestAddress(LocalDefaultAddressSpaceId, subnet1.String(), "", owner); err != nil {
+		t.Fatalf("RequestAddress failed, err:%+v.", err)
+	}
+
+	reclaimed := am.GetReclaimedAddresses()
+	if len(reclaimed) != 1 || reclaimed[0].Owner.ContainerID != "c2" ||
+		reclaimed[0].Reason != ReclaimReasonContainerUnknown || reclaimed[0].Time.IsZero() {
+		t.Fatalf("Unexpected reclaimed addresses %+v.", reclaimed)
+	}
+}
+
+// Tests containers are looked up in docker.
+func TestDockerContainerLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatalf("TempDir failed, err:%+v.", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Listen failed, err:%+v.", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/c1/json":
+			w.Write([]byte("{}"))
+		case "/containers/c2/json":
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	isContainerKnown := newDockerContainerLookup(socketPath)
+
+	if !isContainerKnown("c1") || isContainerKnown("c2") || !isContainerKnown("c3") {
+		t.Errorf("Unexpected docker container lookup results.")
+	}
+
+	// Containers are known when docker is unreachable.
+	if !newDockerContainerLookup(filepath.Join(dir, "missing.sock"))("c2") {
+		t.Errorf("Container unknown while docker is unreachable.")
+	}
+}
@@ -20,12 +20,16 @@ const (
 
 // AddressManager manages the set of address spaces and pools allocated to containers.
 type addressManager struct {
-	Version    string
-	TimeStamp  time.Time
-	AddrSpaces map[string]*addressSpace `json:"AddressSpaces"`
-	store      store.KeyValueStore
-	source     addressConfigSource
-	netApi     common.NetApi
+	Version          string
+	TimeStamp        time.Time
+	AddrSpaces       map[string]*addressSpace `json:"AddressSpaces"`
+	LastReclaimTime  time.Time
+	Reclaimed        []*ReclaimedAddress `json:"ReclaimedAddresses,omitempty"`
+	store            store.KeyValueStore
+	source           addressConfigSource
+	netApi           common.NetApi
+	cooldown         time.Duration
+	isContainerKnown ContainerLookup
 	sync.Mutex
 }
 
@@ -45,6 +49,11 @@ type AddressManager interface {
 
 	RequestAddress(asId, poolId, address string, options map[string]string) (string, error)
 	ReleaseAddress(asId, poolId, address string, options map[string]string) error
+	ReclaimAddresses(isContainerKnown ContainerLookup) ([]*ReclaimedAddress, error)
+
+	GetAddressSpaceDetails() []*AddressSpaceDetails
+	GetOrphanedAddresses() []*AddressSpaceDetails
+	GetReclaimedAddresses() []*ReclaimedAddress
 }
 
 // AddressConfigSource configures the address pools managed by AddressManager.
@@ -185,6 +194,14 @@ func (am *addressManager) StartSource(options map[string]interface{}) error {
 
 	environment, _ := options[common.OptEnvironment].(string)
 
+	// Released addresses are not reused before the cooldown expires.
+	cooldown, _ := options[common.OptIpamReuseCooldown].(int)
+	am.cooldown = time.Duration(cooldown) * time.Second
+
+	// Addresses of containers unknown to the container runtime are reclaimed.
+	runtime, _ := options[common.OptIpamContainerRuntime].(string)
+	am.isContainerKnown = newContainerLookup(runtime)
+
 	switch environment {
 	case common.OptEnvironmentAzure:
 		am.source, err = newAzureSource(options)
@@ -192,6 +209,9 @@ func (am *addressManager) StartSource(options map[string]interface{}) error {
 	case common.OptEnvironmentMAS:
 		am.source, err = newMasSource(options)
 
+	case common.OptEnvironmentFile:
+		am.source, err = newFileSource(options)
+
 	case "null":
 		am.source, err = newNullSource()
 
@@ -231,6 +251,8 @@ func (am *addressManager) refreshSource() {
 			log.Printf("[ipam] Source refresh failed, err:%v.\n", err)
 		}
 	}
+
+	am.reclaimAddressesIfDue()
 }
 
 //
@@ -346,7 +368,15 @@ func (am *addressManager) RequestAddress(asId, poolId, address string, options m
 		return "", err
 	}
 
-	addr, err := ap.requestAddress(address, options)
+	addr, err := ap.requestAddress(address, options, am.cooldown)
+	if err == errNoAvailableAddresses {
+		// Reclaim addresses leaked by owners that no longer exist, and retry.
+		reclaimed := ap.reclaimAddresses(am.isContainerKnown)
+		am.recordReclaimedAddresses(reclaimed)
+		if len(reclaimed) > 0 {
+			addr, err = ap.requestAddress(address, options, am.cooldown)
+		}
+	}
 	if err != nil {
 		return "", err
 	}
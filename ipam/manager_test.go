@@ -203,17 +203,17 @@ func TestAddressSpaceUpdate(t *testing.T) {
 		t.Errorf("Cannot find subnet1, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr11.String(), nil)
+	_, err = ap.requestAddress(addr11.String(), nil, 0)
 	if err != nil {
 		t.Errorf("Cannot find addr11, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr12.String(), nil)
+	_, err = ap.requestAddress(addr12.String(), nil, 0)
 	if err == nil {
 		t.Errorf("Found addr12.")
 	}
 
-	_, err = ap.requestAddress(addr13.String(), nil)
+	_, err = ap.requestAddress(addr13.String(), nil, 0)
 	if err != nil {
 		t.Errorf("Cannot find addr13, err:%+v.", err)
 	}
@@ -230,12 +230,12 @@ func TestAddressSpaceUpdate(t *testing.T) {
 		t.Errorf("Cannot find subnet3, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr31.String(), nil)
+	_, err = ap.requestAddress(addr31.String(), nil, 0)
 	if err != nil {
 		t.Errorf("Cannot find addr31, err:%+v.", err)
 	}
 
-	_, err = ap.requestAddress(addr32.String(), nil)
+	_, err = ap.requestAddress(addr32.String(), nil, 0)
 	if err == nil {
 		t.Errorf("Found addr32.")
 	}
@@ -4,9 +4,11 @@
 package ipam
 
 import (
+	"container/list"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
@@ -62,6 +64,7 @@ type addressPool struct {
 	Priority  int
 	RefCount  int
 	epoch     int
+	free      *list.List
 }
 
 // AddressPoolInfo contains information about an address pool.
@@ -77,11 +80,15 @@ type AddressPoolInfo struct {
 
 // Represents an IP address in a pool.
 type addressRecord struct {
-	ID        string
-	Addr      net.IP
-	InUse     bool
-	unhealthy bool
-	epoch     int
+	ID          string
+	Addr        net.IP
+	InUse       bool
+	Owner       *AddressOwner `json:",omitempty"`
+	LeaseTime   time.Time
+	ReleaseTime time.Time
+	unhealthy   bool
+	epoch       int
+	freeElem    *list.Element
 }
 
 //
@@ -191,6 +198,9 @@ func (as *addressSpace) merge(newas *addressSpace) {
 			pv.epoch = as.epoch
 		} else {
 			// This pool already exists.
+			// Sources may change the gateway of a pool.
+			ap.Gateway = pv.Gateway
+
 			// Compare address records one by one.
 			for ak, av := range pv.Addresses {
 				ar := ap.Addresses[ak]
@@ -200,6 +210,7 @@ func (as *addressSpace) merge(newas *addressSpace) {
 					// Merge it to the existing address pool.
 					ap.Addresses[ak] = av
 					av.epoch = as.epoch
+					ap.addFreeAddress(av)
 				} else {
 					// This address record already exists.
 					ar.epoch = as.epoch
@@ -230,6 +241,7 @@ func (as *addressSpace) merge(newas *addressSpace) {
 					av.unhealthy = true
 				} else {
 					// This address is no longer available.
+					pv.removeFreeAddress(av)
 					delete(pv.Addresses, ak)
 				}
 			}
@@ -388,7 +400,6 @@ func (as *addressSpace) releasePool(poolId string) error {
 	return nil
 }
 
-//
 // AddressPool
 //
 // Returns address pool information.
@@ -442,12 +453,15 @@ func (ap *addressPool) newAddressRecord(addr *net.IP) (*addressRecord, error) {
 	}
 
 	ap.Addresses[id] = ar
+	ap.addFreeAddress(ar)
 
 	return ar, nil
 }
 
 // Requests a new address from the address pool.
-func (ap *addressPool) requestAddress(address string, options map[string]string) (string, error) {
+// Available addresses are handed out in the order they were released, least recently released first,
+// and are not reused before the cooldown expires.
+func (ap *addressPool) requestAddress(address string, options map[string]string, cooldown time.Duration) (string, error) {
 	var ar *addressRecord
 	var addr *net.IPNet
 	var err error
@@ -481,20 +495,16 @@ func (ap *addressPool) requestAddress(address string, options map[string]string)
 		ar = ap.addrsByID[id]
 	}
 
-	// If no address was found, return any available address.
+	// If no address was found, return the next available address.
 	if ar == nil {
-		for _, ar = range ap.Addresses {
-			if !ar.InUse && ar.ID == "" {
-				break
-			}
-			ar = nil
-		}
-
+		ar = ap.getFreeAddress(cooldown, time.Now())
 		if ar == nil {
 			return "", errNoAvailableAddresses
 		}
 	}
 
+	ap.removeFreeAddress(ar)
+
 	if id != "" {
 		ap.addrsByID[id] = ar
 		ar.ID = id
@@ -502,6 +512,10 @@ func (ap *addressPool) requestAddress(address string, options map[string]string)
 		ar.InUse = true
 	}
 
+	// Lease the address to its owner.
+	ar.Owner = getAddressOwner(options)
+	ar.LeaseTime = time.Now()
+
 	// Return address in CIDR notation.
 	addr = &net.IPNet{
 		IP:   ar.Addr,
@@ -552,6 +566,9 @@ func (ap *addressPool) releaseAddress(address string, options map[string]string)
 	}
 
 	ar.InUse = false
+	ar.Owner = nil
+	ar.LeaseTime = time.Time{}
+	ar.ReleaseTime = time.Now()
 
 	if id != "" && ar.ID == id {
 		delete(ap.addrsByID, ar.ID)
@@ -562,6 +579,8 @@ func (ap *addressPool) releaseAddress(address string, options map[string]string)
 	if ar.epoch < ap.as.epoch {
 		log.Printf("Deleting Address record from address pool as metadata doesn't have this address")
 		delete(ap.Addresses, address)
+	} else {
+		ap.addFreeAddress(ar)
 	}
 
 	return nil
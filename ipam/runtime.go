@@ -0,0 +1,64 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package ipam
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Container runtimes supported for reclaiming addresses.
+	ContainerRuntimeDocker = "docker"
+
+	// Docker engine API socket.
+	dockerSocketPath = "/var/run/docker.sock"
+
+	// Timeout for container runtime queries.
+	containerLookupTimeout = 5 * time.Second
+)
+
+// newContainerLookup returns a lookup querying the given container runtime, or nil if the
+// container runtime is not supported.
+func newContainerLookup(runtime string) ContainerLookup {
+	switch runtime {
+	case ContainerRuntimeDocker:
+		return newDockerContainerLookup(dockerSocketPath)
+	case "":
+		return nil
+	default:
+		log.Printf("[ipam] Unsupported container runtime %v, reclaiming addresses by network namespace only.", runtime)
+		return nil
+	}
+}
+
+// newDockerContainerLookup returns a lookup querying the docker engine listening on a unix socket.
+// Containers are reported unknown only when docker says so, so that an unreachable docker engine
+// never causes addresses to be reclaimed.
+func newDockerContainerLookup(socketPath string) ContainerLookup {
+	client := &http.Client{
+		Timeout: containerLookupTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	return func(containerID string) bool {
+		res, err := client.Get("http://unix/containers/" + containerID + "/json")
+		if err != nil {
+			log.Printf("[ipam] Failed to query docker for container %v, err:%v.", containerID, err)
+			return true
+		}
+		res.Body.Close()
+
+		return res.StatusCode != http.StatusNotFound
+	}
+}
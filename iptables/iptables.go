@@ -3,16 +3,17 @@ package iptables
 // This package contains wrapper functions to program iptables rules
 
 import (
-	"fmt"
-
 	"github.com/Azure/azure-container-networking/log"
-	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/rules"
 )
 
 // cni iptable chains
 const (
 	CNIInputChain  = "AZURECNIINPUT"
 	CNIOutputChain = "AZURECNIOUTPUT"
+
+	CNIHostPortChain     = "AZURECNIHOSTPORT"
+	CNIHostPortSnatChain = "AZURECNIHOSTPORTSNAT"
 )
 
 // standard iptable chains
@@ -35,6 +36,7 @@ const (
 	Accept     = "ACCEPT"
 	Drop       = "DROP"
 	Masquerade = "MASQUERADE"
+	Dnat       = "DNAT"
 )
 
 // actions
@@ -50,29 +52,10 @@ const (
 	Related     = "RELATED"
 )
 
-const (
-	iptables    = "iptables"
-	lockTimeout = 60
-)
-
-// Run iptables command
-func runCmd(params string) error {
-	cmd := fmt.Sprintf("%s -w %d %s", iptables, lockTimeout, params)
-	if _, err := platform.ExecuteCommand(cmd); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // check if iptable chain alreay exists
 func ChainExists(tableName, chainName string) bool {
-	params := fmt.Sprintf("-t %s -L %s", tableName, chainName)
-	if err := runCmd(params); err != nil {
-		return false
-	}
-
-	return true
+	exists, _ := rules.GetBackend().Exists(rules.NewChain(rules.Iptables, tableName, chainName))
+	return exists
 }
 
 // create new iptable chain under specified table name
@@ -80,8 +63,7 @@ func CreateChain(tableName, chainName string) error {
 	var err error
 
 	if !ChainExists(tableName, chainName) {
-		params := fmt.Sprintf("-t %s -N %s", tableName, chainName)
-		err = runCmd(params)
+		err = rules.GetBackend().Add(rules.NewChain(rules.Iptables, tableName, chainName))
 	} else {
 		log.Printf("%s Chain exists in table %s", chainName, tableName)
 	}
@@ -89,13 +71,20 @@ func CreateChain(tableName, chainName string) error {
 	return err
 }
 
+// flush all rules of iptable chain
+func FlushChain(tableName, chainName string) error {
+	return rules.GetBackend().Flush(rules.NewChain(rules.Iptables, tableName, chainName))
+}
+
+// flush all rules of iptable chain and delete it
+func DeleteChain(tableName, chainName string) error {
+	return rules.GetBackend().Delete(rules.NewChain(rules.Iptables, tableName, chainName))
+}
+
 // check if iptable rule alreay exists
 func RuleExists(tableName, chainName, match, target string) bool {
-	params := fmt.Sprintf("-t %s -C %s %s -j %s", tableName, chainName, match, target)
-	if err := runCmd(params); err != nil {
-		return false
-	}
-	return true
+	exists, _ := rules.GetBackend().Exists(rules.NewIptablesRule(tableName, chainName, match, target))
+	return exists
 }
 
 // Insert iptable rule at beginning of iptable chain
@@ -105,8 +94,9 @@ func InsertIptableRule(tableName, chainName, match, target string) error {
 		return nil
 	}
 
-	params := fmt.Sprintf("-t %s -I %s 1 %s -j %s", tableName, chainName, match, target)
-	return runCmd(params)
+	rule := rules.NewIptablesRule(tableName, chainName, match, target)
+	rule.Position = 1
+	return rules.GetBackend().Add(rule)
 }
 
 // Append iptable rule at end of iptable chain
@@ -116,12 +106,10 @@ func AppendIptableRule(tableName, chainName, match, target string) error {
 		return nil
 	}
 
-	params := fmt.Sprintf("-t %s -A %s %s -j %s", tableName, chainName, match, target)
-	return runCmd(params)
+	return rules.GetBackend().Add(rules.NewIptablesRule(tableName, chainName, match, target))
 }
 
 // Delete matched iptable rule
 func DeleteIptableRule(tableName, chainName, match, target string) error {
-	params := fmt.Sprintf("-t %s -D %s %s -j %s", tableName, chainName, match, target)
-	return runCmd(params)
+	return rules.GetBackend().Delete(rules.NewIptablesRule(tableName, chainName, match, target))
 }
@@ -0,0 +1,100 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package log
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Fields is the context of an operation added to structured log records.
+type Fields struct {
+	CorrelationID string `json:"correlationId,omitempty"`
+	ContainerID   string `json:"containerId,omitempty"`
+	PodName       string `json:"podName,omitempty"`
+	PodNamespace  string `json:"podNamespace,omitempty"`
+	Command       string `json:"command,omitempty"`
+}
+
+// merge returns the fields overridden by the non-empty fields of other.
+func (fields Fields) merge(other Fields) Fields {
+	if other.CorrelationID != "" {
+		fields.CorrelationID = other.CorrelationID
+	}
+	if other.ContainerID != "" {
+		fields.ContainerID = other.ContainerID
+	}
+	if other.PodName != "" {
+		fields.PodName = other.PodName
+	}
+	if other.PodNamespace != "" {
+		fields.PodNamespace = other.PodNamespace
+	}
+	if other.Command != "" {
+		fields.Command = other.Command
+	}
+
+	return fields
+}
+
+// NewCorrelationID returns a new random ID correlating the log records of an operation across components.
+func NewCorrelationID() string {
+	return uuid.New().String()
+}
+
+// Entry logs through a logger with additional fields.
+// It is used by components handling several operations at once, where the fields cannot be set on the logger.
+type Entry struct {
+	logger *Logger
+	fields Fields
+}
+
+// WithFields returns an entry logging with the given fields.
+func (logger *Logger) WithFields(fields Fields) *Entry {
+	return &Entry{logger: logger, fields: fields}
+}
+
+// Printf logs a formatted string at info level.
+func (entry *Entry) Printf(format string, args ...interface{}) {
+	entry.logger.printf(&entry.fields, format, args...)
+}
+
+// Debugf logs a formatted string at debug level.
+func (entry *Entry) Debugf(format string, args ...interface{}) {
+	entry.logger.debugf(&entry.fields, format, args...)
+}
+
+// Errorf logs a formatted string at error level.
+func (entry *Entry) Errorf(format string, args ...interface{}) {
+	entry.logger.errorf(&entry.fields, format, args...)
+}
+
+// Request logs a structured request.
+func (entry *Entry) Request(tag string, request interface{}, err error) {
+	entry.logger.request(&entry.fields, tag, request, err)
+}
+
+// Response logs a structured response.
+func (entry *Entry) Response(tag string, response interface{}, returnCode int, returnStr string, err error) {
+	entry.logger.response(&entry.fields, tag, response, returnCode, returnStr, err)
+}
+
+type fieldsKey struct{}
+
+// NewContext returns a context carrying the given fields.
+func NewContext(ctx context.Context, fields Fields) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// FieldsFromContext returns the fields carried by a context.
+func FieldsFromContext(ctx context.Context) Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(Fields)
+	return fields
+}
+
+// FromContext returns an entry of the standard logger logging with the fields carried by a context.
+func FromContext(ctx context.Context) *Entry {
+	return stdLog.WithFields(FieldsFromContext(ctx))
+}
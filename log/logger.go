@@ -4,12 +4,14 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path"
 	"sync"
+	"time"
 )
 
 // Log level
@@ -30,6 +32,21 @@ const (
 	TargetStdOutAndLogFile
 )
 
+// Log format
+const (
+	FormatText = iota
+	FormatJSON
+)
+
+// Names of log levels in structured records.
+var levelNames = map[int]string{
+	LevelAlert:   "alert",
+	LevelError:   "error",
+	LevelWarning: "warning",
+	LevelInfo:    "info",
+	LevelDebug:   "debug",
+}
+
 const (
 	// Log file properties.
 	logPrefix        = ""
@@ -40,6 +57,9 @@ const (
 	maxLogFileSize   = 5 * 1024 * 1024
 	maxLogFileCount  = 8
 	rotationCheckFrq = 8
+
+	// Log file rotation default age limit.
+	maxLogFileAge = 24 * time.Hour
 )
 
 // Logger object
@@ -49,8 +69,14 @@ type Logger struct {
 	name         string
 	level        int
 	target       int
+	format       int
+	fields       Fields
 	maxFileSize  int
 	maxFileCount int
+	maxFileAge   time.Duration
+	maxTotalSize int64
+	compress     bool
+	compressions *sync.WaitGroup
 	callCount    int
 	directory    string
 	reports      chan interface{}
@@ -69,6 +95,9 @@ func NewLogger(name string, level int, target int) *Logger {
 	logger.SetTarget(target)
 	logger.maxFileSize = maxLogFileSize
 	logger.maxFileCount = maxLogFileCount
+	logger.maxFileAge = maxLogFileAge
+	logger.compress = true
+	logger.compressions = &sync.WaitGroup{}
 	logger.directory = ""
 	logger.mutex = &sync.Mutex{}
 
@@ -85,19 +114,68 @@ func (logger *Logger) SetLevel(level int) {
 	logger.level = level
 }
 
+// SetFormat sets the log record format.
+func (logger *Logger) SetFormat(format int) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.format = format
+	if format == FormatJSON {
+		// Structured records carry their own timestamp.
+		logger.l.SetFlags(0)
+	} else {
+		logger.l.SetFlags(log.LstdFlags)
+	}
+}
+
+// SetFields sets the fields added to all structured records of the logger.
+func (logger *Logger) SetFields(fields Fields) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.fields = fields
+}
+
+// GetFields returns the fields added to all structured records of the logger.
+func (logger *Logger) GetFields() Fields {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	return logger.fields
+}
+
 // SetLogFileLimits sets the log file limits.
 func (logger *Logger) SetLogFileLimits(maxFileSize int, maxFileCount int) {
 	logger.maxFileSize = maxFileSize
 	logger.maxFileCount = maxFileCount
 }
 
+// SetLogFileMaxAge sets the age after which the log file is rotated regardless of its size.
+// Zero disables rotation by age.
+func (logger *Logger) SetLogFileMaxAge(maxFileAge time.Duration) {
+	logger.maxFileAge = maxFileAge
+}
+
+// SetLogFileMaxTotalSize sets the maximum size in bytes of the log file and its rotated files together.
+// The oldest rotated files are removed to stay within it. Zero limits it to the size of maxFileCount log files.
+func (logger *Logger) SetLogFileMaxTotalSize(maxTotalSize int64) {
+	logger.maxTotalSize = maxTotalSize
+}
+
+// SetLogFileCompression sets whether rotated log files are compressed with gzip.
+func (logger *Logger) SetLogFileCompression(compress bool) {
+	logger.compress = compress
+}
+
 // SetChannel sets the channel for error message reports.
 func (logger *Logger) SetChannel(reports chan interface{}) {
 	logger.reports = reports
 }
 
-// Close closes the log stream.
+// Close closes the log stream, after waiting for rotated log files to be compressed.
 func (logger *Logger) Close() {
+	logger.compressions.Wait()
+
 	if logger.out != nil {
 		logger.out.Close()
 	}
@@ -130,115 +208,179 @@ func (logger *Logger) getLogFileName() string {
 	return logFileName
 }
 
-// Rotate checks the active log file size and rotates log files if necessary.
-func (logger *Logger) rotate() {
-	// Return if target is not a log file.
-	if logger.target != TargetLogfile || logger.out == nil {
-		return
-	}
+// Request logs a structured request.
+func (logger *Logger) Request(tag string, request interface{}, err error) {
+	logger.request(nil, tag, request, err)
+}
 
-	fileName := logger.getLogFileName()
-	fileInfo, err := os.Stat(fileName)
-	if err != nil {
-		logger.Logf("[log] Failed to query log file info %+v.", err)
-		return
-	}
+// Response logs a structured response.
+func (logger *Logger) Response(tag string, response interface{}, returnCode int, returnStr string, err error) {
+	logger.response(nil, tag, response, returnCode, returnStr, err)
+}
 
-	// Rotate if size limit is reached.
-	if fileInfo.Size() >= int64(logger.maxFileSize) {
-		logger.out.Close()
-		var fn1, fn2 string
-
-		// Rotate log files, keeping the last maxFileCount files.
-		for n := logger.maxFileCount - 1; n >= 0; n-- {
-			fn2 = fn1
-			if n == 0 {
-				fn1 = fileName
-			} else {
-				fn1 = fmt.Sprintf("%v.%v", fileName, n)
-			}
-			if fn2 != "" {
-				os.Rename(fn1, fn2)
-			}
+// request logs a structured request with the given fields.
+func (logger *Logger) request(fields *Fields, tag string, request interface{}, err error) {
+	if logger.format != FormatJSON {
+		if err == nil {
+			logger.printf(fields, "[%s] Received %T %+v.", tag, request, request)
+		} else {
+			logger.errorf(fields, "[%s] Failed to decode %T %+v %s.", tag, request, request, err.Error())
 		}
-
-		// Create a new log file.
-		logger.SetTarget(TargetLogfile)
+		return
 	}
-}
 
-// Request logs a structured request.
-func (logger *Logger) Request(tag string, request interface{}, err error) {
 	if err == nil {
-		logger.Printf("[%s] Received %T %+v.", tag, request, request)
+		if logger.level >= LevelInfo {
+			logger.write(&record{level: LevelInfo, fields: fields, message: fmt.Sprintf("[%s] Received %T.", tag, request), Request: request})
+		}
 	} else {
-		logger.Errorf("[%s] Failed to decode %T %+v %s.", tag, request, request, err.Error())
+		logger.write(&record{level: LevelError, fields: fields, message: fmt.Sprintf("[%s] Failed to decode %T %s.", tag, request, err.Error()), Request: request})
 	}
 }
 
-// Response logs a structured response.
-func (logger *Logger) Response(tag string, response interface{}, returnCode int, returnStr string, err error) {
+// response logs a structured response with the given fields.
+func (logger *Logger) response(fields *Fields, tag string, response interface{}, returnCode int, returnStr string, err error) {
+	if logger.format != FormatJSON {
+		if err == nil && returnCode == 0 {
+			logger.printf(fields, "[%s] Sent %T %+v.", tag, response, response)
+		} else if err != nil {
+			logger.errorf(fields, "[%s] Code:%s, %+v %s.", tag, returnStr, response, err.Error())
+		} else {
+			logger.errorf(fields, "[%s] Code:%s, %+v.", tag, returnStr, response)
+		}
+		return
+	}
+
 	if err == nil && returnCode == 0 {
-		logger.Printf("[%s] Sent %T %+v.", tag, response, response)
+		if logger.level >= LevelInfo {
+			logger.write(&record{level: LevelInfo, fields: fields, message: fmt.Sprintf("[%s] Sent %T.", tag, response), Response: response})
+		}
 	} else if err != nil {
-		logger.Errorf("[%s] Code:%s, %+v %s.", tag, returnStr, response, err.Error())
+		logger.write(&record{level: LevelError, fields: fields, message: fmt.Sprintf("[%s] Code:%s, %s.", tag, returnStr, err.Error()), Response: response})
 	} else {
-		logger.Errorf("[%s] Code:%s, %+v.", tag, returnStr, response)
+		logger.write(&record{level: LevelError, fields: fields, message: fmt.Sprintf("[%s] Code:%s.", tag, returnStr), Response: response})
 	}
 }
 
-// logf logs a formatted string.
-func (logger *Logger) logf(format string, args ...interface{}) {
+// record is a single log record.
+type record struct {
+	level    int
+	fields   *Fields
+	message  string
+	Request  interface{}
+	Response interface{}
+}
+
+// write logs a record.
+func (logger *Logger) write(r *record) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
 	if logger.callCount%rotationCheckFrq == 0 {
-		logger.rotate()
+		if err := logger.rotate(); err != nil {
+			logger.l.Printf("[%v] [log] Failed to rotate log file: %v.", pid, err)
+		}
 	}
-	format = fmt.Sprintf("[%v] %s", pid, format)
 	logger.callCount++
-	logger.l.Printf(format, args...)
+
+	if logger.format != FormatJSON {
+		logger.l.Printf("[%v] %s", pid, r.message)
+		return
+	}
+
+	fields := logger.fields
+	if r.fields != nil {
+		fields = fields.merge(*r.fields)
+	}
+
+	structured := struct {
+		Time      string `json:"time"`
+		Level     string `json:"level"`
+		Component string `json:"component"`
+		Pid       int    `json:"pid"`
+		Fields
+		Message  string      `json:"msg"`
+		Request  interface{} `json:"request,omitempty"`
+		Response interface{} `json:"response,omitempty"`
+	}{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		Level:     levelNames[r.level],
+		Component: logger.name,
+		Pid:       pid,
+		Fields:    fields,
+		Message:   r.message,
+		Request:   r.Request,
+		Response:  r.Response,
+	}
+
+	b, err := json.Marshal(&structured)
+	if err != nil {
+		// Fall back to the text representation of objects that cannot be encoded.
+		if r.Request != nil {
+			structured.Request = fmt.Sprintf("%+v", r.Request)
+		}
+		if r.Response != nil {
+			structured.Response = fmt.Sprintf("%+v", r.Response)
+		}
+		b, _ = json.Marshal(&structured)
+	}
+
+	logger.l.Print(string(b))
+}
+
+// logf logs a formatted string.
+func (logger *Logger) logf(level int, fields *Fields, format string, args ...interface{}) {
+	logger.write(&record{level: level, fields: fields, message: fmt.Sprintf(format, args...)})
 }
 
 // Logf wraps logf.
 func (logger *Logger) Logf(format string, args ...interface{}) {
-	logger.mutex.Lock()
-	logger.logf(format, args...)
-	logger.mutex.Unlock()
+	logger.logf(LevelInfo, nil, format, args...)
 }
 
 // Printf logs a formatted string at info level.
 func (logger *Logger) Printf(format string, args ...interface{}) {
+	logger.printf(nil, format, args...)
+}
+
+// Debugf logs a formatted string at info level.
+func (logger *Logger) Debugf(format string, args ...interface{}) {
+	logger.debugf(nil, format, args...)
+}
+
+// Errorf logs a formatted string at info level and sends the string to TelemetryBuffer.
+func (logger *Logger) Errorf(format string, args ...interface{}) {
+	logger.errorf(nil, format, args...)
+}
+
+// printf logs a formatted string with the given fields at info level.
+func (logger *Logger) printf(fields *Fields, format string, args ...interface{}) {
 	if logger.level < LevelInfo {
 		return
 	}
 
-	logger.mutex.Lock()
-	logger.logf(format, args...)
-	logger.mutex.Unlock()
-	go func() {
-		if logger.reports != nil {
-			logger.reports <- fmt.Sprintf(format, args...)
-		}
-	}()
+	logger.logf(LevelInfo, fields, format, args...)
+	logger.report(format, args...)
 }
 
-// Debugf logs a formatted string at info level.
-func (logger *Logger) Debugf(format string, args ...interface{}) {
+// debugf logs a formatted string with the given fields at debug level.
+func (logger *Logger) debugf(fields *Fields, format string, args ...interface{}) {
 	if logger.level < LevelDebug {
 		return
 	}
 
-	logger.mutex.Lock()
-	logger.logf(format, args...)
-	logger.mutex.Unlock()
-	go func() {
-		if logger.reports != nil {
-			logger.reports <- fmt.Sprintf(format, args...)
-		}
-	}()
+	logger.logf(LevelDebug, fields, format, args...)
+	logger.report(format, args...)
 }
 
-// Errorf logs a formatted string at info level and sends the string to TelemetryBuffer.
-func (logger *Logger) Errorf(format string, args ...interface{}) {
-	logger.Logf(format, args...)
+// errorf logs a formatted string with the given fields at error level.
+func (logger *Logger) errorf(fields *Fields, format string, args ...interface{}) {
+	logger.logf(LevelError, fields, format, args...)
+	logger.report(format, args...)
+}
+
+// report sends a formatted string through the report channel.
+func (logger *Logger) report(format string, args ...interface{}) {
 	go func() {
 		if logger.reports != nil {
 			logger.reports <- fmt.Sprintf(format, args...)
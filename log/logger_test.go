@@ -4,11 +4,14 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -50,6 +53,120 @@ func TestLogFileRotatesWhenSizeLimitIsReached(t *testing.T) {
 		t.Errorf("Found the 2nd rotated log file which should have been deleted.")
 	}
 	os.Remove(fn)
+	os.Remove(l.GetLogDirectory() + logName + ".log.created")
+}
+
+// Tests that the log file rotates when age limit is reached.
+func TestLogFileRotatesWhenAgeLimitIsReached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("Failed to create directory, %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := NewLogger(logName, LevelInfo, TargetStderr)
+	l.SetLogDirectory(dir)
+	l.SetTarget(TargetLogfile)
+	l.SetLogFileMaxAge(time.Hour)
+
+	fn := path.Join(dir, logName+".log")
+	l.Logf("LogText %v", 1)
+
+	// Age the active log file.
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(fn+".created", past, past)
+
+	for i := 2; i <= rotationCheckFrq+1; i++ {
+		l.Logf("LogText %v", i)
+	}
+	l.Close()
+
+	if _, err := os.Stat(fn + ".1"); err != nil {
+		t.Errorf("Failed to find the rotated log file.")
+	}
+
+	if stampInfo, err := os.Stat(fn + ".created"); err != nil || time.Since(stampInfo.ModTime()) > time.Hour {
+		t.Errorf("Age of the active log file was not reset.")
+	}
+}
+
+// Tests that older rotated log files are compressed and removed to stay within the disk budget.
+func TestRotatedLogFilesAreCompressedWithinBudget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("Failed to create directory, %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := NewLogger(logName, LevelInfo, TargetStderr)
+	l.SetLogDirectory(dir)
+	l.SetTarget(TargetLogfile)
+	l.SetLogFileLimits(512, 8)
+	l.SetLogFileMaxTotalSize(2048)
+
+	for i := 1; i <= 400; i++ {
+		l.Logf("LogText %v", i)
+	}
+	l.Close()
+
+	fn := path.Join(dir, logName+".log")
+
+	// The most recently rotated file may still be written by other processes and is left uncompressed.
+	if _, err := os.Stat(fn + ".1"); err != nil {
+		t.Errorf("Failed to find the 1st rotated log file.")
+	}
+
+	if _, err := os.Stat(fn + ".2.gz"); err != nil {
+		t.Errorf("Failed to find the 2nd compressed rotated log file.")
+	}
+
+	var totalSize int64
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".lock") || strings.HasSuffix(f.Name(), ".tmp") {
+			t.Errorf("Found leftover file %v.", f.Name())
+		}
+		totalSize += f.Size()
+	}
+
+	// The active log file may grow past its limit until the next rotation check.
+	if totalSize > 2048+512 {
+		t.Errorf("Log files take %v bytes, exceeding the budget.", totalSize)
+	}
+}
+
+// Tests that the log file is reopened when rotated by another process.
+func TestLogFileReopensWhenRotatedExternally(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("Failed to create directory, %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := NewLogger(logName, LevelInfo, TargetStderr)
+	l.SetLogDirectory(dir)
+	l.SetTarget(TargetLogfile)
+
+	fn := path.Join(dir, logName+".log")
+	l.Logf("LogText %v", 1)
+
+	if err := os.Rename(fn, fn+".1"); err != nil {
+		t.Fatalf("Failed to rotate log file, %v", err)
+	}
+
+	for i := 2; i <= rotationCheckFrq+1; i++ {
+		l.Logf("LogText %v", i)
+	}
+	l.Close()
+
+	logBytes, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("Failed to read log, %v", err)
+	}
+
+	if !strings.Contains(string(logBytes), fmt.Sprintf("LogText %v", rotationCheckFrq+1)) {
+		t.Errorf("Unexpected log: %s.", logBytes)
+	}
 }
 
 func TestPid(t *testing.T) {
@@ -62,6 +179,7 @@ func TestPid(t *testing.T) {
 	l.Close()
 	fn := l.GetLogDirectory() + logName + ".log"
 	defer os.Remove(fn)
+	defer os.Remove(fn + ".created")
 	
 	logBytes, err := ioutil.ReadFile(fn)
 	if err != nil {
@@ -74,3 +192,59 @@ func TestPid(t *testing.T) {
 		t.Fatalf("Unexpected log: %s.", log)
 	}
 }
+
+// Tests that structured records carry the logger and entry fields.
+func TestJSONFormat(t *testing.T) {
+	l := NewLogger(logName, LevelInfo, TargetLogfile)
+	if l == nil {
+		t.Fatalf("Failed to create logger.")
+	}
+
+	l.SetFormat(FormatJSON)
+	l.SetFields(Fields{CorrelationID: "id", Command: "ADD"})
+
+	l.Printf("LogText %v", 1)
+	l.WithFields(Fields{ContainerID: "container", PodName: "pod"}).Errorf("LogText %v", 2)
+	l.Request("test", &struct{ Name string }{Name: "request"}, nil)
+	l.Close()
+
+	fn := l.GetLogDirectory() + logName + ".log"
+	defer os.Remove(fn)
+	defer os.Remove(fn + ".created")
+
+	logBytes, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("Failed to read log, %v", err)
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(logBytes)), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode record %s: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("Unexpected records %+v.", records)
+	}
+
+	expected := map[string]interface{}{
+		"level": "info", "component": logName, "pid": float64(os.Getpid()),
+		"correlationId": "id", "command": "ADD", "msg": "LogText 1",
+	}
+	for key, value := range expected {
+		if records[0][key] != value {
+			t.Errorf("Unexpected %s in record %+v.", key, records[0])
+		}
+	}
+
+	if records[1]["level"] != "error" || records[1]["containerId"] != "container" || records[1]["podName"] != "pod" || records[1]["correlationId"] != "id" {
+		t.Errorf("Unexpected entry record %+v.", records[1])
+	}
+
+	if request, ok := records[2]["request"].(map[string]interface{}); !ok || request["Name"] != "request" {
+		t.Errorf("Unexpected request record %+v.", records[2])
+	}
+}
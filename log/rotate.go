@@ -0,0 +1,329 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Extensions of the files kept next to the active log file.
+	compressedFileExtension = ".gz"
+	tempFileExtension       = ".tmp"
+	lockFileExtension       = ".lock"
+	stampFileExtension      = ".created"
+
+	// Age after which a rotation lock left behind by a crashed process is removed.
+	staleLockAge = time.Minute
+)
+
+// rotatedFile is a log file rotated out of the active log file.
+type rotatedFile struct {
+	index int
+	name  string
+	size  int64
+}
+
+// Rotate checks the active log file size and age and rotates log files if necessary.
+//
+// Several processes may share the same log file. Rotation is serialized between them with a
+// lock file, and processes that find the active log file rotated by another process reopen it.
+// The most recently rotated file may still be written by such processes until they notice, so
+// it is compressed on the next rotation. Compression and enforcement of the disk budget run in
+// the background, holding the lock.
+func (logger *Logger) rotate() error {
+	// Return if target is not a log file.
+	if (logger.target != TargetLogfile && logger.target != TargetStdOutAndLogFile) || logger.out == nil {
+		return nil
+	}
+
+	fileName := logger.getLogFileName()
+
+	if rotated, err := logger.isRotatedExternally(fileName); err != nil || rotated {
+		if err != nil {
+			return err
+		}
+		return logger.reopen()
+	}
+
+	if due, err := logger.isRotationDue(fileName); err != nil || !due {
+		return err
+	}
+
+	// Wait for the previous rotation of this process to release the lock.
+	logger.compressions.Wait()
+
+	// Leave rotation to the process holding the lock. This process reopens the log file once rotated.
+	lockName := fileName + lockFileExtension
+	if !tryLockFile(lockName) {
+		return nil
+	}
+
+	// Another process may have rotated the log file since it was checked.
+	rotated, err := logger.isRotatedExternally(fileName)
+	if err != nil || rotated {
+		unlockFile(lockName)
+		if err != nil {
+			return err
+		}
+		return logger.reopen()
+	}
+
+	logger.out.Close()
+
+	// Rotate log files, keeping the last maxFileCount files.
+	for n := logger.maxFileCount - 1; n > 0; n-- {
+		for _, ext := range []string{"", compressedFileExtension} {
+			fn := fmt.Sprintf("%v.%v%v", fileName, n, ext)
+			if n == logger.maxFileCount-1 {
+				os.Remove(fn)
+			} else {
+				os.Rename(fn, fmt.Sprintf("%v.%v%v", fileName, n+1, ext))
+			}
+		}
+	}
+
+	if logger.maxFileCount > 1 {
+		err = os.Rename(fileName, fileName+".1")
+	} else {
+		err = os.Remove(fileName)
+	}
+
+	touchFile(fileName + stampFileExtension)
+
+	// Create a new log file.
+	if openErr := logger.SetTarget(logger.target); err == nil {
+		err = openErr
+	}
+
+	// Compress and clean up the rotated files in the background. The lock is released when done.
+	logger.compressions.Add(1)
+	go logger.cleanUpRotatedFiles(fileName, lockName)
+
+	return err
+}
+
+// Returns whether the active log file is due for rotation by size or age.
+func (logger *Logger) isRotationDue(fileName string) (bool, error) {
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		return false, err
+	}
+
+	if fileInfo.Size() >= int64(logger.maxFileSize) {
+		return true, nil
+	}
+
+	if logger.maxFileAge <= 0 {
+		return false, nil
+	}
+
+	// The age of the active log file is tracked with a stamp file, as file creation time is not portable.
+	stampInfo, err := os.Stat(fileName + stampFileExtension)
+	if os.IsNotExist(err) {
+		return false, touchFile(fileName + stampFileExtension)
+	} else if err != nil {
+		return false, err
+	}
+
+	return fileInfo.Size() > 0 && time.Since(stampInfo.ModTime()) >= logger.maxFileAge, nil
+}
+
+// Returns whether the open log file was rotated or removed by another process.
+func (logger *Logger) isRotatedExternally(fileName string) (bool, error) {
+	file, ok := logger.out.(*os.File)
+	if !ok {
+		return false, nil
+	}
+
+	fileInfo, err := os.Stat(fileName)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	openInfo, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	return !os.SameFile(fileInfo, openInfo), nil
+}
+
+// Reopens the active log file.
+func (logger *Logger) reopen() error {
+	logger.out.Close()
+	return logger.SetTarget(logger.target)
+}
+
+// Compresses the rotated log files except the most recent one, and removes the oldest
+// rotated files exceeding the file count or the disk budget. Releases the lock when done.
+func (logger *Logger) cleanUpRotatedFiles(fileName string, lockName string) {
+	defer logger.compressions.Done()
+	defer unlockFile(lockName)
+
+	var errs []string
+
+	// Temporary files are left behind by processes that crashed while compressing.
+	tempFiles, _ := filepath.Glob(fileName + ".*" + tempFileExtension)
+	for _, fn := range tempFiles {
+		os.Remove(fn)
+	}
+
+	if logger.compress {
+		for _, f := range getRotatedFiles(fileName) {
+			if f.index > 1 && !strings.HasSuffix(f.name, compressedFileExtension) {
+				if err := compressFile(f.name); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+		}
+	}
+
+	maxTotalSize := logger.maxTotalSize
+	if maxTotalSize <= 0 {
+		maxTotalSize = int64(logger.maxFileSize) * int64(logger.maxFileCount)
+	}
+
+	var totalSize int64
+	if fileInfo, err := os.Stat(fileName); err == nil {
+		totalSize = fileInfo.Size()
+	}
+
+	files := getRotatedFiles(fileName)
+	for _, f := range files {
+		totalSize += f.size
+	}
+
+	// Remove the oldest rotated files first.
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if f.index < logger.maxFileCount && totalSize <= maxTotalSize {
+			break
+		}
+
+		if err := os.Remove(f.name); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		totalSize -= f.size
+	}
+
+	if len(errs) > 0 {
+		// Not holding the logger mutex, as a rotation holding it may be waiting for this cleanup.
+		logger.l.Printf("[%v] [log] Failed to clean up rotated log files: %v.", pid, strings.Join(errs, ", "))
+	}
+}
+
+// Returns the rotated files of a log file, ordered from the most recent.
+func getRotatedFiles(fileName string) []rotatedFile {
+	var files []rotatedFile
+
+	names, _ := filepath.Glob(fileName + ".*")
+	for _, name := range names {
+		suffix := strings.TrimPrefix(name, fileName+".")
+		index, err := strconv.Atoi(strings.TrimSuffix(suffix, compressedFileExtension))
+		if err != nil || index < 1 {
+			continue
+		}
+
+		fileInfo, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, rotatedFile{index: index, name: name, size: fileInfo.Size()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].index < files[j].index
+	})
+
+	return files
+}
+
+// Compresses a file with gzip, replacing it with the compressed file.
+func compressFile(fileName string) error {
+	in, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Compress to a temporary file first, so that a crash never leaves a truncated compressed file.
+	tempName := fileName + compressedFileExtension + tempFileExtension
+	out, err := os.OpenFile(tempName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, logFilePerm)
+	if err != nil {
+		return err
+	}
+
+	w := gzip.NewWriter(out)
+	_, err = io.Copy(w, in)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempName)
+		return err
+	}
+
+	if err = os.Rename(tempName, fileName+compressedFileExtension); err != nil {
+		os.Remove(tempName)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(fileName)
+}
+
+// Tries to acquire a lock file without blocking. Lock files older than staleLockAge are removed.
+func tryLockFile(lockName string) bool {
+	for i := 0; i < 2; i++ {
+		file, err := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, logFilePerm)
+		if err == nil {
+			fmt.Fprintf(file, "%v", pid)
+			file.Close()
+			return true
+		}
+
+		lockInfo, statErr := os.Stat(lockName)
+		if !os.IsExist(err) || statErr != nil || time.Since(lockInfo.ModTime()) < staleLockAge {
+			return false
+		}
+
+		os.Remove(lockName)
+	}
+
+	return false
+}
+
+// Releases a lock file.
+func unlockFile(lockName string) {
+	os.Remove(lockName)
+}
+
+// Creates a file or updates its modification time.
+func touchFile(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, logFilePerm)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	now := time.Now()
+	return os.Chtimes(fileName, now, now)
+}
@@ -3,6 +3,8 @@
 
 package log
 
+import "time"
+
 // Standard logger is a pre-defined logger for convenience.
 var stdLog = NewLogger("azure-container-networking", LevelInfo, TargetStderr)
 
@@ -23,10 +25,34 @@ func SetLevel(level int) {
 	stdLog.SetLevel(level)
 }
 
+func SetFormat(format int) {
+	stdLog.SetFormat(format)
+}
+
+func SetFields(fields Fields) {
+	stdLog.SetFields(fields)
+}
+
+func GetFields() Fields {
+	return stdLog.GetFields()
+}
+
 func SetLogFileLimits(maxFileSize int, maxFileCount int) {
 	stdLog.SetLogFileLimits(maxFileSize, maxFileCount)
 }
 
+func SetLogFileMaxAge(maxFileAge time.Duration) {
+	stdLog.SetLogFileMaxAge(maxFileAge)
+}
+
+func SetLogFileMaxTotalSize(maxTotalSize int64) {
+	stdLog.SetLogFileMaxTotalSize(maxTotalSize)
+}
+
+func SetLogFileCompression(compress bool) {
+	stdLog.SetLogFileCompression(compress)
+}
+
 func Close() {
 	stdLog.Close()
 }
@@ -39,6 +65,10 @@ func GetLogDirectory() string {
 	return stdLog.GetLogDirectory()
 }
 
+func WithFields(fields Fields) *Entry {
+	return stdLog.WithFields(fields)
+}
+
 func Request(tag string, request interface{}, err error) {
 	stdLog.Request(tag, request, err)
 }
@@ -0,0 +1,304 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// contentType is the content type of the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of histogram buckets.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a metric that can be written in the Prometheus text exposition format.
+type metric interface {
+	write(buf *bytes.Buffer)
+}
+
+var (
+	registryLock sync.Mutex
+	registry     []metric
+)
+
+// register adds a metric to the ones exposed by Handler.
+func register(m metric) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry = append(registry, m)
+}
+
+// labelSet holds the label names of a metric, and formats label values as series keys.
+type labelSet []string
+
+// key returns the series key of the given label values.
+func (names labelSet) key(values []string) string {
+	if len(values) != len(names) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(names), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// format returns the labels of the series with the given key, followed by extra labels.
+func (names labelSet) format(key string, extra ...string) string {
+	var labels []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			labels = append(labels, fmt.Sprintf("%s=%q", names[i], value))
+		}
+	}
+
+	return strings.Join(append(labels, extra...), ",")
+}
+
+// Counter is a metric that only increases, optionally partitioned by label values.
+type Counter struct {
+	sync.Mutex
+	name   string
+	help   string
+	labels labelSet
+	series map[string]float64
+}
+
+// NewCounter creates and registers a counter partitioned by the given labels.
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labelNames,
+		series: make(map[string]float64),
+	}
+	register(c)
+	return c
+}
+
+// Inc increments by one the counter of the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	key := c.labels.key(labelValues)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.series[key]++
+}
+
+// Get returns the value of the counter of the given label values.
+func (c *Counter) Get(labelValues ...string) float64 {
+	key := c.labels.key(labelValues)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.series[key]
+}
+
+func (c *Counter) write(buf *bytes.Buffer) {
+	c.Lock()
+	defer c.Unlock()
+
+	writeHeader(buf, c.name, c.help, "counter")
+
+	// Counters without labels are always reported.
+	if len(c.labels) == 0 {
+		writeSample(buf, c.name, "", c.series[""])
+		return
+	}
+
+	for _, key := range getSortedKeys(c.series) {
+		writeSample(buf, c.name, c.labels.format(key), c.series[key])
+	}
+}
+
+// Gauge is a metric that can go up and down. Its value is updated atomically so that
+// collecting metrics never waits for the code maintaining it.
+type Gauge struct {
+	bits uint64 // Accessed atomically, first for 64-bit alignment.
+	name string
+	help string
+}
+
+// NewGauge creates and registers a gauge with a value of zero.
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+// Set sets the value of the gauge.
+func (g *Gauge) Set(value float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(value))
+}
+
+// Add adds the given delta to the value of the gauge.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&g.bits, old, updated) {
+			return
+		}
+	}
+}
+
+// Get returns the value of the gauge.
+func (g *Gauge) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) write(buf *bytes.Buffer) {
+	writeHeader(buf, g.name, g.help, "gauge")
+	writeSample(buf, g.name, "", g.Get())
+}
+
+// Histogram counts observations in buckets, optionally partitioned by label values.
+type Histogram struct {
+	sync.Mutex
+	name    string
+	help    string
+	labels  labelSet
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates and registers a histogram with the default buckets, partitioned by the given labels.
+func NewHistogram(name, help string, labelNames ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labelNames,
+		buckets: DefaultBuckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+// Observe records an observation for the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.labels.key(labelValues)
+
+	h.Lock()
+	defer h.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// ObserveSince records the time elapsed since start for the given label values.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// GetCount returns the number of observations recorded for the given label values.
+func (h *Histogram) GetCount(labelValues ...string) uint64 {
+	key := h.labels.key(labelValues)
+
+	h.Lock()
+	defer h.Unlock()
+
+	if series, ok := h.series[key]; ok {
+		return series.count
+	}
+
+	return 0
+}
+
+func (h *Histogram) write(buf *bytes.Buffer) {
+	h.Lock()
+	defer h.Unlock()
+
+	writeHeader(buf, h.name, h.help, "histogram")
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := h.series[key]
+
+		for i, upperBound := range h.buckets {
+			labels := h.labels.format(key, `le="`+formatFloat(upperBound)+`"`)
+			writeSample(buf, h.name+"_bucket", labels, float64(series.counts[i]))
+		}
+		writeSample(buf, h.name+"_bucket", h.labels.format(key, `le="+Inf"`), float64(series.count))
+
+		writeSample(buf, h.name+"_sum", h.labels.format(key), series.sum)
+		writeSample(buf, h.name+"_count", h.labels.format(key), float64(series.count))
+	}
+}
+
+func getSortedKeys(series map[string]float64) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func writeHeader(buf *bytes.Buffer, name, help, metricType string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeSample(buf *bytes.Buffer, name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+
+	fmt.Fprintf(buf, "%s %s\n", name, formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Handler returns an HTTP handler exposing the registered metrics in the Prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryLock.Lock()
+		metrics := append([]metric(nil), registry...)
+		registryLock.Unlock()
+
+		var buf bytes.Buffer
+		for _, m := range metrics {
+			m.write(&buf)
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	counter := NewCounter("test_errors_total", "Test counter.")
+	counter.Inc()
+
+	requests := NewCounter("test_requests_total", "Test counter with labels.", "handler", "code")
+	requests.Inc("/test", "0")
+	requests.Inc("/test", "0")
+
+	gauge := NewGauge("test_num_objects", "Test gauge.")
+	gauge.Set(2)
+	gauge.Add(2)
+	gauge.Add(-1)
+
+	if value := gauge.Get(); value != 3 {
+		t.Errorf("TestHandler failed @ gauge.Get, expected 3, got %v", value)
+	}
+
+	histogram := NewHistogram("test_exec_time_seconds", "Test histogram.", "command")
+	histogram.Observe(0.002, "ipset")
+	histogram.Observe(20, "ipset")
+
+	if count := histogram.GetCount("ipset"); count != 2 {
+		t.Errorf("TestHandler failed @ histogram.GetCount, expected 2, got %d", count)
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := ioutil.ReadAll(recorder.Body)
+	expectedLines := []string{
+		"# TYPE test_errors_total counter",
+		"test_errors_total 1",
+		`test_requests_total{handler="/test",code="0"} 2`,
+		"# TYPE test_num_objects gauge",
+		"test_num_objects 3",
+		"# TYPE test_exec_time_seconds histogram",
+		`test_exec_time_seconds_bucket{command="ipset",le="0.001"} 0`,
+		`test_exec_time_seconds_bucket{command="ipset",le="0.0025"} 1`,
+		`test_exec_time_seconds_bucket{command="ipset",le="+Inf"} 2`,
+		`test_exec_time_seconds_sum{command="ipset"} 20.002`,
+		`test_exec_time_seconds_count{command="ipset"} 2`,
+	}
+
+	for _, line := range expectedLines {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("TestHandler failed @ Handler, missing line %q", line)
+		}
+	}
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("TestHandler failed @ Handler, unexpected content type %s", contentType)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+// +build linux
+
+package netlink
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+// Names of IPVlan modes in ip commands.
+var ipvlanModeNames = map[IPVlanMode]string{
+	IPVLAN_MODE_L2:  "l2",
+	IPVLAN_MODE_L3:  "l3",
+	IPVLAN_MODE_L3S: "l3s",
+}
+
+var (
+	// Links created in dry-run mode, which do not exist on the system, by name.
+	// They are given negative indexes, which are never used by the kernel.
+	plannedLinks     = make(map[string]int)
+	lastPlannedIndex = 0
+	plannedLinksLock sync.Mutex
+)
+
+// GetInterfaceByName returns the network interface with the given name.
+// In dry-run mode, links that would have been created are returned without a hardware address.
+func GetInterfaceByName(name string) (*net.Interface, error) {
+	iface, err := net.InterfaceByName(name)
+	if err == nil || !platform.IsDryRun() {
+		return iface, err
+	}
+
+	plannedLinksLock.Lock()
+	defer plannedLinksLock.Unlock()
+
+	index, ok := plannedLinks[name]
+	if !ok {
+		return nil, err
+	}
+
+	return &net.Interface{Index: index, Name: name, Flags: net.FlagUp}, nil
+}
+
+// Records that a link would have been created, renamed or deleted in dry-run mode.
+// Links are created with an empty name, and deleted with an empty new name.
+func setPlannedLink(name string, newName string) {
+	plannedLinksLock.Lock()
+	defer plannedLinksLock.Unlock()
+
+	index, ok := plannedLinks[name]
+	delete(plannedLinks, name)
+
+	if newName == "" {
+		return
+	}
+
+	if !ok {
+		lastPlannedIndex--
+		index = lastPlannedIndex
+	}
+
+	plannedLinks[newName] = index
+}
+
+// Returns the name of the link with the given index, including links created in dry-run mode.
+func getPlannedLinkName(index int) string {
+	if iface, err := net.InterfaceByIndex(index); err == nil {
+		return iface.Name
+	}
+
+	plannedLinksLock.Lock()
+	defer plannedLinksLock.Unlock()
+
+	for name, i := range plannedLinks {
+		if i == index {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("<index %v>", index)
+}
+
+// Returns the ip command creating a link.
+func getAddLinkCommand(link Link) string {
+	info := link.Info()
+	cmd := fmt.Sprintf("ip link add %v", info.Name)
+
+	if info.MTU > 0 {
+		cmd += fmt.Sprintf(" mtu %v", info.MTU)
+	}
+
+	if info.Flags&net.FlagUp != 0 {
+		cmd += " up"
+	}
+
+	cmd += fmt.Sprintf(" type %v", info.Type)
+
+	switch l := link.(type) {
+	case *VEthLink:
+		cmd += fmt.Sprintf(" peer name %v", l.PeerName)
+	case *IPVlanLink:
+		cmd += fmt.Sprintf(" mode %v", ipvlanModeNames[l.Mode])
+	}
+
+	return cmd
+}
+
+// Returns the arguments of an ip route command for a route.
+func getRouteArgs(route *Route) string {
+	args := "default"
+	if route.Dst != nil {
+		args = route.Dst.String()
+	}
+
+	if route.Gw != nil {
+		args += fmt.Sprintf(" via %v", route.Gw)
+	}
+
+	if route.LinkIndex != 0 {
+		args += fmt.Sprintf(" dev %v", getPlannedLinkName(route.LinkIndex))
+	}
+
+	if route.Table != 0 {
+		args += fmt.Sprintf(" table %v", route.Table)
+	}
+
+	return args
+}
+
+// Returns the add or del subcommand of a command.
+func getDryRunOp(add bool) string {
+	if add {
+		return "add"
+	}
+
+	return "del"
+}
+
+// Returns the on or off argument of a command.
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+
+	return "off"
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+// +build linux
+
+package netlink
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"golang.org/x/sys/unix"
+)
+
+// Ethtool commands setting offload features.
+const (
+	ETHTOOL_SRXCSUM = 0x15
+	ETHTOOL_STXCSUM = 0x17
+	ETHTOOL_SSG     = 0x19
+	ETHTOOL_STSO    = 0x1f
+	ETHTOOL_SGSO    = 0x24
+	ETHTOOL_SGRO    = 0x2c
+)
+
+// Offload features, named as in ethtool -K.
+var offloadCommands = map[string]uint32{
+	"rx":  ETHTOOL_SRXCSUM,
+	"tx":  ETHTOOL_STXCSUM,
+	"sg":  ETHTOOL_SSG,
+	"tso": ETHTOOL_STSO,
+	"gso": ETHTOOL_SGSO,
+	"gro": ETHTOOL_SGRO,
+}
+
+// ethtoolValue is the ethtool_value structure passed to ethtool commands.
+type ethtoolValue struct {
+	cmd  uint32
+	data uint32
+}
+
+// ifreqData is the ifreq structure with a pointer to the data of an ioctl.
+type ifreqData struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+// SetLinkOffload turns an offload feature of a network interface on or off.
+func SetLinkOffload(ifName string, feature string, on bool) error {
+	cmd, ok := offloadCommands[feature]
+	if !ok {
+		return fmt.Errorf("Unsupported offload feature %v", feature)
+	}
+
+	if platform.DryRun("ethtool -K %v %v %v", ifName, feature, onOff(on)) {
+		return nil
+	}
+
+	if len(ifName) >= unix.IFNAMSIZ {
+		return fmt.Errorf("Invalid interface name %v", ifName)
+	}
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	value := ethtoolValue{cmd: cmd}
+	if on {
+		value.data = 1
+	}
+
+	var ifr ifreqData
+	copy(ifr.name[:], ifName)
+	ifr.data = unsafe.Pointer(&value)
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)))
+	if errno != 0 {
+		return fmt.Errorf("Failed to set offload feature %v of %v: %v", feature, ifName, errno)
+	}
+
+	return nil
+}
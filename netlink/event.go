@@ -0,0 +1,160 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+// +build linux
+
+package netlink
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Multicast groups of link, address and route notifications.
+	EVENT_GROUP_LINK    = RTMGRP_LINK
+	EVENT_GROUP_ADDRESS = RTMGRP_IPV4_IFADDR | RTMGRP_IPV6_IFADDR
+	EVENT_GROUP_ROUTE   = RTMGRP_IPV4_ROUTE | RTMGRP_IPV6_ROUTE
+
+	// Interval at which a subscription checks whether it is closed while waiting for notifications.
+	subscriptionPollInterval = time.Second
+
+	// Number of notifications buffered for the subscriber.
+	subscriptionQueueLength = 64
+)
+
+// Event represents a link, address or route change notification.
+// Type is the netlink message type, such as RTM_NEWLINK or RTM_DELLINK,
+// and exactly one of Link, Address and Route is set.
+type Event struct {
+	Type    int
+	Link    Link
+	Address *IpAddress
+	Route   *Route
+}
+
+// Subscription receives change notifications from a multicast netlink socket.
+type Subscription struct {
+	s         *socket
+	events    chan *Event
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Subscribe creates a subscription to the notifications of the given multicast groups.
+func Subscribe(groups uint32) (*Subscription, error) {
+	s, err := newSocket(groups)
+	if err != nil {
+		return nil, err
+	}
+
+	// Time out receives periodically so that the subscription can be closed.
+	tv := unix.NsecToTimeval(subscriptionPollInterval.Nanoseconds())
+	err = unix.SetsockoptTimeval(s.fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+
+	sub := &Subscription{
+		s:      s,
+		events: make(chan *Event, subscriptionQueueLength),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	log.Printf("[netlink] Subscribed to multicast groups %#x.", groups)
+
+	go sub.receive()
+
+	return sub, nil
+}
+
+// Events returns the channel of notifications. The channel is closed when the subscription ends.
+func (sub *Subscription) Events() <-chan *Event {
+	return sub.events
+}
+
+// Close ends the subscription and closes its socket.
+func (sub *Subscription) Close() {
+	sub.closeOnce.Do(func() {
+		close(sub.stop)
+		<-sub.done
+		sub.s.close()
+	})
+}
+
+// Receives notifications until the subscription is closed or the socket fails.
+func (sub *Subscription) receive() {
+	defer close(sub.done)
+	defer close(sub.events)
+
+	for {
+		select {
+		case <-sub.stop:
+			return
+		default:
+		}
+
+		nlMsgs, err := sub.s.receive()
+		if err != nil {
+			switch err {
+			case unix.EAGAIN, unix.EINTR:
+				continue
+			case unix.ENOBUFS:
+				// Notifications were dropped. Subscribers need to resynchronize with a dump.
+				log.Printf("[netlink] Subscription receive buffer overrun.")
+				continue
+			}
+
+			log.Printf("[netlink] Subscription receive err=%v.", err)
+			return
+		}
+
+		for _, nlMsg := range nlMsgs {
+			event, err := parseEvent(newMessageFromNetlink(&nlMsg))
+			if err != nil {
+				log.Printf("[netlink] Failed to parse notification, err=%v.", err)
+				continue
+			}
+
+			if event == nil {
+				continue
+			}
+
+			select {
+			case sub.events <- event:
+			case <-sub.stop:
+				return
+			}
+		}
+	}
+}
+
+// Decodes a notification message. Returns nil for messages that are not notifications.
+func parseEvent(msg *message) (*Event, error) {
+	var err error
+
+	event := &Event{Type: int(msg.Type)}
+
+	switch msg.Type {
+	case unix.RTM_NEWLINK, unix.RTM_DELLINK:
+		event.Link, err = deserializeLink(msg, nil)
+	case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+		event.Address, err = deserializeIpAddress(msg)
+	case unix.RTM_NEWROUTE, unix.RTM_DELROUTE:
+		event.Route, err = deserializeRoute(msg)
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
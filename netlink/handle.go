@@ -0,0 +1,327 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+// +build linux
+
+package netlink
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/Azure/azure-container-networking/log"
+	"golang.org/x/sys/unix"
+)
+
+// Handle is a netlink socket bound to a network namespace.
+// All operations on a handle apply to its namespace, regardless of the namespace of the calling thread.
+type Handle struct {
+	s *socket
+}
+
+// NewHandle creates a handle for the network namespace of the calling thread.
+func NewHandle() (*Handle, error) {
+	s, err := newSocket(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handle{s: s}, nil
+}
+
+// NewHandleAt creates a handle for the network namespace with the given file descriptor.
+func NewHandleAt(nsFd uintptr) (*Handle, error) {
+	s, err := newSocketAt(nsFd, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handle{s: s}, nil
+}
+
+// Delete closes the socket of the handle.
+func (h *Handle) Delete() {
+	if h.s != nil {
+		h.s.close()
+		h.s = nil
+	}
+}
+
+// Returns a handle on the default netlink socket.
+func getHandle() (*Handle, error) {
+	s, err := getSocket()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handle{s: s}, nil
+}
+
+// Creates a new netlink socket in the network namespace with the given file descriptor.
+// The socket stays in that namespace after it is created. The namespace switch is done on
+// a dedicated OS thread, which is discarded if it cannot return to its original namespace.
+func newSocketAt(nsFd uintptr, groups uint32) (*socket, error) {
+	type result struct {
+		s   *socket
+		err error
+	}
+
+	ch := make(chan result, 1)
+
+	go func() {
+		runtime.LockOSThread()
+
+		curNs, err := os.Open(fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			ch <- result{err: err}
+			return
+		}
+		defer curNs.Close()
+
+		if err := unix.Setns(int(nsFd), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			ch <- result{err: fmt.Errorf("Failed to set namespace, err:%v", err)}
+			return
+		}
+
+		s, err := newSocket(groups)
+
+		if nsErr := unix.Setns(int(curNs.Fd()), unix.CLONE_NEWNET); nsErr != nil {
+			// Leave the thread locked so that it exits with the goroutine.
+			log.Printf("[netlink] Failed to restore namespace, err:%v", nsErr)
+		} else {
+			runtime.UnlockOSThread()
+		}
+
+		ch <- result{s: s, err: err}
+	}()
+
+	r := <-ch
+	return r.s, r.err
+}
+
+// Echo sends a netlink echo request message.
+func Echo(text string) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.Echo(text)
+}
+
+// AddLink adds a new network interface of a specified type.
+func AddLink(link Link) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.AddLink(link)
+}
+
+// GetLinks returns all network interfaces.
+func GetLinks() ([]Link, error) {
+	h, err := getHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.GetLinks()
+}
+
+// GetLinkByName returns the network interface with the given name.
+func GetLinkByName(name string) (Link, error) {
+	h, err := getHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.GetLinkByName(name)
+}
+
+// DeleteLink deletes a network interface.
+func DeleteLink(name string) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.DeleteLink(name)
+}
+
+// SetLinkName sets the name of a network interface.
+func SetLinkName(name string, newName string) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkName(name, newName)
+}
+
+// SetLinkState sets the operational state of a network interface.
+func SetLinkState(name string, up bool) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkState(name, up)
+}
+
+// SetLinkMaster sets the master (upper) device of a network interface.
+func SetLinkMaster(name string, master string) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkMaster(name, master)
+}
+
+// SetLinkNetNs sets the network namespace of a network interface.
+func SetLinkNetNs(name string, fd uintptr) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkNetNs(name, fd)
+}
+
+// SetLinkAddress sets the link layer hardware address of a network interface.
+func SetLinkAddress(ifName string, hwAddress net.HardwareAddr) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkAddress(ifName, hwAddress)
+}
+
+// SetLinkMTU sets the MTU of a network interface.
+func SetLinkMTU(ifName string, mtu int) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkMTU(ifName, mtu)
+}
+
+// SetLinkPromisc sets the promiscuous mode of a network interface.
+func SetLinkPromisc(ifName string, on bool) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkPromisc(ifName, on)
+}
+
+// SetLinkHairpin sets the hairpin (reflective relay) mode of a bridged interface.
+func SetLinkHairpin(bridgeName string, on bool) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.SetLinkHairpin(bridgeName, on)
+}
+
+// AddOrRemoveStaticArp sets/removes static arp entry based on mode
+func AddOrRemoveStaticArp(mode int, name string, ipaddr net.IP, mac net.HardwareAddr) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.AddOrRemoveStaticArp(mode, name, ipaddr, mac)
+}
+
+// AddOrRemoveProxyNeighbor sets/removes a proxy neighbor entry based on mode.
+// The kernel answers IPv6 neighbor solicitations for proxied addresses on the given interface.
+func AddOrRemoveProxyNeighbor(mode int, name string, ipaddr net.IP) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.AddOrRemoveProxyNeighbor(mode, name, ipaddr)
+}
+
+// GetNeighbors returns the neighbor cache entries of the given address family on a network interface.
+// An empty interface name returns the entries of all interfaces, and AF_UNSPEC all address families.
+func GetNeighbors(ifName string, family int) ([]*Neighbor, error) {
+	h, err := getHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.GetNeighbors(ifName, family)
+}
+
+// AddIpAddress adds an IP address to a network interface.
+func AddIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.AddIpAddress(ifName, ipAddress, ipNet)
+}
+
+// DeleteIpAddress deletes an IP address from a network interface.
+func DeleteIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.DeleteIpAddress(ifName, ipAddress, ipNet)
+}
+
+// GetIpAddresses returns the IP addresses of the given address family assigned to a network interface.
+// An empty interface name returns the addresses of all interfaces, and AF_UNSPEC all address families.
+func GetIpAddresses(ifName string, family int) ([]*IpAddress, error) {
+	h, err := getHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.GetIpAddresses(ifName, family)
+}
+
+// GetIpRoute returns a list of IP routes matching the given filter.
+func GetIpRoute(filter *Route) ([]*Route, error) {
+	h, err := getHandle()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.GetIpRoute(filter)
+}
+
+// AddIpRoute adds an IP route to the route table.
+func AddIpRoute(route *Route) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.AddIpRoute(route)
+}
+
+// DeleteIpRoute deletes an IP route from the route table.
+func DeleteIpRoute(route *Route) error {
+	h, err := getHandle()
+	if err != nil {
+		return err
+	}
+
+	return h.DeleteIpRoute(route)
+}
@@ -6,8 +6,10 @@
 package netlink
 
 import (
+	"fmt"
 	"net"
 
+	"github.com/Azure/azure-container-networking/platform"
 	"golang.org/x/sys/unix"
 )
 
@@ -34,15 +36,14 @@ func GetIpAddressFamily(ip net.IP) int {
 }
 
 // setIpAddress sends an IP address set request.
-func setIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet, add bool) error {
+func (h *Handle) setIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet, add bool) error {
 	var msgType, flags int
 
-	s, err := getSocket()
-	if err != nil {
-		return err
+	if platform.DryRun("ip addr %v %v dev %v", getDryRunOp(add), &net.IPNet{IP: ipAddress, Mask: ipNet.Mask}, ifName) {
+		return nil
 	}
 
-	iface, err := net.InterfaceByName(ifName)
+	index, err := h.getLinkIndex(ifName)
 	if err != nil {
 		return err
 	}
@@ -60,7 +61,7 @@ func setIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet, add bool) e
 	family := GetIpAddressFamily(ipAddress)
 
 	ifAddr := newIfAddrMsg(family)
-	ifAddr.Index = uint32(iface.Index)
+	ifAddr.Index = uint32(index)
 	prefixLen, _ := ipNet.Mask.Size()
 	ifAddr.Prefixlen = uint8(prefixLen)
 	req.addPayload(ifAddr)
@@ -75,17 +76,120 @@ func setIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet, add bool) e
 	req.addPayload(newAttribute(unix.IFA_LOCAL, ipAddrValue))
 	req.addPayload(newAttribute(unix.IFA_ADDRESS, ipAddrValue))
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // AddIpAddress adds an IP address to a network interface.
-func AddIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet) error {
-	return setIpAddress(ifName, ipAddress, ipNet, true)
+func (h *Handle) AddIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet) error {
+	return h.setIpAddress(ifName, ipAddress, ipNet, true)
 }
 
 // DeleteIpAddress deletes an IP address from a network interface.
-func DeleteIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet) error {
-	return setIpAddress(ifName, ipAddress, ipNet, false)
+func (h *Handle) DeleteIpAddress(ifName string, ipAddress net.IP, ipNet *net.IPNet) error {
+	return h.setIpAddress(ifName, ipAddress, ipNet, false)
+}
+
+// IpAddress represents an IP address assigned to a network interface.
+type IpAddress struct {
+	Family    int
+	LinkIndex int
+	IP        net.IP
+	IPNet     *net.IPNet
+	Scope     int
+	Flags     int
+	Label     string
+}
+
+// deserializeIpAddress decodes a netlink message into an IpAddress struct.
+func deserializeIpAddress(msg *message) (*IpAddress, error) {
+	if len(msg.data) < unix.SizeofIfAddrmsg {
+		return nil, fmt.Errorf("Invalid address message")
+	}
+
+	// Parse address message.
+	ifAddr := deserializeIfAddrMsg(msg.data)
+	attrs := msg.getAttributes(ifAddr)
+
+	addr := IpAddress{
+		Family:    int(ifAddr.Family),
+		LinkIndex: int(ifAddr.Index),
+		Scope:     int(ifAddr.Scope),
+		Flags:     int(ifAddr.Flags),
+	}
+
+	var local, address net.IP
+
+	// Populate address attributes.
+	for _, attr := range attrs {
+		switch attr.Type {
+		case unix.IFA_LOCAL:
+			local = net.IP(attr.value)
+		case unix.IFA_ADDRESS:
+			address = net.IP(attr.value)
+		case unix.IFA_LABEL:
+			addr.Label = attr.getString()
+		case unix.IFA_FLAGS:
+			addr.Flags = int(attr.getUint32())
+		}
+	}
+
+	// IFA_LOCAL is the local address on point-to-point interfaces, where IFA_ADDRESS is the peer.
+	addr.IP = local
+	if addr.IP == nil {
+		addr.IP = address
+	}
+
+	if addr.IP != nil {
+		addr.IPNet = &net.IPNet{
+			IP:   addr.IP,
+			Mask: net.CIDRMask(int(ifAddr.Prefixlen), 8*len(addr.IP)),
+		}
+	}
+
+	return &addr, nil
+}
+
+// GetIpAddresses returns the IP addresses of the given address family assigned to a network interface.
+// An empty interface name returns the addresses of all interfaces, and AF_UNSPEC all address families.
+func (h *Handle) GetIpAddresses(ifName string, family int) ([]*IpAddress, error) {
+	var index int
+	if ifName != "" {
+		var err error
+		index, err = h.getLinkIndex(ifName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req := newRequest(unix.RTM_GETADDR, unix.NLM_F_DUMP)
+	req.addPayload(newIfAddrMsg(family))
+
+	msgs, err := h.s.sendAndWaitForResponse(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []*IpAddress
+
+	for _, msg := range msgs {
+		if msg.Type != unix.RTM_NEWADDR {
+			continue
+		}
+
+		addr, err := deserializeIpAddress(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		// Filter by link index.
+		if index != 0 && index != addr.LinkIndex {
+			continue
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
 }
 
 // Route represents a netlink route.
@@ -107,6 +211,10 @@ type Route struct {
 
 // deserializeRoute decodes a netlink message into a Route struct.
 func deserializeRoute(msg *message) (*Route, error) {
+	if len(msg.data) < unix.SizeofRtMsg {
+		return nil, fmt.Errorf("Invalid route message")
+	}
+
 	// Parse route message.
 	rtmsg := deserializeRtMsg(msg.data)
 	attrs := msg.getAttributes(rtmsg)
@@ -149,19 +257,14 @@ func deserializeRoute(msg *message) (*Route, error) {
 }
 
 // GetIpRoute returns a list of IP routes matching the given filter.
-func GetIpRoute(filter *Route) ([]*Route, error) {
-	s, err := getSocket()
-	if err != nil {
-		return nil, err
-	}
-
+func (h *Handle) GetIpRoute(filter *Route) ([]*Route, error) {
 	req := newRequest(unix.RTM_GETROUTE, unix.NLM_F_DUMP)
 
 	ifInfo := newIfInfoMsg()
 	ifInfo.Family = uint8(filter.Family)
 	req.addPayload(ifInfo)
 
-	msgs, err := s.sendAndWaitForResponse(req)
+	msgs, err := h.s.sendAndWaitForResponse(req)
 	if err != nil {
 		return nil, err
 	}
@@ -221,12 +324,11 @@ func GetIpRoute(filter *Route) ([]*Route, error) {
 }
 
 // setIpRoute sends an IP route set request.
-func setIpRoute(route *Route, add bool) error {
+func (h *Handle) setIpRoute(route *Route, add bool) error {
 	var msgType, flags int
 
-	s, err := getSocket()
-	if err != nil {
-		return err
+	if platform.DryRun("ip route %v %v", getDryRunOp(add), getRouteArgs(route)) {
+		return nil
 	}
 
 	if add {
@@ -285,15 +387,15 @@ func setIpRoute(route *Route, add bool) error {
 		req.addPayload(newAttributeUint32(unix.RTA_IIF, uint32(route.ILinkIndex)))
 	}
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // AddIpRoute adds an IP route to the route table.
-func AddIpRoute(route *Route) error {
-	return setIpRoute(route, true)
+func (h *Handle) AddIpRoute(route *Route) error {
+	return h.setIpRoute(route, true)
 }
 
 // DeleteIpRoute deletes an IP route from the route table.
-func DeleteIpRoute(route *Route) error {
-	return setIpRoute(route, false)
+func (h *Handle) DeleteIpRoute(route *Route) error {
+	return h.setIpRoute(route, false)
 }
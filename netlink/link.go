@@ -10,6 +10,7 @@ import (
 	"net"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/platform"
 	"golang.org/x/sys/unix"
 )
 
@@ -19,6 +20,7 @@ const (
 	LINK_TYPE_VETH   = "veth"
 	LINK_TYPE_IPVLAN = "ipvlan"
 	LINK_TYPE_DUMMY  = "dummy"
+	LINK_TYPE_IFB    = "ifb"
 )
 
 // IPVLAN link attributes.
@@ -43,12 +45,15 @@ type Link interface {
 
 // LinkInfo respresents the common properties of all network interfaces.
 type LinkInfo struct {
-	Type        string
-	Name        string
-	Flags       net.Flags
-	MTU         uint
-	TxQLen      uint
-	ParentIndex int
+	Type         string
+	Name         string
+	Flags        net.Flags
+	MTU          uint
+	TxQLen       uint
+	ParentIndex  int
+	Index        int
+	MasterIndex  int
+	HardwareAddr net.HardwareAddr
 }
 
 func (linkInfo *LinkInfo) Info() *LinkInfo {
@@ -77,8 +82,13 @@ type DummyLink struct {
 	LinkInfo
 }
 
+// IFBLink represents an intermediate functional block network interface.
+type IFBLink struct {
+	LinkInfo
+}
+
 // AddLink adds a new network interface of a specified type.
-func AddLink(link Link) error {
+func (h *Handle) AddLink(link Link) error {
 	var info *LinkInfo
 	info = link.Info()
 
@@ -86,9 +96,12 @@ func AddLink(link Link) error {
 		return fmt.Errorf("Invalid link name or type")
 	}
 
-	s, err := getSocket()
-	if err != nil {
-		return err
+	if platform.DryRun("%s", getAddLinkCommand(link)) {
+		setPlannedLink("", info.Name)
+		if veth, ok := link.(*VEthLink); ok {
+			setPlannedLink("", veth.PeerName)
+		}
+		return nil
 	}
 
 	req := newRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL|unix.NLM_F_ACK)
@@ -134,6 +147,10 @@ func AddLink(link Link) error {
 		attrPeer := newAttribute(VETH_INFO_PEER, nil)
 		attrPeer.addNested(newIfInfoMsg())
 		attrPeer.addNested(newAttributeStringZ(unix.IFLA_IFNAME, veth.PeerName))
+		if info.MTU > 0 {
+			// Both ends of the veth pair have the same MTU.
+			attrPeer.addNested(newAttributeUint32(unix.IFLA_MTU, uint32(info.MTU)))
+		}
 		attrData.addNested(attrPeer)
 
 		attrLinkInfo.addNested(attrData)
@@ -148,44 +165,250 @@ func AddLink(link Link) error {
 
 	req.addPayload(attrLinkInfo)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
+}
+
+// deserializeLink decodes a netlink message into a typed Link.
+// Links of types without a specific type are returned as *LinkInfo.
+// The optional getLinkName function resolves the peer names of veth links.
+func deserializeLink(msg *message, getLinkName func(index int) string) (Link, error) {
+	if len(msg.data) < unix.SizeofIfInfomsg {
+		return nil, fmt.Errorf("Invalid link message")
+	}
+
+	// Parse interface info message.
+	ifInfo := deserializeIfInfoMsg(msg.data)
+	attrs := msg.getAttributes(ifInfo)
+
+	info := LinkInfo{
+		Index: int(ifInfo.Index),
+		Flags: linkFlags(ifInfo.Flags),
+	}
+
+	var linkData []*attribute
+	var peerNetNs bool
+
+	// Populate link attributes.
+	for _, attr := range attrs {
+		switch attr.Type {
+		case unix.IFLA_IFNAME:
+			info.Name = attr.getString()
+		case unix.IFLA_MTU:
+			info.MTU = uint(attr.getUint32())
+		case unix.IFLA_TXQLEN:
+			info.TxQLen = uint(attr.getUint32())
+		case unix.IFLA_LINK:
+			info.ParentIndex = int(attr.getUint32())
+		case unix.IFLA_MASTER:
+			info.MasterIndex = int(attr.getUint32())
+		case unix.IFLA_ADDRESS:
+			info.HardwareAddr = net.HardwareAddr(attr.value)
+		case unix.IFLA_LINK_NETNSID:
+			peerNetNs = true
+		case unix.IFLA_LINKINFO:
+			for _, nested := range parseAttributes(attr.value) {
+				switch nested.Type {
+				case IFLA_INFO_KIND:
+					info.Type = nested.getString()
+				case IFLA_INFO_DATA:
+					linkData = parseAttributes(nested.value)
+				}
+			}
+		}
+	}
+
+	switch info.Type {
+	case LINK_TYPE_BRIDGE:
+		return &BridgeLink{LinkInfo: info}, nil
+
+	case LINK_TYPE_VETH:
+		veth := &VEthLink{LinkInfo: info}
+		// The peer index refers to another namespace if the link-netnsid is present.
+		if info.ParentIndex != 0 && !peerNetNs && getLinkName != nil {
+			veth.PeerName = getLinkName(info.ParentIndex)
+		}
+		return veth, nil
+
+	case LINK_TYPE_IPVLAN:
+		ipvlan := &IPVlanLink{LinkInfo: info}
+		for _, attr := range linkData {
+			if attr.Type == IFLA_IPVLAN_MODE && len(attr.value) >= 2 {
+				ipvlan.Mode = IPVlanMode(encoder.Uint16(attr.value[0:2]))
+			}
+		}
+		return ipvlan, nil
+
+	case LINK_TYPE_DUMMY:
+		return &DummyLink{LinkInfo: info}, nil
+
+	case LINK_TYPE_IFB:
+		return &IFBLink{LinkInfo: info}, nil
+	}
+
+	return &info, nil
+}
+
+// linkFlags converts interface flags to net.Flags.
+func linkFlags(rawFlags uint32) net.Flags {
+	var flags net.Flags
+
+	if rawFlags&unix.IFF_UP != 0 {
+		flags |= net.FlagUp
+	}
+	if rawFlags&unix.IFF_BROADCAST != 0 {
+		flags |= net.FlagBroadcast
+	}
+	if rawFlags&unix.IFF_LOOPBACK != 0 {
+		flags |= net.FlagLoopback
+	}
+	if rawFlags&unix.IFF_POINTOPOINT != 0 {
+		flags |= net.FlagPointToPoint
+	}
+	if rawFlags&unix.IFF_MULTICAST != 0 {
+		flags |= net.FlagMulticast
+	}
+
+	return flags
+}
+
+// GetLinks returns all network interfaces.
+func (h *Handle) GetLinks() ([]Link, error) {
+	req := newRequest(unix.RTM_GETLINK, unix.NLM_F_DUMP)
+	req.addPayload(newIfInfoMsg())
+
+	msgs, err := h.s.sendAndWaitForResponse(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var linkMsgs []*message
+	names := make(map[int]string)
+
+	for _, msg := range msgs {
+		if msg.Type != unix.RTM_NEWLINK {
+			continue
+		}
+
+		link, err := deserializeLink(msg, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		linkMsgs = append(linkMsgs, msg)
+		names[link.Info().Index] = link.Info().Name
+	}
+
+	// Resolve veth peer names from the same dump.
+	getLinkName := func(index int) string { return names[index] }
+
+	var links []Link
+
+	for _, msg := range linkMsgs {
+		link, _ := deserializeLink(msg, getLinkName)
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// GetLinkByName returns the network interface with the given name.
+func (h *Handle) GetLinkByName(name string) (Link, error) {
+	msg, err := h.getLink(0, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return deserializeLink(msg, h.getLinkName)
+}
+
+// Requests the link message of the network interface with the given index or name.
+func (h *Handle) getLink(index int, name string) (*message, error) {
+	req := newRequest(unix.RTM_GETLINK, 0)
+
+	ifInfo := newIfInfoMsg()
+	ifInfo.Index = int32(index)
+	req.addPayload(ifInfo)
+
+	if name != "" {
+		req.addPayload(newAttributeStringZ(unix.IFLA_IFNAME, name))
+	}
+
+	msgs, err := h.s.sendAndWaitForResponse(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgs {
+		if msg.Type == unix.RTM_NEWLINK && len(msg.data) >= unix.SizeofIfInfomsg {
+			return msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Link %v%v not found", name, index)
+}
+
+// Returns the index of the network interface with the given name.
+// The interface is looked up in the namespace of the handle.
+func (h *Handle) getLinkIndex(name string) (int, error) {
+	msg, err := h.getLink(0, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(deserializeIfInfoMsg(msg.data).Index), nil
+}
+
+// Returns the name of the network interface with the given index, or an empty string if not found.
+func (h *Handle) getLinkName(index int) string {
+	msg, err := h.getLink(index, "")
+	if err != nil {
+		return ""
+	}
+
+	for _, attr := range msg.getAttributes(nil) {
+		if attr.Type == unix.IFLA_IFNAME {
+			return attr.getString()
+		}
+	}
+
+	return ""
 }
 
 // DeleteLink deletes a network interface.
-func DeleteLink(name string) error {
+func (h *Handle) DeleteLink(name string) error {
 	if name == "" {
 		log.Printf("[net] Invalid link name. Not returning error")
 		return nil
 	}
 
-	iface, err := net.InterfaceByName(name)
-	if err != nil {
-		log.Printf("[net] Interface not found. Not returning error")
+	if platform.DryRun("ip link delete %v", name) {
+		setPlannedLink(name, "")
 		return nil
 	}
 
-	s, err := getSocket()
+	index, err := h.getLinkIndex(name)
 	if err != nil {
-		return err
+		log.Printf("[net] Interface not found. Not returning error")
+		return nil
 	}
 
 	req := newRequest(unix.RTM_DELLINK, unix.NLM_F_ACK)
 
 	ifInfo := newIfInfoMsg()
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 	req.addPayload(ifInfo)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // SetLinkName sets the name of a network interface.
-func SetLinkName(name string, newName string) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
+func (h *Handle) SetLinkName(name string, newName string) error {
+	if platform.DryRun("ip link set %v name %v", name, newName) {
+		setPlannedLink(name, newName)
+		return nil
 	}
 
-	iface, err := net.InterfaceByName(name)
+	index, err := h.getLinkIndex(name)
 	if err != nil {
 		return err
 	}
@@ -194,7 +417,7 @@ func SetLinkName(name string, newName string) error {
 
 	ifInfo := newIfInfoMsg()
 	ifInfo.Type = unix.RTM_SETLINK
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 	ifInfo.Flags = unix.NLM_F_REQUEST
 	ifInfo.Change = DEFAULT_CHANGE
 	req.addPayload(ifInfo)
@@ -202,17 +425,21 @@ func SetLinkName(name string, newName string) error {
 	attrName := newAttributeString(unix.IFLA_IFNAME, newName)
 	req.addPayload(attrName)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // SetLinkState sets the operational state of a network interface.
-func SetLinkState(name string, up bool) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
+func (h *Handle) SetLinkState(name string, up bool) error {
+	state := "down"
+	if up {
+		state = "up"
 	}
 
-	iface, err := net.InterfaceByName(name)
+	if platform.DryRun("ip link set %v %v", name, state) {
+		return nil
+	}
+
+	index, err := h.getLinkIndex(name)
 	if err != nil {
 		return err
 	}
@@ -221,7 +448,7 @@ func SetLinkState(name string, up bool) error {
 
 	ifInfo := newIfInfoMsg()
 	ifInfo.Type = unix.RTM_SETLINK
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 
 	if up {
 		ifInfo.Flags = unix.IFF_UP
@@ -233,35 +460,38 @@ func SetLinkState(name string, up bool) error {
 
 	req.addPayload(ifInfo)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // SetLinkMaster sets the master (upper) device of a network interface.
-func SetLinkMaster(name string, master string) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
+func (h *Handle) SetLinkMaster(name string, master string) error {
+	if master == "" {
+		if platform.DryRun("ip link set %v nomaster", name) {
+			return nil
+		}
+	} else if platform.DryRun("ip link set %v master %v", name, master) {
+		return nil
 	}
 
-	iface, err := net.InterfaceByName(name)
+	index, err := h.getLinkIndex(name)
 	if err != nil {
 		return err
 	}
 
 	var masterIndex uint32
 	if master != "" {
-		masterIface, err := net.InterfaceByName(master)
+		masterIfIndex, err := h.getLinkIndex(master)
 		if err != nil {
 			return err
 		}
-		masterIndex = uint32(masterIface.Index)
+		masterIndex = uint32(masterIfIndex)
 	}
 
 	req := newRequest(unix.RTM_SETLINK, unix.NLM_F_ACK)
 
 	ifInfo := newIfInfoMsg()
 	ifInfo.Type = unix.RTM_SETLINK
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 	ifInfo.Flags = unix.NLM_F_REQUEST
 	ifInfo.Change = DEFAULT_CHANGE
 	req.addPayload(ifInfo)
@@ -269,17 +499,16 @@ func SetLinkMaster(name string, master string) error {
 	attrMaster := newAttributeUint32(unix.IFLA_MASTER, masterIndex)
 	req.addPayload(attrMaster)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // SetLinkNetNs sets the network namespace of a network interface.
-func SetLinkNetNs(name string, fd uintptr) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
+func (h *Handle) SetLinkNetNs(name string, fd uintptr) error {
+	if platform.DryRun("ip link set %v netns <fd %v>", name, fd) {
+		return nil
 	}
 
-	iface, err := net.InterfaceByName(name)
+	index, err := h.getLinkIndex(name)
 	if err != nil {
 		return err
 	}
@@ -288,7 +517,7 @@ func SetLinkNetNs(name string, fd uintptr) error {
 
 	ifInfo := newIfInfoMsg()
 	ifInfo.Type = unix.RTM_SETLINK
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 	ifInfo.Flags = unix.NLM_F_REQUEST
 	ifInfo.Change = DEFAULT_CHANGE
 	req.addPayload(ifInfo)
@@ -296,17 +525,16 @@ func SetLinkNetNs(name string, fd uintptr) error {
 	attrNetNs := newAttributeUint32(IFLA_NET_NS_FD, uint32(fd))
 	req.addPayload(attrNetNs)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // SetLinkAddress sets the link layer hardware address of a network interface.
-func SetLinkAddress(ifName string, hwAddress net.HardwareAddr) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
+func (h *Handle) SetLinkAddress(ifName string, hwAddress net.HardwareAddr) error {
+	if platform.DryRun("ip link set %v address %v", ifName, hwAddress) {
+		return nil
 	}
 
-	iface, err := net.InterfaceByName(ifName)
+	index, err := h.getLinkIndex(ifName)
 	if err != nil {
 		return err
 	}
@@ -315,24 +543,48 @@ func SetLinkAddress(ifName string, hwAddress net.HardwareAddr) error {
 
 	ifInfo := newIfInfoMsg()
 	ifInfo.Type = unix.RTM_SETLINK
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 	ifInfo.Flags = unix.NLM_F_REQUEST
 	ifInfo.Change = DEFAULT_CHANGE
 	req.addPayload(ifInfo)
 
 	req.addPayload(newAttribute(unix.IFLA_ADDRESS, hwAddress))
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
-// SetLinkPromisc sets the promiscuous mode of a network interface.
-func SetLinkPromisc(ifName string, on bool) error {
-	s, err := getSocket()
+// SetLinkMTU sets the MTU of a network interface.
+func (h *Handle) SetLinkMTU(ifName string, mtu int) error {
+	if platform.DryRun("ip link set %v mtu %v", ifName, mtu) {
+		return nil
+	}
+
+	index, err := h.getLinkIndex(ifName)
 	if err != nil {
 		return err
 	}
 
-	iface, err := net.InterfaceByName(ifName)
+	req := newRequest(unix.RTM_SETLINK, unix.NLM_F_ACK)
+
+	ifInfo := newIfInfoMsg()
+	ifInfo.Type = unix.RTM_SETLINK
+	ifInfo.Index = int32(index)
+	ifInfo.Flags = unix.NLM_F_REQUEST
+	ifInfo.Change = DEFAULT_CHANGE
+	req.addPayload(ifInfo)
+
+	req.addPayload(newAttributeUint32(unix.IFLA_MTU, uint32(mtu)))
+
+	return h.s.sendAndWaitForAck(req)
+}
+
+// SetLinkPromisc sets the promiscuous mode of a network interface.
+func (h *Handle) SetLinkPromisc(ifName string, on bool) error {
+	if platform.DryRun("ip link set %v promisc %v", ifName, onOff(on)) {
+		return nil
+	}
+
+	index, err := h.getLinkIndex(ifName)
 	if err != nil {
 		return err
 	}
@@ -341,7 +593,7 @@ func SetLinkPromisc(ifName string, on bool) error {
 
 	ifInfo := newIfInfoMsg()
 	ifInfo.Type = unix.RTM_SETLINK
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 
 	if on {
 		ifInfo.Flags = unix.IFF_PROMISC
@@ -353,17 +605,16 @@ func SetLinkPromisc(ifName string, on bool) error {
 
 	req.addPayload(ifInfo)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // SetLinkHairpin sets the hairpin (reflective relay) mode of a bridged interface.
-func SetLinkHairpin(bridgeName string, on bool) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
+func (h *Handle) SetLinkHairpin(bridgeName string, on bool) error {
+	if platform.DryRun("bridge link set dev %v hairpin %v", bridgeName, onOff(on)) {
+		return nil
 	}
 
-	iface, err := net.InterfaceByName(bridgeName)
+	index, err := h.getLinkIndex(bridgeName)
 	if err != nil {
 		return err
 	}
@@ -373,7 +624,7 @@ func SetLinkHairpin(bridgeName string, on bool) error {
 	ifInfo := newIfInfoMsg()
 	ifInfo.Family = unix.AF_BRIDGE
 	ifInfo.Type = unix.RTM_SETLINK
-	ifInfo.Index = int32(iface.Index)
+	ifInfo.Index = int32(index)
 	ifInfo.Flags = unix.NLM_F_REQUEST
 	ifInfo.Change = DEFAULT_CHANGE
 	req.addPayload(ifInfo)
@@ -387,14 +638,17 @@ func SetLinkHairpin(bridgeName string, on bool) error {
 	attrProtInfo.addNested(newAttribute(IFLA_BRPORT_MODE, hairpin))
 	req.addPayload(attrProtInfo)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
 
 // AddOrRemoveStaticArp sets/removes static arp entry based on mode
-func AddOrRemoveStaticArp(mode int, name string, ipaddr net.IP, mac net.HardwareAddr) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
+func (h *Handle) AddOrRemoveStaticArp(mode int, name string, ipaddr net.IP, mac net.HardwareAddr) error {
+	if mode == ADD {
+		if platform.DryRun("ip neigh replace %v lladdr %v dev %v nud permanent", ipaddr, mac, name) {
+			return nil
+		}
+	} else if platform.DryRun("ip neigh del %v dev %v", ipaddr, name) {
+		return nil
 	}
 
 	var req *message
@@ -407,24 +661,152 @@ func AddOrRemoveStaticArp(mode int, name string, ipaddr net.IP, mac net.Hardware
 		state = NUD_INCOMPLETE
 	}
 
-	iface, err := net.InterfaceByName(name)
+	index, err := h.getLinkIndex(name)
 	if err != nil {
 		return err
 	}
 
+	family := GetIpAddressFamily(ipaddr)
 	msg := neighMsg{
-		Family: uint8(unix.AF_INET),
-		Index:  uint32(iface.Index),
+		Family: uint8(family),
+		Index:  uint32(index),
 		State:  uint16(state),
 	}
 	req.addPayload(&msg)
 
 	ipData := ipaddr.To4()
+	if family == unix.AF_INET6 {
+		ipData = ipaddr.To16()
+	}
+
 	dstData := newRtAttr(NDA_DST, ipData)
 	req.addPayload(dstData)
 
 	hwData := newRtAttr(NDA_LLADDR, []byte(mac))
 	req.addPayload(hwData)
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
+}
+
+// AddOrRemoveProxyNeighbor sets/removes a proxy neighbor entry based on mode.
+// The kernel answers IPv6 neighbor solicitations for proxied addresses on the given interface.
+func (h *Handle) AddOrRemoveProxyNeighbor(mode int, name string, ipaddr net.IP) error {
+	if mode == ADD {
+		if platform.DryRun("ip neigh replace proxy %v dev %v", ipaddr, name) {
+			return nil
+		}
+	} else if platform.DryRun("ip neigh del proxy %v dev %v", ipaddr, name) {
+		return nil
+	}
+
+	var req *message
+	if mode == ADD {
+		req = newRequest(unix.RTM_NEWNEIGH, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	} else {
+		req = newRequest(unix.RTM_DELNEIGH, unix.NLM_F_ACK)
+	}
+
+	index, err := h.getLinkIndex(name)
+	if err != nil {
+		return err
+	}
+
+	msg := neighMsg{
+		Family: uint8(unix.AF_INET6),
+		Index:  uint32(index),
+		Flags:  NTF_PROXY,
+	}
+	req.addPayload(&msg)
+
+	dstData := newRtAttr(NDA_DST, ipaddr.To16())
+	req.addPayload(dstData)
+
+	return h.s.sendAndWaitForAck(req)
+}
+
+// Neighbor represents a neighbor cache entry.
+type Neighbor struct {
+	Family       int
+	LinkIndex    int
+	State        int
+	Flags        int
+	Type         int
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+}
+
+// deserializeNeighbor decodes a netlink message into a Neighbor struct.
+func deserializeNeighbor(msg *message) (*Neighbor, error) {
+	var ndmsg neighMsg
+	if len(msg.data) < ndmsg.length() {
+		return nil, fmt.Errorf("Invalid neighbor message")
+	}
+
+	// Parse neighbor message.
+	// Neighbor attributes are not parsed with the message as they are not route attributes.
+	ndmsg = *deserializeNeighMsg(msg.data)
+	attrs := parseAttributes(msg.data[rtaAlignOf(ndmsg.length()):])
+
+	neigh := Neighbor{
+		Family:    int(ndmsg.Family),
+		LinkIndex: int(ndmsg.Index),
+		State:     int(ndmsg.State),
+		Flags:     int(ndmsg.Flags),
+		Type:      int(ndmsg.Type),
+	}
+
+	// Populate neighbor attributes.
+	for _, attr := range attrs {
+		switch attr.Type {
+		case NDA_DST:
+			neigh.IP = net.IP(attr.value)
+		case NDA_LLADDR:
+			neigh.HardwareAddr = net.HardwareAddr(attr.value)
+		}
+	}
+
+	return &neigh, nil
+}
+
+// GetNeighbors returns the neighbor cache entries of the given address family on a network interface.
+// An empty interface name returns the entries of all interfaces, and AF_UNSPEC all address families.
+func (h *Handle) GetNeighbors(ifName string, family int) ([]*Neighbor, error) {
+	var index int
+	if ifName != "" {
+		var err error
+		index, err = h.getLinkIndex(ifName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req := newRequest(unix.RTM_GETNEIGH, unix.NLM_F_DUMP)
+	req.addPayload(&neighMsg{Family: uint8(family)})
+
+	msgs, err := h.s.sendAndWaitForResponse(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors []*Neighbor
+
+	for _, msg := range msgs {
+		if msg.Type != unix.RTM_NEWNEIGH {
+			continue
+		}
+
+		neigh, err := deserializeNeighbor(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		// Filter by link index.
+		if index != 0 && index != neigh.LinkIndex {
+			continue
+		}
+
+		neighbors = append(neighbors, neigh)
+	}
+
+	return neighbors, nil
 }
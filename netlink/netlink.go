@@ -15,12 +15,7 @@ func init() {
 }
 
 // Echo sends a netlink echo request message.
-func Echo(text string) error {
-	s, err := getSocket()
-	if err != nil {
-		return err
-	}
-
+func (h *Handle) Echo(text string) error {
 	req := newRequest(unix.NLMSG_NOOP, unix.NLM_F_ECHO|unix.NLM_F_ACK)
 	if req == nil {
 		return unix.ENOMEM
@@ -28,5 +23,5 @@ func Echo(text string) error {
 
 	req.addPayload(newAttributeString(0, text))
 
-	return s.sendAndWaitForAck(req)
+	return h.s.sendAndWaitForAck(req)
 }
@@ -6,8 +6,16 @@
 package netlink
 
 import (
+	"bytes"
+	"fmt"
 	"net"
+	"os"
+	"runtime"
 	"testing"
+	"time"
+
+	"github.com/Azure/azure-container-networking/platform"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -190,6 +198,60 @@ func TestSetLinkPromisc(t *testing.T) {
 	}
 }
 
+// TestSetLinkMTU tests setting the MTU of an interface.
+func TestSetLinkMTU(t *testing.T) {
+	_, err := addDummyInterface(ifName)
+	if err != nil {
+		t.Errorf("addDummyInterface failed: %v", err)
+	}
+
+	err = SetLinkMTU(ifName, 1400)
+	if err != nil {
+		t.Errorf("SetLinkMTU failed: %+v", err)
+	}
+
+	dummy, err := net.InterfaceByName(ifName)
+	if err != nil || dummy.MTU != 1400 {
+		t.Errorf("Interface MTU was not set: %+v %v", dummy, err)
+	}
+
+	err = DeleteLink(ifName)
+	if err != nil {
+		t.Errorf("DeleteLink failed: %+v", err)
+	}
+}
+
+// TestSetLinkOffload tests turning offload features of an interface on and off.
+func TestSetLinkOffload(t *testing.T) {
+	link := VEthLink{
+		LinkInfo: LinkInfo{
+			Type: LINK_TYPE_VETH,
+			Name: ifName,
+		},
+		PeerName: ifName2,
+	}
+
+	err := AddLink(&link)
+	if err != nil {
+		t.Fatalf("AddLink failed: %+v", err)
+	}
+	defer DeleteLink(ifName)
+
+	for _, feature := range []string{"tx", "tso", "gso", "gro"} {
+		if err = SetLinkOffload(ifName, feature, false); err != nil {
+			t.Errorf("SetLinkOffload %v off failed: %+v", feature, err)
+		}
+
+		if err = SetLinkOffload(ifName2, feature, true); err != nil {
+			t.Errorf("SetLinkOffload %v on failed: %+v", feature, err)
+		}
+	}
+
+	if err = SetLinkOffload(ifName, "lro2", false); err == nil {
+		t.Errorf("SetLinkOffload succeeded with an unsupported feature")
+	}
+}
+
 // TestSetHairpinMode tests setting the hairpin mode of a bridged interface.
 func TestSetLinkHairpin(t *testing.T) {
 	link := BridgeLink{
@@ -259,3 +321,296 @@ func TestAddRemoveStaticArp(t *testing.T) {
 		t.Errorf("DeleteLink failed: %+v", err)
 	}
 }
+
+// TestGetLinks tests listing interfaces and getting a typed interface by name.
+func TestGetLinks(t *testing.T) {
+	link := VEthLink{
+		LinkInfo: LinkInfo{
+			Type: LINK_TYPE_VETH,
+			Name: ifName,
+			MTU:  1400,
+		},
+		PeerName: ifName2,
+	}
+
+	err := AddLink(&link)
+	if err != nil {
+		t.Fatalf("AddLink failed: %+v", err)
+	}
+	defer DeleteLink(ifName)
+
+	links, err := GetLinks()
+	if err != nil {
+		t.Fatalf("GetLinks failed: %+v", err)
+	}
+
+	found := false
+	for _, l := range links {
+		if l.Info().Name == ifName {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("GetLinks did not return interface %v", ifName)
+	}
+
+	l, err := GetLinkByName(ifName)
+	if err != nil {
+		t.Fatalf("GetLinkByName failed: %+v", err)
+	}
+
+	veth, ok := l.(*VEthLink)
+	if !ok {
+		t.Fatalf("GetLinkByName returned %T, expected *VEthLink", l)
+	}
+
+	if veth.MTU != 1400 || veth.PeerName != ifName2 || veth.Index == 0 {
+		t.Errorf("GetLinkByName returned unexpected link %+v", *veth)
+	}
+}
+
+// TestGetIpAddresses tests listing the IP addresses of an interface.
+func TestGetIpAddresses(t *testing.T) {
+	_, err := addDummyInterface(ifName)
+	if err != nil {
+		t.Fatalf("addDummyInterface failed: %v", err)
+	}
+	defer DeleteLink(ifName)
+
+	ip, ipNet, _ := net.ParseCIDR("192.168.10.2/24")
+
+	err = AddIpAddress(ifName, ip, ipNet)
+	if err != nil {
+		t.Fatalf("AddIpAddress failed: %+v", err)
+	}
+
+	addrs, err := GetIpAddresses(ifName, unix.AF_INET)
+	if err != nil {
+		t.Fatalf("GetIpAddresses failed: %+v", err)
+	}
+
+	if len(addrs) != 1 || !addrs[0].IP.Equal(ip) || addrs[0].IPNet.String() != "192.168.10.2/24" {
+		t.Errorf("GetIpAddresses returned unexpected addresses %+v", addrs)
+	}
+}
+
+// TestGetNeighbors tests listing the neighbor cache entries of an interface.
+func TestGetNeighbors(t *testing.T) {
+	_, err := addDummyInterface(ifName)
+	if err != nil {
+		t.Fatalf("addDummyInterface failed: %v", err)
+	}
+	defer DeleteLink(ifName)
+
+	ip := net.ParseIP("192.168.0.2")
+	mac, _ := net.ParseMAC("aa:b3:4d:5e:e2:4a")
+
+	err = AddOrRemoveStaticArp(ADD, ifName, ip, mac)
+	if err != nil {
+		t.Fatalf("AddOrRemoveStaticArp failed: %+v", err)
+	}
+
+	neighbors, err := GetNeighbors(ifName, unix.AF_INET)
+	if err != nil {
+		t.Fatalf("GetNeighbors failed: %+v", err)
+	}
+
+	if len(neighbors) != 1 || !neighbors[0].IP.Equal(ip) ||
+		neighbors[0].HardwareAddr.String() != mac.String() || neighbors[0].State != NUD_PERMANENT {
+		t.Errorf("GetNeighbors returned unexpected neighbors %+v", neighbors)
+	}
+}
+
+// TestSubscribe tests receiving link notifications.
+func TestSubscribe(t *testing.T) {
+	sub, err := Subscribe(EVENT_GROUP_LINK)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %+v", err)
+	}
+	defer sub.Close()
+
+	_, err = addDummyInterface(ifName)
+	if err != nil {
+		t.Fatalf("addDummyInterface failed: %v", err)
+	}
+
+	err = DeleteLink(ifName)
+	if err != nil {
+		t.Fatalf("DeleteLink failed: %+v", err)
+	}
+
+	var added, deleted bool
+	timeout := time.After(5 * time.Second)
+
+	for !added || !deleted {
+		select {
+		case event := <-sub.Events():
+			if event.Link == nil || event.Link.Info().Name != ifName {
+				continue
+			}
+			if event.Type == unix.RTM_NEWLINK {
+				added = true
+			} else if event.Type == unix.RTM_DELLINK {
+				deleted = true
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for link notifications, added=%v deleted=%v", added, deleted)
+		}
+	}
+}
+
+// TestParseAttributes tests parsing nested attributes.
+func TestParseAttributes(t *testing.T) {
+	attr := newAttribute(unix.IFLA_LINKINFO, nil)
+	attr.addNested(newAttributeStringZ(IFLA_INFO_KIND, LINK_TYPE_VETH))
+	attr.addNested(newAttributeUint32(IFLA_INFO_DATA, 1500))
+
+	attrs := parseAttributes(attr.serialize()[unix.SizeofNlAttr:])
+
+	if len(attrs) != 2 {
+		t.Fatalf("Expected 2 attributes, got %v", len(attrs))
+	}
+
+	if attrs[0].Type != IFLA_INFO_KIND || attrs[0].getString() != LINK_TYPE_VETH {
+		t.Errorf("Unexpected kind attribute %+v", *attrs[0])
+	}
+
+	if attrs[1].Type != IFLA_INFO_DATA || attrs[1].getUint32() != 1500 {
+		t.Errorf("Unexpected data attribute %+v", *attrs[1])
+	}
+}
+
+// newTestNamespace creates a new network namespace and returns its file.
+func newTestNamespace() (*os.File, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	curNs, err := os.Open(fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid()))
+	if err != nil {
+		return nil, err
+	}
+	defer curNs.Close()
+
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		return nil, err
+	}
+	defer unix.Setns(int(curNs.Fd()), unix.CLONE_NEWNET)
+
+	return os.Open(fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid()))
+}
+
+// TestHandleAt tests configuring interfaces in another namespace through a handle.
+func TestHandleAt(t *testing.T) {
+	ns, err := newTestNamespace()
+	if err != nil {
+		t.Fatalf("newTestNamespace failed: %v", err)
+	}
+	defer ns.Close()
+
+	h, err := NewHandleAt(ns.Fd())
+	if err != nil {
+		t.Fatalf("NewHandleAt failed: %+v", err)
+	}
+	defer h.Delete()
+
+	link := VEthLink{
+		LinkInfo: LinkInfo{
+			Type: LINK_TYPE_VETH,
+			Name: ifName,
+		},
+		PeerName: ifName2,
+	}
+
+	err = h.AddLink(&link)
+	if err != nil {
+		t.Fatalf("AddLink failed: %+v", err)
+	}
+
+	err = h.SetLinkState(ifName, true)
+	if err != nil {
+		t.Errorf("SetLinkState failed: %+v", err)
+	}
+
+	if _, err = net.InterfaceByName(ifName); err == nil {
+		t.Errorf("Interface created in the namespace of the caller")
+	}
+
+	l, err := h.GetLinkByName(ifName)
+	if err != nil {
+		t.Fatalf("GetLinkByName failed: %+v", err)
+	}
+
+	if l.Info().Flags&net.FlagUp == 0 {
+		t.Errorf("Interface state was not set: %+v", l.Info())
+	}
+
+	links, err := h.GetLinks()
+	if err != nil {
+		t.Fatalf("GetLinks failed: %+v", err)
+	}
+
+	// The namespace contains the loopback interface and the veth pair.
+	if len(links) != 3 {
+		t.Errorf("GetLinks returned %v links, expected 3", len(links))
+	}
+
+	err = h.DeleteLink(ifName)
+	if err != nil {
+		t.Errorf("DeleteLink failed: %+v", err)
+	}
+
+	if _, err = h.GetLinkByName(ifName); err == nil {
+		t.Errorf("Interface not deleted")
+	}
+}
+
+// TestDryRun tests that changes are printed instead of being made in dry-run mode.
+func TestDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	platform.SetDryRun(&buf)
+	defer platform.SetDryRun(nil)
+
+	err := AddLink(&VEthLink{
+		LinkInfo: LinkInfo{
+			Type: LINK_TYPE_VETH,
+			Name: ifName,
+			MTU:  1400,
+		},
+		PeerName: ifName2,
+	})
+	if err != nil {
+		t.Fatalf("AddLink failed: %+v", err)
+	}
+
+	if _, err = net.InterfaceByName(ifName); err == nil {
+		t.Fatalf("Interface was created")
+	}
+
+	if err = SetLinkName(ifName2, "eth1"); err != nil {
+		t.Fatalf("SetLinkName failed: %+v", err)
+	}
+
+	iface, err := GetInterfaceByName("eth1")
+	if err != nil {
+		t.Fatalf("GetInterfaceByName failed: %+v", err)
+	}
+
+	_, dst, _ := net.ParseCIDR("10.0.0.0/8")
+	err = AddIpRoute(&Route{Family: unix.AF_INET, Dst: dst, Gw: net.ParseIP("10.0.0.1"), LinkIndex: iface.Index})
+	if err != nil {
+		t.Fatalf("AddIpRoute failed: %+v", err)
+	}
+
+	if err = DeleteLink(ifName); err != nil {
+		t.Fatalf("DeleteLink failed: %+v", err)
+	}
+
+	expected := "ip link add nltest mtu 1400 type veth peer name nltest2\n" +
+		"ip link set nltest2 name eth1\n" +
+		"ip route add 10.0.0.0/8 via 10.0.0.1 dev eth1\n" +
+		"ip link delete nltest\n"
+	if buf.String() != expected {
+		t.Errorf("Printed changes:\n%v\nexpected:\n%v", buf.String(), expected)
+	}
+}
@@ -8,6 +8,7 @@ package netlink
 import (
 	"encoding/binary"
 	"net"
+	"strings"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -57,6 +58,17 @@ const (
 	IFLA_BRPORT_MODE = 4
 	VETH_INFO_PEER   = 1
 	DEFAULT_CHANGE   = 0xFFFFFFFF
+	NLA_TYPE_MASK    = ^uint16(unix.NLA_F_NESTED | unix.NLA_F_NET_BYTEORDER)
+)
+
+// Netlink route multicast groups.
+const (
+	RTMGRP_LINK        = 0x1
+	RTMGRP_NEIGH       = 0x4
+	RTMGRP_IPV4_IFADDR = 0x10
+	RTMGRP_IPV4_ROUTE  = 0x40
+	RTMGRP_IPV6_IFADDR = 0x100
+	RTMGRP_IPV6_ROUTE  = 0x400
 )
 
 // Serializable types are used to construct netlink messages.
@@ -220,6 +232,45 @@ func newAttributeUint16(attrType int, value uint16) *attribute {
 	return newAttribute(attrType, buf)
 }
 
+// Parses a buffer of attributes, such as the value of a nested attribute.
+func parseAttributes(b []byte) []*attribute {
+	var attrs []*attribute
+
+	for len(b) >= unix.SizeofNlAttr {
+		length := int(encoder.Uint16(b[0:2]))
+		if length < unix.SizeofNlAttr || length > len(b) {
+			break
+		}
+
+		attr := &attribute{
+			NlAttr: unix.NlAttr{
+				Len:  uint16(length),
+				Type: encoder.Uint16(b[2:4]) & NLA_TYPE_MASK,
+			},
+			value: b[unix.SizeofNlAttr:length],
+		}
+		attrs = append(attrs, attr)
+
+		length = (length + unix.NLA_ALIGNTO - 1) & ^(unix.NLA_ALIGNTO - 1)
+		if length > len(b) {
+			break
+		}
+		b = b[length:]
+	}
+
+	return attrs
+}
+
+// Returns the value of a null-terminated string attribute.
+func (attr *attribute) getString() string {
+	return strings.TrimRight(string(attr.value), "\000")
+}
+
+// Returns the value of a uint32 attribute.
+func (attr *attribute) getUint32() uint32 {
+	return encoder.Uint32(attr.value[0:4])
+}
+
 // Creates a new attribute with a net.IP value.
 func newAttributeIpAddress(attrType int, value net.IP) *attribute {
 	addr := value.To4()
@@ -305,6 +356,11 @@ func (ifInfo *ifInfoMsg) serialize() []byte {
 	return b
 }
 
+// Deserializes an interface info message.
+func deserializeIfInfoMsg(b []byte) *ifInfoMsg {
+	return (*ifInfoMsg)(unsafe.Pointer(&b[0:unix.SizeofIfInfomsg][0]))
+}
+
 // Returns the length of an interface info message.
 func (ifInfo *ifInfoMsg) length() int {
 	return unix.SizeofIfInfomsg
@@ -339,6 +395,11 @@ func (ifAddr *ifAddrMsg) serialize() []byte {
 	return b
 }
 
+// Deserializes an interface address message.
+func deserializeIfAddrMsg(b []byte) *ifAddrMsg {
+	return (*ifAddrMsg)(unsafe.Pointer(&b[0:unix.SizeofIfAddrmsg][0]))
+}
+
 // Returns the length of an interface address message.
 func (ifAddr *ifAddrMsg) length() int {
 	return unix.SizeofIfAddrmsg
@@ -399,6 +460,12 @@ func (msg *neighMsg) length() int {
 	return int(unsafe.Sizeof(*msg))
 }
 
+// deserialize neighbor message
+func deserializeNeighMsg(b []byte) *neighMsg {
+	var msg neighMsg
+	return (*neighMsg)(unsafe.Pointer(&b[0:unsafe.Sizeof(msg)][0]))
+}
+
 // creates new rta attr message
 func newRtAttr(attrType int, data []byte) *rtAttr {
 	return &rtAttr{
@@ -36,7 +36,7 @@ func getSocket() (*socket, error) {
 	defer m.Unlock()
 
 	if s == nil {
-		s, err = newSocket()
+		s, err = newSocket(0)
 	}
 
 	return s, err
@@ -51,7 +51,8 @@ func ResetSocket() {
 }
 
 // Creates a new netlink socket object.
-func newSocket() (*socket, error) {
+// The socket joins the given multicast groups to receive notifications.
+func newSocket(groups uint32) (*socket, error) {
 	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
 	if err != nil {
 		log.Debugf("[netlink] Failed to create socket, err=%v\n", err)
@@ -65,6 +66,7 @@ func newSocket() (*socket, error) {
 	}
 
 	s.sa.Family = unix.AF_NETLINK
+	s.sa.Groups = groups
 
 	err = unix.Bind(fd, &s.sa)
 	if err != nil {
@@ -73,6 +75,14 @@ func newSocket() (*socket, error) {
 		return nil, err
 	}
 
+	// Use the port ID assigned by the kernel, as it differs from the process ID
+	// when the process has more than one netlink socket.
+	if sa, err := unix.Getsockname(fd); err == nil {
+		if nlsa, ok := sa.(*unix.SockaddrNetlink); ok {
+			s.pid = nlsa.Pid
+		}
+	}
+
 	log.Debugf("[netlink] Socket created.\n")
 	return s, nil
 }
@@ -86,6 +96,7 @@ func (s *socket) close() {
 // Sends a netlink message.
 func (s *socket) send(msg *message) error {
 	msg.Seq = atomic.AddUint32(&s.seq, 1)
+	msg.Pid = s.pid
 	err := unix.Sendto(s.fd, msg.serialize(), 0, &s.sa)
 	log.Debugf("[netlink] Sent %+v, err=%v\n", *msg, err)
 	return err
@@ -143,20 +154,11 @@ func (s *socket) receiveResponse(sent *message) ([]*message, error) {
 		// Process received messages.
 		for _, nlMsg := range nlMsgs {
 			// Convert to message object.
-			msg := message{
-				NlMsghdr: unix.NlMsghdr{
-					Len:   nlMsg.Header.Len,
-					Type:  nlMsg.Header.Type,
-					Flags: nlMsg.Header.Flags,
-					Seq:   nlMsg.Header.Seq,
-					Pid:   nlMsg.Header.Pid,
-				},
-				data: nlMsg.Data,
-			}
+			msg := newMessageFromNetlink(&nlMsg)
 
 			// Ignore if the message is not in response to the sent message.
 			if msg.Seq != sent.Seq || msg.Pid != sent.Pid {
-				log.Printf("[netlink] Ignoring unexpected message %+v\n", msg)
+				log.Printf("[netlink] Ignoring unexpected message %+v\n", *msg)
 				continue
 			}
 
@@ -166,35 +168,16 @@ func (s *socket) receiveResponse(sent *message) ([]*message, error) {
 			if msg.Type == unix.NLMSG_ERROR {
 				errCode := int32(encoder.Uint32(msg.data[0:4]))
 				if errCode == 0 {
-					log.Debugf("[netlink] Received %+v, ack\n", msg)
+					log.Debugf("[netlink] Received %+v, ack\n", *msg)
 				} else {
 					err = syscall.Errno(-errCode)
-					log.Printf("[netlink] Received %+v, err=%v\n", msg, err)
+					log.Printf("[netlink] Received %+v, err=%v\n", *msg, err)
 				}
 				return nil, err
 			}
 
 			// Log response message.
-			log.Debugf("[netlink] Received %+v\n", msg)
-
-			// Parse body.
-			msg.payload = append(msg.payload, nil)
-
-			// Parse attributes.
-			// Ignore failures as not all messages have attributes.
-			nlAttrs, _ := syscall.ParseNetlinkRouteAttr(&nlMsg)
-
-			// Convert to attribute objects.
-			for _, nlAttr := range nlAttrs {
-				attr := attribute{
-					NlAttr: unix.NlAttr{
-						Len:  nlAttr.Attr.Len,
-						Type: nlAttr.Attr.Type,
-					},
-					value: nlAttr.Value,
-				}
-				msg.payload = append(msg.payload, &attr)
-			}
+			log.Debugf("[netlink] Received %+v\n", *msg)
 
 			multi = ((msg.Flags & unix.NLM_F_MULTI) != 0)
 			done = (msg.Type == unix.NLMSG_DONE)
@@ -204,7 +187,7 @@ func (s *socket) receiveResponse(sent *message) ([]*message, error) {
 				break
 			}
 
-			messages = append(messages, &msg)
+			messages = append(messages, msg)
 		}
 
 		// Exit if response is a single message,
@@ -216,3 +199,38 @@ func (s *socket) receiveResponse(sent *message) ([]*message, error) {
 
 	return messages, nil
 }
+
+// Converts a received netlink message to a message object and parses its attributes.
+func newMessageFromNetlink(nlMsg *syscall.NetlinkMessage) *message {
+	msg := message{
+		NlMsghdr: unix.NlMsghdr{
+			Len:   nlMsg.Header.Len,
+			Type:  nlMsg.Header.Type,
+			Flags: nlMsg.Header.Flags,
+			Seq:   nlMsg.Header.Seq,
+			Pid:   nlMsg.Header.Pid,
+		},
+		data: nlMsg.Data,
+	}
+
+	// Parse body.
+	msg.payload = append(msg.payload, nil)
+
+	// Parse attributes.
+	// Ignore failures as not all messages have attributes.
+	nlAttrs, _ := syscall.ParseNetlinkRouteAttr(nlMsg)
+
+	// Convert to attribute objects.
+	for _, nlAttr := range nlAttrs {
+		attr := attribute{
+			NlAttr: unix.NlAttr{
+				Len:  nlAttr.Attr.Len,
+				Type: nlAttr.Attr.Type,
+			},
+			value: nlAttr.Value,
+		}
+		msg.payload = append(msg.payload, &attr)
+	}
+
+	return &msg
+}
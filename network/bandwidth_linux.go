@@ -0,0 +1,133 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+const (
+	// Prefix for the IFB interface names shaping the egress traffic of endpoints.
+	bandwidthIfbInterfacePrefix = commonInterfacePrefix + "b"
+
+	// Maximum time a packet can wait in the token bucket filter.
+	bandwidthLatency = "25ms"
+
+	// Handle of the ingress qdisc.
+	ingressQdiscHandle = "ffff:"
+
+	// Maximum length of Linux network interface names.
+	maxInterfaceNameLength = 15
+)
+
+// addBandwidthLimits shapes the traffic of an endpoint with tc qdiscs on its host veth.
+// Traffic to the endpoint is shaped on egress of the host veth. Traffic from the endpoint is
+// redirected from ingress of the host veth to an IFB interface, and shaped on egress of the IFB.
+func addBandwidthLimits(hostIfName string, bw *BandwidthLimits) error {
+	if bw == nil {
+		return nil
+	}
+
+	if err := validateBandwidthLimits(bw); err != nil {
+		return err
+	}
+
+	log.Printf("[net] Adding bandwidth limits %+v to interface %v.", *bw, hostIfName)
+
+	if bw.EgressRate > 0 {
+		ifbName := getBandwidthIfbName(hostIfName)
+		link := netlink.IFBLink{
+			LinkInfo: netlink.LinkInfo{
+				Type:  netlink.LINK_TYPE_IFB,
+				Name:  ifbName,
+				Flags: net.FlagUp,
+			},
+		}
+
+		log.Printf("[net] Creating IFB interface %v.", ifbName)
+		if err := netlink.AddLink(&link); err != nil {
+			return fmt.Errorf("Failed to create IFB interface %v: %v", ifbName, err)
+		}
+
+		if err := netlink.SetLinkState(ifbName, true); err != nil {
+			return err
+		}
+	}
+
+	for _, cmd := range getBandwidthCommands(hostIfName, bw) {
+		if _, err := platform.ExecuteChangeCommand(cmd); err != nil {
+			return fmt.Errorf("Failed to add bandwidth limits to interface %v: %v", hostIfName, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteBandwidthLimits removes the traffic shaping of an endpoint.
+// The qdiscs of the host veth are removed along with the host veth.
+func deleteBandwidthLimits(hostIfName string) error {
+	ifbName := getBandwidthIfbName(hostIfName)
+	if _, err := net.InterfaceByName(ifbName); err != nil {
+		return nil
+	}
+
+	log.Printf("[net] Deleting IFB interface %v.", ifbName)
+
+	return netlink.DeleteLink(ifbName)
+}
+
+// validateBandwidthLimits returns an error if a rate is set without a burst, or a burst without a rate.
+func validateBandwidthLimits(bw *BandwidthLimits) error {
+	if (bw.IngressRate == 0) != (bw.IngressBurst == 0) {
+		return fmt.Errorf("Ingress rate and burst must be set together")
+	}
+
+	if (bw.EgressRate == 0) != (bw.EgressBurst == 0) {
+		return fmt.Errorf("Egress rate and burst must be set together")
+	}
+
+	return nil
+}
+
+// getBandwidthCommands returns the tc commands shaping the traffic of an endpoint.
+func getBandwidthCommands(hostIfName string, bw *BandwidthLimits) []string {
+	var cmds []string
+
+	if bw.IngressRate > 0 {
+		cmds = append(cmds, getTbfCommand(hostIfName, bw.IngressRate, bw.IngressBurst))
+	}
+
+	if bw.EgressRate > 0 {
+		ifbName := getBandwidthIfbName(hostIfName)
+		cmds = append(cmds,
+			getTbfCommand(ifbName, bw.EgressRate, bw.EgressBurst),
+			fmt.Sprintf("tc qdisc add dev %s handle %s ingress", hostIfName, ingressQdiscHandle),
+			fmt.Sprintf("tc filter add dev %s parent %s protocol all u32 match u32 0 0 action mirred egress redirect dev %s",
+				hostIfName, ingressQdiscHandle, ifbName))
+	}
+
+	return cmds
+}
+
+// getTbfCommand returns the tc command adding a token bucket filter. The burst is converted to bytes.
+func getTbfCommand(ifName string, rate uint64, burst uint64) string {
+	return fmt.Sprintf("tc qdisc add dev %s root tbf rate %dbit burst %d latency %s",
+		ifName, rate, (burst+7)/8, bandwidthLatency)
+}
+
+// getBandwidthIfbName returns the name of the IFB interface of a host veth.
+func getBandwidthIfbName(hostIfName string) string {
+	name := bandwidthIfbInterfacePrefix + strings.TrimPrefix(hostIfName, hostVEthInterfacePrefix)
+	if len(name) > maxInterfaceNameLength {
+		name = name[:maxInterfaceNameLength]
+	}
+
+	return name
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetBandwidthCommands(t *testing.T) {
+	bw := &BandwidthLimits{IngressRate: 1000000, IngressBurst: 80000, EgressRate: 2000000, EgressBurst: 16001}
+
+	expected := []string{
+		"tc qdisc add dev azv3f8a1b2c root tbf rate 1000000bit burst 10000 latency 25ms",
+		"tc qdisc add dev azb3f8a1b2c root tbf rate 2000000bit burst 2001 latency 25ms",
+		"tc qdisc add dev azv3f8a1b2c handle ffff: ingress",
+		"tc filter add dev azv3f8a1b2c parent ffff: protocol all u32 match u32 0 0 action mirred egress redirect dev azb3f8a1b2c",
+	}
+
+	if cmds := getBandwidthCommands("azv3f8a1b2c", bw); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, cmds)
+	}
+
+	if cmds := getBandwidthCommands("azv3f8a1b2c", &BandwidthLimits{EgressRate: 1, EgressBurst: 8}); len(cmds) != 3 {
+		t.Errorf("Expected egress commands only, got %v", cmds)
+	}
+}
+
+func TestValidateBandwidthLimits(t *testing.T) {
+	tests := []struct {
+		bw    BandwidthLimits
+		valid bool
+	}{
+		{BandwidthLimits{IngressRate: 1000, IngressBurst: 1000}, true},
+		{BandwidthLimits{EgressRate: 1000, EgressBurst: 1000}, true},
+		{BandwidthLimits{IngressRate: 1000}, false},
+		{BandwidthLimits{EgressBurst: 1000}, false},
+	}
+
+	for _, test := range tests {
+		if err := validateBandwidthLimits(&test.bw); (err == nil) != test.valid {
+			t.Errorf("Unexpected result for %+v: %v", test.bw, err)
+		}
+	}
+}
+
+func TestGetBandwidthIfbName(t *testing.T) {
+	if name := getBandwidthIfbName("azv0123456789a"); name != "azb0123456789a" {
+		t.Errorf("Unexpected IFB interface name %v", name)
+	}
+
+	if name := getBandwidthIfbName("veth0123456789abcdef"); len(name) > maxInterfaceNameLength {
+		t.Errorf("IFB interface name %v exceeds the interface name limit", name)
+	}
+}
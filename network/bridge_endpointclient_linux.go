@@ -1,7 +1,10 @@
 package network
 
 import (
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 
 	"github.com/Azure/azure-container-networking/ebtables"
 	"github.com/Azure/azure-container-networking/log"
@@ -9,6 +12,11 @@ import (
 	"github.com/Azure/azure-container-networking/network/epcommon"
 )
 
+const (
+	// Sysfs symlink pointing to the master device of a link.
+	linkMasterPathFmt = "/sys/class/net/%s/master"
+)
+
 type LinuxBridgeEndpointClient struct {
 	bridgeName        string
 	hostPrimaryIfName string
@@ -39,11 +47,11 @@ func NewLinuxBridgeEndpointClient(
 }
 
 func (client *LinuxBridgeEndpointClient) AddEndpoints(epInfo *EndpointInfo) error {
-	if err := epcommon.CreateEndpoint(client.hostVethName, client.containerVethName); err != nil {
+	if err := epcommon.CreateEndpoint(client.hostVethName, client.containerVethName, epInfo.MTU, epInfo.Offload); err != nil {
 		return err
 	}
 
-	containerIf, err := net.InterfaceByName(client.containerVethName)
+	containerIf, err := netlink.GetInterfaceByName(client.containerVethName)
 	if err != nil {
 		return err
 	}
@@ -61,10 +69,12 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 	}
 
 	for _, ipAddr := range epInfo.IPAddresses {
-		// Add ARP reply rule.
-		log.Printf("[net] Adding ARP reply rule for IP address %v", ipAddr.String())
-		if err = ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(client.containerMac), ebtables.Append); err != nil {
-			return err
+		// Add ARP reply rule. IPv6 neighbor solicitations are answered by the bridge below.
+		if ipAddr.IP.To4() != nil {
+			log.Printf("[net] Adding ARP reply rule for IP address %v", ipAddr.String())
+			if err = ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(client.containerMac), ebtables.Append); err != nil {
+				return err
+			}
 		}
 
 		// Add MAC address translation rule.
@@ -81,6 +91,10 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 		}
 	}
 
+	if err := client.addIPv6ProxyRules(epInfo); err != nil {
+		return err
+	}
+
 	log.Printf("[net] Setting hairpin for hostveth %v", client.hostVethName)
 	if err := netlink.SetLinkHairpin(client.hostVethName, true); err != nil {
 		log.Printf("Setting up hairpin failed for interface %v error %v", client.hostVethName, err)
@@ -93,11 +107,15 @@ func (client *LinuxBridgeEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	// Delete rules for IP addresses on the container interface.
 	for _, ipAddr := range ep.IPAddresses {
+		var err error
+
 		// Delete ARP reply rule.
-		log.Printf("[net] Deleting ARP reply rule for IP address %v on %v.", ipAddr.String(), ep.Id)
-		err := ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(ep.MacAddress), ebtables.Delete)
-		if err != nil {
-			log.Printf("[net] Failed to delete ARP reply rule for IP address %v: %v.", ipAddr.String(), err)
+		if ipAddr.IP.To4() != nil {
+			log.Printf("[net] Deleting ARP reply rule for IP address %v on %v.", ipAddr.String(), ep.Id)
+			err = ebtables.SetArpReply(ipAddr.IP, client.getArpReplyAddress(ep.MacAddress), ebtables.Delete)
+			if err != nil {
+				log.Printf("[net] Failed to delete ARP reply rule for IP address %v: %v.", ipAddr.String(), err)
+			}
 		}
 
 		// Delete MAC address translation rule.
@@ -114,7 +132,57 @@ func (client *LinuxBridgeEndpointClient) DeleteEndpointRules(ep *endpoint) {
 				log.Printf("Failed removing arp from vm: %v", err)
 			}
 		}
+
+		// Delete the proxy neighbor set up for the container's IPv6 address.
+		if ipAddr.IP.To4() == nil {
+			log.Printf("[net] Deleting proxy neighbor for ip %v on %v", ipAddr.IP.String(), client.bridgeName)
+			if err = netlink.AddOrRemoveProxyNeighbor(netlink.REMOVE, client.bridgeName, ipAddr.IP); err != nil {
+				log.Printf("[net] Failed to delete proxy neighbor for ip %v: %v", ipAddr.IP.String(), err)
+			}
+		}
+	}
+}
+
+// addIPv6ProxyRules sets up neighbor proxying so that the bridge answers neighbor solicitations
+// from the network for the container's IPv6 addresses.
+func (client *LinuxBridgeEndpointClient) addIPv6ProxyRules(epInfo *EndpointInfo) error {
+	proxyNdpEnabled := false
+
+	for _, ipAddr := range epInfo.IPAddresses {
+		if ipAddr.IP.To4() != nil {
+			continue
+		}
+
+		if !proxyNdpEnabled {
+			log.Printf("calling setNdpProxy for %v", client.bridgeName)
+			if err := setNdpProxy(client.bridgeName); err != nil {
+				log.Printf("setNdpProxy failed with: %v", err)
+				return err
+			}
+			proxyNdpEnabled = true
+		}
+
+		log.Printf("[net] Adding proxy neighbor for ip %v on %v", ipAddr.IP.String(), client.bridgeName)
+		if err := netlink.AddOrRemoveProxyNeighbor(netlink.ADD, client.bridgeName, ipAddr.IP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (client *LinuxBridgeEndpointClient) CheckEndpointRules(ep *endpoint) error {
+	// The host veth must still be enslaved to the bridge.
+	masterPath, err := os.Readlink(fmt.Sprintf(linkMasterPathFmt, client.hostVethName))
+	if err != nil {
+		return fmt.Errorf("Interface %v is not attached to bridge %v: %v", client.hostVethName, client.bridgeName, err)
 	}
+
+	if filepath.Base(masterPath) != client.bridgeName {
+		return fmt.Errorf("Interface %v is attached to %v instead of bridge %v", client.hostVethName, filepath.Base(masterPath), client.bridgeName)
+	}
+
+	return nil
 }
 
 // getArpReplyAddress returns the MAC address to use in ARP replies.
@@ -39,6 +39,7 @@ type endpoint struct {
 	ContainerID              string
 	PODName                  string `json:",omitempty"`
 	PODNameSpace             string `json:",omitempty"`
+	MTU                      int    `json:",omitempty"`
 	InfraVnetAddressSpace    string `json:",omitempty"`
 }
 
@@ -56,6 +57,10 @@ type EndpointInfo struct {
 	InfraVnetIP              net.IPNet
 	Routes                   []RouteInfo
 	Policies                 []policy.Policy
+	PortMappings             []PortMapping
+	Bandwidth                *BandwidthLimits
+	MTU                      int
+	Offload                  map[string]bool
 	Gateways                 []net.IP
 	EnableSnatOnHost         bool
 	EnableInfraVnet          bool
@@ -69,6 +74,23 @@ type EndpointInfo struct {
 	SkipHotAttachEp       bool
 }
 
+// PortMapping maps a host port to a port of an endpoint.
+type PortMapping struct {
+	HostPort      int
+	ContainerPort int
+	Protocol      string
+	HostIP        string
+}
+
+// BandwidthLimits limits the traffic rate of an endpoint. Rates are in bits per second and bursts in bits.
+// Ingress is the traffic sent to the endpoint, and egress the traffic sent from the endpoint.
+type BandwidthLimits struct {
+	IngressRate  uint64
+	IngressBurst uint64
+	EgressRate   uint64
+	EgressBurst  uint64
+}
+
 // RouteInfo contains information about an IP route.
 type RouteInfo struct {
 	Dst      net.IPNet
@@ -135,6 +157,22 @@ func (nw *network) deleteEndpoint(endpointId string) error {
 	return nil
 }
 
+// CheckEndpoint verifies that an existing endpoint is still programmed as expected.
+func (nw *network) checkEndpoint(ep *endpoint, ifName string) error {
+	log.Printf("[net] Checking endpoint %v in network %v.", ep.Id, nw.Id)
+
+	// Call the platform implementation.
+	err := nw.checkEndpointImpl(ep, ifName)
+	if err != nil {
+		log.Printf("[net] Endpoint %v failed check, err:%v.", ep.Id, err)
+		return err
+	}
+
+	log.Printf("[net] Endpoint %v passed check.", ep.Id)
+
+	return nil
+}
+
 // GetEndpoint returns the endpoint with the given ID.
 func (nw *network) getEndpoint(endpointId string) (*endpoint, error) {
 	log.Printf("Trying to retrieve endpoint id %v", endpointId)
@@ -206,6 +244,7 @@ func (ep *endpoint) getInfo() *EndpointInfo {
 		NetNsPath:    ep.NetworkNameSpace,
 		PODName:      ep.PODName,
 		PODNameSpace: ep.PODNameSpace,
+		MTU:          ep.MTU,
 	}
 
 	for _, route := range ep.Routes {
@@ -12,6 +12,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/netlink"
+	"github.com/Azure/azure-container-networking/rules"
 )
 
 const (
@@ -85,6 +86,8 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		contIfName = fmt.Sprintf("%s%s-2", hostVEthInterfacePrefix, epInfo.Id[:7])
 	}
 
+	epInfo.MTU = nw.getEndpointMTU(epInfo)
+
 	if vlanid != 0 {
 		log.Printf("OVS client")
 		if _, ok := epInfo.Data[SnatBridgeIPKey]; ok {
@@ -116,7 +119,7 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 				HostIfName:               hostIfName,
 				LocalIP:                  localIP,
 				IPAddresses:              epInfo.IPAddresses,
-				Gateways:                 []net.IP{nw.extIf.IPv4Gateway},
+				Gateways:                 getEndpointGateways(nw.extIf, epInfo.IPAddresses),
 				DNS:                      epInfo.DNS,
 				VlanID:                   vlanid,
 				EnableSnatOnHost:         epInfo.EnableSnatOnHost,
@@ -128,9 +131,11 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 			if containerIf != nil {
 				endpt.MacAddress = containerIf.HardwareAddr
 				epClient.DeleteEndpointRules(endpt)
+				CleanupPortMappings(epInfo.Id)
 			}
 
 			epClient.DeleteEndpoints(endpt)
+			deleteBandwidthLimits(hostIfName)
 		}
 	}()
 
@@ -138,13 +143,26 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		return nil, err
 	}
 
-	containerIf, err = net.InterfaceByName(contIfName)
+	containerIf, err = netlink.GetInterfaceByName(contIfName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup rules for IP addresses on the container interface, and hostPort mappings to it.
+	// The rules are programmed together once all of them are known.
+	err = rules.Batch(func() error {
+		if err := epClient.AddEndpointRules(epInfo); err != nil {
+			return err
+		}
+
+		return addPortMappings(epInfo)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Setup rules for IP addresses on the container interface.
-	if err = epClient.AddEndpointRules(epInfo); err != nil {
+	// Shape the traffic of the container interface on the host veth.
+	if err = addBandwidthLimits(hostIfName, epInfo.Bandwidth); err != nil {
 		return nil, err
 	}
 
@@ -197,7 +215,7 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		InfraVnetIP:              epInfo.InfraVnetIP,
 		LocalIP:                  localIP,
 		IPAddresses:              epInfo.IPAddresses,
-		Gateways:                 []net.IP{nw.extIf.IPv4Gateway},
+		Gateways:                 getEndpointGateways(nw.extIf, epInfo.IPAddresses),
 		DNS:                      epInfo.DNS,
 		VlanID:                   vlanid,
 		EnableSnatOnHost:         epInfo.EnableSnatOnHost,
@@ -209,6 +227,7 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 		ContainerID:              epInfo.ContainerID,
 		PODName:                  epInfo.PODName,
 		PODNameSpace:             epInfo.PODNameSpace,
+		MTU:                      epInfo.MTU,
 	}
 
 	for _, route := range epInfo.Routes {
@@ -218,6 +237,33 @@ func (nw *network) newEndpointImpl(epInfo *EndpointInfo) (*endpoint, error) {
 	return ep, nil
 }
 
+// getEndpointMTU returns the MTU of a new endpoint. It defaults to the MTU of the network,
+// and then to the MTU of the external interface.
+func (nw *network) getEndpointMTU(epInfo *EndpointInfo) int {
+	if epInfo.MTU > 0 {
+		return epInfo.MTU
+	}
+
+	if nw.MTU > 0 {
+		return nw.MTU
+	}
+
+	if nw.extIf == nil {
+		return 0
+	}
+
+	if nw.extIf.MTU > 0 {
+		return nw.extIf.MTU
+	}
+
+	// The MTU of interfaces that are not connected to a bridge is not saved.
+	if hostIf, err := net.InterfaceByName(nw.extIf.Name); err == nil {
+		return hostIf.MTU
+	}
+
+	return 0
+}
+
 // deleteEndpointImpl deletes an existing endpoint from the network.
 func (nw *network) deleteEndpointImpl(ep *endpoint) error {
 	var epClient EndpointClient
@@ -237,6 +283,147 @@ func (nw *network) deleteEndpointImpl(ep *endpoint) error {
 	epClient.DeleteEndpointRules(ep)
 	epClient.DeleteEndpoints(ep)
 
+	if err := CleanupPortMappings(ep.Id); err != nil {
+		log.Printf("[net] Failed to delete port mappings of endpoint %v, err:%v.", ep.Id, err)
+	}
+
+	if err := deleteBandwidthLimits(ep.HostIfName); err != nil {
+		log.Printf("[net] Failed to delete bandwidth limits of endpoint %v, err:%v.", ep.Id, err)
+	}
+
+	return nil
+}
+
+// checkEndpointImpl compares the endpoint with the live state of the host and container network namespace.
+func (nw *network) checkEndpointImpl(ep *endpoint, ifName string) error {
+	var epClient EndpointClient
+	var err error
+
+	if ep.VlanID != 0 {
+		epInfo := ep.getInfo()
+		epClient = NewOVSEndpointClient(nw, epInfo, ep.HostIfName, "", ep.VlanID, ep.LocalIP)
+	} else if nw.Mode != opModeTransparent {
+		epClient = NewLinuxBridgeEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode)
+	} else {
+		epClient = NewTransparentEndpointClient(nw.extIf, ep.HostIfName, "", nw.Mode)
+	}
+
+	// Check the host side of the veth pair.
+	if err = checkLinkUp(ep.HostIfName); err != nil {
+		return err
+	}
+
+	// Check the rules that attach the host veth to the network.
+	if err = epClient.CheckEndpointRules(ep); err != nil {
+		return err
+	}
+
+	// CNM does not rename the container interface.
+	if ifName == "" {
+		ifName = ep.IfName
+	}
+
+	if ep.NetworkNameSpace != "" {
+		log.Printf("[net] Opening netns %v.", ep.NetworkNameSpace)
+		ns, err := OpenNamespace(ep.NetworkNameSpace)
+		if err != nil {
+			return fmt.Errorf("Failed to open netns %v: %v", ep.NetworkNameSpace, err)
+		}
+		defer ns.Close()
+
+		log.Printf("[net] Entering netns %v.", ep.NetworkNameSpace)
+		if err = ns.Enter(); err != nil {
+			return err
+		}
+
+		defer func() {
+			log.Printf("[net] Exiting netns %v.", ep.NetworkNameSpace)
+			if err := ns.Exit(); err != nil {
+				log.Printf("[net] Failed to exit netns, err:%v.", err)
+			}
+		}()
+	}
+
+	return checkContainerInterface(ifName, ep.IPAddresses, ep.Routes)
+}
+
+// checkLinkUp verifies that the given link exists and is administratively up.
+func checkLinkUp(ifName string) error {
+	iface, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return fmt.Errorf("Interface %v not found: %v", ifName, err)
+	}
+
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("Interface %v is down", ifName)
+	}
+
+	return nil
+}
+
+// checkContainerInterface verifies the addresses and routes of a container interface.
+// It must be called from within the container network namespace.
+func checkContainerInterface(ifName string, ipAddresses []net.IPNet, routes []RouteInfo) error {
+	if err := checkLinkUp(ifName); err != nil {
+		return err
+	}
+
+	iface, _ := net.InterfaceByName(ifName)
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return fmt.Errorf("Failed to query addresses of interface %v: %v", ifName, err)
+	}
+
+	for _, ipAddr := range ipAddresses {
+		found := false
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.String() == ipAddr.String() {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("IP address %v not found on interface %v", ipAddr.String(), ifName)
+		}
+	}
+
+	for _, route := range routes {
+		linkIndex := iface.Index
+		if route.DevName != "" {
+			devIf, err := net.InterfaceByName(route.DevName)
+			if err != nil {
+				return fmt.Errorf("Interface %v for route %v not found: %v", route.DevName, route.Dst.String(), err)
+			}
+
+			linkIndex = devIf.Index
+		}
+
+		dst := route.Dst
+		filter := &netlink.Route{
+			Family:    netlink.GetIpAddressFamily(dst.IP),
+			Dst:       &dst,
+			LinkIndex: linkIndex,
+		}
+
+		nlRoutes, err := netlink.GetIpRoute(filter)
+		if err != nil {
+			return fmt.Errorf("Failed to query routes: %v", err)
+		}
+
+		found := false
+		for _, nlRoute := range nlRoutes {
+			if route.Gw == nil || route.Gw.IsUnspecified() || route.Gw.Equal(nlRoute.Gw) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("Route %v via %v not found on interface %v", route.Dst.String(), route.Gw, ifName)
+		}
+	}
+
 	return nil
 }
 
@@ -246,13 +433,13 @@ func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo) {
 
 func addRoutes(interfaceName string, routes []RouteInfo) error {
 	ifIndex := 0
-	interfaceIf, _ := net.InterfaceByName(interfaceName)
+	interfaceIf, _ := netlink.GetInterfaceByName(interfaceName)
 
 	for _, route := range routes {
 		log.Printf("[net] Adding IP route %+v to link %v.", route, interfaceName)
 
 		if route.DevName != "" {
-			devIf, _ := net.InterfaceByName(route.DevName)
+			devIf, _ := netlink.GetInterfaceByName(route.DevName)
 			ifIndex = devIf.Index
 		} else {
 			ifIndex = interfaceIf.Index
@@ -460,3 +647,17 @@ func getDefaultGateway(routes []RouteInfo) net.IP {
 
 	return nil
 }
+
+// getEndpointGateways returns the gateways of the external interface for the address families of the endpoint.
+func getEndpointGateways(extIf *externalInterface, ipAddresses []net.IPNet) []net.IP {
+	gateways := []net.IP{extIf.IPv4Gateway}
+
+	for _, ipAddr := range ipAddresses {
+		if ipAddr.IP.To4() == nil && extIf.IPv6Gateway != nil && !extIf.IPv6Gateway.IsUnspecified() {
+			gateways = append(gateways, extIf.IPv6Gateway)
+			break
+		}
+	}
+
+	return gateways
+}
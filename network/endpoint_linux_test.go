@@ -0,0 +1,67 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func TestGetEndpointMTU(t *testing.T) {
+	extIf := &externalInterface{Name: "invalid", MTU: 1500}
+	nw := &network{extIf: extIf, MTU: 1400}
+
+	if mtu := nw.getEndpointMTU(&EndpointInfo{MTU: 1300}); mtu != 1300 {
+		t.Errorf("Expected the endpoint MTU 1300, got %v", mtu)
+	}
+
+	if mtu := nw.getEndpointMTU(&EndpointInfo{}); mtu != 1400 {
+		t.Errorf("Expected the network MTU 1400, got %v", mtu)
+	}
+
+	nw.MTU = 0
+	if mtu := nw.getEndpointMTU(&EndpointInfo{}); mtu != 1500 {
+		t.Errorf("Expected the external interface MTU 1500, got %v", mtu)
+	}
+
+	extIf.MTU = 0
+	if mtu := nw.getEndpointMTU(&EndpointInfo{}); mtu != 0 {
+		t.Errorf("Expected the default MTU, got %v", mtu)
+	}
+}
+
+func TestGetEndpointGateways(t *testing.T) {
+	ipv4Gateway := net.ParseIP("10.0.0.1")
+	ipv6Gateway := net.ParseIP("fd00::1")
+	ipv4Address := net.IPNet{IP: net.ParseIP("10.0.0.4"), Mask: net.CIDRMask(24, 32)}
+	ipv6Address := net.IPNet{IP: net.ParseIP("fd00::4"), Mask: net.CIDRMask(64, 128)}
+
+	tests := []struct {
+		name        string
+		ipv6Gateway net.IP
+		addresses   []net.IPNet
+		expected    []net.IP
+	}{
+		{"IPv4 only", ipv6Gateway, []net.IPNet{ipv4Address}, []net.IP{ipv4Gateway}},
+		{"dual stack", ipv6Gateway, []net.IPNet{ipv4Address, ipv6Address}, []net.IP{ipv4Gateway, ipv6Gateway}},
+		{"no IPv6 gateway", nil, []net.IPNet{ipv4Address, ipv6Address}, []net.IP{ipv4Gateway}},
+		{"unspecified IPv6 gateway", net.IPv6unspecified, []net.IPNet{ipv4Address, ipv6Address}, []net.IP{ipv4Gateway}},
+	}
+
+	for _, test := range tests {
+		extIf := &externalInterface{IPv4Gateway: ipv4Gateway, IPv6Gateway: test.ipv6Gateway}
+		gateways := getEndpointGateways(extIf, test.addresses)
+
+		if len(gateways) != len(test.expected) {
+			t.Errorf("%s: expected gateways %v, got %v", test.name, test.expected, gateways)
+			continue
+		}
+
+		for i := range gateways {
+			if !gateways[i].Equal(test.expected[i]) {
+				t.Errorf("%s: expected gateways %v, got %v", test.name, test.expected, gateways)
+			}
+		}
+	}
+}
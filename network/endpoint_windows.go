@@ -5,6 +5,7 @@ package network
 
 import (
 	"encoding/json"
+	"fmt"
 	"net"
 	"strings"
 
@@ -139,6 +140,22 @@ func (nw *network) deleteEndpointImpl(ep *endpoint) error {
 	return err
 }
 
+// checkEndpointImpl verifies that the HNS endpoint still exists.
+func (nw *network) checkEndpointImpl(ep *endpoint, ifName string) error {
+	log.Printf("[net] HNSEndpointRequest GET id:%v", ep.HnsId)
+	hnsResponse, err := hcsshim.HNSEndpointRequest("GET", ep.HnsId, "")
+	log.Printf("[net] HNSEndpointRequest GET response:%+v err:%v.", hnsResponse, err)
+	if err != nil {
+		return err
+	}
+
+	if hnsResponse.IPAddress != nil && len(ep.IPAddresses) > 0 && !hnsResponse.IPAddress.Equal(ep.IPAddresses[0].IP) {
+		return fmt.Errorf("HNS endpoint %v has IP address %v instead of %v", ep.HnsId, hnsResponse.IPAddress, ep.IPAddresses[0].IP)
+	}
+
+	return nil
+}
+
 // getInfoImpl returns information about the endpoint.
 func (ep *endpoint) getInfoImpl(epInfo *EndpointInfo) {
 	epInfo.Data["hnsid"] = ep.HnsId
@@ -28,7 +28,9 @@ RFC for Link Local Addresses: https://tools.ietf.org/html/rfc3927
 */
 
 const (
-	enableIPForwardCmd = "sysctl -w net.ipv4.ip_forward=1"
+	enableIPForwardCmd   = "sysctl -w net.ipv4.ip_forward=1"
+	enableIPv6ForwardCmd = "sysctl -w net.ipv6.conf.all.forwarding=1"
+	acceptRaCmdFmt       = "sysctl -w net.ipv6.conf.%v.accept_ra=2"
 )
 
 func getPrivateIPSpace() []string {
@@ -46,13 +48,16 @@ func getFilterchainTarget() []string {
 	return actions
 }
 
-func CreateEndpoint(hostVethName string, containerVethName string) error {
-	log.Printf("[net] Creating veth pair %v %v.", hostVethName, containerVethName)
+// CreateEndpoint creates a veth pair. Both ends have the given MTU, or the kernel default MTU if it is 0,
+// and the given offload features turned on or off.
+func CreateEndpoint(hostVethName string, containerVethName string, mtu int, offload map[string]bool) error {
+	log.Printf("[net] Creating veth pair %v %v with MTU %v.", hostVethName, containerVethName, mtu)
 
 	link := netlink.VEthLink{
 		LinkInfo: netlink.LinkInfo{
 			Type: netlink.LINK_TYPE_VETH,
 			Name: hostVethName,
+			MTU:  uint(mtu),
 		},
 		PeerName: containerVethName,
 	}
@@ -63,6 +68,16 @@ func CreateEndpoint(hostVethName string, containerVethName string) error {
 		return err
 	}
 
+	for feature, on := range offload {
+		for _, name := range []string{hostVethName, containerVethName} {
+			log.Printf("[net] Setting link %v offload %v %v.", name, feature, on)
+			if err = netlink.SetLinkOffload(name, feature, on); err != nil {
+				netlink.DeleteLink(hostVethName)
+				return err
+			}
+		}
+	}
+
 	log.Printf("[net] Setting link %v state up.", hostVethName)
 	err = netlink.SetLinkState(hostVethName, true)
 	if err != nil {
@@ -180,7 +195,7 @@ func EnableIPForwarding(ifName string) error {
 	// Enable ip forwading on linux vm.
 	// sysctl -w net.ipv4.ip_forward=1
 	cmd := fmt.Sprintf(enableIPForwardCmd)
-	_, err := platform.ExecuteCommand(cmd)
+	_, err := platform.ExecuteChangeCommand(cmd)
 	if err != nil {
 		log.Printf("[net] Enable ipforwarding failed with: %v", err)
 		return err
@@ -194,3 +209,21 @@ func EnableIPForwarding(ifName string) error {
 
 	return nil
 }
+
+// EnableIPv6Forwarding enables IPv6 forwarding in VM. Router advertisements are still accepted on the
+// given interface, since enabling forwarding otherwise removes the default route learnt from them.
+func EnableIPv6Forwarding(ifName string) error {
+	cmd := fmt.Sprintf(acceptRaCmdFmt, ifName)
+	if _, err := platform.ExecuteChangeCommand(cmd); err != nil {
+		log.Printf("[net] Enable accept_ra on %v failed with: %v", ifName, err)
+		return err
+	}
+
+	// sysctl -w net.ipv6.conf.all.forwarding=1
+	if _, err := platform.ExecuteChangeCommand(enableIPv6ForwardCmd); err != nil {
+		log.Printf("[net] Enable ipv6 forwarding failed with: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -37,6 +37,7 @@ type EndpointClient interface {
 	SetupContainerInterfaces(epInfo *EndpointInfo) error
 	ConfigureContainerInterfacesAndRoutes(epInfo *EndpointInfo) error
 	DeleteEndpoints(ep *endpoint) error
+	CheckEndpointRules(ep *endpoint) error
 }
 
 // NetworkManager manages the set of container networking resources.
@@ -54,6 +55,7 @@ type NetworkManager interface {
 	Uninitialize()
 
 	AddExternalInterface(ifName string, subnet string) error
+	EndpointExists(endpointId string) bool
 
 	CreateNetwork(nwInfo *NetworkInfo) error
 	DeleteNetwork(networkId string) error
@@ -62,6 +64,7 @@ type NetworkManager interface {
 	CreateEndpoint(networkId string, epInfo *EndpointInfo) error
 	DeleteEndpoint(networkId string, endpointId string) error
 	GetEndpointInfo(networkId string, endpointId string) (*EndpointInfo, error)
+	CheckEndpoint(networkId string, endpointId string, ifName string) error
 	GetEndpointInfoBasedOnPODDetails(networkId string, podName string, podNameSpace string, doExactMatchForPodName bool) (*EndpointInfo, error)
 	AttachEndpoint(networkId string, endpointId string, sandboxKey string) (*endpoint, error)
 	DetachEndpoint(networkId string, endpointId string) error
@@ -232,6 +235,22 @@ func (nm *networkManager) AddExternalInterface(ifName string, subnet string) err
 	return nil
 }
 
+// EndpointExists returns whether an endpoint with the given ID exists in any network.
+func (nm *networkManager) EndpointExists(endpointId string) bool {
+	nm.Lock()
+	defer nm.Unlock()
+
+	for _, extIf := range nm.ExternalInterfaces {
+		for _, nw := range extIf.Networks {
+			if nw.Endpoints[endpointId] != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // CreateNetwork creates a new container network.
 func (nm *networkManager) CreateNetwork(nwInfo *NetworkInfo) error {
 	nm.Lock()
@@ -284,6 +303,7 @@ func (nm *networkManager) GetNetworkInfo(networkId string) (*NetworkInfo, error)
 		Mode:             nw.Mode,
 		EnableSnatOnHost: nw.EnableSnatOnHost,
 		DNS:              nw.DNS,
+		MTU:              nw.MTU,
 		Options:          make(map[string]interface{}),
 	}
 
@@ -367,6 +387,24 @@ func (nm *networkManager) GetEndpointInfo(networkId string, endpointId string) (
 	return ep.getInfo(), nil
 }
 
+// CheckEndpoint verifies that the live state of the given endpoint matches its persisted state.
+func (nm *networkManager) CheckEndpoint(networkId string, endpointId string, ifName string) error {
+	nm.Lock()
+	defer nm.Unlock()
+
+	nw, err := nm.getNetwork(networkId)
+	if err != nil {
+		return err
+	}
+
+	ep, err := nw.getEndpoint(endpointId)
+	if err != nil {
+		return err
+	}
+
+	return nw.checkEndpoint(ep, ifName)
+}
+
 // GetEndpointInfoBasedOnPODDetails returns information about the given endpoint.
 // It returns an error if a single pod has multiple endpoints.
 func (nm *networkManager) GetEndpointInfoBasedOnPODDetails(networkID string, podName string, podNameSpace string, doExactMatchForPodName bool) (*EndpointInfo, error) {
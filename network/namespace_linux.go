@@ -56,6 +56,12 @@ func (ns *Namespace) GetFd() uintptr {
 	return ns.file.Fd()
 }
 
+// NewNetlinkHandle creates a netlink handle for configuring the namespace
+// without switching the caller thread into it.
+func (ns *Namespace) NewNetlinkHandle() (*netlink.Handle, error) {
+	return netlink.NewHandleAt(ns.file.Fd())
+}
+
 // Set sets the current namespace.
 func (ns *Namespace) set() error {
 	_, _, err := unix.Syscall(unix.SYS_SETNS, ns.file.Fd(), uintptr(unix.CLONE_NEWNET), 0)
@@ -32,6 +32,7 @@ type externalInterface struct {
 	Routes      []*route
 	IPv4Gateway net.IP
 	IPv6Gateway net.IP
+	MTU         int `json:",omitempty"`
 }
 
 // A container network is a set of endpoints allowed to communicate with each other.
@@ -46,6 +47,7 @@ type network struct {
 	DNS              DNSInfo
 	EnableSnatOnHost bool
 	SnatBridgeIP     string
+	MTU              int `json:",omitempty"`
 }
 
 // NetworkInfo contains read-only information about a container network.
@@ -58,6 +60,7 @@ type NetworkInfo struct {
 	Policies         []policy.Policy
 	BridgeName       string
 	EnableSnatOnHost bool
+	MTU              int
 	Options          map[string]interface{}
 }
 
@@ -78,6 +78,7 @@ func (nm *networkManager) newNetworkImpl(nwInfo *NetworkInfo, extIf *externalInt
 		VlanId:           vlanid,
 		DNS:              nwInfo.DNS,
 		EnableSnatOnHost: nwInfo.EnableSnatOnHost,
+		MTU:              nwInfo.MTU,
 	}
 
 	return nw, nil
@@ -103,6 +104,9 @@ func (nm *networkManager) deleteNetworkImpl(nw *network) error {
 
 //  SaveIPConfig saves the IP configuration of an interface.
 func (nm *networkManager) saveIPConfig(hostIf *net.Interface, extIf *externalInterface) error {
+	// Save the MTU of the interface, used by default for container networks.
+	extIf.MTU = hostIf.MTU
+
 	// Save the default routes on the interface.
 	routes, err := netlink.GetIpRoute(&netlink.Route{Dst: &net.IPNet{}, LinkIndex: hostIf.Index})
 	if err != nil {
@@ -270,13 +274,13 @@ func (nm *networkManager) applyIPConfig(extIf *externalInterface, targetIf *net.
 
 func applyDnsConfig(extIf *externalInterface, ifName string) error {
 	cmd := fmt.Sprintf("systemd-resolve --interface=%s --set-dns=%s", ifName, extIf.DNSInfo.Servers[0])
-	_, err := platform.ExecuteCommand(cmd)
+	_, err := platform.ExecuteChangeCommand(cmd)
 	if err != nil {
 		return err
 	}
 
 	cmd = fmt.Sprintf("systemd-resolve --interface=%s --set-domain=%s", ifName, extIf.DNSInfo.Suffix)
-	_, err = platform.ExecuteCommand(cmd)
+	_, err = platform.ExecuteChangeCommand(cmd)
 	return err
 }
 
@@ -328,7 +332,18 @@ func (nm *networkManager) connectExternalInterface(extIf *externalInterface, nwI
 			}
 		}()
 
-		bridge, err = net.InterfaceByName(bridgeName)
+		// The bridge MTU defaults to the MTU of the external interface.
+		mtu := nwInfo.MTU
+		if mtu == 0 {
+			mtu = hostIf.MTU
+		}
+
+		log.Printf("[net] Setting link %v MTU %v.", bridgeName, mtu)
+		if err = netlink.SetLinkMTU(bridgeName, mtu); err != nil {
+			return err
+		}
+
+		bridge, err = netlink.GetInterfaceByName(bridgeName)
 		if err != nil {
 			return err
 		}
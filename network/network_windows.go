@@ -99,6 +99,7 @@ func (nm *networkManager) newNetworkImpl(nwInfo *NetworkInfo, extIf *externalInt
 		extIf:            extIf,
 		VlanId:           vlanid,
 		EnableSnatOnHost: nwInfo.EnableSnatOnHost,
+		MTU:              nwInfo.MTU,
 	}
 
 	globals, err := hcsshim.GetHNSGlobals()
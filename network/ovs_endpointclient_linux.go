@@ -1,7 +1,7 @@
 package network
 
 import (
-	"net"
+	"fmt"
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/netlink"
@@ -60,11 +60,11 @@ func NewOVSEndpointClient(
 }
 
 func (client *OVSEndpointClient) AddEndpoints(epInfo *EndpointInfo) error {
-	if err := epcommon.CreateEndpoint(client.hostVethName, client.containerVethName); err != nil {
+	if err := epcommon.CreateEndpoint(client.hostVethName, client.containerVethName, epInfo.MTU, epInfo.Offload); err != nil {
 		return err
 	}
 
-	containerIf, err := net.InterfaceByName(client.containerVethName)
+	containerIf, err := netlink.GetInterfaceByName(client.containerVethName)
 	if err != nil {
 		log.Printf("InterfaceByName returns error for ifname %v with error %v", client.containerVethName, err)
 		return err
@@ -166,6 +166,20 @@ func (client *OVSEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	DeleteInfraVnetEndpointRules(client, ep, hostPort)
 }
 
+func (client *OVSEndpointClient) CheckEndpointRules(ep *endpoint) error {
+	log.Printf("[ovs] Get bridge for interface %v.", client.hostVethName)
+	bridgeName, err := ovsctl.GetOVSBridgeForPort(client.hostVethName)
+	if err != nil {
+		return fmt.Errorf("Interface %v is not attached to OVS bridge %v: %v", client.hostVethName, client.bridgeName, err)
+	}
+
+	if bridgeName != client.bridgeName {
+		return fmt.Errorf("Interface %v is attached to %v instead of OVS bridge %v", client.hostVethName, bridgeName, client.bridgeName)
+	}
+
+	return nil
+}
+
 func (client *OVSEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
 	// Move the container interface to container's network namespace.
 	log.Printf("[ovs] Setting link %v netns %v.", client.containerVethName, epInfo.NetNsPath)
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/ovsctl"
+	"github.com/Azure/azure-container-networking/platform"
 )
 
 type OVSNetworkClient struct {
@@ -20,6 +21,10 @@ const (
 )
 
 func updateOVSConfig(option string) error {
+	if platform.DryRun("echo \"%s\" >> %s", option, ovsConfigFile) {
+		return nil
+	}
+
 	f, err := os.OpenFile(ovsConfigFile, os.O_APPEND|os.O_RDWR, 0666)
 	if err != nil {
 		log.Printf("Error while opening ovs config %v", err)
@@ -31,7 +31,7 @@ func NewInfraVnetClient(hostIfName string, contIfName string) OVSInfraVnetClient
 }
 
 func (client *OVSInfraVnetClient) CreateInfraVnetEndpoint(bridgeName string) error {
-	if err := epcommon.CreateEndpoint(client.hostInfraVethName, client.ContainerInfraVethName); err != nil {
+	if err := epcommon.CreateEndpoint(client.hostInfraVethName, client.ContainerInfraVethName, 0, nil); err != nil {
 		log.Printf("Creating infraep failed with error %v", err)
 		return err
 	}
@@ -42,7 +42,7 @@ func (client *OVSInfraVnetClient) CreateInfraVnetEndpoint(bridgeName string) err
 		return err
 	}
 
-	infraContainerIf, err := net.InterfaceByName(client.ContainerInfraVethName)
+	infraContainerIf, err := netlink.GetInterfaceByName(client.ContainerInfraVethName)
 	if err != nil {
 		log.Printf("InterfaceByName returns error for ifname %v with error %v", client.ContainerInfraVethName, err)
 		return err
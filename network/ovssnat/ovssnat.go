@@ -5,27 +5,23 @@ import (
 	"net"
 	"strings"
 
+	"github.com/Azure/azure-container-networking/ebtables"
 	"github.com/Azure/azure-container-networking/iptables"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/netlink"
 	"github.com/Azure/azure-container-networking/network/epcommon"
 
 	"github.com/Azure/azure-container-networking/ovsctl"
-	"github.com/Azure/azure-container-networking/platform"
 )
 
 const (
-	azureSnatVeth0      = "azSnatveth0"
-	azureSnatVeth1      = "azSnatveth1"
-	azureSnatIfName     = "eth1"
-	cniOutputChain      = "AZURECNIOUTPUT"
-	cniInputChain       = "AZURECNIINPUT"
-	SnatBridgeName      = "azSnatbr"
-	ImdsIP              = "169.254.169.254/32"
-	vlanDropDeleteRule  = "ebtables -t nat -D PREROUTING -p 802_1Q -j DROP"
-	vlanDropAddRule     = "ebtables -t nat -A PREROUTING -p 802_1Q -j DROP"
-	vlanDropMatch       = "-p 802_1Q -j DROP"
-	l2PreroutingEntries = "ebtables -t nat -L PREROUTING"
+	azureSnatVeth0  = "azSnatveth0"
+	azureSnatVeth1  = "azSnatveth1"
+	azureSnatIfName = "eth1"
+	cniOutputChain  = "AZURECNIOUTPUT"
+	cniInputChain   = "AZURECNIINPUT"
+	SnatBridgeName  = "azSnatbr"
+	ImdsIP          = "169.254.169.254/32"
 )
 
 type OVSSnatClient struct {
@@ -75,7 +71,7 @@ func (client *OVSSnatClient) CreateSnatEndpoint(bridgeName string) error {
 	}
 
 	// Create veth pair to tie one end to container and other end to linux bridge
-	if err := epcommon.CreateEndpoint(client.hostSnatVethName, client.containerSnatVethName); err != nil {
+	if err := epcommon.CreateEndpoint(client.hostSnatVethName, client.containerSnatVethName, 0, nil); err != nil {
 		log.Printf("Creating Snat Endpoint failed with error %v", err)
 		return err
 	}
@@ -180,7 +176,7 @@ func (client *OVSSnatClient) AllowInboundFromHostToNC() error {
 		return err
 	}
 
-	snatContainerVeth, _ := net.InterfaceByName(client.containerSnatVethName)
+	snatContainerVeth, _ := netlink.GetInterfaceByName(client.containerSnatVethName)
 
 	// Add static arp entry for localIP to prevent arp going out of VM
 	log.Printf("Adding static arp entry for ip %s mac %s", containerIP, snatContainerVeth.HardwareAddr.String())
@@ -258,7 +254,7 @@ func (client *OVSSnatClient) AllowInboundFromNCToHost() error {
 		return err
 	}
 
-	snatContainerVeth, _ := net.InterfaceByName(client.containerSnatVethName)
+	snatContainerVeth, _ := netlink.GetInterfaceByName(client.containerSnatVethName)
 
 	// Add static arp entry for localIP to prevent arp going out of VM
 	log.Printf("Adding static arp entry for ip %s mac %s", containerIP, snatContainerVeth.HardwareAddr.String())
@@ -389,7 +385,7 @@ func CreateSnatBridge(snatBridgeIP string, mainInterface string) error {
 }
 
 func DeleteSnatBridge(bridgeName string) error {
-	_, err := platform.ExecuteCommand(vlanDropDeleteRule)
+	err := ebtables.SetVlanDrop(ebtables.Delete)
 	if err != nil {
 		log.Printf("Deleting ebtable vlan drop rule failed with error %v", err)
 	}
@@ -447,19 +443,6 @@ func DeleteMasqueradeRule() error {
 	Drop all vlan traffic on linux bridge
 **/
 func AddVlanDropRule() error {
-	out, err := platform.ExecuteCommand(l2PreroutingEntries)
-	if err != nil {
-		log.Printf("Error while listing ebtable rules %v", err)
-		return err
-	}
-
-	out = strings.TrimSpace(out)
-	if strings.Contains(out, vlanDropMatch) {
-		log.Printf("vlan drop rule already exists")
-		return nil
-	}
-
-	log.Printf("Adding ebtable rule to drop vlan traffic on snat bridge %v", vlanDropAddRule)
-	_, err = platform.ExecuteCommand(vlanDropAddRule)
-	return err
+	log.Printf("Adding ebtable rule to drop vlan traffic on snat bridge")
+	return ebtables.SetVlanDrop(ebtables.Append)
 }
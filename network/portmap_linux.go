@@ -0,0 +1,213 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Prefixes of the chains holding the DNAT and SNAT rules of an endpoint.
+	hostPortDnatChainPrefix = "AZURECNIDN"
+	hostPortSnatChainPrefix = "AZURECNISN"
+
+	// Match of the traffic to local addresses, looked up for host ports.
+	localDestinationMatch = "-m addrtype --dst-type LOCAL"
+	loopbackNetwork       = "127.0.0.0/8"
+
+	// Match of the traffic translated by port mappings, so that direct traffic to endpoints is not masqueraded.
+	translatedTrafficMatch = "-m conntrack --ctstate DNAT"
+)
+
+// portMappingRule is an iptables rule of the nat table implementing a port mapping.
+type portMappingRule struct {
+	chain  string
+	match  string
+	target string
+}
+
+// SetupPortMappings programs the hostPort mappings of an endpoint, replacing its existing mappings.
+func SetupPortMappings(epInfo *EndpointInfo) error {
+	if err := CleanupPortMappings(epInfo.Id); err != nil {
+		return err
+	}
+
+	return addPortMappings(epInfo)
+}
+
+// CleanupPortMappings removes the hostPort mappings of an endpoint.
+func CleanupPortMappings(endpointID string) error {
+	dnatChain, snatChain := getPortMappingChains(endpointID)
+
+	for _, chain := range []struct{ parent, name string }{
+		{iptables.CNIHostPortChain, dnatChain},
+		{iptables.CNIHostPortSnatChain, snatChain},
+	} {
+		if !iptables.ChainExists(iptables.Nat, chain.name) {
+			continue
+		}
+
+		log.Printf("[net] Deleting port mapping chain %v of endpoint %v.", chain.name, endpointID)
+		if iptables.RuleExists(iptables.Nat, chain.parent, "", chain.name) {
+			if err := iptables.DeleteIptableRule(iptables.Nat, chain.parent, "", chain.name); err != nil {
+				return err
+			}
+		}
+
+		if err := iptables.FlushChain(iptables.Nat, chain.name); err != nil {
+			return err
+		}
+
+		if err := iptables.DeleteChain(iptables.Nat, chain.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addPortMappings programs the hostPort mappings of a new endpoint.
+func addPortMappings(epInfo *EndpointInfo) error {
+	if len(epInfo.PortMappings) == 0 {
+		return nil
+	}
+
+	ipAddress := getPortMappingAddress(epInfo.IPAddresses)
+	if ipAddress == nil {
+		log.Printf("[net] Skipping port mappings of endpoint %v without an IPv4 address.", epInfo.Id)
+		return nil
+	}
+
+	rules := getPortMappingRules(epInfo.Id, ipAddress, epInfo.PortMappings)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	if err := addHostPortChains(); err != nil {
+		return err
+	}
+
+	dnatChain, snatChain := getPortMappingChains(epInfo.Id)
+	for _, chain := range []string{dnatChain, snatChain} {
+		if err := iptables.CreateChain(iptables.Nat, chain); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[net] Adding port mappings %+v of endpoint %v.", epInfo.PortMappings, epInfo.Id)
+	for _, rule := range rules {
+		if err := iptables.AppendIptableRule(iptables.Nat, rule.chain, rule.match, rule.target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addHostPortChains creates the chains holding the jumps to the port mapping chains of endpoints.
+// Traffic to local addresses is looked up for host ports, including traffic from the host itself.
+func addHostPortChains() error {
+	for _, chain := range []string{iptables.CNIHostPortChain, iptables.CNIHostPortSnatChain} {
+		if err := iptables.CreateChain(iptables.Nat, chain); err != nil {
+			return err
+		}
+	}
+
+	if err := iptables.InsertIptableRule(iptables.Nat, iptables.Prerouting, localDestinationMatch, iptables.CNIHostPortChain); err != nil {
+		return err
+	}
+
+	// Loopback addresses are not routed to endpoints.
+	outputMatch := fmt.Sprintf("! -d %s %s", loopbackNetwork, localDestinationMatch)
+	if err := iptables.InsertIptableRule(iptables.Nat, iptables.Output, outputMatch, iptables.CNIHostPortChain); err != nil {
+		return err
+	}
+
+	return iptables.InsertIptableRule(iptables.Nat, iptables.Postrouting, "", iptables.CNIHostPortSnatChain)
+}
+
+// getPortMappingRules returns the rules implementing the port mappings of an endpoint. Traffic to a host port
+// is translated to the endpoint address. Translated traffic from the endpoint subnet, including the endpoint
+// itself, is masqueraded so that replies go back through the host. Direct traffic between endpoints keeps
+// its source address, so that network policies still apply to it.
+func getPortMappingRules(endpointID string, ipAddress *net.IPNet, portMappings []PortMapping) []portMappingRule {
+	var rules []portMappingRule
+	dnatChain, snatChain := getPortMappingChains(endpointID)
+
+	subnet := &net.IPNet{IP: ipAddress.IP.Mask(ipAddress.Mask), Mask: ipAddress.Mask}
+
+	for _, mapping := range portMappings {
+		protocol := strings.ToLower(mapping.Protocol)
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		if protocol != "tcp" && protocol != "udp" && protocol != "sctp" {
+			log.Printf("[net] Skipping port mapping %+v with unsupported protocol.", mapping)
+			continue
+		}
+
+		dnatMatch := fmt.Sprintf("-p %s --dport %d", protocol, mapping.HostPort)
+		if mapping.HostIP != "" {
+			hostIP := net.ParseIP(mapping.HostIP)
+			if hostIP == nil || hostIP.To4() == nil {
+				log.Printf("[net] Skipping port mapping %+v with unsupported host IP.", mapping)
+				continue
+			}
+
+			if !hostIP.IsUnspecified() {
+				dnatMatch = fmt.Sprintf("-d %s %s", hostIP, dnatMatch)
+			}
+		}
+
+		rules = append(rules,
+			portMappingRule{
+				chain:  dnatChain,
+				match:  dnatMatch,
+				target: fmt.Sprintf("%s --to-destination %s:%d", iptables.Dnat, ipAddress.IP, mapping.ContainerPort),
+			},
+			portMappingRule{
+				chain:  snatChain,
+				match:  fmt.Sprintf("%s -s %s -d %s -p %s --dport %d", translatedTrafficMatch, subnet, ipAddress.IP, protocol, mapping.ContainerPort),
+				target: iptables.Masquerade,
+			},
+		)
+	}
+
+	if len(rules) > 0 {
+		rules = append(rules,
+			portMappingRule{chain: iptables.CNIHostPortChain, target: dnatChain},
+			portMappingRule{chain: iptables.CNIHostPortSnatChain, target: snatChain},
+		)
+	}
+
+	return rules
+}
+
+// getPortMappingChains returns the names of the DNAT and SNAT chains of an endpoint.
+// Chain names are limited to 28 characters, hence derived from a hash of the endpoint ID.
+func getPortMappingChains(endpointID string) (string, string) {
+	hash := sha1.Sum([]byte(endpointID))
+	suffix := strings.ToUpper(hex.EncodeToString(hash[:8]))
+
+	return hostPortDnatChainPrefix + suffix, hostPortSnatChainPrefix + suffix
+}
+
+// getPortMappingAddress returns the IPv4 address port mappings are translated to.
+func getPortMappingAddress(ipAddresses []net.IPNet) *net.IPNet {
+	for _, ipAddress := range ipAddresses {
+		if ipAddress.IP.To4() != nil {
+			return &net.IPNet{IP: ipAddress.IP.To4(), Mask: ipAddress.Mask}
+		}
+	}
+
+	return nil
+}
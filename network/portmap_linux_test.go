@@ -0,0 +1,126 @@
+// Copyright 2019 Microsoft. All rights reserved.
+// MIT License
+
+package network
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/iptables"
+	"github.com/Azure/azure-container-networking/rules"
+)
+
+func TestGetPortMappingRules(t *testing.T) {
+	ipAddress := &net.IPNet{IP: net.ParseIP("10.240.0.7").To4(), Mask: net.CIDRMask(16, 32)}
+	portMappings := []PortMapping{
+		{HostPort: 8080, ContainerPort: 80},
+		{HostPort: 5353, ContainerPort: 53, Protocol: "UDP", HostIP: "10.0.0.4"},
+		{HostPort: 9090, ContainerPort: 90, Protocol: "icmp"},
+		{HostPort: 9091, ContainerPort: 91, HostIP: "fd00::1"},
+	}
+
+	dnatChain, snatChain := getPortMappingChains("endpoint")
+	expected := []portMappingRule{
+		{dnatChain, "-p tcp --dport 8080", "DNAT --to-destination 10.240.0.7:80"},
+		{snatChain, "-m conntrack --ctstate DNAT -s 10.240.0.0/16 -d 10.240.0.7 -p tcp --dport 80", iptables.Masquerade},
+		{dnatChain, "-d 10.0.0.4 -p udp --dport 5353", "DNAT --to-destination 10.240.0.7:53"},
+		{snatChain, "-m conntrack --ctstate DNAT -s 10.240.0.0/16 -d 10.240.0.7 -p udp --dport 53", iptables.Masquerade},
+		{iptables.CNIHostPortChain, "", dnatChain},
+		{iptables.CNIHostPortSnatChain, "", snatChain},
+	}
+
+	rules := getPortMappingRules("endpoint", ipAddress, portMappings)
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected rules %+v, got %+v", expected, rules)
+	}
+
+	// Only translated traffic is masqueraded, not direct traffic from other endpoints.
+	for _, rule := range rules {
+		if rule.target == iptables.Masquerade && !strings.HasPrefix(rule.match, "-m conntrack --ctstate DNAT ") {
+			t.Errorf("Masquerade rule %+v does not match translated traffic only", rule)
+		}
+	}
+
+	if rules := getPortMappingRules("endpoint", ipAddress, portMappings[2:]); len(rules) != 0 {
+		t.Errorf("Expected no rules for unsupported port mappings, got %+v", rules)
+	}
+}
+
+func TestGetPortMappingChains(t *testing.T) {
+	dnatChain, snatChain := getPortMappingChains("3f8a1b2c-eth0")
+	otherDnatChain, _ := getPortMappingChains("3f8a1b2c-eth1")
+
+	if len(dnatChain) > 28 || len(snatChain) > 28 {
+		t.Errorf("Chain names %v and %v exceed the iptables limit", dnatChain, snatChain)
+	}
+
+	if dnatChain == otherDnatChain || dnatChain[len(hostPortDnatChainPrefix):] != snatChain[len(hostPortSnatChainPrefix):] {
+		t.Errorf("Unexpected chain names %v, %v and %v", dnatChain, snatChain, otherDnatChain)
+	}
+}
+
+func TestGetPortMappingAddress(t *testing.T) {
+	ipv6 := net.IPNet{IP: net.ParseIP("fd00::7"), Mask: net.CIDRMask(64, 128)}
+	_, ipv4, _ := net.ParseCIDR("10.240.0.7/16")
+	ipv4.IP = net.ParseIP("10.240.0.7")
+
+	if ipAddress := getPortMappingAddress([]net.IPNet{ipv6}); ipAddress != nil {
+		t.Errorf("Expected no address, got %v", ipAddress)
+	}
+
+	ipAddress := getPortMappingAddress([]net.IPNet{ipv6, *ipv4})
+	if ipAddress == nil || ipAddress.String() != "10.240.0.7/16" {
+		t.Errorf("Expected address 10.240.0.7/16, got %v", ipAddress)
+	}
+}
+
+func TestSetupAndCleanupPortMappings(t *testing.T) {
+	backend := rules.NewRecordingBackend(nil)
+	rules.SetBackend(backend)
+	defer rules.SetBackend(rules.NewExecBackend())
+
+	_, ipNet, _ := net.ParseCIDR("10.240.0.0/16")
+	ipNet.IP = net.ParseIP("10.240.0.7").To4()
+	epInfo := &EndpointInfo{
+		Id:           "endpoint",
+		IPAddresses:  []net.IPNet{*ipNet},
+		PortMappings: []PortMapping{{HostPort: 8080, ContainerPort: 80}},
+	}
+
+	if err := SetupPortMappings(epInfo); err != nil {
+		t.Fatalf("SetupPortMappings failed: %v", err)
+	}
+
+	dnatChain, _ := getPortMappingChains(epInfo.Id)
+	dnatRule := rules.NewIptablesRule(iptables.Nat, dnatChain, "-p tcp --dport 8080", "DNAT --to-destination 10.240.0.7:80")
+	jumpRule := rules.NewIptablesRule(iptables.Nat, iptables.CNIHostPortChain, "", dnatChain)
+
+	for _, rule := range []*rules.Rule{dnatRule, jumpRule} {
+		if exists, _ := backend.Exists(rule); !exists {
+			t.Errorf("Rule %v was not programmed, rules %+v", rule, backend.Rules())
+		}
+	}
+
+	// Setting up the same mappings again does not duplicate rules.
+	count := len(backend.Rules())
+	if err := SetupPortMappings(epInfo); err != nil {
+		t.Fatalf("SetupPortMappings failed: %v", err)
+	}
+
+	if len(backend.Rules()) != count {
+		t.Errorf("Expected %v rules after setting up the mappings again, got %v", count, len(backend.Rules()))
+	}
+
+	if err := CleanupPortMappings(epInfo.Id); err != nil {
+		t.Fatalf("CleanupPortMappings failed: %v", err)
+	}
+
+	for _, rule := range []*rules.Rule{dnatRule, jumpRule, rules.NewChain(rules.Iptables, iptables.Nat, dnatChain)} {
+		if exists, _ := backend.Exists(rule); exists {
+			t.Errorf("Rule %v was not deleted", rule)
+		}
+	}
+}
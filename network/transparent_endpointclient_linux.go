@@ -47,10 +47,36 @@ func NewTransparentEndpointClient(
 
 func setArpProxy(ifName string) error {
 	cmd := fmt.Sprintf("echo 1 > /proc/sys/net/ipv4/conf/%v/proxy_arp", ifName)
-	_, err := platform.ExecuteCommand(cmd)
+	_, err := platform.ExecuteChangeCommand(cmd)
 	return err
 }
 
+func setNdpProxy(ifName string) error {
+	cmd := fmt.Sprintf("echo 1 > /proc/sys/net/ipv6/conf/%v/proxy_ndp", ifName)
+	_, err := platform.ExecuteChangeCommand(cmd)
+	return err
+}
+
+// getHostRouteMask returns the mask of a host route for the given address.
+func getHostRouteMask(ip net.IP) net.IPMask {
+	if ip.To4() == nil {
+		return net.CIDRMask(128, 128)
+	}
+
+	return net.CIDRMask(32, 32)
+}
+
+// getIPv6Gateway returns the gateway of the IPv6 default route of the endpoint, if any.
+func getIPv6Gateway(routes []RouteInfo) net.IP {
+	for _, route := range routes {
+		if route.Gw != nil && route.Gw.To4() == nil {
+			return route.Gw
+		}
+	}
+
+	return nil
+}
+
 func (client *TransparentEndpointClient) AddEndpoints(epInfo *EndpointInfo) error {
 
 	if _, err := net.InterfaceByName(client.hostVethName); err == nil {
@@ -61,18 +87,18 @@ func (client *TransparentEndpointClient) AddEndpoints(epInfo *EndpointInfo) erro
 		}
 	}
 
-	if err := epcommon.CreateEndpoint(client.hostVethName, client.containerVethName); err != nil {
+	if err := epcommon.CreateEndpoint(client.hostVethName, client.containerVethName, epInfo.MTU, epInfo.Offload); err != nil {
 		return err
 	}
 
-	containerIf, err := net.InterfaceByName(client.containerVethName)
+	containerIf, err := netlink.GetInterfaceByName(client.containerVethName)
 	if err != nil {
 		return err
 	}
 
 	client.containerMac = containerIf.HardwareAddr
 
-	hostVethIf, err := net.InterfaceByName(client.hostVethName)
+	hostVethIf, err := netlink.GetInterfaceByName(client.hostVethName)
 	if err != nil {
 		return err
 	}
@@ -89,7 +115,7 @@ func (client *TransparentEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 	// This route is needed for incoming packets to pod to route via hostveth
 	for _, ipAddr := range epInfo.IPAddresses {
 		var routeInfo RouteInfo
-		ipNet := net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(32, 32)}
+		ipNet := net.IPNet{IP: ipAddr.IP, Mask: getHostRouteMask(ipAddr.IP)}
 		log.Printf("[net] Adding route for the ip %v", ipNet.String())
 		routeInfo.Dst = ipNet
 		routeInfoList = append(routeInfoList, routeInfo)
@@ -104,6 +130,45 @@ func (client *TransparentEndpointClient) AddEndpointRules(epInfo *EndpointInfo)
 		return err
 	}
 
+	return client.addIPv6ProxyRules(epInfo)
+}
+
+// addIPv6ProxyRules sets up neighbor proxying so that the host answers neighbor solicitations
+// for the pod's IPv6 addresses on the primary interface, and for the gateway on hostveth.
+func (client *TransparentEndpointClient) addIPv6ProxyRules(epInfo *EndpointInfo) error {
+	gateway := getIPv6Gateway(epInfo.Routes)
+	if gateway == nil {
+		return nil
+	}
+
+	if err := epcommon.EnableIPv6Forwarding(client.hostPrimaryIfName); err != nil {
+		return err
+	}
+
+	for _, ifName := range []string{client.hostVethName, client.hostPrimaryIfName} {
+		log.Printf("calling setNdpProxy for %v", ifName)
+		if err := setNdpProxy(ifName); err != nil {
+			log.Printf("setNdpProxy failed with: %v", err)
+			return err
+		}
+	}
+
+	log.Printf("[net] Adding proxy neighbor for gateway %v on %v", gateway.String(), client.hostVethName)
+	if err := netlink.AddOrRemoveProxyNeighbor(netlink.ADD, client.hostVethName, gateway); err != nil {
+		return err
+	}
+
+	for _, ipAddr := range epInfo.IPAddresses {
+		if ipAddr.IP.To4() != nil {
+			continue
+		}
+
+		log.Printf("[net] Adding proxy neighbor for ip %v on %v", ipAddr.IP.String(), client.hostPrimaryIfName)
+		if err := netlink.AddOrRemoveProxyNeighbor(netlink.ADD, client.hostPrimaryIfName, ipAddr.IP); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -114,14 +179,50 @@ func (client *TransparentEndpointClient) DeleteEndpointRules(ep *endpoint) {
 	// Deleting the route set up for routing the incoming packets to pod
 	for _, ipAddr := range ep.IPAddresses {
 		var routeInfo RouteInfo
-		ipNet := net.IPNet{IP: ipAddr.IP, Mask: net.CIDRMask(32, 32)}
+		ipNet := net.IPNet{IP: ipAddr.IP, Mask: getHostRouteMask(ipAddr.IP)}
 		log.Printf("[net] Deleting route for the ip %v", ipNet.String())
 		routeInfo.Dst = ipNet
 		routeInfoList = append(routeInfoList, routeInfo)
 		deleteRoutes(client.hostVethName, routeInfoList)
+
+		// Delete the proxy neighbor set up for the pod's IPv6 address.
+		if ipAddr.IP.To4() == nil {
+			log.Printf("[net] Deleting proxy neighbor for ip %v on %v", ipAddr.IP.String(), client.hostPrimaryIfName)
+			if err := netlink.AddOrRemoveProxyNeighbor(netlink.REMOVE, client.hostPrimaryIfName, ipAddr.IP); err != nil {
+				log.Printf("[net] Failed to delete proxy neighbor for ip %v: %v", ipAddr.IP.String(), err)
+			}
+		}
 	}
 }
 
+func (client *TransparentEndpointClient) CheckEndpointRules(ep *endpoint) error {
+	hostVethIf, err := net.InterfaceByName(client.hostVethName)
+	if err != nil {
+		return err
+	}
+
+	// Incoming packets to the pod must still be routed via hostveth.
+	for _, ipAddr := range ep.IPAddresses {
+		ipNet := net.IPNet{IP: ipAddr.IP, Mask: getHostRouteMask(ipAddr.IP)}
+		filter := &netlink.Route{
+			Family:    netlink.GetIpAddressFamily(ipAddr.IP),
+			Dst:       &ipNet,
+			LinkIndex: hostVethIf.Index,
+		}
+
+		routes, err := netlink.GetIpRoute(filter)
+		if err != nil {
+			return err
+		}
+
+		if len(routes) == 0 {
+			return fmt.Errorf("Route for %v via %v not found", ipNet.String(), client.hostVethName)
+		}
+	}
+
+	return nil
+}
+
 func (client *TransparentEndpointClient) MoveEndpointsToContainerNS(epInfo *EndpointInfo, nsID uintptr) error {
 	// Move the container interface to container's network namespace.
 	log.Printf("[net] Setting link %v netns %v.", client.containerVethName, epInfo.NetNsPath)
@@ -7,8 +7,10 @@ import (
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/util"
 )
 
@@ -17,12 +19,14 @@ type ipsEntry struct {
 	name          string
 	set           string
 	spec          string
+	family        string
 }
 
 // IpsetManager stores ipset states.
 type IpsetManager struct {
-	listMap map[string]*Ipset //tracks all set lists.
-	setMap  map[string]*Ipset //label -> []ip
+	listMap     map[string]*Ipset //tracks all set lists.
+	setMap      map[string]*Ipset //label -> []ip
+	transaction *ipsetTransaction
 }
 
 // Ipset represents one ipset entry.
@@ -47,6 +51,11 @@ func NewIpsetManager() *IpsetManager {
 	}
 }
 
+// GetIpsetCount returns the number of sets and lists maintained by the ipset manager.
+func (ipsMgr *IpsetManager) GetIpsetCount() int {
+	return len(ipsMgr.setMap) + len(ipsMgr.listMap)
+}
+
 // Exists checks if an element exists in setMap/listMap.
 func (ipsMgr *IpsetManager) Exists(key string, val string, kind string) bool {
 	m := ipsMgr.setMap
@@ -71,22 +80,53 @@ func isNsSet(setName string) bool {
 	return !strings.Contains(setName, "-") && !strings.Contains(setName, ":")
 }
 
+// getSetSpec returns the type of the ipset with the given name.
+// Named port sets hold ip,proto:port entries, other sets hold ips and cidrs.
+func getSetSpec(setName string) string {
+	if util.IsNamedPortIpset(setName) {
+		return util.IpsetIPPortHashFlag
+	}
+
+	return util.IpsetNetHashFlag
+}
+
+// getHashedNames returns the hashed names of the ipsets kept for every IP family in use.
+func getHashedNames(name string) []string {
+	hashedNames := []string{util.GetHashedName(name)}
+	if util.IsIPv6Enabled {
+		hashedNames = append(hashedNames, util.GetIPv6HashedName(name))
+	}
+
+	return hashedNames
+}
+
+// getHashedNameForIP returns the hashed name of the ipset with the same IP family as the given ip.
+func getHashedNameForIP(name string, ip string) string {
+	if util.IsIPv6(ip) {
+		return util.GetIPv6HashedName(name)
+	}
+
+	return util.GetHashedName(name)
+}
+
 // CreateList creates an ipset list. npm maintains one setlist per namespace label.
 func (ipsMgr *IpsetManager) CreateList(listName string) error {
 	if _, exists := ipsMgr.listMap[listName]; exists {
 		return nil
 	}
 
-	entry := &ipsEntry{
-		name:          listName,
-		operationFlag: util.IpsetCreationFlag,
-		set:           util.GetHashedName(listName),
-		spec:          util.IpsetSetListFlag,
-	}
-	log.Printf("Creating List: %+v", entry)
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Errorf("Error: failed to create ipset list %s.", listName)
-		return err
+	for _, hashedListName := range getHashedNames(listName) {
+		entry := &ipsEntry{
+			name:          listName,
+			operationFlag: util.IpsetCreationFlag,
+			set:           hashedListName,
+			spec:          util.IpsetSetListFlag,
+		}
+		log.Printf("Creating List: %+v", entry)
+		if _, err := ipsMgr.Run(entry); err != nil {
+			log.Errorf("Error: failed to create ipset list %s.", listName)
+			return err
+		}
 	}
 
 	ipsMgr.listMap[listName] = NewIpset(listName)
@@ -96,20 +136,30 @@ func (ipsMgr *IpsetManager) CreateList(listName string) error {
 
 // DeleteList removes an ipset list.
 func (ipsMgr *IpsetManager) DeleteList(listName string) error {
-	entry := &ipsEntry{
-		operationFlag: util.IpsetDestroyFlag,
-		set:           util.GetHashedName(listName),
-	}
+	// Every IP family is destroyed even if one of them is still referred,
+	// and the list is forgotten only once all of them are gone.
+	inUse := false
+	for _, hashedListName := range getHashedNames(listName) {
+		entry := &ipsEntry{
+			operationFlag: util.IpsetDestroyFlag,
+			set:           hashedListName,
+		}
 
-	errCode, err := ipsMgr.Run(entry)
-	if err != nil {
-		if errCode == 1 {
-			log.Printf("Error: Cannot delete list %s as it's being referred or doesn't exist.", listName)
-			return nil
+		errCode, err := ipsMgr.Run(entry)
+		if err != nil {
+			if errCode == 1 {
+				log.Printf("Error: Cannot delete list %s as it's being referred or doesn't exist.", hashedListName)
+				inUse = true
+				continue
+			}
+
+			log.Errorf("Error: failed to delete ipset %s %+v", listName, entry)
+			return err
 		}
+	}
 
-		log.Errorf("Error: failed to delete ipset %s %+v", listName, entry)
-		return err
+	if inUse {
+		return nil
 	}
 
 	delete(ipsMgr.listMap, listName)
@@ -127,15 +177,19 @@ func (ipsMgr *IpsetManager) AddToList(listName string, setName string) error {
 		return err
 	}
 
-	entry := &ipsEntry{
-		operationFlag: util.IpsetAppendFlag,
-		set:           util.GetHashedName(listName),
-		spec:          util.GetHashedName(setName),
-	}
+	// Sets are only added to the list of the same IP family.
+	hashedListNames, hashedSetNames := getHashedNames(listName), getHashedNames(setName)
+	for i := range hashedListNames {
+		entry := &ipsEntry{
+			operationFlag: util.IpsetAppendFlag,
+			set:           hashedListNames[i],
+			spec:          hashedSetNames[i],
+		}
 
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Errorf("Error: failed to create ipset rules. rule: %+v", entry)
-		return err
+		if _, err := ipsMgr.Run(entry); err != nil {
+			log.Errorf("Error: failed to create ipset rules. rule: %+v", entry)
+			return err
+		}
 	}
 
 	ipsMgr.listMap[listName].elements = append(ipsMgr.listMap[listName].elements, setName)
@@ -156,16 +210,18 @@ func (ipsMgr *IpsetManager) DeleteFromList(listName string, setName string) erro
 		}
 	}
 
-	hashedListName, hashedSetName := util.GetHashedName(listName), util.GetHashedName(setName)
-	entry := &ipsEntry{
-		operationFlag: util.IpsetDeletionFlag,
-		set:           hashedListName,
-		spec:          hashedSetName,
-	}
-	errCode, err := ipsMgr.Run(entry)
-	if errCode > 1 && err != nil {
-		log.Errorf("Error: failed to delete ipset entry. %+v", entry)
-		return err
+	hashedListNames, hashedSetNames := getHashedNames(listName), getHashedNames(setName)
+	for i := range hashedListNames {
+		entry := &ipsEntry{
+			operationFlag: util.IpsetDeletionFlag,
+			set:           hashedListNames[i],
+			spec:          hashedSetNames[i],
+		}
+		errCode, err := ipsMgr.Run(entry)
+		if errCode > 1 && err != nil {
+			log.Errorf("Error: failed to delete ipset entry. %+v", entry)
+			return err
+		}
 	}
 
 	if len(ipsMgr.listMap[listName].elements) == 0 {
@@ -184,17 +240,22 @@ func (ipsMgr *IpsetManager) CreateSet(setName string) error {
 		return nil
 	}
 
-	entry := &ipsEntry{
-		name:          setName,
-		operationFlag: util.IpsetCreationFlag,
-		// Use hashed string for set name to avoid string length limit of ipset.
-		set:  util.GetHashedName(setName),
-		spec: util.IpsetNetHashFlag,
-	}
-	log.Printf("Creating Set: %+v", entry)
-	if _, err := ipsMgr.Run(entry); err != nil {
-		log.Errorf("Error: failed to create ipset.")
-		return err
+	for _, hashedSetName := range getHashedNames(setName) {
+		entry := &ipsEntry{
+			name:          setName,
+			operationFlag: util.IpsetCreationFlag,
+			// Use hashed string for set name to avoid string length limit of ipset.
+			set:  hashedSetName,
+			spec: getSetSpec(setName),
+		}
+		if strings.HasPrefix(hashedSetName, util.AzureNpmIPv6Prefix) {
+			entry.family = util.IpsetIPv6Family
+		}
+		log.Printf("Creating Set: %+v", entry)
+		if _, err := ipsMgr.Run(entry); err != nil {
+			log.Errorf("Error: failed to create ipset.")
+			return err
+		}
 	}
 
 	ipsMgr.setMap[setName] = NewIpset(setName)
@@ -213,19 +274,27 @@ func (ipsMgr *IpsetManager) DeleteSet(setName string) error {
 		return nil
 	}
 
-	entry := &ipsEntry{
-		operationFlag: util.IpsetDestroyFlag,
-		set:           util.GetHashedName(setName),
-	}
-	errCode, err := ipsMgr.Run(entry)
-	if err != nil {
-		if errCode == 1 {
-			log.Printf("Cannot delete set %s as it's being referred.", setName)
-			return nil
+	inUse := false
+	for _, hashedSetName := range getHashedNames(setName) {
+		entry := &ipsEntry{
+			operationFlag: util.IpsetDestroyFlag,
+			set:           hashedSetName,
 		}
+		errCode, err := ipsMgr.Run(entry)
+		if err != nil {
+			if errCode == 1 {
+				log.Printf("Cannot delete set %s as it's being referred.", hashedSetName)
+				inUse = true
+				continue
+			}
+
+			log.Errorf("Error: failed to delete ipset %s. Entry: %+v", setName, entry)
+			return err
+		}
+	}
 
-		log.Errorf("Error: failed to delete ipset %s. Entry: %+v", setName, entry)
-		return err
+	if inUse {
+		return nil
 	}
 
 	delete(ipsMgr.setMap, setName)
@@ -245,7 +314,7 @@ func (ipsMgr *IpsetManager) AddToSet(setName string, ip string) error {
 
 	entry := &ipsEntry{
 		operationFlag: util.IpsetAppendFlag,
-		set:           util.GetHashedName(setName),
+		set:           getHashedNameForIP(setName, ip),
 		spec:          ip,
 	}
 
@@ -274,7 +343,7 @@ func (ipsMgr *IpsetManager) DeleteFromSet(setName string, ip string) error {
 
 	entry := &ipsEntry{
 		operationFlag: util.IpsetDeletionFlag,
-		set:           util.GetHashedName(setName),
+		set:           getHashedNameForIP(setName, ip),
 		spec:          ip,
 	}
 	if _, err := ipsMgr.Run(entry); err != nil {
@@ -331,8 +400,13 @@ func (ipsMgr *IpsetManager) Destroy() error {
 	return nil
 }
 
-// Run execute an ipset command to update ipset.
+// Run execute an ipset command to update ipset. Within a transaction, the entry is batched instead.
 func (ipsMgr *IpsetManager) Run(entry *ipsEntry) (int, error) {
+	if tx := ipsMgr.transaction; tx != nil && isBatched(entry) {
+		tx.add(entry)
+		return 0, nil
+	}
+
 	cmdName := util.Ipset
 	cmdArgs := []string{entry.operationFlag, util.IpsetExistFlag}
 	if len(entry.set) > 0 {
@@ -341,12 +415,18 @@ func (ipsMgr *IpsetManager) Run(entry *ipsEntry) (int, error) {
 	if len(entry.spec) > 0 {
 		cmdArgs = append(cmdArgs, entry.spec)
 	}
+	if len(entry.family) > 0 {
+		cmdArgs = append(cmdArgs, util.IpsetFamilyFlag, entry.family)
+	}
 
 	log.Printf("Executing ipset command %s %v", cmdName, cmdArgs)
+	start := time.Now()
 	_, err := exec.Command(cmdName, cmdArgs...).Output()
+	metrics.ExecTime.ObserveSince(start, cmdName)
 	if msg, failed := err.(*exec.ExitError); failed {
 		errCode := msg.Sys().(syscall.WaitStatus).ExitStatus()
 		if errCode > 1 {
+			metrics.IpsetErrors.Inc()
 			log.Errorf("Error: There was an error running command: %s %s Arguments:%v", err, cmdName, cmdArgs)
 		}
 
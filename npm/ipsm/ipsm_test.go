@@ -242,6 +242,115 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestGetRestoreLine(t *testing.T) {
+	entry := &ipsEntry{
+		operationFlag: util.IpsetCreationFlag,
+		set:           "test-set",
+		spec:          util.IpsetNetHashFlag,
+		family:        util.IpsetIPv6Family,
+	}
+
+	if line := getRestoreLine(entry); line != "create test-set nethash family inet6" {
+		t.Errorf("TestGetRestoreLine failed @ getRestoreLine, got %s", line)
+	}
+
+	entry = &ipsEntry{
+		operationFlag: util.IpsetDeletionFlag,
+		set:           "test-set",
+		spec:          "1.2.3.4",
+	}
+
+	if line := getRestoreLine(entry); line != "del test-set 1.2.3.4" {
+		t.Errorf("TestGetRestoreLine failed @ getRestoreLine, got %s", line)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	ipsMgr := NewIpsetManager()
+	ipsMgr.setMap["test-set"] = NewIpset("test-set")
+
+	ipsMgr.BeginTransaction()
+
+	if err := ipsMgr.DeleteSet("test-set"); err != nil {
+		t.Errorf("TestTransaction failed @ ipsMgr.DeleteSet")
+	}
+
+	if len(ipsMgr.transaction.destroys) != len(getHashedNames("test-set")) {
+		t.Errorf("TestTransaction failed @ ipsMgr.DeleteSet, destroy is not deferred")
+	}
+
+	// Creating the set again cancels the deferred destroy.
+	if err := ipsMgr.AddToSet("test-set", "1.2.3.4"); err != nil {
+		t.Errorf("TestTransaction failed @ ipsMgr.AddToSet")
+	}
+
+	if len(ipsMgr.transaction.destroys) != 0 {
+		t.Errorf("TestTransaction failed @ ipsMgr.AddToSet, destroy is not cancelled")
+	}
+
+	ipsMgr.AbortTransaction()
+
+	if set, exists := ipsMgr.setMap["test-set"]; !exists || len(set.elements) != 0 {
+		t.Errorf("TestTransaction failed @ ipsMgr.AbortTransaction, state is not restored")
+	}
+}
+
+func TestDiffIpsets(t *testing.T) {
+	isIPv6Enabled := util.IsIPv6Enabled
+	util.IsIPv6Enabled = false
+	defer func() { util.IsIPv6Enabled = isIPv6Enabled }()
+
+	hashedSetName := util.GetHashedName("test-set")
+	hashedListName := util.GetHashedName("test-list")
+	staleSetName := util.GetHashedName("stale-set")
+
+	live := parseIpsetSave(
+		"create " + hashedSetName + " hash:net family inet hashsize 1024 maxelem 65536\n" +
+			"add " + hashedSetName + " 1.2.3.4\n" +
+			"add " + hashedSetName + " 1.2.3.5\n" +
+			"create " + staleSetName + " hash:net family inet hashsize 1024 maxelem 65536\n" +
+			"create other-set hash:net family inet hashsize 1024 maxelem 65536\n")
+
+	if _, exists := live["other-set"]; exists {
+		t.Errorf("TestDiffIpsets failed @ parseIpsetSave, non azure-npm ipset is parsed")
+	}
+
+	desired := getDesiredIpsets(
+		map[string][]string{"test-set": {"1.2.3.4/32", "1.2.3.6"}},
+		map[string][]string{"test-list": {"test-set"}},
+	)
+
+	entries, drift := diffIpsets(desired, live)
+
+	expected := Drift{MissingSets: 1, StaleSets: 1, MissingEntries: 2, StaleEntries: 1}
+	if *drift != expected {
+		t.Errorf("TestDiffIpsets failed @ diffIpsets, expected %+v, got %+v", expected, *drift)
+	}
+
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, entry.operationFlag+" "+entry.set+" "+entry.spec)
+	}
+
+	expectedLines := []string{
+		util.IpsetCreationFlag + " " + hashedListName + " " + util.IpsetSetListFlag,
+		util.IpsetAppendFlag + " " + hashedListName + " " + hashedSetName,
+		util.IpsetAppendFlag + " " + hashedSetName + " 1.2.3.6",
+		util.IpsetDeletionFlag + " " + hashedSetName + " 1.2.3.5",
+		util.IpsetDestroyFlag + " " + staleSetName + " ",
+	}
+
+	if len(lines) != len(expectedLines) {
+		t.Fatalf("TestDiffIpsets failed @ diffIpsets, expected %v, got %v", expectedLines, lines)
+	}
+
+	for i := range lines {
+		if lines[i] != expectedLines[i] {
+			t.Errorf("TestDiffIpsets failed @ entry %d, expected %s, got %s", i, expectedLines[i], lines[i])
+		}
+	}
+}
+
 func TestMain(m *testing.M) {
 	ipsMgr := NewIpsetManager()
 	ipsMgr.Save(util.IpsetConfigFile)
@@ -0,0 +1,263 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package ipsm
+
+import (
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// Drift counts the differences found between the desired ipsets and the azure-npm ipsets in the kernel.
+type Drift struct {
+	MissingSets    int
+	StaleSets      int
+	MissingEntries int
+	StaleEntries   int
+}
+
+// ipsetState holds the members of an ipset, keyed by hashed ipset name.
+type ipsetState struct {
+	spec    string
+	family  string
+	members map[string]bool
+}
+
+// Reconcile compares the given sets and lists, mapping names to members, with the azure-npm ipsets
+// in the kernel and repairs the differences. In-memory state is replaced by the given sets and lists.
+// Within a transaction, the repairs are batched.
+func (ipsMgr *IpsetManager) Reconcile(sets map[string][]string, lists map[string][]string) (*Drift, error) {
+	live, err := loadIpsets()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, drift := diffIpsets(getDesiredIpsets(sets, lists), live)
+	for _, entry := range entries {
+		log.Printf("Repairing ipset drift: %+v", entry)
+		errCode, err := ipsMgr.Run(entry)
+		if err != nil && (entry.operationFlag != util.IpsetDestroyFlag || errCode > 1) {
+			log.Errorf("Error: failed to repair ipset %s.", entry.set)
+			return drift, err
+		}
+	}
+
+	ipsMgr.setMap = getIpsets(sets, ipsMgr.setMap)
+	ipsMgr.listMap = getIpsets(lists, ipsMgr.listMap)
+
+	return drift, nil
+}
+
+// getIpsets returns the in-memory ipsets holding the given members, keeping reference counts of existing ipsets.
+func getIpsets(members map[string][]string, existing map[string]*Ipset) map[string]*Ipset {
+	ipsets := make(map[string]*Ipset, len(members))
+	for name, elements := range members {
+		ipset := NewIpset(name)
+		if old, exists := existing[name]; exists {
+			ipset.referCount = old.referCount
+		}
+		ipset.elements = append([]string(nil), elements...)
+		ipsets[name] = ipset
+	}
+
+	return ipsets
+}
+
+// getDesiredIpsets returns the kernel ipsets implementing the given sets and lists, for every IP family in use.
+func getDesiredIpsets(sets map[string][]string, lists map[string][]string) map[string]*ipsetState {
+	desired := make(map[string]*ipsetState)
+	newState := func(hashedName string, spec string) *ipsetState {
+		state := &ipsetState{
+			spec:    spec,
+			members: make(map[string]bool),
+		}
+		if strings.HasPrefix(hashedName, util.AzureNpmIPv6Prefix) {
+			state.family = util.IpsetIPv6Family
+		}
+		desired[hashedName] = state
+		return state
+	}
+
+	for setName, members := range sets {
+		for _, hashedSetName := range getHashedNames(setName) {
+			newState(hashedSetName, getSetSpec(setName))
+		}
+
+		for _, member := range members {
+			if state, exists := desired[getHashedNameForIP(setName, member)]; exists {
+				state.members[normalizeMember(member)] = true
+			}
+		}
+	}
+
+	for listName, members := range lists {
+		hashedListNames := getHashedNames(listName)
+		states := make([]*ipsetState, len(hashedListNames))
+		for i, hashedListName := range hashedListNames {
+			states[i] = newState(hashedListName, util.IpsetSetListFlag)
+		}
+
+		// Sets are only added to the list of the same IP family.
+		for _, member := range members {
+			for i, hashedSetName := range getHashedNames(member) {
+				states[i].members[hashedSetName] = true
+			}
+		}
+	}
+
+	return desired
+}
+
+// diffIpsets returns the entries turning the live ipsets into the desired ones, and the drift they repair.
+// Sets are created before entries are added to them, and lists are destroyed before the sets in them.
+func diffIpsets(desired map[string]*ipsetState, live map[string]*ipsetState) ([]*ipsEntry, *Drift) {
+	drift := &Drift{}
+	var creates, updates, destroys []*ipsEntry
+
+	for _, hashedName := range getSortedNames(desired) {
+		state := desired[hashedName]
+		liveState, exists := live[hashedName]
+		if !exists {
+			drift.MissingSets++
+			creates = append(creates, &ipsEntry{
+				operationFlag: util.IpsetCreationFlag,
+				set:           hashedName,
+				spec:          state.spec,
+				family:        state.family,
+			})
+			liveState = &ipsetState{members: make(map[string]bool)}
+		}
+
+		for _, member := range getSortedMembers(state.members) {
+			if !liveState.members[member] {
+				drift.MissingEntries++
+				updates = append(updates, &ipsEntry{
+					operationFlag: util.IpsetAppendFlag,
+					set:           hashedName,
+					spec:          member,
+				})
+			}
+		}
+
+		for _, member := range getSortedMembers(liveState.members) {
+			if !state.members[member] {
+				drift.StaleEntries++
+				updates = append(updates, &ipsEntry{
+					operationFlag: util.IpsetDeletionFlag,
+					set:           hashedName,
+					spec:          member,
+				})
+			}
+		}
+	}
+
+	for _, hashedName := range getSortedNames(live) {
+		if _, exists := desired[hashedName]; exists {
+			continue
+		}
+
+		drift.StaleSets++
+		entry := &ipsEntry{
+			operationFlag: util.IpsetDestroyFlag,
+			set:           hashedName,
+		}
+		if live[hashedName].spec == util.IpsetSetListFlag {
+			destroys = append([]*ipsEntry{entry}, destroys...)
+		} else {
+			destroys = append(destroys, entry)
+		}
+	}
+
+	return append(append(creates, updates...), destroys...), drift
+}
+
+// loadIpsets reads the azure-npm ipsets in the kernel with ipset save.
+func loadIpsets() (map[string]*ipsetState, error) {
+	start := time.Now()
+	out, err := exec.Command(util.Ipset, util.IpsetSaveFlag).Output()
+	metrics.ExecTime.ObserveSince(start, util.Ipset)
+	if err != nil {
+		metrics.IpsetErrors.Inc()
+		log.Errorf("Error: failed to run ipset save. %v", err)
+		return nil, err
+	}
+
+	return parseIpsetSave(string(out)), nil
+}
+
+// parseIpsetSave returns the azure-npm ipsets in the output of ipset save.
+func parseIpsetSave(out string) map[string]*ipsetState {
+	ipsets := make(map[string]*ipsetState)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		command, hashedName := fields[0], fields[1]
+		if !strings.HasPrefix(hashedName, util.AzureNpmPrefix) && !strings.HasPrefix(hashedName, util.AzureNpmIPv6Prefix) {
+			continue
+		}
+
+		switch command {
+		case util.IpsetCreateCmd:
+			state := &ipsetState{members: make(map[string]bool)}
+			// ipset save reports list:set for the setlist type.
+			if fields[2] == "list:set" {
+				state.spec = util.IpsetSetListFlag
+			} else {
+				state.spec = fields[2]
+			}
+			for i := 3; i+1 < len(fields); i++ {
+				if fields[i] == util.IpsetFamilyFlag && fields[i+1] == util.IpsetIPv6Family {
+					state.family = util.IpsetIPv6Family
+				}
+			}
+			ipsets[hashedName] = state
+		case util.IpsetAddCmd:
+			if state, exists := ipsets[hashedName]; exists {
+				state.members[normalizeMember(fields[2])] = true
+			}
+		}
+	}
+
+	return ipsets
+}
+
+// normalizeMember returns an ipset member as ipset save reports it. Host CIDRs are reported as addresses.
+func normalizeMember(member string) string {
+	if strings.HasSuffix(member, "/32") && !util.IsIPv6(member) {
+		return strings.TrimSuffix(member, "/32")
+	}
+
+	if strings.HasSuffix(member, "/128") && util.IsIPv6(member) {
+		return strings.TrimSuffix(member, "/128")
+	}
+
+	return member
+}
+
+func getSortedNames(ipsets map[string]*ipsetState) []string {
+	names := make([]string, 0, len(ipsets))
+	for name := range ipsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func getSortedMembers(members map[string]bool) []string {
+	sorted := make([]string, 0, len(members))
+	for member := range members {
+		sorted = append(sorted, member)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package ipsm
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// ipset restore reports the line it failed on, e.g. "ipset v6.38: Error in line 3: ...".
+var ipsetRestoreErrorLine = regexp.MustCompile(`Error in line (\d+)`)
+
+// ipsetTransaction batches ipset entries so that they are applied with one ipset restore.
+type ipsetTransaction struct {
+	entries  []*ipsEntry
+	destroys []*ipsEntry
+	listMap  map[string]*Ipset
+	setMap   map[string]*Ipset
+}
+
+// BeginTransaction starts batching ipset entries until CommitTransaction or AbortTransaction is called.
+func (ipsMgr *IpsetManager) BeginTransaction() {
+	ipsMgr.transaction = &ipsetTransaction{
+		listMap: copyIpsets(ipsMgr.listMap),
+		setMap:  copyIpsets(ipsMgr.setMap),
+	}
+}
+
+// CommitTransaction applies the batched entries with ipset restore, then calls applyRules to apply
+// the iptables rules referring to them. Sets are destroyed last, once rules no longer refer to them.
+// If either step fails, the applied ipset entries are reverted.
+func (ipsMgr *IpsetManager) CommitTransaction(applyRules func() error) error {
+	tx := ipsMgr.transaction
+	ipsMgr.transaction = nil
+
+	if tx == nil {
+		return nil
+	}
+
+	if applied, err := ipsMgr.restore(tx.entries); err != nil {
+		ipsMgr.rollback(tx, applied)
+		return err
+	}
+
+	if applyRules != nil {
+		if err := applyRules(); err != nil {
+			ipsMgr.rollback(tx, tx.entries)
+			return err
+		}
+	}
+
+	for _, entry := range tx.destroys {
+		errCode, err := ipsMgr.Run(entry)
+		if err != nil && errCode > 1 {
+			log.Errorf("Error: failed to destroy ipset %s.", entry.set)
+		}
+	}
+
+	return nil
+}
+
+// AbortTransaction discards the batched entries.
+func (ipsMgr *IpsetManager) AbortTransaction() {
+	if tx := ipsMgr.transaction; tx != nil {
+		ipsMgr.listMap, ipsMgr.setMap = tx.listMap, tx.setMap
+	}
+
+	ipsMgr.transaction = nil
+}
+
+// add batches an entry. Sets are destroyed after the batch, unless they are created again.
+func (tx *ipsetTransaction) add(entry *ipsEntry) {
+	switch entry.operationFlag {
+	case util.IpsetDestroyFlag:
+		tx.destroys = append(tx.destroys, entry)
+		return
+	case util.IpsetCreationFlag:
+		for i, destroy := range tx.destroys {
+			if destroy.set == entry.set {
+				tx.destroys = append(tx.destroys[:i], tx.destroys[i+1:]...)
+				break
+			}
+		}
+	}
+
+	tx.entries = append(tx.entries, entry)
+}
+
+// isBatched reports whether the operation of an entry can be batched.
+func isBatched(entry *ipsEntry) bool {
+	switch entry.operationFlag {
+	case util.IpsetCreationFlag, util.IpsetAppendFlag, util.IpsetDeletionFlag, util.IpsetDestroyFlag:
+		return len(entry.set) > 0
+	}
+
+	return false
+}
+
+// rollback reverts the applied entries and the in-memory state of a transaction.
+func (ipsMgr *IpsetManager) rollback(tx *ipsetTransaction, applied []*ipsEntry) {
+	ipsMgr.listMap, ipsMgr.setMap = tx.listMap, tx.setMap
+
+	var inverse []*ipsEntry
+	for i := len(applied) - 1; i >= 0; i-- {
+		entry := *applied[i]
+		switch entry.operationFlag {
+		case util.IpsetAppendFlag:
+			entry.operationFlag = util.IpsetDeletionFlag
+		case util.IpsetDeletionFlag:
+			entry.operationFlag = util.IpsetAppendFlag
+		default:
+			// Empty sets left behind are removed by Clean.
+			continue
+		}
+		inverse = append(inverse, &entry)
+	}
+
+	log.Printf("Rolling back %d ipset entries.", len(inverse))
+	if _, err := ipsMgr.restore(inverse); err != nil {
+		log.Errorf("Error: failed to roll back ipset entries. %v", err)
+	}
+}
+
+// restore applies the given entries with ipset restore. On failure, it returns the entries that were applied.
+func (ipsMgr *IpsetManager) restore(entries []*ipsEntry) ([]*ipsEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintln(&buf, getRestoreLine(entry))
+	}
+
+	cmdArgs := []string{util.IpsetRestoreFlag, util.IpsetExistFlag}
+	log.Printf("Executing ipset command %s %v with %d entries", util.Ipset, cmdArgs, len(entries))
+
+	cmd := exec.Command(util.Ipset, cmdArgs...)
+	cmd.Stdin = &buf
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	metrics.ExecTime.ObserveSince(start, util.Ipset)
+	if err == nil {
+		return nil, nil
+	}
+
+	metrics.IpsetErrors.Inc()
+	log.Errorf("Error: failed to run ipset restore. %v: %s", err, out)
+
+	// ipset restore stops on the first failing line. Entries before it were applied.
+	applied := entries
+	if match := ipsetRestoreErrorLine.FindSubmatch(out); match != nil {
+		if line, convErr := strconv.Atoi(string(match[1])); convErr == nil && line >= 1 && line <= len(entries) {
+			applied = entries[:line-1]
+		}
+	}
+
+	return applied, fmt.Errorf("ipset restore failed: %v: %s", err, out)
+}
+
+// getRestoreLine returns the ipset restore line of an entry.
+func getRestoreLine(entry *ipsEntry) string {
+	var command string
+	switch entry.operationFlag {
+	case util.IpsetCreationFlag:
+		command = util.IpsetCreateCmd
+	case util.IpsetAppendFlag:
+		command = util.IpsetAddCmd
+	case util.IpsetDeletionFlag:
+		command = util.IpsetDelCmd
+	}
+
+	fields := []string{command, entry.set}
+	if len(entry.spec) > 0 {
+		fields = append(fields, entry.spec)
+	}
+	if len(entry.family) > 0 {
+		fields = append(fields, util.IpsetFamilyFlag, entry.family)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// copyIpsets returns a deep copy of the given ipsets.
+func copyIpsets(ipsets map[string]*Ipset) map[string]*Ipset {
+	copied := make(map[string]*Ipset, len(ipsets))
+	for name, ipset := range ipsets {
+		c := *ipset
+		c.elements = append([]string(nil), ipset.elements...)
+		copied[name] = &c
+	}
+
+	return copied
+}
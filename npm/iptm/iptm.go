@@ -9,12 +9,14 @@ package iptm
 import (
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 	"time"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/util"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
@@ -37,6 +39,7 @@ type IptEntry struct {
 // IptablesManager stores iptables entries.
 type IptablesManager struct {
 	OperationFlag string
+	transaction   *iptablesTransaction
 }
 
 // NewIptablesManager creates a new instance for IptablesManager object.
@@ -48,17 +51,39 @@ func NewIptablesManager() *IptablesManager {
 	return iptMgr
 }
 
-// InitNpmChains initializes Azure NPM chains in iptables.
+// getCommands returns the iptables commands of the IP families npm maintains chains for.
+func getCommands() []string {
+	commands := []string{util.Iptables}
+	if util.IsIPv6Enabled {
+		commands = append(commands, util.Ip6tables)
+	}
+
+	return commands
+}
+
+// InitNpmChains initializes Azure NPM chains in iptables and ip6tables.
 func (iptMgr *IptablesManager) InitNpmChains() error {
-	log.Printf("Initializing AZURE-NPM chains.")
+	for _, command := range getCommands() {
+		if err := iptMgr.initNpmChains(command); err != nil {
+			return err
+		}
+	}
 
-	if err := iptMgr.AddChain(util.IptablesAzureChain); err != nil {
+	return nil
+}
+
+// initNpmChains initializes Azure NPM chains using the given iptables command.
+func (iptMgr *IptablesManager) initNpmChains(command string) error {
+	log.Printf("Initializing AZURE-NPM chains in %s.", command)
+
+	if err := iptMgr.addChain(command, util.IptablesAzureChain); err != nil {
 		return err
 	}
 
 	// Insert AZURE-NPM chain to FORWARD chain.
 	entry := &IptEntry{
-		Chain: util.IptablesForwardChain,
+		Command: command,
+		Chain:   util.IptablesForwardChain,
 		Specs: []string{
 			util.IptablesJumpFlag,
 			util.IptablesAzureChain,
@@ -101,7 +126,7 @@ func (iptMgr *IptablesManager) InitNpmChains() error {
 	}
 
 	// Create AZURE-NPM-INGRESS-PORT chain.
-	if err := iptMgr.AddChain(util.IptablesAzureIngressPortChain); err != nil {
+	if err := iptMgr.addChain(command, util.IptablesAzureIngressPortChain); err != nil {
 		return err
 	}
 
@@ -122,17 +147,17 @@ func (iptMgr *IptablesManager) InitNpmChains() error {
 	}
 
 	// Create AZURE-NPM-INGRESS-FROM-NS chain.
-	if err = iptMgr.AddChain(util.IptablesAzureIngressFromNsChain); err != nil {
+	if err = iptMgr.addChain(command, util.IptablesAzureIngressFromNsChain); err != nil {
 		return err
 	}
 
 	// Create AZURE-NPM-INGRESS-FROM-POD chain.
-	if err = iptMgr.AddChain(util.IptablesAzureIngressFromPodChain); err != nil {
+	if err = iptMgr.addChain(command, util.IptablesAzureIngressFromPodChain); err != nil {
 		return err
 	}
 
 	// Create AZURE-NPM-EGRESS-PORT chain.
-	if err := iptMgr.AddChain(util.IptablesAzureEgressPortChain); err != nil {
+	if err := iptMgr.addChain(command, util.IptablesAzureEgressPortChain); err != nil {
 		return err
 	}
 
@@ -153,17 +178,17 @@ func (iptMgr *IptablesManager) InitNpmChains() error {
 	}
 
 	// Create AZURE-NPM-EGRESS-TO-NS chain.
-	if err = iptMgr.AddChain(util.IptablesAzureEgressToNsChain); err != nil {
+	if err = iptMgr.addChain(command, util.IptablesAzureEgressToNsChain); err != nil {
 		return err
 	}
 
 	// Create AZURE-NPM-EGRESS-TO-POD chain.
-	if err = iptMgr.AddChain(util.IptablesAzureEgressToPodChain); err != nil {
+	if err = iptMgr.addChain(command, util.IptablesAzureEgressToPodChain); err != nil {
 		return err
 	}
 
 	// Create AZURE-NPM-TARGET-SETS chain.
-	if err := iptMgr.AddChain(util.IptablesAzureTargetSetsChain); err != nil {
+	if err := iptMgr.addChain(command, util.IptablesAzureTargetSetsChain); err != nil {
 		return err
 	}
 
@@ -186,8 +211,21 @@ func (iptMgr *IptablesManager) InitNpmChains() error {
 	return nil
 }
 
-// UninitNpmChains uninitializes Azure NPM chains in iptables.
+// UninitNpmChains uninitializes Azure NPM chains in iptables and ip6tables.
 func (iptMgr *IptablesManager) UninitNpmChains() error {
+	for _, command := range getCommands() {
+		if err := iptMgr.uninitNpmChains(command); err != nil {
+			return err
+		}
+	}
+
+	metrics.NumIptablesRules.Set(0)
+
+	return nil
+}
+
+// uninitNpmChains uninitializes Azure NPM chains using the given iptables command.
+func (iptMgr *IptablesManager) uninitNpmChains(command string) error {
 	IptablesAzureChainList := []string{
 		util.IptablesAzureChain,
 		util.IptablesAzureIngressPortChain,
@@ -201,7 +239,8 @@ func (iptMgr *IptablesManager) UninitNpmChains() error {
 
 	// Remove AZURE-NPM chain from FORWARD chain.
 	entry := &IptEntry{
-		Chain: util.IptablesForwardChain,
+		Command: command,
+		Chain:   util.IptablesForwardChain,
 		Specs: []string{
 			util.IptablesJumpFlag,
 			util.IptablesAzureChain,
@@ -217,7 +256,8 @@ func (iptMgr *IptablesManager) UninitNpmChains() error {
 	iptMgr.OperationFlag = util.IptablesFlushFlag
 	for _, chain := range IptablesAzureChainList {
 		entry := &IptEntry{
-			Chain: chain,
+			Command: command,
+			Chain:   chain,
 		}
 		if _, err := iptMgr.Run(entry); err != nil {
 			log.Errorf("Error: failed to flush iptables chain %s.", chain)
@@ -225,7 +265,7 @@ func (iptMgr *IptablesManager) UninitNpmChains() error {
 	}
 
 	for _, chain := range IptablesAzureChainList {
-		if err := iptMgr.DeleteChain(chain); err != nil {
+		if err := iptMgr.deleteChain(command, chain); err != nil {
 			return err
 		}
 	}
@@ -250,10 +290,22 @@ func (iptMgr *IptablesManager) Exists(entry *IptEntry) (bool, error) {
 	return false, err
 }
 
-// AddChain adds a chain to iptables.
+// AddChain adds a chain to iptables and ip6tables.
 func (iptMgr *IptablesManager) AddChain(chain string) error {
+	for _, command := range getCommands() {
+		if err := iptMgr.addChain(command, chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addChain adds a chain using the given iptables command.
+func (iptMgr *IptablesManager) addChain(command string, chain string) error {
 	entry := &IptEntry{
-		Chain: chain,
+		Command: command,
+		Chain:   chain,
 	}
 	iptMgr.OperationFlag = util.IptablesChainCreationFlag
 	errCode, err := iptMgr.Run(entry)
@@ -270,10 +322,22 @@ func (iptMgr *IptablesManager) AddChain(chain string) error {
 	return nil
 }
 
-// DeleteChain deletes a chain from iptables.
+// DeleteChain deletes a chain from iptables and ip6tables.
 func (iptMgr *IptablesManager) DeleteChain(chain string) error {
+	for _, command := range getCommands() {
+		if err := iptMgr.deleteChain(command, chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteChain deletes a chain using the given iptables command.
+func (iptMgr *IptablesManager) deleteChain(command string, chain string) error {
 	entry := &IptEntry{
-		Chain: chain,
+		Command: command,
+		Chain:   chain,
 	}
 	iptMgr.OperationFlag = util.IptablesDestroyFlag
 	errCode, err := iptMgr.Run(entry)
@@ -293,6 +357,15 @@ func (iptMgr *IptablesManager) DeleteChain(chain string) error {
 func (iptMgr *IptablesManager) Add(entry *IptEntry) error {
 	log.Printf("Add iptables entry: %+v.", entry)
 
+	if tx := iptMgr.transaction; tx != nil {
+		exists, err := tx.exists(entry)
+		if err == nil && !exists {
+			tx.add(util.IptablesInsertionFlag, entry)
+		}
+
+		return err
+	}
+
 	exists, err := iptMgr.Exists(entry)
 	if err != nil {
 		return err
@@ -315,6 +388,15 @@ func (iptMgr *IptablesManager) Add(entry *IptEntry) error {
 func (iptMgr *IptablesManager) Delete(entry *IptEntry) error {
 	log.Printf("Deleting iptables entry: %+v", entry)
 
+	if tx := iptMgr.transaction; tx != nil {
+		exists, err := tx.exists(entry)
+		if err == nil && exists {
+			tx.add(util.IptablesDeletionFlag, entry)
+		}
+
+		return err
+	}
+
 	exists, err := iptMgr.Exists(entry)
 	if err != nil {
 		return err
@@ -346,20 +428,39 @@ func (iptMgr *IptablesManager) Run(entry *IptEntry) (int, error) {
 
 	cmdArgs := append([]string{util.IptablesWaitFlag, entry.LockWaitTimeInSeconds, iptMgr.OperationFlag, entry.Chain}, entry.Specs...)
 	log.Printf("Executing iptables command %s %v", cmdName, cmdArgs)
+	start := time.Now()
 	_, err := exec.Command(cmdName, cmdArgs...).Output()
+	metrics.ExecTime.ObserveSince(start, cmdName)
 
 	if msg, failed := err.(*exec.ExitError); failed {
 		errCode := msg.Sys().(syscall.WaitStatus).ExitStatus()
 		if errCode > 1 {
+			metrics.IptablesErrors.Inc()
 			log.Errorf("Error: There was an error running command: %s %s Arguments:%v", err, cmdName, cmdArgs)
 		}
 
 		return errCode, err
 	}
 
+	updateRuleCount(iptMgr.OperationFlag, entry.Chain)
+
 	return 0, nil
 }
 
+// updateRuleCount updates the number of rules in azure-npm chains after a rule was applied.
+func updateRuleCount(operationFlag string, chain string) {
+	if !strings.HasPrefix(chain, util.IptablesAzureChain) {
+		return
+	}
+
+	switch operationFlag {
+	case util.IptablesAppendFlag, util.IptablesInsertionFlag:
+		metrics.NumIptablesRules.Add(1)
+	case util.IptablesDeletionFlag:
+		metrics.NumIptablesRules.Add(-1)
+	}
+}
+
 // Save saves current iptables configuration to /var/log/iptables.conf
 func (iptMgr *IptablesManager) Save(configFile string) error {
 	if len(configFile) == 0 {
@@ -429,6 +530,11 @@ func (iptMgr *IptablesManager) Restore(configFile string) error {
 	}
 	cmd.Wait()
 
+	// The restored rules are unknown, count them once.
+	if count, err := iptMgr.CountNpmRules(); err == nil {
+		metrics.NumIptablesRules.Set(float64(count))
+	}
+
 	return nil
 }
 
@@ -1,8 +1,11 @@
 package iptm
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/util"
 )
 
@@ -200,6 +203,147 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestNormalizeRule(t *testing.T) {
+	specs := []string{
+		util.IptablesProtFlag,
+		"TCP",
+		util.IptablesDstPortFlag,
+		"80",
+		util.IptablesMatchFlag,
+		util.IptablesSetFlag,
+		util.IptablesMatchSetFlag,
+		"azure-npm-123",
+		util.IptablesDstFlag,
+		util.IptablesSFlag,
+		"10.0.0.4",
+		util.IptablesJumpFlag,
+		util.IptablesAccept,
+	}
+
+	// The same rule as printed by iptables-save.
+	saved := strings.Fields("-s 10.0.0.4/32 -p tcp -m set --match-set azure-npm-123 dst -m tcp --dport 80 -j ACCEPT")
+
+	if normalizeRule("TEST-CHAIN", specs) != normalizeRule("TEST-CHAIN", saved) {
+		t.Errorf("TestNormalizeRule failed @ normalizeRule, %s != %s",
+			normalizeRule("TEST-CHAIN", specs), normalizeRule("TEST-CHAIN", saved))
+	}
+
+	if normalizeRule("TEST-CHAIN", specs) == normalizeRule("OTHER-CHAIN", saved) {
+		t.Errorf("TestNormalizeRule failed @ normalizeRule, rules in different chains are equal")
+	}
+}
+
+func TestGetInverseLines(t *testing.T) {
+	lines := []string{
+		"-I TEST-CHAIN -j ACCEPT",
+		"-D TEST-CHAIN -j DROP",
+		"-D TEST-CHAIN -j RETURN",
+	}
+
+	inverse := getInverseLines(lines, []int{0, 3, 0})
+	expected := []string{
+		"-I TEST-CHAIN -j RETURN",
+		"-I TEST-CHAIN 3 -j DROP",
+		"-D TEST-CHAIN -j ACCEPT",
+	}
+
+	if !reflect.DeepEqual(inverse, expected) {
+		t.Errorf("TestGetInverseLines failed @ getInverseLines, got %v, expected %v", inverse, expected)
+	}
+}
+
+func TestTransactionRuleNumbers(t *testing.T) {
+	newEntry := func(source string) *IptEntry {
+		return &IptEntry{Chain: "TEST-CHAIN", Specs: []string{util.IptablesSFlag, source, util.IptablesJumpFlag, "ACCEPT"}}
+	}
+	entries := []*IptEntry{newEntry("10.0.0.1"), newEntry("10.0.0.2"), newEntry("10.0.0.3"), newEntry("10.0.0.4")}
+
+	tx := &iptablesTransaction{
+		rules:     map[string]map[string]bool{util.Iptables: make(map[string]bool)},
+		chains:    map[string]map[string][]string{util.Iptables: make(map[string][]string)},
+		lines:     make(map[string][]string),
+		positions: make(map[string][]int),
+	}
+	for _, entry := range entries[:3] {
+		rule := normalizeRule(entry.Chain, entry.Specs)
+		tx.rules[util.Iptables][rule] = true
+		tx.chains[util.Iptables][entry.Chain] = append(tx.chains[util.Iptables][entry.Chain], rule)
+	}
+
+	tx.add(util.IptablesInsertionFlag, entries[3])
+	tx.add(util.IptablesDeletionFlag, entries[1])
+	tx.add(util.IptablesDeletionFlag, entries[0])
+
+	expected := []string{
+		"-I TEST-CHAIN 2 -s 10.0.0.1 -j ACCEPT",
+		"-I TEST-CHAIN 3 -s 10.0.0.2 -j ACCEPT",
+		"-D TEST-CHAIN -s 10.0.0.4 -j ACCEPT",
+	}
+
+	inverse := getInverseLines(tx.lines[util.Iptables], tx.positions[util.Iptables])
+	if !reflect.DeepEqual(inverse, expected) {
+		t.Errorf("TestTransactionRuleNumbers failed @ getInverseLines, got %v, expected %v", inverse, expected)
+	}
+}
+
+func TestDiffRules(t *testing.T) {
+	live := parseRules(util.Iptables, strings.Join([]string{
+		"*filter",
+		"-A FORWARD -j AZURE-NPM",
+		"-A AZURE-NPM-INGRESS-PORT -p tcp -m tcp --dport 8000 -m set --match-set azure-npm-1 dst -j AZURE-NPM-INGRESS-FROM-NS",
+		"-A AZURE-NPM-INGRESS-PORT -p tcp -m tcp --dport 9000 -m set --match-set azure-npm-1 dst -j AZURE-NPM-INGRESS-FROM-NS",
+		"COMMIT",
+	}, "\n"))
+
+	newEntry := func(port string) *IptEntry {
+		return &IptEntry{
+			Chain: util.IptablesAzureIngressPortChain,
+			Specs: []string{
+				util.IptablesProtFlag, "TCP",
+				util.IptablesDstPortFlag, port,
+				util.IptablesMatchFlag, util.IptablesSetFlag, util.IptablesMatchSetFlag, "azure-npm-1", util.IptablesDstFlag,
+				util.IptablesJumpFlag, util.IptablesAzureIngressFromNsChain,
+			},
+		}
+	}
+
+	missing, stale := diffRules([]*IptEntry{newEntry("8000"), newEntry("7000")}, live)
+
+	if len(missing) != 1 || missing[0].Specs[3] != "7000" {
+		t.Errorf("TestDiffRules failed @ diffRules, expected the rule of port 7000 to be missing, got %+v", missing)
+	}
+
+	// Rules outside of policy chains, like the jump from FORWARD, are never stale.
+	if len(stale) != 1 || !reflect.DeepEqual(stale[0].Specs[:5], []string{"-p", "tcp", "-m", "tcp", "--dport"}) || stale[0].Specs[5] != "9000" {
+		t.Errorf("TestDiffRules failed @ diffRules, expected the rule of port 9000 to be stale, got %+v", stale)
+	}
+}
+
+func TestUpdateRuleCount(t *testing.T) {
+	live := parseRules(util.Iptables, strings.Join([]string{
+		"*filter",
+		"-A FORWARD -j AZURE-NPM",
+		"-A AZURE-NPM -j AZURE-NPM-INGRESS-PORT",
+		"-A AZURE-NPM-INGRESS-PORT -p tcp -m tcp --dport 8000 -j ACCEPT",
+		"COMMIT",
+	}, "\n"))
+
+	if count := countNpmRules(live); count != 2 {
+		t.Errorf("TestUpdateRuleCount failed @ countNpmRules, expected 2, got %d", count)
+	}
+
+	metrics.NumIptablesRules.Set(2)
+	updateRuleCount(util.IptablesInsertionFlag, util.IptablesAzureIngressPortChain)
+	updateRuleCount(util.IptablesAppendFlag, util.IptablesAzureChain)
+	updateRuleCount(util.IptablesDeletionFlag, util.IptablesAzureIngressPortChain)
+	updateRuleCount(util.IptablesInsertionFlag, util.IptablesForwardChain)
+	updateRuleCount(util.IptablesCheckFlag, util.IptablesAzureChain)
+
+	if count := metrics.NumIptablesRules.Get(); count != 3 {
+		t.Errorf("TestUpdateRuleCount failed @ updateRuleCount, expected 3, got %v", count)
+	}
+}
+
 func TestMain(m *testing.M) {
 	iptMgr := NewIptablesManager()
 	iptMgr.Save(util.IptablesConfigFile)
@@ -0,0 +1,218 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package iptm
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// Drift counts the differences found between the desired rules and the rules of the azure-npm chains.
+type Drift struct {
+	MissingRules int
+	StaleRules   int
+}
+
+// policyChains are the chains holding the rules translated from network policies.
+var policyChains = map[string]bool{
+	util.IptablesAzureIngressPortChain:    true,
+	util.IptablesAzureIngressFromNsChain:  true,
+	util.IptablesAzureIngressFromPodChain: true,
+	util.IptablesAzureEgressPortChain:     true,
+	util.IptablesAzureEgressToNsChain:     true,
+	util.IptablesAzureEgressToPodChain:    true,
+	util.IptablesAzureTargetSetsChain:     true,
+}
+
+// Reconcile compares the given entries with the rules of the azure-npm chains in the filter table
+// and repairs the differences. Azure-npm chains are expected to exist only while there are entries.
+// Within a transaction, the repaired entries are batched.
+func (iptMgr *IptablesManager) Reconcile(entries []*IptEntry) (*Drift, error) {
+	drift := &Drift{}
+	if len(entries) == 0 {
+		return drift, nil
+	}
+
+	var missing, stale []*IptEntry
+	initChains := false
+	count := 0
+	for _, command := range getCommands() {
+		live, err := listRules(command)
+		if err != nil {
+			return nil, err
+		}
+
+		count += countNpmRules(live)
+
+		for _, entry := range getNpmChainEntries(command) {
+			if _, exists := live[normalizeRule(entry.Chain, entry.Specs)]; !exists {
+				drift.MissingRules++
+				initChains = true
+			}
+		}
+
+		var desired []*IptEntry
+		for _, entry := range entries {
+			if getCommand(entry) == command {
+				desired = append(desired, entry)
+			}
+		}
+
+		m, s := diffRules(desired, live)
+		missing, stale = append(missing, m...), append(stale, s...)
+	}
+
+	drift.MissingRules += len(missing)
+	drift.StaleRules += len(stale)
+
+	// Correct the rule count maintained as rules are applied, repairs are counted when applied.
+	metrics.NumIptablesRules.Set(float64(count))
+
+	if initChains {
+		if err := iptMgr.InitNpmChains(); err != nil {
+			log.Errorf("Error: failed to repair azure-npm chains.")
+			return drift, err
+		}
+	}
+
+	for _, entry := range stale {
+		log.Printf("Removing stale iptables rule: %+v", entry)
+		if err := iptMgr.Delete(entry); err != nil {
+			return drift, err
+		}
+	}
+
+	for _, entry := range missing {
+		log.Printf("Restoring missing iptables rule: %+v", entry)
+		if err := iptMgr.Add(entry); err != nil {
+			return drift, err
+		}
+	}
+
+	return drift, nil
+}
+
+// CountNpmRules returns the number of rules in the azure-npm chains of iptables and ip6tables.
+func (iptMgr *IptablesManager) CountNpmRules() (int, error) {
+	count := 0
+	for _, command := range getCommands() {
+		rules, err := listRules(command)
+		if err != nil {
+			return 0, err
+		}
+
+		count += countNpmRules(rules)
+	}
+
+	return count, nil
+}
+
+// countNpmRules returns the number of the given rules that are in azure-npm chains.
+func countNpmRules(rules map[string]*IptEntry) int {
+	count := 0
+	for _, entry := range rules {
+		if strings.HasPrefix(entry.Chain, util.IptablesAzureChain) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// diffRules returns the desired entries missing from the live rules, and the live rules of policy chains
+// that are not desired.
+func diffRules(desired []*IptEntry, live map[string]*IptEntry) ([]*IptEntry, []*IptEntry) {
+	var missing, stale []*IptEntry
+
+	desiredRules := make(map[string]bool)
+	for _, entry := range desired {
+		rule := normalizeRule(entry.Chain, entry.Specs)
+		if desiredRules[rule] {
+			continue
+		}
+		desiredRules[rule] = true
+
+		if _, exists := live[rule]; !exists {
+			missing = append(missing, entry)
+		}
+	}
+
+	for rule, entry := range live {
+		if policyChains[entry.Chain] && !desiredRules[rule] {
+			stale = append(stale, entry)
+		}
+	}
+
+	return missing, stale
+}
+
+// getNpmChainEntries returns the rules initNpmChains adds to link the azure-npm chains.
+func getNpmChainEntries(command string) []*IptEntry {
+	entries := []*IptEntry{
+		{
+			Chain: util.IptablesForwardChain,
+			Specs: []string{util.IptablesJumpFlag, util.IptablesAzureChain},
+		},
+		{
+			Chain: util.IptablesAzureChain,
+			Specs: []string{
+				util.IptablesMatchFlag,
+				util.IptablesStateFlag,
+				util.IptablesMatchStateFlag,
+				util.IptablesRelatedState + "," + util.IptablesEstablishedState,
+				util.IptablesJumpFlag,
+				util.IptablesAccept,
+			},
+		},
+		{
+			Chain: util.IptablesAzureChain,
+			Specs: []string{util.IptablesJumpFlag, util.IptablesAzureIngressPortChain},
+		},
+		{
+			Chain: util.IptablesAzureChain,
+			Specs: []string{util.IptablesJumpFlag, util.IptablesAzureEgressPortChain},
+		},
+		{
+			Chain: util.IptablesAzureChain,
+			Specs: []string{util.IptablesJumpFlag, util.IptablesAzureTargetSetsChain},
+		},
+	}
+
+	for _, entry := range entries {
+		entry.Command = command
+	}
+
+	return entries
+}
+
+// listRules reads the filter table with iptables-save and returns its rules, keyed by normalized rule.
+func listRules(command string) (map[string]*IptEntry, error) {
+	out, err := saveRules(command)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRules(command, out), nil
+}
+
+// parseRules returns the rules in the output of iptables-save, keyed by normalized rule.
+func parseRules(command string, out string) map[string]*IptEntry {
+	rules := make(map[string]*IptEntry)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != util.IptablesAppendFlag {
+			continue
+		}
+
+		rules[normalizeRule(fields[1], fields[2:])] = &IptEntry{
+			Command: command,
+			Chain:   fields[1],
+			Specs:   fields[2:],
+		}
+	}
+
+	return rules
+}
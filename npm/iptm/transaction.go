@@ -0,0 +1,289 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package iptm
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
+	"github.com/Azure/azure-container-networking/npm/util"
+)
+
+// iptablesTransaction batches iptables entries so that they are applied with one iptables-restore per IP family.
+type iptablesTransaction struct {
+	// Normalized rules of the filter table, per iptables command. Loaded on first use.
+	rules map[string]map[string]bool
+	// Normalized rules of each chain in order once the batched lines are applied, per iptables command.
+	chains map[string]map[string][]string
+	// Batched iptables-restore lines, per iptables command.
+	lines map[string][]string
+	// Rule numbers of the rules deleted by the batched lines, or 0 for other lines, per iptables command.
+	positions map[string][]int
+}
+
+// BeginTransaction starts batching entries added or deleted through Add and Delete.
+// Chain operations are still applied immediately.
+func (iptMgr *IptablesManager) BeginTransaction() {
+	iptMgr.transaction = &iptablesTransaction{
+		rules:     make(map[string]map[string]bool),
+		chains:    make(map[string]map[string][]string),
+		lines:     make(map[string][]string),
+		positions: make(map[string][]int),
+	}
+}
+
+// CommitTransaction applies the batched entries atomically per IP family with iptables-restore --noflush.
+// If an IP family fails, the entries already applied for the other family are reverted.
+func (iptMgr *IptablesManager) CommitTransaction() error {
+	tx := iptMgr.transaction
+	iptMgr.transaction = nil
+
+	if tx == nil {
+		return nil
+	}
+
+	var committed []string
+	for _, command := range getCommands() {
+		lines := tx.lines[command]
+		if len(lines) == 0 {
+			continue
+		}
+
+		if err := restoreLines(command, lines); err != nil {
+			for _, command := range committed {
+				log.Printf("Rolling back iptables entries applied by %s.", command)
+				if err := restoreLines(command, getInverseLines(tx.lines[command], tx.positions[command])); err != nil {
+					log.Errorf("Error: failed to roll back iptables entries. %v", err)
+				}
+			}
+
+			return err
+		}
+
+		committed = append(committed, command)
+	}
+
+	for _, command := range committed {
+		for _, line := range tx.lines[command] {
+			fields := strings.SplitN(line, " ", 3)
+			updateRuleCount(fields[0], fields[1])
+		}
+	}
+
+	return nil
+}
+
+// AbortTransaction discards the batched entries.
+func (iptMgr *IptablesManager) AbortTransaction() {
+	iptMgr.transaction = nil
+}
+
+// exists checks if a rule exists in iptables, taking batched entries into account.
+func (tx *iptablesTransaction) exists(entry *IptEntry) (bool, error) {
+	command := getCommand(entry)
+
+	rules, ok := tx.rules[command]
+	if !ok {
+		var chains map[string][]string
+		var err error
+		if rules, chains, err = loadRules(command); err != nil {
+			return false, err
+		}
+		tx.rules[command] = rules
+		tx.chains[command] = chains
+	}
+
+	return rules[normalizeRule(entry.Chain, entry.Specs)], nil
+}
+
+// add batches an entry with the given operation flag.
+func (tx *iptablesTransaction) add(operationFlag string, entry *IptEntry) {
+	command := getCommand(entry)
+
+	rule := normalizeRule(entry.Chain, entry.Specs)
+
+	// Track the rules of the chain to record the rule number of deleted rules, as iptables will
+	// number them once the preceding lines are applied. Other rules are inserted first.
+	chain := tx.chains[command][entry.Chain]
+	position := 0
+	if operationFlag == util.IptablesDeletionFlag {
+		for i := range chain {
+			if chain[i] == rule {
+				position = i + 1
+				chain = append(chain[:i:i], chain[i+1:]...)
+				break
+			}
+		}
+	} else {
+		chain = append([]string{rule}, chain...)
+	}
+	tx.chains[command][entry.Chain] = chain
+
+	line := strings.Join(append([]string{operationFlag, entry.Chain}, entry.Specs...), " ")
+	tx.lines[command] = append(tx.lines[command], line)
+	tx.positions[command] = append(tx.positions[command], position)
+
+	tx.rules[command][rule] = operationFlag != util.IptablesDeletionFlag
+}
+
+// getCommand returns the iptables command of an entry.
+func getCommand(entry *IptEntry) string {
+	if entry.Command == "" {
+		return util.Iptables
+	}
+
+	return entry.Command
+}
+
+// loadRules reads the filter table with iptables-save and returns its normalized rules,
+// and the normalized rules of each chain in order.
+func loadRules(command string) (map[string]bool, map[string][]string, error) {
+	out, err := saveRules(command)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rules := make(map[string]bool)
+	chains := make(map[string][]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != util.IptablesAppendFlag {
+			continue
+		}
+
+		rule := normalizeRule(fields[1], fields[2:])
+		rules[rule] = true
+		chains[fields[1]] = append(chains[fields[1]], rule)
+	}
+
+	return rules, chains, nil
+}
+
+// saveRules returns the filter table as reported by iptables-save.
+func saveRules(command string) (string, error) {
+	saveCommand := util.IptablesSave
+	if command == util.Ip6tables {
+		saveCommand = util.Ip6tablesSave
+	}
+
+	start := time.Now()
+	out, err := exec.Command(saveCommand, util.IptablesTableFlag, util.IptablesFilterTable).Output()
+	metrics.ExecTime.ObserveSince(start, saveCommand)
+	if err != nil {
+		metrics.IptablesErrors.Inc()
+		log.Errorf("Error: failed to run %s. %v", saveCommand, err)
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// restoreLines applies the given lines to the filter table with iptables-restore --noflush.
+func restoreLines(command string, lines []string) error {
+	restoreCommand := util.IptablesRestore
+	if command == util.Ip6tables {
+		restoreCommand = util.Ip6tablesRestore
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%s\n", util.IptablesFilterTable)
+	for _, line := range lines {
+		fmt.Fprintln(&buf, line)
+	}
+	fmt.Fprintln(&buf, util.IptablesCommit)
+
+	cmdArgs := []string{util.IptablesWaitFlag, defaultlockWaitTimeInSeconds, util.IptablesNoFlushFlag}
+	log.Printf("Executing %s %v with %d entries", restoreCommand, cmdArgs, len(lines))
+
+	cmd := exec.Command(restoreCommand, cmdArgs...)
+	cmd.Stdin = &buf
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	metrics.ExecTime.ObserveSince(start, restoreCommand)
+	if err != nil {
+		metrics.IptablesErrors.Inc()
+		log.Errorf("Error: failed to run %s. %v: %s", restoreCommand, err, out)
+		return fmt.Errorf("%s failed: %v: %s", restoreCommand, err, out)
+	}
+
+	return nil
+}
+
+// getInverseLines returns the lines reverting the given ones, in reverse order.
+// Deleted rules are inserted back at the given rule numbers.
+func getInverseLines(lines []string, positions []int) []string {
+	var inverse []string
+	for i := len(lines) - 1; i >= 0; i-- {
+		fields := strings.SplitN(lines[i], " ", 2)
+		if fields[0] == util.IptablesDeletionFlag {
+			fields[0] = util.IptablesInsertionFlag
+			if positions[i] > 0 && len(fields) == 2 {
+				// The rule number follows the chain.
+				chainSpecs := strings.SplitN(fields[1], " ", 2)
+				chainSpecs[0] += " " + strconv.Itoa(positions[i])
+				fields[1] = strings.Join(chainSpecs, " ")
+			}
+		} else {
+			fields[0] = util.IptablesDeletionFlag
+		}
+		inverse = append(inverse, strings.Join(fields, " "))
+	}
+
+	return inverse
+}
+
+// normalizeRule returns a representation of a rule that does not depend on how iptables-save
+// orders and spells its options, so that rules can be compared with the output of iptables-save.
+func normalizeRule(chain string, specs []string) string {
+	var options []string
+	for i := 0; i < len(specs); {
+		option := []string{strings.ToLower(specs[i])}
+		for i++; i < len(specs) && !strings.HasPrefix(specs[i], "-"); i++ {
+			option = append(option, strings.ToLower(specs[i]))
+		}
+
+		switch option[0] {
+		case util.IptablesMatchFlag:
+			// iptables-save adds the implicit match of the protocol.
+			if len(option) == 2 && (option[1] == "tcp" || option[1] == "udp" || option[1] == "sctp") {
+				continue
+			}
+		case util.IptablesSFlag, util.IptablesDFlag:
+			if len(option) == 2 {
+				option[1] = normalizeCIDR(option[1])
+			}
+		}
+
+		options = append(options, strings.Join(option, " "))
+	}
+
+	sort.Strings(options)
+
+	return chain + " " + strings.Join(options, " ")
+}
+
+// normalizeCIDR returns the address in the CIDR notation used by iptables-save.
+func normalizeCIDR(address string) string {
+	if !strings.Contains(address, "/") {
+		if util.IsIPv6(address) {
+			address += "/128"
+		} else {
+			address += "/32"
+		}
+	}
+
+	_, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return address
+	}
+
+	return ipNet.String()
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package metrics
+
+import (
+	"github.com/Azure/azure-container-networking/metrics"
+)
+
+// Azure-NPM metrics.
+var (
+	NumPolicies = metrics.NewGauge(
+		"npm_num_policies",
+		"The number of network policies applied by azure-npm.",
+	)
+	NumIpsets = metrics.NewGauge(
+		"npm_num_ipsets",
+		"The number of ipsets and ipset lists maintained by azure-npm.",
+	)
+	NumIptablesRules = metrics.NewGauge(
+		"npm_num_iptables_rules",
+		"The number of rules in azure-npm iptables chains.",
+	)
+	AddPodExecTime = metrics.NewHistogram(
+		"npm_add_pod_exec_time_seconds",
+		"The time taken to handle a pod creation.",
+	)
+	AddPolicyExecTime = metrics.NewHistogram(
+		"npm_add_policy_exec_time_seconds",
+		"The time taken to handle a network policy creation.",
+	)
+	ExecTime = metrics.NewHistogram(
+		"npm_exec_time_seconds",
+		"The time taken to run ipset and iptables commands.",
+		"command",
+	)
+	IpsetErrors = metrics.NewCounter(
+		"npm_ipset_errors_total",
+		"The number of failed ipset commands.",
+	)
+	IptablesErrors = metrics.NewCounter(
+		"npm_iptables_errors_total",
+		"The number of failed iptables commands.",
+	)
+)
@@ -79,6 +79,13 @@ func (npMgr *NetworkPolicyManager) AddNamespace(nsObj *corev1.Namespace) error {
 	npMgr.Lock()
 	defer npMgr.Unlock()
 
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	return endTransaction(allNs, npMgr.addNamespace(nsObj))
+}
+
+func (npMgr *NetworkPolicyManager) addNamespace(nsObj *corev1.Namespace) error {
 	var err error
 
 	nsName, nsNs, nsLabel := nsObj.ObjectMeta.Name, nsObj.ObjectMeta.Namespace, nsObj.ObjectMeta.Labels
@@ -129,17 +136,21 @@ func (npMgr *NetworkPolicyManager) UpdateNamespace(oldNsObj *corev1.Namespace, n
 		oldNsName, oldNsNs, oldNsLabel, newNsName, newNsNs, newNsLabel,
 	)
 
-	if err = npMgr.DeleteNamespace(oldNsObj); err != nil {
-		return err
+	npMgr.Lock()
+	defer npMgr.Unlock()
+
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	if err = npMgr.deleteNamespace(oldNsObj); err != nil {
+		return endTransaction(allNs, err)
 	}
 
 	if newNsObj.ObjectMeta.DeletionTimestamp == nil && newNsObj.ObjectMeta.DeletionGracePeriodSeconds == nil {
-		if err = npMgr.AddNamespace(newNsObj); err != nil {
-			return err
-		}
+		err = npMgr.addNamespace(newNsObj)
 	}
 
-	return nil
+	return endTransaction(allNs, err)
 }
 
 // DeleteNamespace handles deleting namespace from ipset.
@@ -147,6 +158,13 @@ func (npMgr *NetworkPolicyManager) DeleteNamespace(nsObj *corev1.Namespace) erro
 	npMgr.Lock()
 	defer npMgr.Unlock()
 
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	return endTransaction(allNs, npMgr.deleteNamespace(nsObj))
+}
+
+func (npMgr *NetworkPolicyManager) deleteNamespace(nsObj *corev1.Namespace) error {
 	var err error
 
 	nsName, nsNs, nsLabel := nsObj.ObjectMeta.Name, nsObj.ObjectMeta.Namespace, nsObj.ObjectMeta.Labels
@@ -11,6 +11,7 @@ import (
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/npm/iptm"
+	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/util"
 	"github.com/Azure/azure-container-networking/telemetry"
 	corev1 "k8s.io/api/core/v1"
@@ -28,6 +29,7 @@ const (
 	restoreRetryWaitTimeInSeconds = 5
 	restoreMaxRetries             = 10
 	backupWaitTimeInSeconds       = 60
+	reconcileWaitTimeInSeconds    = 300
 	telemetryRetryTimeInSeconds   = 60
 	heartbeatIntervalInMinutes    = 30
 )
@@ -50,6 +52,7 @@ type NetworkPolicyManager struct {
 	isAzureNpmChainCreated bool
 
 	clusterState  telemetry.ClusterState
+	driftState    telemetry.DriftState
 	reportManager *telemetry.ReportManager
 
 	serverVersion    *version.Info
@@ -80,6 +83,14 @@ func (npMgr *NetworkPolicyManager) GetClusterState() telemetry.ClusterState {
 	return npMgr.clusterState
 }
 
+// GetDriftState returns the drift found by the last reconciliation.
+func (npMgr *NetworkPolicyManager) GetDriftState() telemetry.DriftState {
+	npMgr.Lock()
+	defer npMgr.Unlock()
+
+	return npMgr.driftState
+}
+
 // SendNpmTelemetry updates the npm report then send it.
 func (npMgr *NetworkPolicyManager) SendNpmTelemetry() {
 	if !npMgr.TelemetryEnabled {
@@ -115,6 +126,7 @@ CONNECT:
 			fmt.Println(msg.(string))
 		}
 
+		reflect.ValueOf(report).Elem().FieldByName("DriftState").Set(reflect.ValueOf(npMgr.GetDriftState()))
 		reflect.ValueOf(report).Elem().FieldByName("Timestamp").SetString(time.Now().UTC().String())
 		// TODO: Remove below line after the host change is rolled out
 		reflect.ValueOf(report).Elem().FieldByName("EventMessage").SetString(time.Now().UTC().String())
@@ -134,6 +146,32 @@ CONNECT:
 	}
 }
 
+// updateMetrics reports the number of policies and ipsets of a namespace to the azure-npm metrics.
+// It is called whenever they may have changed, so that collecting metrics does not need the npMgr lock.
+func updateMetrics(ns *namespace) {
+	metrics.NumPolicies.Set(float64(len(ns.npMap)))
+	metrics.NumIpsets.Set(float64(ns.ipsMgr.GetIpsetCount()))
+}
+
+// beginTransaction starts batching the ipset and iptables updates of an event.
+func beginTransaction(ns *namespace) {
+	ns.ipsMgr.BeginTransaction()
+	ns.iptMgr.BeginTransaction()
+}
+
+// endTransaction applies the batched updates of an event, or discards them if the event failed.
+func endTransaction(ns *namespace, err error) error {
+	if err == nil {
+		err = ns.ipsMgr.CommitTransaction(ns.iptMgr.CommitTransaction)
+	}
+
+	ns.ipsMgr.AbortTransaction()
+	ns.iptMgr.AbortTransaction()
+	updateMetrics(ns)
+
+	return err
+}
+
 // restore restores iptables from backup file
 func (npMgr *NetworkPolicyManager) restore() {
 	iptMgr := iptm.NewIptablesManager()
@@ -187,6 +225,7 @@ func (npMgr *NetworkPolicyManager) Start(stopCh <-chan struct{}) error {
 	}
 
 	go npMgr.backup()
+	go npMgr.reconcile()
 
 	return nil
 }
@@ -248,6 +287,8 @@ func NewNetworkPolicyManager(clientset *kubernetes.Clientset, informerFactory in
 	}
 	npMgr.nsMap[util.KubeAllNamespacesFlag] = allNs
 
+	updateMetrics(allNs)
+
 	podInformer.Informer().AddEventHandler(
 		// Pod event handlers
 		cache.ResourceEventHandlerFuncs{
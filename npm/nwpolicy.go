@@ -3,16 +3,28 @@
 package npm
 
 import (
+	"time"
+
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/util"
 	networkingv1 "k8s.io/api/networking/v1"
 )
 
 // AddNetworkPolicy handles adding network policy to iptables.
 func (npMgr *NetworkPolicyManager) AddNetworkPolicy(npObj *networkingv1.NetworkPolicy) error {
+	defer metrics.AddPolicyExecTime.ObserveSince(time.Now())
+
 	npMgr.Lock()
 	defer npMgr.Unlock()
 
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	return endTransaction(allNs, npMgr.addNetworkPolicy(npObj))
+}
+
+func (npMgr *NetworkPolicyManager) addNetworkPolicy(npObj *networkingv1.NetworkPolicy) error {
 	var err error
 
 	npNs, npName := npObj.ObjectMeta.Namespace, npObj.ObjectMeta.Name
@@ -81,17 +93,25 @@ func (npMgr *NetworkPolicyManager) UpdateNetworkPolicy(oldNpObj *networkingv1.Ne
 
 	log.Printf("NETWORK POLICY UPDATING:\n old policy:[%v]\n new policy:[%v]", oldNpObj, newNpObj)
 
-	if err = npMgr.DeleteNetworkPolicy(oldNpObj); err != nil {
-		return err
+	npMgr.Lock()
+	defer npMgr.Unlock()
+
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	if err = npMgr.deleteNetworkPolicy(oldNpObj); err != nil {
+		return endTransaction(allNs, err)
 	}
 
 	if newNpObj.ObjectMeta.DeletionTimestamp == nil && newNpObj.ObjectMeta.DeletionGracePeriodSeconds == nil {
-		if err = npMgr.AddNetworkPolicy(newNpObj); err != nil {
-			return err
-		}
+		err = npMgr.addNetworkPolicy(newNpObj)
 	}
 
-	return nil
+	if err = endTransaction(allNs, err); err != nil {
+		return err
+	}
+
+	return npMgr.uninitNpmChainsIfUnused()
 }
 
 // DeleteNetworkPolicy handles deleting network policy from iptables.
@@ -99,6 +119,17 @@ func (npMgr *NetworkPolicyManager) DeleteNetworkPolicy(npObj *networkingv1.Netwo
 	npMgr.Lock()
 	defer npMgr.Unlock()
 
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	if err := endTransaction(allNs, npMgr.deleteNetworkPolicy(npObj)); err != nil {
+		return err
+	}
+
+	return npMgr.uninitNpmChainsIfUnused()
+}
+
+func (npMgr *NetworkPolicyManager) deleteNetworkPolicy(npObj *networkingv1.NetworkPolicy) error {
 	var err error
 
 	npName := npObj.ObjectMeta.Name
@@ -118,13 +149,22 @@ func (npMgr *NetworkPolicyManager) DeleteNetworkPolicy(npObj *networkingv1.Netwo
 
 	delete(allNs.npMap, npName)
 
-	if len(allNs.npMap) == 0 {
-		if err = iptMgr.UninitNpmChains(); err != nil {
-			log.Errorf("Error: failed to uninitialize azure-npm chains.")
-			return err
-		}
-		npMgr.isAzureNpmChainCreated = false
+	return nil
+}
+
+// uninitNpmChainsIfUnused removes azure-npm chains once no network policy is left.
+// Chains are removed outside of transactions, after the rules in them are deleted.
+func (npMgr *NetworkPolicyManager) uninitNpmChainsIfUnused() error {
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	if len(allNs.npMap) > 0 {
+		return nil
+	}
+
+	if err := allNs.iptMgr.UninitNpmChains(); err != nil {
+		log.Errorf("Error: failed to uninitialize azure-npm chains.")
+		return err
 	}
+	npMgr.isAzureNpmChainCreated = false
 
 	return nil
 }
@@ -4,16 +4,127 @@ package npm
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/npm/iptm"
 	"github.com/Azure/azure-container-networking/npm/util"
+
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 type portsInfo struct {
-	protocol string
-	port     string
+	protocol  string
+	port      string
+	namedPort string
+}
+
+// getPortsInfo returns the protocol and port matched by a port rule.
+// The protocol defaults to TCP, and a missing port matches all ports.
+// A numerical port with an end port matches the range from port to end port.
+func getPortsInfo(portRule networkingv1.NetworkPolicyPort) *portsInfo {
+	protPortPair := &portsInfo{
+		protocol: string(corev1.ProtocolTCP),
+	}
+
+	if portRule.Protocol != nil {
+		protPortPair.protocol = string(*portRule.Protocol)
+	}
+
+	if portRule.Port != nil {
+		if portRule.Port.Type == intstr.String {
+			protPortPair.namedPort = portRule.Port.StrVal
+		} else {
+			protPortPair.port = fmt.Sprint(portRule.Port.IntVal)
+			if portRule.EndPort != nil && *portRule.EndPort > portRule.Port.IntVal {
+				protPortPair.port += fmt.Sprintf(":%d", *portRule.EndPort)
+			}
+		}
+	}
+
+	return protPortPair
+}
+
+// getPortRuleSpecs returns the iptables specs matching the protocol and port of a port rule.
+// Named ports are matched against the ipset of the pods exposing a container port with that name.
+func getPortRuleSpecs(protPortPair *portsInfo) []string {
+	specs := []string{
+		util.IptablesProtFlag,
+		protPortPair.protocol,
+	}
+
+	if len(protPortPair.namedPort) > 0 {
+		specs = append(specs,
+			util.IptablesMatchFlag,
+			util.IptablesSetFlag,
+			util.IptablesMatchSetFlag,
+			util.GetHashedName(util.GetNamedPortIpsetName(protPortPair.namedPort)),
+			util.IptablesDstFlag+","+util.IptablesDstFlag,
+		)
+	} else if len(protPortPair.port) > 0 {
+		specs = append(specs,
+			util.IptablesDstPortFlag,
+			protPortPair.port,
+		)
+	}
+
+	return specs
+}
+
+// getCIDRFromEntry returns the CIDR matched by an IPBlock entry, if any.
+func getCIDRFromEntry(entry *iptm.IptEntry) string {
+	for i, spec := range entry.Specs {
+		if (spec == util.IptablesSFlag || spec == util.IptablesDFlag) && i+1 < len(entry.Specs) {
+			return entry.Specs[i+1]
+		}
+	}
+
+	return ""
+}
+
+// getIPv6Entry returns the ip6tables counterpart of an iptables entry, matching the inet6 ipsets.
+func getIPv6Entry(entry *iptm.IptEntry) *iptm.IptEntry {
+	ipv6Entry := &iptm.IptEntry{
+		Command:    util.Ip6tables,
+		Name:       entry.Name,
+		HashedName: entry.HashedName,
+		Chain:      entry.Chain,
+		Flag:       entry.Flag,
+	}
+
+	if strings.HasPrefix(entry.HashedName, util.AzureNpmPrefix) {
+		ipv6Entry.HashedName = util.AzureNpmIPv6Prefix + strings.TrimPrefix(entry.HashedName, util.AzureNpmPrefix)
+	}
+
+	for _, spec := range entry.Specs {
+		if strings.HasPrefix(spec, util.AzureNpmPrefix) {
+			spec = util.AzureNpmIPv6Prefix + strings.TrimPrefix(spec, util.AzureNpmPrefix)
+		}
+		ipv6Entry.Specs = append(ipv6Entry.Specs, spec)
+	}
+
+	return ipv6Entry
+}
+
+// getDualStackEntries returns the iptables entries followed by their ip6tables counterparts.
+// Entries matching an IPBlock CIDR are only kept for the IP family of the CIDR.
+func getDualStackEntries(entries []*iptm.IptEntry) []*iptm.IptEntry {
+	var ipv4Entries, ipv6Entries []*iptm.IptEntry
+
+	for _, entry := range entries {
+		cidr := getCIDRFromEntry(entry)
+		if cidr == "" || !util.IsIPv6(cidr) {
+			ipv4Entries = append(ipv4Entries, entry)
+		}
+
+		if util.IsIPv6Enabled && (cidr == "" || util.IsIPv6(cidr)) {
+			ipv6Entries = append(ipv6Entries, getIPv6Entry(entry))
+		}
+	}
+
+	return append(ipv4Entries, ipv6Entries...)
 }
 
 func appendAndClearSets(podNsRuleSets *[]string, nsRuleLists *[]string, policyRuleSets *[]string, policyRuleLists *[]string) {
@@ -110,11 +221,11 @@ func parseIngress(ns string, targetSets []string, rules []networkingv1.NetworkPo
 
 		for _, rule := range rules {
 			for _, portRule := range rule.Ports {
-				protPortPairSlice = append(protPortPairSlice,
-					&portsInfo{
-						protocol: string(*portRule.Protocol),
-						port:     fmt.Sprint(portRule.Port.IntVal),
-					})
+				protPortPair := getPortsInfo(portRule)
+				if len(protPortPair.namedPort) > 0 {
+					policyRuleSets = append(policyRuleSets, util.GetNamedPortIpsetName(protPortPair.namedPort))
+				}
+				protPortPairSlice = append(protPortPairSlice, protPortPair)
 
 				portRuleExists = true
 			}
@@ -176,11 +287,7 @@ func parseIngress(ns string, targetSets []string, rules []networkingv1.NetworkPo
 						Name:       targetSet,
 						HashedName: hashedTargetSetName,
 						Chain:      util.IptablesAzureIngressPortChain,
-						Specs: []string{
-							util.IptablesProtFlag,
-							protPortPair.protocol,
-							util.IptablesDstPortFlag,
-							protPortPair.port,
+						Specs: append(getPortRuleSpecs(protPortPair),
 							util.IptablesMatchFlag,
 							util.IptablesSetFlag,
 							util.IptablesMatchSetFlag,
@@ -188,7 +295,7 @@ func parseIngress(ns string, targetSets []string, rules []networkingv1.NetworkPo
 							util.IptablesDstFlag,
 							util.IptablesJumpFlag,
 							util.IptablesAzureIngressFromNsChain,
-						},
+						),
 					}
 					entries = append(entries, entry)
 				}
@@ -428,7 +535,7 @@ func parseIngress(ns string, targetSets []string, rules []networkingv1.NetworkPo
 	}
 
 	log.Printf("finished parsing ingress rule")
-	return policyRuleSets, policyRuleLists, entries
+	return policyRuleSets, policyRuleLists, getDualStackEntries(entries)
 }
 
 func parseEgress(ns string, targetSets []string, rules []networkingv1.NetworkPolicyEgressRule) ([]string, []string, []*iptm.IptEntry) {
@@ -519,11 +626,11 @@ func parseEgress(ns string, targetSets []string, rules []networkingv1.NetworkPol
 
 		for _, rule := range rules {
 			for _, portRule := range rule.Ports {
-				protPortPairSlice = append(protPortPairSlice,
-					&portsInfo{
-						protocol: string(*portRule.Protocol),
-						port:     fmt.Sprint(portRule.Port.IntVal),
-					})
+				protPortPair := getPortsInfo(portRule)
+				if len(protPortPair.namedPort) > 0 {
+					policyRuleSets = append(policyRuleSets, util.GetNamedPortIpsetName(protPortPair.namedPort))
+				}
+				protPortPairSlice = append(protPortPairSlice, protPortPair)
 
 				portRuleExists = true
 			}
@@ -585,11 +692,7 @@ func parseEgress(ns string, targetSets []string, rules []networkingv1.NetworkPol
 						Name:       targetSet,
 						HashedName: hashedTargetSetName,
 						Chain:      util.IptablesAzureEgressPortChain,
-						Specs: []string{
-							util.IptablesProtFlag,
-							protPortPair.protocol,
-							util.IptablesDstPortFlag,
-							protPortPair.port,
+						Specs: append(getPortRuleSpecs(protPortPair),
 							util.IptablesMatchFlag,
 							util.IptablesSetFlag,
 							util.IptablesMatchSetFlag,
@@ -597,7 +700,7 @@ func parseEgress(ns string, targetSets []string, rules []networkingv1.NetworkPol
 							util.IptablesSrcFlag,
 							util.IptablesJumpFlag,
 							util.IptablesAzureEgressToNsChain,
-						},
+						),
 					}
 					entries = append(entries, entry)
 				}
@@ -838,7 +941,7 @@ func parseEgress(ns string, targetSets []string, rules []networkingv1.NetworkPol
 	}
 
 	log.Printf("finished parsing ingress rule")
-	return policyRuleSets, policyRuleLists, entries
+	return policyRuleSets, policyRuleLists, getDualStackEntries(entries)
 }
 
 // Drop all non-whitelisted packets.
@@ -880,7 +983,7 @@ func getDefaultDropEntries(targetSets []string) []*iptm.IptEntry {
 		entries = append(entries, entry)
 	}
 
-	return entries
+	return getDualStackEntries(entries)
 }
 
 // Allow traffic from/to kube-system pods
@@ -937,7 +1040,7 @@ func getAllowKubeSystemEntries(ns string, targetSets []string) []*iptm.IptEntry
 		entries = append(entries, allowKubeSystemEgress)
 	}
 
-	return entries
+	return getDualStackEntries(entries)
 }
 
 // ParsePolicy parses network policy.
@@ -0,0 +1,141 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package npm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/iptm"
+	"github.com/Azure/azure-container-networking/npm/util"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGetDualStackEntries(t *testing.T) {
+	isIPv6Enabled := util.IsIPv6Enabled
+	util.IsIPv6Enabled = true
+	defer func() { util.IsIPv6Enabled = isIPv6Enabled }()
+
+	hashedSetName := util.GetHashedName("test-set")
+	newEntry := func(cidr string) *iptm.IptEntry {
+		entry := &iptm.IptEntry{
+			Chain: util.IptablesAzureIngressFromNsChain,
+			Specs: []string{
+				util.IptablesMatchFlag,
+				util.IptablesSetFlag,
+				util.IptablesMatchSetFlag,
+				hashedSetName,
+				util.IptablesDstFlag,
+			},
+		}
+		if cidr != "" {
+			entry.Specs = append(entry.Specs, util.IptablesSFlag, cidr)
+		}
+		entry.Specs = append(entry.Specs, util.IptablesJumpFlag, util.IptablesAccept)
+		return entry
+	}
+
+	entries := getDualStackEntries([]*iptm.IptEntry{
+		newEntry(""),
+		newEntry("10.0.0.0/16"),
+		newEntry("fd00::/64"),
+	})
+
+	if len(entries) != 4 {
+		t.Fatalf("TestGetDualStackEntries failed @ getDualStackEntries, expected 4 entries, got %d", len(entries))
+	}
+
+	for i, command := range []string{"", "", util.Ip6tables, util.Ip6tables} {
+		if entries[i].Command != command {
+			t.Errorf("TestGetDualStackEntries failed @ entry %d, expected command %q, got %q", i, command, entries[i].Command)
+		}
+	}
+
+	if cidr := getCIDRFromEntry(entries[1]); cidr != "10.0.0.0/16" {
+		t.Errorf("TestGetDualStackEntries failed @ entry 1, expected IPv4 CIDR, got %q", cidr)
+	}
+
+	if cidr := getCIDRFromEntry(entries[3]); cidr != "fd00::/64" {
+		t.Errorf("TestGetDualStackEntries failed @ entry 3, expected IPv6 CIDR, got %q", cidr)
+	}
+
+	if entries[2].Specs[3] != util.GetIPv6HashedName("test-set") {
+		t.Errorf("TestGetDualStackEntries failed @ entry 2, expected inet6 ipset, got %s", entries[2].Specs[3])
+	}
+}
+
+func TestGetPortRuleSpecs(t *testing.T) {
+	sctp := corev1.ProtocolSCTP
+	numberedPort := intstr.FromInt(8000)
+	namedPort := intstr.FromString("http")
+	endPort := int32(8080)
+
+	testCases := []struct {
+		portRule networkingv1.NetworkPolicyPort
+		expected []string
+	}{
+		{
+			portRule: networkingv1.NetworkPolicyPort{},
+			expected: []string{util.IptablesProtFlag, "TCP"},
+		},
+		{
+			portRule: networkingv1.NetworkPolicyPort{Protocol: &sctp, Port: &numberedPort},
+			expected: []string{util.IptablesProtFlag, "SCTP", util.IptablesDstPortFlag, "8000"},
+		},
+		{
+			portRule: networkingv1.NetworkPolicyPort{Port: &numberedPort, EndPort: &endPort},
+			expected: []string{util.IptablesProtFlag, "TCP", util.IptablesDstPortFlag, "8000:8080"},
+		},
+		{
+			portRule: networkingv1.NetworkPolicyPort{Port: &namedPort},
+			expected: []string{
+				util.IptablesProtFlag,
+				"TCP",
+				util.IptablesMatchFlag,
+				util.IptablesSetFlag,
+				util.IptablesMatchSetFlag,
+				util.GetHashedName(util.GetNamedPortIpsetName("http")),
+				util.IptablesDstFlag + "," + util.IptablesDstFlag,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		if specs := getPortRuleSpecs(getPortsInfo(testCase.portRule)); !reflect.DeepEqual(specs, testCase.expected) {
+			t.Errorf("TestGetPortRuleSpecs failed, expected %v, got %v", testCase.expected, specs)
+		}
+	}
+}
+
+// hasPortRange returns whether an entry matches the given destination port range.
+func hasPortRange(entries []*iptm.IptEntry, portRange string) bool {
+	for _, entry := range entries {
+		for i, spec := range entry.Specs {
+			if spec == util.IptablesDstPortFlag && i+1 < len(entry.Specs) && entry.Specs[i+1] == portRange {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func TestParsePortRange(t *testing.T) {
+	port := intstr.FromInt(8000)
+	endPort := int32(8080)
+	ports := []networkingv1.NetworkPolicyPort{{Port: &port, EndPort: &endPort}}
+	targetSets := []string{"ns-test"}
+
+	_, _, ingressEntries := parseIngress("test", targetSets, []networkingv1.NetworkPolicyIngressRule{{Ports: ports}})
+	if !hasPortRange(ingressEntries, "8000:8080") {
+		t.Errorf("TestParsePortRange failed @ parseIngress, no entry matches the port range: %+v", ingressEntries)
+	}
+
+	_, _, egressEntries := parseEgress("test", targetSets, []networkingv1.NetworkPolicyEgressRule{{Ports: ports}})
+	if !hasPortRange(egressEntries, "8000:8080") {
+		t.Errorf("TestParsePortRange failed @ parseEgress, no entry matches the port range: %+v", egressEntries)
+	}
+}
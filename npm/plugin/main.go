@@ -3,9 +3,11 @@
 package main
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/metrics"
 	"github.com/Azure/azure-container-networking/npm"
 
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -14,7 +16,11 @@ import (
 	"k8s.io/client-go/rest"
 )
 
-const waitForTelemetryInSeconds = 60
+const (
+	waitForTelemetryInSeconds = 60
+	metricsAddress            = ":10091"
+	metricsPath               = "/metrics"
+)
 
 // Version is populated by make during build.
 var version string
@@ -30,6 +36,17 @@ func initLogging() error {
 	return nil
 }
 
+// serveMetrics exposes azure-npm metrics for Prometheus.
+func serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, metrics.Handler())
+
+	log.Logf("Serving metrics on %s%s.", metricsAddress, metricsPath)
+	if err := http.ListenAndServe(metricsAddress, mux); err != nil {
+		log.Logf("Failed to serve metrics, err:%v.", err)
+	}
+}
+
 func main() {
 	var err error
 
@@ -62,6 +79,8 @@ func main() {
 
 	go npMgr.SendNpmTelemetry()
 
+	go serveMetrics()
+
 	time.Sleep(time.Second * waitForTelemetryInSeconds)
 
 	err = npMgr.Start(wait.NeverStop)
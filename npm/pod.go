@@ -4,8 +4,10 @@ package npm
 
 import (
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/metrics"
 	"github.com/Azure/azure-container-networking/npm/util"
 
 	corev1 "k8s.io/api/core/v1"
@@ -22,11 +24,66 @@ func isSystemPod(podObj *corev1.Pod) bool {
 	return podObj.ObjectMeta.Namespace == util.KubeSystemFlag
 }
 
+// getPodIPs returns the IP addresses of the pod, at most one per IP family. IPv6 addresses are added
+// to the inet6 ipsets, and skipped if IPv6 is not enabled on the node.
+func getPodIPs(podObj *corev1.Pod) []string {
+	var addresses []string
+	for _, podIP := range podObj.Status.PodIPs {
+		addresses = append(addresses, podIP.IP)
+	}
+
+	// Clusters without dual-stack support only report the primary address.
+	if len(addresses) == 0 {
+		addresses = append(addresses, podObj.Status.PodIP)
+	}
+
+	var podIPs []string
+	for _, address := range addresses {
+		if util.IsIPv6(address) && !util.IsIPv6Enabled {
+			continue
+		}
+
+		podIPs = append(podIPs, address)
+	}
+
+	return podIPs
+}
+
+// getNamedPortEntries returns the ip,proto:port entries of the named container ports of a pod, keyed by ipset name.
+func getNamedPortEntries(podObj *corev1.Pod, podIP string) map[string]string {
+	entries := make(map[string]string)
+	for _, container := range podObj.Spec.Containers {
+		for _, port := range container.Ports {
+			if len(port.Name) == 0 {
+				continue
+			}
+
+			protocol := port.Protocol
+			if len(protocol) == 0 {
+				protocol = corev1.ProtocolTCP
+			}
+
+			entries[util.GetNamedPortIpsetName(port.Name)] = util.GetNamedPortIpsetEntry(podIP, string(protocol), port.ContainerPort)
+		}
+	}
+
+	return entries
+}
+
 // AddPod handles adding pod ip to its label's ipset.
 func (npMgr *NetworkPolicyManager) AddPod(podObj *corev1.Pod) error {
+	defer metrics.AddPodExecTime.ObserveSince(time.Now())
+
 	npMgr.Lock()
 	defer npMgr.Unlock()
 
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	return endTransaction(allNs, npMgr.addPod(podObj))
+}
+
+func (npMgr *NetworkPolicyManager) addPod(podObj *corev1.Pod) error {
 	if !isValidPod(podObj) {
 		return nil
 	}
@@ -37,33 +94,42 @@ func (npMgr *NetworkPolicyManager) AddPod(podObj *corev1.Pod) error {
 	podName := podObj.ObjectMeta.Name
 	podNodeName := podObj.Spec.NodeName
 	podLabels := podObj.ObjectMeta.Labels
-	podIP := podObj.Status.PodIP
-	log.Printf("POD CREATING: [%s/%s/%s%+v%s]", podNs, podName, podNodeName, podLabels, podIP)
+	podIPs := getPodIPs(podObj)
+	log.Printf("POD CREATING: [%s/%s/%s%+v%v]", podNs, podName, podNodeName, podLabels, podIPs)
 
 	// Add the pod to ipset
 	ipsMgr := npMgr.nsMap[util.KubeAllNamespacesFlag].ipsMgr
-	// Add the pod to its namespace's ipset.
-	log.Printf("Adding pod %s to ipset %s", podIP, podNs)
-	if err = ipsMgr.AddToSet(podNs, podIP); err != nil {
-		log.Errorf("Error: failed to add pod to namespace ipset.")
-		return err
-	}
+	for _, podIP := range podIPs {
+		// Add the pod to its namespace's ipset.
+		log.Printf("Adding pod %s to ipset %s", podIP, podNs)
+		if err = ipsMgr.AddToSet(podNs, podIP); err != nil {
+			log.Errorf("Error: failed to add pod to namespace ipset.")
+			return err
+		}
 
-	// Add the pod to its label's ipset.
-	var labelKeys []string
-	for podLabelKey, podLabelVal := range podLabels {
-		//Ignore pod-template-hash label.
-		if strings.Contains(podLabelKey, util.KubePodTemplateHashFlag) {
-			continue
+		// Add the pod to its label's ipset.
+		for podLabelKey, podLabelVal := range podLabels {
+			//Ignore pod-template-hash label.
+			if strings.Contains(podLabelKey, util.KubePodTemplateHashFlag) {
+				continue
+			}
+
+			labelKey := util.KubeAllNamespacesFlag + "-" + podLabelKey + ":" + podLabelVal
+			log.Printf("Adding pod %s to ipset %s", podIP, labelKey)
+			if err = ipsMgr.AddToSet(labelKey, podIP); err != nil {
+				log.Errorf("Error: failed to add pod to label ipset.")
+				return err
+			}
 		}
 
-		labelKey := util.KubeAllNamespacesFlag + "-" + podLabelKey + ":" + podLabelVal
-		log.Printf("Adding pod %s to ipset %s", podIP, labelKey)
-		if err = ipsMgr.AddToSet(labelKey, podIP); err != nil {
-			log.Errorf("Error: failed to add pod to label ipset.")
-			return err
+		// Add the pod to the ipsets of its named container ports.
+		for setName, entry := range getNamedPortEntries(podObj, podIP) {
+			log.Printf("Adding pod %s to ipset %s", entry, setName)
+			if err = ipsMgr.AddToSet(setName, entry); err != nil {
+				log.Errorf("Error: failed to add pod to named port ipset.")
+				return err
+			}
 		}
-		labelKeys = append(labelKeys, labelKey)
 	}
 
 	ns, err := newNs(podNs)
@@ -88,30 +154,34 @@ func (npMgr *NetworkPolicyManager) UpdatePod(oldPodObj, newPodObj *corev1.Pod) e
 	oldPodObjName := oldPodObj.ObjectMeta.Name
 	oldPodObjLabel := oldPodObj.ObjectMeta.Labels
 	oldPodObjPhase := oldPodObj.Status.Phase
-	oldPodObjIP := oldPodObj.Status.PodIP
+	oldPodObjIPs := getPodIPs(oldPodObj)
 	newPodObjNs := newPodObj.ObjectMeta.Namespace
 	newPodObjName := newPodObj.ObjectMeta.Name
 	newPodObjLabel := newPodObj.ObjectMeta.Labels
 	newPodObjPhase := newPodObj.Status.Phase
-	newPodObjIP := newPodObj.Status.PodIP
+	newPodObjIPs := getPodIPs(newPodObj)
 
 	log.Printf(
-		"POD UPDATING:\n old pod: [%s/%s/%+v/%s/%s]\n new pod: [%s/%s/%+v/%s/%s]",
-		oldPodObjNs, oldPodObjName, oldPodObjLabel, oldPodObjPhase, oldPodObjIP,
-		newPodObjNs, newPodObjName, newPodObjLabel, newPodObjPhase, newPodObjIP,
+		"POD UPDATING:\n old pod: [%s/%s/%+v/%s/%v]\n new pod: [%s/%s/%+v/%s/%v]",
+		oldPodObjNs, oldPodObjName, oldPodObjLabel, oldPodObjPhase, oldPodObjIPs,
+		newPodObjNs, newPodObjName, newPodObjLabel, newPodObjPhase, newPodObjIPs,
 	)
 
-	if err = npMgr.DeletePod(oldPodObj); err != nil {
-		return err
+	npMgr.Lock()
+	defer npMgr.Unlock()
+
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	if err = npMgr.deletePod(oldPodObj); err != nil {
+		return endTransaction(allNs, err)
 	}
 
 	if newPodObj.ObjectMeta.DeletionTimestamp == nil && newPodObj.ObjectMeta.DeletionGracePeriodSeconds == nil {
-		if err = npMgr.AddPod(newPodObj); err != nil {
-			return err
-		}
+		err = npMgr.addPod(newPodObj)
 	}
 
-	return nil
+	return endTransaction(allNs, err)
 }
 
 // DeletePod handles deleting pod from its label's ipset.
@@ -119,6 +189,13 @@ func (npMgr *NetworkPolicyManager) DeletePod(podObj *corev1.Pod) error {
 	npMgr.Lock()
 	defer npMgr.Unlock()
 
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	return endTransaction(allNs, npMgr.deletePod(podObj))
+}
+
+func (npMgr *NetworkPolicyManager) deletePod(podObj *corev1.Pod) error {
 	if !isValidPod(podObj) {
 		return nil
 	}
@@ -129,28 +206,37 @@ func (npMgr *NetworkPolicyManager) DeletePod(podObj *corev1.Pod) error {
 	podName := podObj.ObjectMeta.Name
 	podNodeName := podObj.Spec.NodeName
 	podLabels := podObj.ObjectMeta.Labels
-	podIP := podObj.Status.PodIP
-	log.Printf("POD DELETING: [%s/%s/%s%+v%s]", podNs, podName, podNodeName, podLabels, podIP)
+	podIPs := getPodIPs(podObj)
+	log.Printf("POD DELETING: [%s/%s/%s%+v%v]", podNs, podName, podNodeName, podLabels, podIPs)
 
 	// Delete pod from ipset
 	ipsMgr := npMgr.nsMap[util.KubeAllNamespacesFlag].ipsMgr
-	// Delete the pod from its namespace's ipset.
-	if err = ipsMgr.DeleteFromSet(podNs, podIP); err != nil {
-		log.Errorf("Error: failed to delete pod from namespace ipset.")
-		return err
-	}
-	// Delete the pod from its label's ipset.
-	for podLabelKey, podLabelVal := range podLabels {
-		//Ignore pod-template-hash label.
-		if strings.Contains(podLabelKey, "pod-template-hash") {
-			continue
-		}
-
-		labelKey := util.KubeAllNamespacesFlag + "-" + podLabelKey + ":" + podLabelVal
-		if err = ipsMgr.DeleteFromSet(labelKey, podIP); err != nil {
-			log.Errorf("Error: failed to delete pod from label ipset.")
+	for _, podIP := range podIPs {
+		// Delete the pod from its namespace's ipset.
+		if err = ipsMgr.DeleteFromSet(podNs, podIP); err != nil {
+			log.Errorf("Error: failed to delete pod from namespace ipset.")
 			return err
 		}
+		// Delete the pod from its label's ipset.
+		for podLabelKey, podLabelVal := range podLabels {
+			//Ignore pod-template-hash label.
+			if strings.Contains(podLabelKey, "pod-template-hash") {
+				continue
+			}
+
+			labelKey := util.KubeAllNamespacesFlag + "-" + podLabelKey + ":" + podLabelVal
+			if err = ipsMgr.DeleteFromSet(labelKey, podIP); err != nil {
+				log.Errorf("Error: failed to delete pod from label ipset.")
+				return err
+			}
+		}
+		// Delete the pod from the ipsets of its named container ports.
+		for setName, entry := range getNamedPortEntries(podObj, podIP) {
+			if err = ipsMgr.DeleteFromSet(setName, entry); err != nil {
+				log.Errorf("Error: failed to delete pod from named port ipset.")
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -3,6 +3,7 @@
 package npm
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/Azure/azure-container-networking/npm/ipsm"
@@ -35,6 +36,31 @@ func TestisSystemPod(t *testing.T) {
 	}
 }
 
+func TestGetPodIPs(t *testing.T) {
+	defer func(enabled bool) { util.IsIPv6Enabled = enabled }(util.IsIPv6Enabled)
+
+	podObj := &corev1.Pod{
+		Status: corev1.PodStatus{
+			PodIP: "1.2.3.4",
+		},
+	}
+	if podIPs := getPodIPs(podObj); !reflect.DeepEqual(podIPs, []string{"1.2.3.4"}) {
+		t.Errorf("TestGetPodIPs failed @ getPodIPs without PodIPs: %v", podIPs)
+	}
+
+	podObj.Status.PodIPs = []corev1.PodIP{{IP: "1.2.3.4"}, {IP: "fd00::4"}}
+
+	util.IsIPv6Enabled = true
+	if podIPs := getPodIPs(podObj); !reflect.DeepEqual(podIPs, []string{"1.2.3.4", "fd00::4"}) {
+		t.Errorf("TestGetPodIPs failed @ getPodIPs with IPv6 enabled: %v", podIPs)
+	}
+
+	util.IsIPv6Enabled = false
+	if podIPs := getPodIPs(podObj); !reflect.DeepEqual(podIPs, []string{"1.2.3.4"}) {
+		t.Errorf("TestGetPodIPs failed @ getPodIPs with IPv6 disabled: %v", podIPs)
+	}
+}
+
 func TestAddPod(t *testing.T) {
 	npMgr := &NetworkPolicyManager{
 		nsMap:            make(map[string]*namespace),
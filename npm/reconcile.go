@@ -0,0 +1,189 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package npm
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/npm/iptm"
+	"github.com/Azure/azure-container-networking/npm/util"
+	"github.com/Azure/azure-container-networking/telemetry"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// desiredState holds the ipsets and iptables rules npm maintains for the objects in the informer caches.
+type desiredState struct {
+	sets    map[string]map[string]bool
+	lists   map[string]map[string]bool
+	entries []*iptm.IptEntry
+}
+
+// reconcile periodically repairs the differences between the informer caches and the live ipsets and iptables rules.
+func (npMgr *NetworkPolicyManager) reconcile() {
+	for {
+		time.Sleep(reconcileWaitTimeInSeconds * time.Second)
+
+		if err := npMgr.Reconcile(); err != nil {
+			log.Errorf("Error: failed to reconcile Azure-NPM states. %v", err)
+		}
+	}
+}
+
+// Reconcile computes the ipsets and iptables rules of the objects in the informer caches,
+// compares them with the live ipsets and iptables rules, and repairs the differences.
+func (npMgr *NetworkPolicyManager) Reconcile() error {
+	npMgr.Lock()
+	defer npMgr.Unlock()
+
+	pods, err := npMgr.podInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	namespaces, err := npMgr.nsInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	policies, err := npMgr.npInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	desired := getDesiredState(pods, namespaces, policies)
+
+	allNs := npMgr.nsMap[util.KubeAllNamespacesFlag]
+	beginTransaction(allNs)
+
+	ipsDrift, err := allNs.ipsMgr.Reconcile(getMembers(desired.sets), getMembers(desired.lists))
+	if err != nil {
+		return endTransaction(allNs, err)
+	}
+
+	iptDrift, err := allNs.iptMgr.Reconcile(desired.entries)
+	if err = endTransaction(allNs, err); err != nil {
+		return err
+	}
+
+	if len(desired.entries) > 0 {
+		npMgr.isAzureNpmChainCreated = true
+	}
+
+	driftState := telemetry.DriftState{
+		MissingIpsets:        ipsDrift.MissingSets,
+		StaleIpsets:          ipsDrift.StaleSets,
+		MissingIpsetEntries:  ipsDrift.MissingEntries,
+		StaleIpsetEntries:    ipsDrift.StaleEntries,
+		MissingIptablesRules: iptDrift.MissingRules,
+		StaleIptablesRules:   iptDrift.StaleRules,
+	}
+	if driftState != (telemetry.DriftState{}) {
+		log.Logf("Repaired Azure-NPM drift: %+v", driftState)
+	}
+
+	// The telemetry goroutine copies the drift state into the report under the lock.
+	npMgr.driftState = driftState
+
+	return nil
+}
+
+// getDesiredState returns the ipsets and iptables rules the event handlers maintain for the given objects.
+func getDesiredState(pods []*corev1.Pod, namespaces []*corev1.Namespace, policies []*networkingv1.NetworkPolicy) *desiredState {
+	desired := &desiredState{
+		sets:  make(map[string]map[string]bool),
+		lists: make(map[string]map[string]bool),
+	}
+
+	for _, podObj := range pods {
+		if !isValidPod(podObj) || isDeleting(podObj.ObjectMeta) {
+			continue
+		}
+
+		podNs := podObj.ObjectMeta.Namespace
+		for _, podIP := range getPodIPs(podObj) {
+			addMember(desired.sets, podNs, podIP)
+
+			for podLabelKey, podLabelVal := range podObj.ObjectMeta.Labels {
+				if strings.Contains(podLabelKey, util.KubePodTemplateHashFlag) {
+					continue
+				}
+
+				addMember(desired.sets, util.KubeAllNamespacesFlag+"-"+podLabelKey+":"+podLabelVal, podIP)
+			}
+
+			for setName, entry := range getNamedPortEntries(podObj, podIP) {
+				addMember(desired.sets, setName, entry)
+			}
+		}
+	}
+
+	for _, nsObj := range namespaces {
+		if isDeleting(nsObj.ObjectMeta) {
+			continue
+		}
+
+		nsName := nsObj.ObjectMeta.Name
+		addMember(desired.sets, nsName, "")
+		addMember(desired.lists, util.KubeAllNamespacesFlag, nsName)
+
+		for nsLabelKey, nsLabelVal := range nsObj.ObjectMeta.Labels {
+			addMember(desired.lists, util.GetNsIpsetName(nsLabelKey, nsLabelVal), nsName)
+		}
+	}
+
+	for _, npObj := range policies {
+		if isDeleting(npObj.ObjectMeta) {
+			continue
+		}
+
+		podSets, nsLists, iptEntries := parsePolicy(npObj)
+		for _, set := range append(podSets, util.KubeSystemFlag) {
+			addMember(desired.sets, set, "")
+		}
+
+		for _, list := range nsLists {
+			addMember(desired.lists, list, "")
+		}
+
+		desired.entries = append(desired.entries, iptEntries...)
+	}
+
+	return desired
+}
+
+// isDeleting reports whether an object is being deleted, in which case the event handlers already removed it.
+func isDeleting(objectMeta metav1.ObjectMeta) bool {
+	return objectMeta.DeletionTimestamp != nil || objectMeta.DeletionGracePeriodSeconds != nil
+}
+
+// addMember adds a member to the ipset with the given name. An empty member only ensures the ipset exists.
+func addMember(ipsets map[string]map[string]bool, name string, member string) {
+	if _, exists := ipsets[name]; !exists {
+		ipsets[name] = make(map[string]bool)
+	}
+
+	if len(member) > 0 {
+		ipsets[name][member] = true
+	}
+}
+
+// getMembers returns the sorted members of the given ipsets.
+func getMembers(ipsets map[string]map[string]bool) map[string][]string {
+	members := make(map[string][]string, len(ipsets))
+	for name, set := range ipsets {
+		members[name] = []string{}
+		for member := range set {
+			members[name] = append(members[name], member)
+		}
+		sort.Strings(members[name])
+	}
+
+	return members
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+package npm
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-container-networking/npm/util"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetDesiredState(t *testing.T) {
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-pod",
+				Namespace: "test-namespace",
+				Labels:    map[string]string{"app": "test-pod"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}},
+				},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				PodIP: "1.2.3.4",
+			},
+		},
+	}
+
+	namespaces := []*corev1.Namespace{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "test-namespace",
+				Labels: map[string]string{"env": "test"},
+			},
+		},
+	}
+
+	policies := []*networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "deny-all",
+				Namespace: "test-namespace",
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+	}
+
+	desired := getDesiredState(pods, namespaces, policies)
+
+	if !desired.sets["test-namespace"]["1.2.3.4"] {
+		t.Errorf("TestGetDesiredState failed @ namespace set")
+	}
+
+	if !desired.sets[util.KubeAllNamespacesFlag+"-app:test-pod"]["1.2.3.4"] {
+		t.Errorf("TestGetDesiredState failed @ label set")
+	}
+
+	if !desired.sets[util.GetNamedPortIpsetName("http")]["1.2.3.4,tcp:8080"] {
+		t.Errorf("TestGetDesiredState failed @ named port set")
+	}
+
+	if !desired.lists[util.KubeAllNamespacesFlag]["test-namespace"] || !desired.lists[util.GetNsIpsetName("env", "test")]["test-namespace"] {
+		t.Errorf("TestGetDesiredState failed @ namespace lists")
+	}
+
+	if _, exists := desired.sets[util.KubeSystemFlag]; !exists {
+		t.Errorf("TestGetDesiredState failed @ kube-system set")
+	}
+
+	if len(desired.entries) == 0 {
+		t.Errorf("TestGetDesiredState failed @ policy entries")
+	}
+}
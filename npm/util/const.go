@@ -25,6 +25,11 @@ const (
 	Ip6tables                        string = "ip6tables"
 	IptablesSave                     string = "iptables-save"
 	IptablesRestore                  string = "iptables-restore"
+	Ip6tablesSave                    string = "ip6tables-save"
+	Ip6tablesRestore                 string = "ip6tables-restore"
+	IptablesNoFlushFlag              string = "--noflush"
+	IptablesTableFlag                string = "-t"
+	IptablesCommit                   string = "COMMIT"
 	IptablesConfigFile               string = "/var/log/iptables.conf"
 	IptablesTestConfigFile           string = "/var/log/iptables-test.conf"
 	IptablesLockFile                 string = "/run/xtables.lock"
@@ -86,11 +91,28 @@ const (
 	IpsetExistFlag string = "-exist"
 	IpsetFileFlag  string = "-file"
 
-	IpsetSetListFlag string = "setlist"
-	IpsetNetHashFlag string = "nethash"
+	IpsetCreateCmd string = "create"
+	IpsetAddCmd    string = "add"
+	IpsetDelCmd    string = "del"
 
-	AzureNpmFlag   string = "azure-npm"
-	AzureNpmPrefix string = "azure-npm-"
+	IpsetSetListFlag    string = "setlist"
+	IpsetNetHashFlag    string = "nethash"
+	IpsetIPPortHashFlag string = "hash:ip,port"
+
+	IpsetFamilyFlag string = "family"
+	IpsetIPv6Family string = "inet6"
+
+	NamedPortIpsetPrefix string = "namedport:"
+
+	AzureNpmFlag       string = "azure-npm"
+	AzureNpmPrefix     string = "azure-npm-"
+	AzureNpmIPv6Prefix string = "azure-npm6-"
+)
+
+//IPv6 related constants.
+const (
+	IPv6ProcFile  string = "/proc/net/if_inet6"
+	EnableIPv6Env string = "AZURE_NPM_ENABLE_IPV6"
 )
 
 //NPM telemetry constants.
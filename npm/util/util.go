@@ -5,6 +5,7 @@ package util
 import (
 	"fmt"
 	"hash/fnv"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -15,6 +16,36 @@ import (
 // IsNewNwPolicyVerFlag indicates if the current kubernetes version is newer than 1.11 or not
 var IsNewNwPolicyVerFlag = false
 
+// IsIPv6Enabled indicates if the node has IPv6 enabled, in which case npm maintains ip6tables chains and inet6 ipsets.
+var IsIPv6Enabled = isIPv6Enabled()
+
+// isIPv6Enabled reads the IPv6 setting from the environment, falling back to
+// checking whether the node has a global IPv6 address.
+func isIPv6Enabled() bool {
+	if value, ok := os.LookupEnv(EnableIPv6Env); ok {
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			return enabled
+		}
+	}
+
+	if !Exists(IPv6ProcFile) {
+		return false
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() == nil && ipNet.IP.IsGlobalUnicast() {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Exists reports whether the named file or directory exists.
 func Exists(filePath string) bool {
 	if _, err := os.Stat(filePath); err == nil {
@@ -41,6 +72,21 @@ func GetNsIpsetName(k, v string) string {
 	return "ns-" + k + ":" + v
 }
 
+// GetNamedPortIpsetName returns ipset name of the pods exposing a container port with the given name.
+func GetNamedPortIpsetName(portName string) string {
+	return NamedPortIpsetPrefix + portName
+}
+
+// IsNamedPortIpset reports whether the ipset with the given name holds named ports.
+func IsNamedPortIpset(setName string) bool {
+	return strings.HasPrefix(setName, NamedPortIpsetPrefix)
+}
+
+// GetNamedPortIpsetEntry returns the ipset entry of a pod ip exposing a container port, formatted as ip,proto:port.
+func GetNamedPortIpsetEntry(ip string, protocol string, port int32) string {
+	return fmt.Sprintf("%s,%s:%d", ip, strings.ToLower(protocol), port)
+}
+
 // Hash hashes a string to another string with length <= 32.
 func Hash(s string) string {
 	h := fnv.New32a()
@@ -77,6 +123,16 @@ func GetHashedName(name string) string {
 	return AzureNpmPrefix + Hash(name)
 }
 
+// GetIPv6HashedName returns hashed name of the inet6 ipset kept in parallel to the ipset with the given name.
+func GetIPv6HashedName(name string) string {
+	return AzureNpmIPv6Prefix + Hash(name)
+}
+
+// IsIPv6 reports whether the given IP address, CIDR or ip,proto:port ipset entry is an IPv6 one.
+func IsIPv6(address string) bool {
+	return strings.Contains(strings.Split(address, ",")[0], ":")
+}
+
 // CompareK8sVer compares two k8s versions.
 // returns -1, 0, 1 if firstVer smaller, equals, bigger than secondVer respectively.
 // returns -2 for error.
@@ -8,6 +8,7 @@ import (
 	"github.com/Azure/azure-container-networking/common"
 	"github.com/Azure/azure-container-networking/log"
 	"github.com/Azure/azure-container-networking/platform"
+	"github.com/Azure/azure-container-networking/rules"
 )
 
 const (
@@ -25,7 +26,7 @@ func CreateOVSBridge(bridgeName string) error {
 	log.Printf("[ovs] Creating OVS Bridge %v", bridgeName)
 
 	ovsCreateCmd := fmt.Sprintf("ovs-vsctl add-br %s", bridgeName)
-	_, err := platform.ExecuteCommand(ovsCreateCmd)
+	_, err := platform.ExecuteChangeCommand(ovsCreateCmd)
 	if err != nil {
 		log.Printf("[ovs] Error while creating OVS bridge %v", err)
 		return err
@@ -38,7 +39,7 @@ func DeleteOVSBridge(bridgeName string) error {
 	log.Printf("[ovs] Deleting OVS Bridge %v", bridgeName)
 
 	ovsCreateCmd := fmt.Sprintf("ovs-vsctl del-br %s", bridgeName)
-	_, err := platform.ExecuteCommand(ovsCreateCmd)
+	_, err := platform.ExecuteChangeCommand(ovsCreateCmd)
 	if err != nil {
 		log.Printf("[ovs] Error while deleting OVS bridge %v", err)
 		return err
@@ -49,7 +50,7 @@ func DeleteOVSBridge(bridgeName string) error {
 
 func AddPortOnOVSBridge(hostIfName string, bridgeName string, vlanID int) error {
 	cmd := fmt.Sprintf("ovs-vsctl add-port %s %s", bridgeName, hostIfName)
-	_, err := platform.ExecuteCommand(cmd)
+	_, err := platform.ExecuteChangeCommand(cmd)
 	if err != nil {
 		log.Printf("[ovs] Error while setting OVS as master to primary interface %v", err)
 		return err
@@ -69,9 +70,20 @@ func GetOVSPortNumber(interfaceName string) (string, error) {
 	return strings.Trim(ofport, "\n"), nil
 }
 
+func GetOVSBridgeForPort(interfaceName string) (string, error) {
+	cmd := fmt.Sprintf("ovs-vsctl port-to-br %s", interfaceName)
+	bridgeName, err := platform.ExecuteCommand(cmd)
+	if err != nil {
+		log.Printf("[ovs] Get bridge for port %v failed with error %v", interfaceName, err)
+		return "", err
+	}
+
+	return strings.Trim(bridgeName, "\n"), nil
+}
+
 func AddVMIpAcceptRule(bridgeName string, primaryIP string, mac string) error {
-	cmd := fmt.Sprintf("ovs-ofctl add-flow %s ip,nw_dst=%s,dl_dst=%s,priority=%d,actions=normal", bridgeName, primaryIP, mac, high)
-	_, err := platform.ExecuteCommand(cmd)
+	flow := fmt.Sprintf("ip,nw_dst=%s,dl_dst=%s,priority=%d,actions=normal", primaryIP, mac, high)
+	err := addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding SNAT rule failed with error %v", err)
 		return err
@@ -81,9 +93,9 @@ func AddVMIpAcceptRule(bridgeName string, primaryIP string, mac string) error {
 }
 
 func AddArpSnatRule(bridgeName string, mac string, macHex string, ofport string) error {
-	cmd := fmt.Sprintf(`ovs-ofctl add-flow %v table=1,priority=%d,arp,arp_op=1,actions='mod_dl_src:%s,
-		load:0x%s->NXM_NX_ARP_SHA[],output:%s'`, bridgeName, low, mac, macHex, ofport)
-	_, err := platform.ExecuteCommand(cmd)
+	flow := fmt.Sprintf("table=1,priority=%d,arp,arp_op=1,actions=mod_dl_src:%s,"+
+		"load:0x%s->NXM_NX_ARP_SHA[],output:%s", low, mac, macHex, ofport)
+	err := addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding ARP SNAT rule failed with error %v", err)
 		return err
@@ -94,31 +106,30 @@ func AddArpSnatRule(bridgeName string, mac string, macHex string, ofport string)
 
 // IP SNAT Rule - Change src mac to VM Mac for packets coming from container host veth port.
 func AddIpSnatRule(bridgeName string, ip net.IP, vlanID int, port string, mac string, outport string) error {
-	var cmd string
+	var flow string
 	if outport == "" {
 		outport = "normal"
 	}
 
-	commonPrefix := fmt.Sprintf("ovs-ofctl add-flow %v priority=%d,ip,nw_src=%s,in_port=%s,vlan_tci=0,actions=mod_dl_src:%s", bridgeName, high, ip.String(), port, mac)
+	commonPrefix := fmt.Sprintf("priority=%d,ip,nw_src=%s,in_port=%s,vlan_tci=0,actions=mod_dl_src:%s", high, ip.String(), port, mac)
 
 	// This rule also checks if packets coming from right source ip based on the ovs port to prevent ip spoofing.
 	// Otherwise it drops the packet.
 	if vlanID != 0 {
-		cmd = fmt.Sprintf("%s,mod_vlan_vid:%v,%v", commonPrefix, vlanID, outport)
+		flow = fmt.Sprintf("%s,mod_vlan_vid:%v,%v", commonPrefix, vlanID, outport)
 	} else {
-		cmd = fmt.Sprintf("%s,strip_vlan,%v", commonPrefix, outport)
+		flow = fmt.Sprintf("%s,strip_vlan,%v", commonPrefix, outport)
 	}
 
-	_, err := platform.ExecuteCommand(cmd)
+	err := addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding IP SNAT rule failed with error %v", err)
 		return err
 	}
 
 	// Drop other packets which doesn't satisfy above condition
-	cmd = fmt.Sprintf("ovs-ofctl add-flow %v priority=%d,ip,in_port=%s,actions=drop",
-		bridgeName, low, port)
-	_, err = platform.ExecuteCommand(cmd)
+	flow = fmt.Sprintf("priority=%d,ip,in_port=%s,actions=drop", low, port)
+	err = addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Dropping vlantag packet rule failed with error %v", err)
 		return err
@@ -129,9 +140,9 @@ func AddIpSnatRule(bridgeName string, ip net.IP, vlanID int, port string, mac st
 
 func AddArpDnatRule(bridgeName string, port string, mac string) error {
 	// Add DNAT rule to forward ARP replies to container interfaces.
-	cmd := fmt.Sprintf(`ovs-ofctl add-flow %s arp,arp_op=2,in_port=%s,actions='mod_dl_dst:ff:ff:ff:ff:ff:ff,
-		load:0x%s->NXM_NX_ARP_THA[],normal'`, bridgeName, port, mac)
-	_, err := platform.ExecuteCommand(cmd)
+	flow := fmt.Sprintf("arp,arp_op=2,in_port=%s,actions=mod_dl_dst:ff:ff:ff:ff:ff:ff,"+
+		"load:0x%s->NXM_NX_ARP_THA[],normal", port, mac)
+	err := addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding DNAT rule failed with error %v", err)
 		return err
@@ -146,12 +157,12 @@ func AddFakeArpReply(bridgeName string, ip net.IP) error {
 	ipAddrInt := common.IpToInt(ip)
 
 	log.Printf("[ovs] Adding ARP reply rule for IP address %v ", ip.String())
-	cmd := fmt.Sprintf(`ovs-ofctl add-flow %s arp,arp_op=1,priority=%d,actions='load:0x2->NXM_OF_ARP_OP[],
-			move:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],mod_dl_src:%s,
-			move:NXM_NX_ARP_SHA[]->NXM_NX_ARP_THA[],move:NXM_OF_ARP_TPA[]->NXM_OF_ARP_SPA[],
-			load:0x%s->NXM_NX_ARP_SHA[],load:0x%x->NXM_OF_ARP_TPA[],IN_PORT'`,
-		bridgeName, high, defaultMacForArpResponse, macAddrHex, ipAddrInt)
-	_, err := platform.ExecuteCommand(cmd)
+	flow := fmt.Sprintf("arp,arp_op=1,priority=%d,actions=load:0x2->NXM_OF_ARP_OP[],"+
+		"move:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],mod_dl_src:%s,"+
+		"move:NXM_NX_ARP_SHA[]->NXM_NX_ARP_THA[],move:NXM_OF_ARP_TPA[]->NXM_OF_ARP_SPA[],"+
+		"load:0x%s->NXM_NX_ARP_SHA[],load:0x%x->NXM_OF_ARP_TPA[],IN_PORT",
+		high, defaultMacForArpResponse, macAddrHex, ipAddrInt)
+	err := addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding ARP reply rule failed with error %v", err)
 		return err
@@ -165,9 +176,8 @@ func AddArpReplyRule(bridgeName string, port string, ip net.IP, mac string, vlan
 	macAddrHex := strings.Replace(mac, ":", "", -1)
 
 	log.Printf("[ovs] Adding ARP reply rule to add vlan %v and forward packet to table 1 for port %v", vlanid, port)
-	cmd := fmt.Sprintf(`ovs-ofctl add-flow %s arp,arp_op=1,in_port=%s,actions='mod_vlan_vid:%v,resubmit(,1)'`,
-		bridgeName, port, vlanid)
-	_, err := platform.ExecuteCommand(cmd)
+	flow := fmt.Sprintf("arp,arp_op=1,in_port=%s,actions=mod_vlan_vid:%v,resubmit(,1)", port, vlanid)
+	err := addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding ARP reply rule failed with error %v", err)
 		return err
@@ -175,12 +185,12 @@ func AddArpReplyRule(bridgeName string, port string, ip net.IP, mac string, vlan
 
 	// If arp fields matches, set arp reply rule for the request
 	log.Printf("[ovs] Adding ARP reply rule for IP address %v and vlanid %v.", ip, vlanid)
-	cmd = fmt.Sprintf(`ovs-ofctl add-flow %s table=1,arp,arp_tpa=%s,dl_vlan=%v,arp_op=1,priority=%d,actions='load:0x2->NXM_OF_ARP_OP[],
-			move:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],mod_dl_src:%s,
-			move:NXM_NX_ARP_SHA[]->NXM_NX_ARP_THA[],move:NXM_OF_ARP_SPA[]->NXM_OF_ARP_TPA[],
-			load:0x%s->NXM_NX_ARP_SHA[],load:0x%x->NXM_OF_ARP_SPA[],strip_vlan,IN_PORT'`,
-		bridgeName, ip.String(), vlanid, high, mac, macAddrHex, ipAddrInt)
-	_, err = platform.ExecuteCommand(cmd)
+	flow = fmt.Sprintf("table=1,arp,arp_tpa=%s,dl_vlan=%v,arp_op=1,priority=%d,actions=load:0x2->NXM_OF_ARP_OP[],"+
+		"move:NXM_OF_ETH_SRC[]->NXM_OF_ETH_DST[],mod_dl_src:%s,"+
+		"move:NXM_NX_ARP_SHA[]->NXM_NX_ARP_THA[],move:NXM_OF_ARP_SPA[]->NXM_OF_ARP_TPA[],"+
+		"load:0x%s->NXM_NX_ARP_SHA[],load:0x%x->NXM_OF_ARP_SPA[],strip_vlan,IN_PORT",
+		ip.String(), vlanid, high, mac, macAddrHex, ipAddrInt)
+	err = addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding ARP reply rule failed with error %v", err)
 		return err
@@ -191,17 +201,17 @@ func AddArpReplyRule(bridgeName string, port string, ip net.IP, mac string, vlan
 
 // Add MAC DNAT rule based on dst ip and vlanid
 func AddMacDnatRule(bridgeName string, port string, ip net.IP, mac string, vlanid int, containerPort string) error {
-	var cmd string
+	var flow string
 	// This rule changes the destination mac to speciifed mac based on the ip and vlanid.
 	// and forwards the packet to corresponding container hostveth port
 
-	commonPrefix := fmt.Sprintf("ovs-ofctl add-flow %s ip,nw_dst=%s,in_port=%s", bridgeName, ip.String(), port)
+	commonPrefix := fmt.Sprintf("ip,nw_dst=%s,in_port=%s", ip.String(), port)
 	if vlanid != 0 {
-		cmd = fmt.Sprintf("%s,dl_vlan=%v,actions=mod_dl_dst:%s,strip_vlan,%s", commonPrefix, vlanid, mac, containerPort)
+		flow = fmt.Sprintf("%s,dl_vlan=%v,actions=mod_dl_dst:%s,strip_vlan,%s", commonPrefix, vlanid, mac, containerPort)
 	} else {
-		cmd = fmt.Sprintf("%s,actions=mod_dl_dst:%s,strip_vlan,%s", commonPrefix, mac, containerPort)
+		flow = fmt.Sprintf("%s,actions=mod_dl_dst:%s,strip_vlan,%s", commonPrefix, mac, containerPort)
 	}
-	_, err := platform.ExecuteCommand(cmd)
+	err := addFlow(bridgeName, flow)
 	if err != nil {
 		log.Printf("[ovs] Adding MAC DNAT rule failed with error %v", err)
 		return err
@@ -211,42 +221,37 @@ func AddMacDnatRule(bridgeName string, port string, ip net.IP, mac string, vlani
 }
 
 func DeleteArpReplyRule(bridgeName string, port string, ip net.IP, vlanid int) {
-	cmd := fmt.Sprintf("ovs-ofctl del-flows %s arp,arp_op=1,in_port=%s",
-		bridgeName, port)
-	_, err := platform.ExecuteCommand(cmd)
+	flow := fmt.Sprintf("arp,arp_op=1,in_port=%s", port)
+	err := deleteFlows(bridgeName, flow)
 	if err != nil {
 		log.Printf("[net] Deleting ARP reply rule failed with error %v", err)
 	}
 
-	cmd = fmt.Sprintf("ovs-ofctl del-flows %s table=1,arp,arp_tpa=%s,dl_vlan=%v,arp_op=1",
-		bridgeName, ip.String(), vlanid)
-	_, err = platform.ExecuteCommand(cmd)
+	flow = fmt.Sprintf("table=1,arp,arp_tpa=%s,dl_vlan=%v,arp_op=1", ip.String(), vlanid)
+	err = deleteFlows(bridgeName, flow)
 	if err != nil {
 		log.Printf("[net] Deleting ARP reply rule failed with error %v", err)
 	}
 }
 
 func DeleteIPSnatRule(bridgeName string, port string) {
-	cmd := fmt.Sprintf("ovs-ofctl del-flows %v ip,in_port=%s",
-		bridgeName, port)
-	_, err := platform.ExecuteCommand(cmd)
+	flow := fmt.Sprintf("ip,in_port=%s", port)
+	err := deleteFlows(bridgeName, flow)
 	if err != nil {
-		log.Printf("Error while deleting ovs rule %v error %v", cmd, err)
+		log.Printf("Error while deleting ovs rule %v error %v", flow, err)
 	}
 }
 
 func DeleteMacDnatRule(bridgeName string, port string, ip net.IP, vlanid int) {
-	var cmd string
+	var flow string
 
 	if vlanid != 0 {
-		cmd = fmt.Sprintf("ovs-ofctl del-flows %s ip,nw_dst=%s,dl_vlan=%v,in_port=%s",
-			bridgeName, ip.String(), vlanid, port)
+		flow = fmt.Sprintf("ip,nw_dst=%s,dl_vlan=%v,in_port=%s", ip.String(), vlanid, port)
 	} else {
-		cmd = fmt.Sprintf("ovs-ofctl del-flows %s ip,nw_dst=%s,in_port=%s",
-			bridgeName, ip.String(), port)
+		flow = fmt.Sprintf("ip,nw_dst=%s,in_port=%s", ip.String(), port)
 	}
 
-	_, err := platform.ExecuteCommand(cmd)
+	err := deleteFlows(bridgeName, flow)
 	if err != nil {
 		log.Printf("[net] Deleting MAC DNAT rule failed with error %v", err)
 	}
@@ -255,7 +260,7 @@ func DeleteMacDnatRule(bridgeName string, port string, ip net.IP, vlanid int) {
 func DeletePortFromOVS(bridgeName string, interfaceName string) error {
 	// Disconnect external interface from its bridge.
 	cmd := fmt.Sprintf("ovs-vsctl del-port %s %s", bridgeName, interfaceName)
-	_, err := platform.ExecuteCommand(cmd)
+	_, err := platform.ExecuteChangeCommand(cmd)
 	if err != nil {
 		log.Printf("[ovs] Failed to disconnect interface %v from bridge, err:%v.", interfaceName, err)
 		return err
@@ -263,3 +268,13 @@ func DeletePortFromOVS(bridgeName string, interfaceName string) error {
 
 	return nil
 }
+
+// Adds a flow to an OVS bridge.
+func addFlow(bridgeName string, flow string) error {
+	return rules.GetBackend().Add(&rules.Rule{Type: rules.OVSFlow, Table: bridgeName, Spec: flow})
+}
+
+// Deletes the flows matching the given match fields from an OVS bridge.
+func deleteFlows(bridgeName string, match string) error {
+	return rules.GetBackend().Delete(&rules.Rule{Type: rules.OVSFlow, Table: bridgeName, Spec: match})
+}
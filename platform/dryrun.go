@@ -0,0 +1,57 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package platform
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	// Writer the changes to the system are printed to in dry-run mode, or nil.
+	dryRunWriter io.Writer
+	dryRunLock   sync.Mutex
+)
+
+// SetDryRun makes changes to the system be printed to w instead of being made.
+// A nil writer turns dry-run mode off.
+func SetDryRun(w io.Writer) {
+	dryRunLock.Lock()
+	defer dryRunLock.Unlock()
+
+	dryRunWriter = w
+}
+
+// IsDryRun returns whether changes to the system are printed instead of being made.
+func IsDryRun() bool {
+	dryRunLock.Lock()
+	defer dryRunLock.Unlock()
+
+	return dryRunWriter != nil
+}
+
+// DryRun prints a change to the system in dry-run mode.
+// Returns true if the change was printed, in which case the caller must not make it.
+func DryRun(format string, args ...interface{}) bool {
+	dryRunLock.Lock()
+	defer dryRunLock.Unlock()
+
+	if dryRunWriter == nil {
+		return false
+	}
+
+	fmt.Fprintf(dryRunWriter, format+"\n", args...)
+	return true
+}
+
+// ExecuteChangeCommand executes a command that changes the system.
+// In dry-run mode, the command is printed instead and no output is returned.
+func ExecuteChangeCommand(command string) (string, error) {
+	if DryRun("%s", command) {
+		return "", nil
+	}
+
+	return ExecuteCommand(command)
+}
@@ -20,7 +20,7 @@ const (
 func GetAddressFamily(address *net.IP) AddressFamily {
 	var family AddressFamily
 
-	if address.To4() == nil {
+	if address.To4() != nil {
 		family = AfINET
 	} else {
 		family = AfINET6
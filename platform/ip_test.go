@@ -0,0 +1,18 @@
+package platform
+
+import (
+	"net"
+	"testing"
+)
+
+func TestGetAddressFamily(t *testing.T) {
+	ipv4 := net.ParseIP("10.0.0.4")
+	if family := GetAddressFamily(&ipv4); family != AfINET {
+		t.Errorf("GetAddressFamily(%v) returned %v, expected %v", ipv4, family, AfINET)
+	}
+
+	ipv6 := net.ParseIP("fd00::4")
+	if family := GetAddressFamily(&ipv6); family != AfINET6 {
+		t.Errorf("GetAddressFamily(%v) returned %v, expected %v", ipv6, family, AfINET6)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package rules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+// Serializes batches, as they replace the rule backend while they run.
+var batchMutex sync.Mutex
+
+// Operation queued in a batch.
+type batchOp struct {
+	add   bool
+	flush bool
+	rule  *Rule
+}
+
+// BatchBackend queues rule changes and programs them together on Commit, in the order they
+// were queued. Consecutive iptables changes are applied with a single iptables-restore, and
+// consecutive OVS flow changes on the same bridge with a single ovs-ofctl add-flows. ebtables
+// has no incremental restore, so ebtables changes are applied one command at a time.
+type BatchBackend struct {
+	exec *ExecBackend
+	ops  []batchOp
+	sync.Mutex
+}
+
+// NewBatchBackend creates a new batch rule backend.
+func NewBatchBackend() *BatchBackend {
+	return &BatchBackend{
+		exec: NewExecBackend(),
+	}
+}
+
+// Add queues a rule or chain to be programmed.
+func (b *BatchBackend) Add(rule *Rule) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ops = append(b.ops, batchOp{add: true, rule: rule})
+	return nil
+}
+
+// Delete queues a rule or chain to be removed.
+func (b *BatchBackend) Delete(rule *Rule) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ops = append(b.ops, batchOp{add: false, rule: rule})
+	return nil
+}
+
+// Flush queues all rules of a chain to be removed.
+func (b *BatchBackend) Flush(chain *Rule) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ops = append(b.ops, batchOp{flush: true, rule: chain})
+	return nil
+}
+
+// Exists returns whether a rule or chain is programmed once the queued changes are committed.
+func (b *BatchBackend) Exists(rule *Rule) (bool, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	for i := len(b.ops) - 1; i >= 0; i-- {
+		op := b.ops[i]
+		if op.flush {
+			// Flushing a chain removes its rules, but not the chain itself.
+			if !rule.IsChain() && rule.Type == op.rule.Type && rule.Table == op.rule.Table && rule.Chain == op.rule.Chain {
+				return false, nil
+			}
+			continue
+		}
+
+		if op.rule.matches(rule) {
+			return op.add, nil
+		}
+	}
+
+	return b.exec.Exists(rule)
+}
+
+// Commit programs the queued changes.
+func (b *BatchBackend) Commit() error {
+	b.Lock()
+	ops := b.ops
+	b.ops = nil
+	b.Unlock()
+
+	for _, step := range getBatchSteps(ops) {
+		var err error
+
+		switch step.ruleType {
+		case Iptables:
+			err = runWithInput(fmt.Sprintf("iptables-restore -w %d --noflush", lockTimeout), step.input)
+		case OVSFlow:
+			err = runWithInput(fmt.Sprintf("ovs-ofctl add-flows %s", step.table), step.input)
+		case Ebtables:
+			switch {
+			case step.op.flush:
+				err = b.exec.Flush(step.op.rule)
+			case step.op.add:
+				err = b.exec.Add(step.op.rule)
+			default:
+				err = b.exec.Delete(step.op.rule)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Batch runs fn with the rule changes it makes queued, and programs them together once fn succeeds.
+// The queued changes are discarded if fn fails. Rules are programmed directly by fn if the rule
+// backend does not run commands, such as when rules are recorded.
+func Batch(fn func() error) error {
+	batchMutex.Lock()
+	defer batchMutex.Unlock()
+
+	base := GetBackend()
+	exec, ok := base.(*ExecBackend)
+	if !ok {
+		return fn()
+	}
+
+	b := &BatchBackend{exec: exec}
+	SetBackend(b)
+	err := fn()
+	SetBackend(base)
+
+	if err != nil {
+		log.Printf("[rules] Discarding batched rule changes, err:%v.", err)
+		return err
+	}
+
+	return b.Commit()
+}
+
+// batchStep programs consecutive queued operations with a single command.
+type batchStep struct {
+	ruleType string
+	table    string
+	input    []byte
+	op       batchOp
+}
+
+// Returns the steps programming the given operations in order. Consecutive iptables operations
+// are merged into one iptables-restore input, with one section per run of operations on the same
+// table, and consecutive OVS operations on the same bridge into one ovs-ofctl add-flows input.
+// Each ebtables operation is a step of its own.
+func getBatchSteps(ops []batchOp) []*batchStep {
+	var steps []*batchStep
+	var step *batchStep
+	var table string
+
+	for _, op := range ops {
+		var args []string
+		switch {
+		case op.flush:
+			args = getFlushArgs(op.rule)
+		case op.add:
+			args = getAddArgs(op.rule)
+		default:
+			args = getDeleteArgs(op.rule)
+		}
+
+		switch op.rule.Type {
+		case Iptables:
+			if step == nil || step.ruleType != Iptables {
+				step = &batchStep{ruleType: Iptables}
+				steps = append(steps, step)
+				table = ""
+			}
+
+			if op.rule.Table != table {
+				if table != "" {
+					step.input = append(step.input, "COMMIT\n"...)
+				}
+				table = op.rule.Table
+				step.input = append(step.input, fmt.Sprintf("*%s\n", table)...)
+			}
+
+			for _, arg := range args {
+				step.input = append(step.input, fmt.Sprintf("%s\n", arg)...)
+			}
+
+		case OVSFlow:
+			if step == nil || step.ruleType != OVSFlow || step.table != op.rule.Table {
+				step = &batchStep{ruleType: OVSFlow, table: op.rule.Table}
+				steps = append(steps, step)
+			}
+
+			command := "add"
+			if !op.add {
+				command = "delete"
+			}
+			for _, arg := range args {
+				step.input = append(step.input, fmt.Sprintf("%s %s\n", command, arg)...)
+			}
+
+		default:
+			step = &batchStep{ruleType: op.rule.Type, table: op.rule.Table, op: op}
+			steps = append(steps, step)
+		}
+	}
+
+	// Close the iptables-restore inputs.
+	for _, step := range steps {
+		if step.ruleType == Iptables {
+			step.input = append(step.input, "COMMIT\n"...)
+		}
+	}
+
+	return steps
+}
+
+// Runs a command reading its input from a temporary file.
+func runWithInput(cmd string, input []byte) error {
+	f, err := ioutil.TempFile("", "azure-rules")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(input)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("[rules] %s input:\n%s", cmd, input)
+
+	_, err = platform.ExecuteCommand(fmt.Sprintf("%s < %s", cmd, f.Name()))
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+// ExecBackend programs rules by running one command per rule.
+type ExecBackend struct{}
+
+// NewExecBackend creates a new exec rule backend.
+func NewExecBackend() *ExecBackend {
+	return &ExecBackend{}
+}
+
+// Add programs a rule, or creates a chain.
+func (b *ExecBackend) Add(rule *Rule) error {
+	return b.run(getAddCommands(rule))
+}
+
+// Delete removes a rule, or flushes and deletes a chain.
+func (b *ExecBackend) Delete(rule *Rule) error {
+	return b.run(getDeleteCommands(rule))
+}
+
+// Flush removes all rules of a chain.
+func (b *ExecBackend) Flush(chain *Rule) error {
+	return b.run(getFlushCommands(chain))
+}
+
+// Exists returns whether a rule or chain is programmed.
+func (b *ExecBackend) Exists(rule *Rule) (bool, error) {
+	switch {
+	case rule.IsChain():
+		// Listing a chain fails if it does not exist.
+		_, err := platform.ExecuteCommand(getCommand(rule, "", fmt.Sprintf("-L %s", rule.Chain)))
+		return err == nil, nil
+
+	case rule.Type == Iptables:
+		// Checking a rule fails if it does not exist.
+		_, err := platform.ExecuteCommand(getCommand(rule, "", fmt.Sprintf("-C %s %s", rule.Chain, rule.Spec)))
+		return err == nil, nil
+
+	case rule.Type == Ebtables:
+		// Not all ebtables versions can check a rule, so look for it in the chain listing.
+		out, err := platform.ExecuteCommand(getCommand(rule, "", fmt.Sprintf("-L %s --Lmac2", rule.Chain)))
+		if err != nil {
+			return false, err
+		}
+		return strings.Contains(out, strings.Join(strings.Fields(rule.Spec), " ")), nil
+
+	default:
+		out, err := platform.ExecuteCommand(getCommand(rule, "dump-flows", rule.Spec))
+		if err != nil {
+			return false, err
+		}
+		return strings.Contains(out, "actions="), nil
+	}
+}
+
+// Runs the given commands in order, stopping at the first failure.
+func (b *ExecBackend) run(cmds []string) error {
+	for _, cmd := range cmds {
+		if _, err := platform.ExecuteCommand(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package rules
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// RecordingBackend records rule changes without programming them.
+// It tracks the programmed rules in memory, and optionally prints the commands that would
+// have programmed them. It is used by unit tests and to print the rules azure-vnet would program.
+type RecordingBackend struct {
+	w        io.Writer
+	rules    []*Rule
+	commands []string
+	sync.Mutex
+}
+
+// NewRecordingBackend creates a new recording rule backend.
+// The commands that would program the rules are printed to w, unless it is nil.
+func NewRecordingBackend(w io.Writer) *RecordingBackend {
+	return &RecordingBackend{w: w}
+}
+
+// Add records a rule or chain as programmed.
+func (b *RecordingBackend) Add(rule *Rule) error {
+	b.Lock()
+	defer b.Unlock()
+
+	r := *rule
+	i := b.getInsertIndex(&r)
+	b.rules = append(b.rules[:i], append([]*Rule{&r}, b.rules[i:]...)...)
+
+	b.record(getAddCommands(rule))
+	return nil
+}
+
+// Delete records a rule or chain as removed.
+func (b *RecordingBackend) Delete(rule *Rule) error {
+	b.Lock()
+	defer b.Unlock()
+
+	var rules []*Rule
+	deleted := false
+
+	for _, r := range b.rules {
+		switch {
+		case rule.IsChain() && r.Type == rule.Type && r.Table == rule.Table && r.Chain == rule.Chain:
+			// Deleting a chain flushes it.
+		case rule.Type == OVSFlow && r.matches(rule):
+			// Deleting flows removes all flows matching the given fields.
+		case !deleted && r.equals(rule):
+			// Deleting a rule removes its first occurrence.
+			deleted = true
+		default:
+			rules = append(rules, r)
+		}
+	}
+
+	b.rules = rules
+
+	b.record(getDeleteCommands(rule))
+	return nil
+}
+
+// Flush records all rules of a chain as removed.
+func (b *RecordingBackend) Flush(chain *Rule) error {
+	b.Lock()
+	defer b.Unlock()
+
+	var rules []*Rule
+	for _, r := range b.rules {
+		if r.IsChain() || r.Type != chain.Type || r.Table != chain.Table || r.Chain != chain.Chain {
+			rules = append(rules, r)
+		}
+	}
+
+	b.rules = rules
+
+	b.record(getFlushCommands(chain))
+	return nil
+}
+
+// Exists returns whether a rule or chain is recorded as programmed.
+func (b *RecordingBackend) Exists(rule *Rule) (bool, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, r := range b.rules {
+		if r.matches(rule) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Rules returns the rules and chains recorded as programmed.
+func (b *RecordingBackend) Rules() []*Rule {
+	b.Lock()
+	defer b.Unlock()
+
+	rules := make([]*Rule, len(b.rules))
+	copy(rules, b.rules)
+	return rules
+}
+
+// Commands returns the commands that would have been run, in order.
+func (b *RecordingBackend) Commands() []string {
+	b.Lock()
+	defer b.Unlock()
+
+	commands := make([]string, len(b.commands))
+	copy(commands, b.commands)
+	return commands
+}
+
+// Returns the index at which a rule is inserted, which is before the rule at its position in its chain.
+func (b *RecordingBackend) getInsertIndex(rule *Rule) int {
+	if rule.Position > 0 {
+		position := 0
+		for i, r := range b.rules {
+			if r.Type == rule.Type && r.Table == rule.Table && r.Chain == rule.Chain && !r.IsChain() {
+				position++
+				if position == rule.Position {
+					return i
+				}
+			}
+		}
+	}
+
+	return len(b.rules)
+}
+
+// Records and prints commands.
+func (b *RecordingBackend) record(cmds []string) {
+	b.commands = append(b.commands, cmds...)
+
+	if b.w != nil {
+		for _, cmd := range cmds {
+			fmt.Fprintln(b.w, cmd)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Rule types.
+const (
+	Iptables = "iptables"
+	Ebtables = "ebtables"
+	OVSFlow  = "ovs-flow"
+)
+
+const (
+	// Seconds to wait for the xtables lock.
+	lockTimeout = 60
+)
+
+// Rule represents an iptables or ebtables rule, or an OVS flow.
+//
+// For iptables and ebtables rules, Spec is the match and target of the rule in chain Chain
+// of table Table. A rule with an empty Spec represents the chain itself. Rules are appended
+// to their chain, or inserted at Position if it is set.
+//
+// For OVS flows, Table is the bridge name and Spec is the flow. Delete and Exists take a Spec
+// with only the match fields of the flow.
+type Rule struct {
+	Type     string
+	Table    string
+	Chain    string
+	Spec     string
+	Position int
+}
+
+// RuleBackend programs rules.
+type RuleBackend interface {
+	// Add programs a rule, or creates a chain.
+	Add(rule *Rule) error
+	// Delete removes a rule, or flushes and deletes a chain.
+	Delete(rule *Rule) error
+	// Flush removes all rules of a chain, keeping the chain.
+	Flush(chain *Rule) error
+	// Exists returns whether a rule or chain is programmed.
+	Exists(rule *Rule) (bool, error)
+}
+
+// Backend used by the rule programming packages.
+var backend RuleBackend = NewExecBackend()
+var m sync.Mutex
+
+// GetBackend returns the rule backend used by the rule programming packages.
+func GetBackend() RuleBackend {
+	m.Lock()
+	defer m.Unlock()
+
+	return backend
+}
+
+// SetBackend sets the rule backend used by the rule programming packages.
+func SetBackend(b RuleBackend) {
+	m.Lock()
+	defer m.Unlock()
+
+	backend = b
+}
+
+// NewIptablesRule creates an iptables rule jumping to the given target.
+func NewIptablesRule(table, chain, match, target string) *Rule {
+	return &Rule{
+		Type:  Iptables,
+		Table: table,
+		Chain: chain,
+		Spec:  strings.TrimSpace(fmt.Sprintf("%s -j %s", match, target)),
+	}
+}
+
+// NewChain creates a rule representing an iptables or ebtables chain.
+func NewChain(ruleType, table, chain string) *Rule {
+	return &Rule{
+		Type:  ruleType,
+		Table: table,
+		Chain: chain,
+	}
+}
+
+// IsChain returns whether the rule represents a chain.
+func (rule *Rule) IsChain() bool {
+	return rule.Type != OVSFlow && rule.Spec == ""
+}
+
+// String returns the command programming the rule.
+func (rule *Rule) String() string {
+	return strings.Join(getAddCommands(rule), "; ")
+}
+
+// Returns whether two rules are the same, ignoring differences in whitespace and position.
+func (rule *Rule) equals(other *Rule) bool {
+	return rule.Type == other.Type &&
+		rule.Table == other.Table &&
+		rule.Chain == other.Chain &&
+		strings.Join(strings.Fields(rule.Spec), " ") == strings.Join(strings.Fields(other.Spec), " ")
+}
+
+// Returns whether a programmed rule is matched by the given rule.
+// OVS flows are matched by a subset of their match fields, the same way they are deleted.
+func (rule *Rule) matches(match *Rule) bool {
+	if rule.Type != OVSFlow || match.Type != OVSFlow {
+		return rule.equals(match)
+	}
+
+	if rule.Table != match.Table {
+		return false
+	}
+
+	fields := make(map[string]bool)
+	for _, field := range strings.Split(getFlowMatch(rule.Spec), ",") {
+		fields[strings.TrimSpace(field)] = true
+	}
+
+	for _, field := range strings.Split(getFlowMatch(match.Spec), ",") {
+		if field = strings.TrimSpace(field); field != "" && !fields[field] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the match fields of an OVS flow.
+func getFlowMatch(flow string) string {
+	if i := strings.Index(flow, "actions="); i >= 0 {
+		return flow[:i]
+	}
+
+	return flow
+}
+
+// Returns the arguments of the commands adding a rule, relative to its table or bridge.
+func getAddArgs(rule *Rule) []string {
+	switch {
+	case rule.Type == OVSFlow:
+		return []string{rule.Spec}
+	case rule.IsChain():
+		return []string{fmt.Sprintf("-N %s", rule.Chain)}
+	case rule.Position > 0:
+		return []string{fmt.Sprintf("-I %s %d %s", rule.Chain, rule.Position, rule.Spec)}
+	default:
+		return []string{fmt.Sprintf("-A %s %s", rule.Chain, rule.Spec)}
+	}
+}
+
+// Returns the arguments of the commands deleting a rule, relative to its table or bridge.
+func getDeleteArgs(rule *Rule) []string {
+	switch {
+	case rule.Type == OVSFlow:
+		return []string{rule.Spec}
+	case rule.IsChain():
+		return []string{fmt.Sprintf("-F %s", rule.Chain), fmt.Sprintf("-X %s", rule.Chain)}
+	default:
+		return []string{fmt.Sprintf("-D %s %s", rule.Chain, rule.Spec)}
+	}
+}
+
+// Returns the arguments of the command flushing a chain, relative to its table.
+func getFlushArgs(chain *Rule) []string {
+	return []string{fmt.Sprintf("-F %s", chain.Chain)}
+}
+
+// Returns the commands adding a rule.
+func getAddCommands(rule *Rule) []string {
+	var cmds []string
+	for _, args := range getAddArgs(rule) {
+		cmds = append(cmds, getCommand(rule, "add-flow", args))
+	}
+
+	return cmds
+}
+
+// Returns the commands deleting a rule.
+func getDeleteCommands(rule *Rule) []string {
+	var cmds []string
+	for _, args := range getDeleteArgs(rule) {
+		cmds = append(cmds, getCommand(rule, "del-flows", args))
+	}
+
+	return cmds
+}
+
+// Returns the commands flushing a chain.
+func getFlushCommands(chain *Rule) []string {
+	return []string{getCommand(chain, "", getFlushArgs(chain)[0])}
+}
+
+// Returns the command running the given arguments on the table or bridge of a rule.
+func getCommand(rule *Rule, ovsCommand string, args string) string {
+	switch rule.Type {
+	case Iptables:
+		return fmt.Sprintf("iptables -w %d -t %s %s", lockTimeout, rule.Table, args)
+	case Ebtables:
+		return fmt.Sprintf("ebtables -t %s %s", rule.Table, args)
+	default:
+		return fmt.Sprintf("ovs-ofctl %s %s '%s'", ovsCommand, rule.Table, args)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package rules
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestGetCommands(t *testing.T) {
+	rule := NewIptablesRule("nat", "POSTROUTING", "-s 10.0.0.0/8", "MASQUERADE")
+	expected := []string{"iptables -w 60 -t nat -A POSTROUTING -s 10.0.0.0/8 -j MASQUERADE"}
+	if cmds := getAddCommands(rule); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("Expected %v, got %v", expected, cmds)
+	}
+
+	rule.Position = 1
+	expected = []string{"iptables -w 60 -t nat -I POSTROUTING 1 -s 10.0.0.0/8 -j MASQUERADE"}
+	if cmds := getAddCommands(rule); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("Expected %v, got %v", expected, cmds)
+	}
+
+	chain := NewChain(Ebtables, "nat", "TEST")
+	expected = []string{"ebtables -t nat -F TEST", "ebtables -t nat -X TEST"}
+	if cmds := getDeleteCommands(chain); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("Expected %v, got %v", expected, cmds)
+	}
+
+	expected = []string{"ebtables -t nat -F TEST"}
+	if cmds := getFlushCommands(chain); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("Expected %v, got %v", expected, cmds)
+	}
+
+	flow := &Rule{Type: OVSFlow, Table: "br0", Spec: "ip,in_port=2"}
+	expected = []string{"ovs-ofctl del-flows br0 'ip,in_port=2'"}
+	if cmds := getDeleteCommands(flow); !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("Expected %v, got %v", expected, cmds)
+	}
+}
+
+func TestGetBatchSteps(t *testing.T) {
+	ops := []batchOp{
+		{add: true, rule: NewChain(Iptables, "nat", "TEST")},
+		{add: true, rule: NewIptablesRule("filter", "FORWARD", "", "ACCEPT")},
+		{add: true, rule: NewIptablesRule("nat", "TEST", "-p tcp --dport 80", "ACCEPT")},
+		{add: false, rule: NewIptablesRule("nat", "PREROUTING", "", "TEST")},
+		{add: true, rule: &Rule{Type: Ebtables, Table: "nat", Chain: "PREROUTING", Spec: "-p 802_1Q -j DROP"}},
+		{add: true, rule: &Rule{Type: OVSFlow, Table: "br0", Spec: "ip,in_port=2,actions=normal"}},
+		{add: false, rule: &Rule{Type: OVSFlow, Table: "br0", Spec: "ip,in_port=3"}},
+		{add: true, rule: &Rule{Type: OVSFlow, Table: "br1", Spec: "ip,in_port=4,actions=normal"}},
+		{flush: true, rule: NewChain(Iptables, "nat", "TEST")},
+		{add: false, rule: NewChain(Iptables, "nat", "TEST")},
+	}
+
+	// Operations are programmed in the order they were queued.
+	expected := []batchStep{
+		{
+			ruleType: Iptables,
+			input: []byte("*nat\n" +
+				"-N TEST\n" +
+				"COMMIT\n" +
+				"*filter\n" +
+				"-A FORWARD -j ACCEPT\n" +
+				"COMMIT\n" +
+				"*nat\n" +
+				"-A TEST -p tcp --dport 80 -j ACCEPT\n" +
+				"-D PREROUTING -j TEST\n" +
+				"COMMIT\n"),
+		},
+		{ruleType: Ebtables, table: "nat", op: ops[4]},
+		{ruleType: OVSFlow, table: "br0", input: []byte("add ip,in_port=2,actions=normal\ndelete ip,in_port=3\n")},
+		{ruleType: OVSFlow, table: "br1", input: []byte("add ip,in_port=4,actions=normal\n")},
+		{ruleType: Iptables, input: []byte("*nat\n-F TEST\n-F TEST\n-X TEST\nCOMMIT\n")},
+	}
+
+	steps := getBatchSteps(ops)
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d", len(expected), len(steps))
+	}
+
+	for i, step := range steps {
+		if !reflect.DeepEqual(*step, expected[i]) {
+			t.Errorf("Expected step %d %+v with input %q, got %+v with input %q", i, expected[i], expected[i].input, *step, step.input)
+		}
+	}
+}
+
+func TestRecordingBackend(t *testing.T) {
+	var out bytes.Buffer
+	b := NewRecordingBackend(&out)
+
+	chain := NewChain(Iptables, "nat", "TEST")
+	first := NewIptablesRule("nat", "TEST", "-p tcp", "ACCEPT")
+	second := NewIptablesRule("nat", "TEST", "-p udp", "ACCEPT")
+	second.Position = 1
+
+	for _, rule := range []*Rule{chain, first, second} {
+		if err := b.Add(rule); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	// Inserted rules go before the existing rules of their chain.
+	rules := b.Rules()
+	if len(rules) != 3 || !rules[1].equals(second) || !rules[2].equals(first) {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+
+	if exists, _ := b.Exists(NewIptablesRule("nat", "TEST", " -p  tcp", "ACCEPT")); !exists {
+		t.Errorf("Rule with different whitespace not found")
+	}
+
+	// Flushing a chain removes its rules and keeps the chain.
+	if err := b.Flush(chain); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if rules := b.Rules(); len(rules) != 1 || !rules[0].IsChain() {
+		t.Errorf("Expected only the chain after flushing it, got %+v", rules)
+	}
+
+	b.Add(first)
+
+	// Deleting a chain flushes it.
+	if err := b.Delete(chain); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if rules := b.Rules(); len(rules) != 0 {
+		t.Errorf("Expected no rules after deleting the chain, got %+v", rules)
+	}
+
+	flow := &Rule{Type: OVSFlow, Table: "br0", Spec: "priority=20,ip,in_port=2,actions=normal"}
+	b.Add(flow)
+
+	if exists, _ := b.Exists(&Rule{Type: OVSFlow, Table: "br0", Spec: "ip,in_port=2"}); !exists {
+		t.Errorf("Flow not found by its match fields")
+	}
+
+	b.Delete(&Rule{Type: OVSFlow, Table: "br0", Spec: "ip,in_port=2"})
+	if rules := b.Rules(); len(rules) != 0 {
+		t.Errorf("Expected no flows after deleting them, got %+v", rules)
+	}
+
+	commands := b.Commands()
+	if len(commands) != 9 || out.String() != joinLines(commands) {
+		t.Errorf("Unexpected commands %v, printed %q", commands, out.String())
+	}
+}
+
+func joinLines(lines []string) string {
+	var s string
+	for _, line := range lines {
+		s += line + "\n"
+	}
+	return s
+}
+
+func TestBatch(t *testing.T) {
+	b := NewRecordingBackend(nil)
+	SetBackend(b)
+	defer SetBackend(NewExecBackend())
+
+	// Recorded rules are not batched.
+	err := Batch(func() error {
+		return GetBackend().Add(NewIptablesRule("nat", "TEST", "-p tcp", "ACCEPT"))
+	})
+	if err != nil || GetBackend() != b || len(b.Rules()) != 1 {
+		t.Errorf("Unexpected batch result %v, rules %+v", err, b.Rules())
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// dryRunStore is an implementation of KeyValueStore that reads from another store,
+// and keeps the values written to it in memory instead of persisting them.
+type dryRunStore struct {
+	KeyValueStore
+	data map[string]*json.RawMessage
+	lock sync.Mutex
+}
+
+// NewDryRunStore creates a new dryRunStore object reading from the given store, accessed as a KeyValueStore.
+// Locking the store locks the given store.
+func NewDryRunStore(kvs KeyValueStore) KeyValueStore {
+	return &dryRunStore{
+		KeyValueStore: kvs,
+		data:          make(map[string]*json.RawMessage),
+	}
+}
+
+// Read restores the value last written for the given key, or else reads it from the underlying store.
+func (kvs *dryRunStore) Read(key string, value interface{}) error {
+	kvs.lock.Lock()
+	raw, ok := kvs.data[key]
+	kvs.lock.Unlock()
+
+	if !ok {
+		return kvs.KeyValueStore.Read(key, value)
+	}
+
+	return json.Unmarshal(*raw, value)
+}
+
+// Write saves the given key value pair in memory.
+func (kvs *dryRunStore) Write(key string, value interface{}) error {
+	var raw json.RawMessage
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	kvs.lock.Lock()
+	defer kvs.lock.Unlock()
+
+	kvs.data[key] = &raw
+
+	return nil
+}
+
+// Flush does nothing, since the values written are not persisted.
+func (kvs *dryRunStore) Flush() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Tests that values written to a dry-run store are read back, and not persisted.
+func TestDryRunStoreDoesNotPersistWrites(t *testing.T) {
+	var encodedPair = `{"key1":{"Field1":"test","Field2":42}}`
+
+	if err := ioutil.WriteFile(testFileName, []byte(encodedPair), 0644); err != nil {
+		t.Fatalf("Failed to write to file %v", err)
+	}
+	defer os.Remove(testFileName)
+
+	fileStore, err := NewJsonFileStore(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	kvs := NewDryRunStore(fileStore)
+
+	// Values not written are read from the underlying store.
+	var value testType1
+	if err := kvs.Read(testKey1, &value); err != nil || value != (testType1{"test", 42}) {
+		t.Fatalf("Read returned %+v, err:%v", value, err)
+	}
+
+	written := testType1{"dry-run", 7}
+	if err := kvs.Write(testKey1, &written); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if err := kvs.Write(testKey2, &written); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if err := kvs.Flush(); err != nil {
+		t.Fatalf("Failed to flush store %v", err)
+	}
+
+	// Values written are read back.
+	if err := kvs.Read(testKey1, &value); err != nil || value != written {
+		t.Fatalf("Read returned %+v, err:%v", value, err)
+	}
+
+	// The file is not changed.
+	contents, err := ioutil.ReadFile(testFileName)
+	if err != nil {
+		t.Fatalf("Failed to read file %v", err)
+	}
+
+	if string(contents) != encodedPair {
+		t.Errorf("File was changed to %s", contents)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Extension added to the file name for temporary files.
+	tmpExtension = ".tmp"
+)
+
+// writeFileAtomic replaces the contents of the given file without exposing partial writes.
+// The data is written to a temporary file that is synced to disk and then renamed over the target,
+// so a crash leaves either the old or the new contents in place.
+func writeFileAtomic(fileName string, buf []byte) error {
+	tmpName := fileName + tmpExtension
+
+	file, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(buf); err != nil {
+		file.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err = os.Rename(tmpName, fileName); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	syncDir(filepath.Dir(fileName))
+
+	return nil
+}
+
+// syncDir commits the directory entry of a renamed file to disk.
+// Not all platforms support syncing directories, so errors are ignored.
+func syncDir(dirName string) {
+	dir, err := os.Open(dirName)
+	if err != nil {
+		return
+	}
+
+	dir.Sync()
+	dir.Close()
+}
@@ -0,0 +1,434 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+const (
+	// Extension added to the file name for the journal.
+	journalExtension = ".journal"
+
+	// The journal is compacted into the snapshot once it is larger than journalCompactRatio times
+	// the snapshot, and at least journalMinCompactSize bytes, so that compaction cost stays
+	// proportional to the data written whatever the size of the state.
+	journalCompactRatio   = 4
+	journalMinCompactSize = 64 * 1024
+
+	// Maximum size of a single journal record.
+	journalMaxRecordSize = 64 * 1024 * 1024
+)
+
+// journalRecord is a single entry in the journal. A record holds either the whole value of
+// a key or a patch to apply to the previous value.
+type journalRecord struct {
+	Key   string           `json:"key"`
+	Value *json.RawMessage `json:"value,omitempty"`
+	Patch *json.RawMessage `json:"patch,omitempty"`
+}
+
+// journalFileStore is an implementation of KeyValueStore using an append-only journal.
+// Writes append one record to the journal instead of rewriting the whole store. Since callers
+// keep their whole state under a single key, a record only holds the members of the value that
+// changed since the previous write. The journal is periodically compacted into a snapshot file,
+// which has the same format as a jsonFileStore.
+type journalFileStore struct {
+	*jsonFileStore
+	journalName  string
+	journalSize  int64
+	snapshotSize int64
+	torn         bool
+}
+
+// NewJournalFileStore creates a new journalFileStore object, accessed as a KeyValueStore.
+func NewJournalFileStore(fileName string) (KeyValueStore, error) {
+	if fileName == "" {
+		fileName = defaultFileName
+	}
+
+	kvs := &journalFileStore{
+		jsonFileStore: &jsonFileStore{
+			fileName: fileName,
+			data:     make(map[string]*json.RawMessage),
+		},
+		journalName: fileName + journalExtension,
+	}
+
+	return kvs, nil
+}
+
+// Read restores the value for the given key from persistent store.
+func (kvs *journalFileStore) Read(key string, value interface{}) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if err := kvs.load(); err != nil {
+		return err
+	}
+
+	raw, ok := kvs.data[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	return json.Unmarshal(*raw, value)
+}
+
+// Write saves the given key value pair to persistent store.
+func (kvs *journalFileStore) Write(key string, value interface{}) error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if err := kvs.load(); err != nil {
+		return err
+	}
+
+	var raw json.RawMessage
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	record := &journalRecord{Key: key, Value: &raw}
+	if old, ok := kvs.data[key]; ok {
+		patch, ok, err := makePatch(*old, raw)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			if patch == nil {
+				// The value did not change.
+				return nil
+			}
+
+			record = &journalRecord{Key: key, Patch: &patch}
+		}
+	}
+
+	kvs.data[key] = &raw
+
+	if kvs.needsCompaction() {
+		return kvs.compact()
+	}
+
+	return kvs.append(record)
+}
+
+// Flush commits in-memory state to persistent store.
+func (kvs *journalFileStore) Flush() error {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	if err := kvs.load(); err != nil {
+		return err
+	}
+
+	return kvs.compact()
+}
+
+// GetModificationTime returns the modification time of the persistent store.
+func (kvs *journalFileStore) GetModificationTime() (time.Time, error) {
+	kvs.Mutex.Lock()
+	defer kvs.Mutex.Unlock()
+
+	var modTime time.Time
+	var err error
+
+	for _, fileName := range []string{kvs.fileName, kvs.journalName} {
+		info, statErr := os.Stat(fileName)
+		if statErr != nil {
+			err = statErr
+			continue
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	if modTime.IsZero() {
+		log.Printf("os.stat() for store %v failed: %v", kvs.fileName, err)
+		return time.Time{}.UTC(), err
+	}
+
+	return modTime.UTC(), nil
+}
+
+// load reads the snapshot and replays the journal on top of it if memory is not in sync.
+func (kvs *journalFileStore) load() error {
+	if kvs.inSync {
+		return nil
+	}
+
+	kvs.data = make(map[string]*json.RawMessage)
+	kvs.journalSize = 0
+	kvs.snapshotSize = 0
+	kvs.torn = false
+
+	// Read the snapshot if it exists.
+	file, err := os.Open(kvs.fileName)
+	if err == nil {
+		if info, statErr := file.Stat(); statErr == nil {
+			kvs.snapshotSize = info.Size()
+		}
+
+		err = json.NewDecoder(file).Decode(&kvs.data)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Replay the journal if it exists.
+	file, err = os.Open(kvs.journalName)
+	if err == nil {
+		defer file.Close()
+
+		if info, statErr := file.Stat(); statErr == nil {
+			kvs.journalSize = info.Size()
+		}
+
+		// Values are kept decoded while patches are applied, and encoded once replay is complete.
+		patched := make(map[string]interface{})
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, journalMaxRecordSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var record journalRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				// Torn records are left behind by a crash during append and were never acknowledged.
+				log.Printf("[store] Ignoring corrupt record in journal %v: %v.", kvs.journalName, err)
+				// Force compaction on the next write so new records are not appended to a torn line.
+				kvs.torn = true
+				continue
+			}
+
+			if record.Patch == nil {
+				kvs.data[record.Key] = record.Value
+				delete(patched, record.Key)
+				continue
+			}
+
+			target, ok := patched[record.Key]
+			if !ok {
+				if raw := kvs.data[record.Key]; raw != nil {
+					if target, err = decodeJSON(*raw); err != nil {
+						return err
+					}
+				}
+			}
+
+			patch, err := decodeJSON(*record.Patch)
+			if err != nil {
+				return err
+			}
+
+			patched[record.Key] = applyPatch(target, patch)
+		}
+
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+
+		for key, value := range patched {
+			var raw json.RawMessage
+			if raw, err = json.Marshal(value); err != nil {
+				return err
+			}
+
+			kvs.data[key] = &raw
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	kvs.inSync = true
+
+	return nil
+}
+
+// append adds a record to the end of the journal and syncs it to disk.
+func (kvs *journalFileStore) append(record *journalRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	buf = append(buf, '\n')
+
+	file, err := os.OpenFile(kvs.journalName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Write(buf); err != nil {
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		return err
+	}
+
+	kvs.journalSize += int64(len(buf))
+
+	return nil
+}
+
+// needsCompaction returns whether the journal should be compacted into the snapshot.
+func (kvs *journalFileStore) needsCompaction() bool {
+	limit := kvs.snapshotSize * journalCompactRatio
+	if limit < journalMinCompactSize {
+		limit = journalMinCompactSize
+	}
+
+	return kvs.torn || kvs.journalSize > limit
+}
+
+// compact writes the in-memory state to the snapshot and truncates the journal.
+// Replaying records already contained in the snapshot is harmless, so a crash between
+// the two steps does not lose data.
+func (kvs *journalFileStore) compact() error {
+	if err := kvs.flush(); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(kvs.fileName); err == nil {
+		kvs.snapshotSize = info.Size()
+	}
+
+	if err := os.Remove(kvs.journalName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	kvs.journalSize = 0
+	kvs.torn = false
+
+	return nil
+}
+
+// makePatch returns a patch that turns the JSON object from into the JSON object to. The patch
+// holds the members that were added or changed, recursing into members that are objects in both,
+// and null for members that were removed. Returns a nil patch if the objects are equal, and false
+// if the change cannot be expressed as a patch.
+func makePatch(from json.RawMessage, to json.RawMessage) (json.RawMessage, bool, error) {
+	fromValue, err := decodeJSON(from)
+	if err != nil {
+		return nil, false, err
+	}
+
+	toValue, err := decodeJSON(to)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fromObject, ok1 := fromValue.(map[string]interface{})
+	toObject, ok2 := toValue.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return nil, false, nil
+	}
+
+	patch, ok := diffObjects(fromObject, toObject)
+	if !ok {
+		return nil, false, nil
+	}
+
+	if len(patch) == 0 {
+		return nil, true, nil
+	}
+
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return raw, true, nil
+}
+
+// diffObjects returns the patch between two decoded JSON objects. Returns false if a member
+// changed to null, since null marks removed members in patches.
+func diffObjects(from map[string]interface{}, to map[string]interface{}) (map[string]interface{}, bool) {
+	patch := make(map[string]interface{})
+
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			patch[name] = nil
+		}
+	}
+
+	for name, toValue := range to {
+		fromValue, ok := from[name]
+		if ok && reflect.DeepEqual(fromValue, toValue) {
+			continue
+		}
+
+		if toValue == nil {
+			return nil, false
+		}
+
+		fromObject, ok1 := fromValue.(map[string]interface{})
+		toObject, ok2 := toValue.(map[string]interface{})
+		if ok1 && ok2 {
+			subPatch, ok := diffObjects(fromObject, toObject)
+			if !ok {
+				return nil, false
+			}
+
+			patch[name] = subPatch
+			continue
+		}
+
+		patch[name] = toValue
+	}
+
+	return patch, true
+}
+
+// applyPatch applies a patch created by diffObjects to a decoded JSON value.
+func applyPatch(target interface{}, patch interface{}) interface{} {
+	targetObject, ok1 := target.(map[string]interface{})
+	patchObject, ok2 := patch.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return patch
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = applyPatch(targetObject[name], value)
+		}
+	}
+
+	return targetObject
+}
+
+// decodeJSON decodes a JSON document without losing the precision of numbers.
+func decodeJSON(raw json.RawMessage) (interface{}, error) {
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
@@ -0,0 +1,269 @@
+// Copyright 2017 Microsoft. All rights reserved.
+// MIT License
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	// File name used for test journal store.
+	testJournalFileName = "test-journal.json"
+)
+
+// Removes the files backing the test journal store.
+func cleanupJournalFiles() {
+	os.Remove(testJournalFileName)
+	os.Remove(testJournalFileName + journalExtension)
+	os.Remove(testJournalFileName + tmpExtension)
+}
+
+// Tests that key value pairs written to the journal are replayed by a new store.
+func TestJournalKeyValuePairsAreReplayed(t *testing.T) {
+	var writtenValue = testType1{"test", 42}
+	var anotherValue = testType1{"any", 14}
+	var readValue testType1
+
+	defer cleanupJournalFiles()
+
+	kvs, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	// Overwrite the first key to verify that the last record wins.
+	if err = kvs.Write(testKey1, &anotherValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if err = kvs.Write(testKey1, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	// The snapshot is only written on compaction.
+	if _, err = os.Stat(testJournalFileName); !os.IsNotExist(err) {
+		t.Errorf("Snapshot file exists before compaction: %v", err)
+	}
+
+	// Create a second store pointing to the same files.
+	kvs2, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs2.Read(testKey1, &readValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if readValue != writtenValue {
+		t.Errorf("Read pair (%v, %v) does not match the written pair (%v, %v)",
+			testKey1, readValue, testKey1, writtenValue)
+	}
+}
+
+// Tests that the journal is compacted once it grows large relative to the snapshot.
+func TestJournalIsCompactedBySize(t *testing.T) {
+	var writtenValue = testType1{"", 42}
+	var writes int
+
+	defer cleanupJournalFiles()
+
+	kvs, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	// Only changes are journaled, so replace the whole value on each write.
+	write := func() error {
+		writes++
+		writtenValue.Field1 = strings.Repeat(string(rune('a'+writes%2)), journalMinCompactSize)
+		writtenValue.Field2 = writes
+		return kvs.Write(testKey1, &writtenValue)
+	}
+
+	journalExists := func() bool {
+		_, err := os.Stat(testJournalFileName + journalExtension)
+		return err == nil
+	}
+
+	// The journal is compacted once it exceeds the minimum compaction size.
+	for i := 0; i < 2; i++ {
+		if err = write(); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+	}
+
+	if journalExists() {
+		t.Errorf("Journal file exists after exceeding the minimum compaction size")
+	}
+
+	// The journal then grows up to journalCompactRatio times the snapshot.
+	for i := 0; i < journalCompactRatio-1; i++ {
+		if err = write(); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+	}
+
+	if !journalExists() {
+		t.Errorf("Journal file compacted before exceeding the snapshot size ratio")
+	}
+
+	for i := 0; i < 2 && journalExists(); i++ {
+		if err = write(); err != nil {
+			t.Fatalf("Failed to write to store %v", err)
+		}
+	}
+
+	if journalExists() {
+		t.Errorf("Journal file not compacted after exceeding the snapshot size ratio")
+	}
+}
+
+// Tests that flushing compacts the journal into a snapshot readable by the JSON file store.
+func TestJournalIsCompactedIntoSnapshot(t *testing.T) {
+	var writtenValue = testType1{"test", 42}
+	var readValue testType1
+
+	defer cleanupJournalFiles()
+
+	kvs, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs.Write(testKey2, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	if err = kvs.Flush(); err != nil {
+		t.Fatalf("Failed to flush store %v", err)
+	}
+
+	if _, err = os.Stat(testJournalFileName + journalExtension); !os.IsNotExist(err) {
+		t.Errorf("Journal file exists after compaction: %v", err)
+	}
+
+	jsonKvs, err := NewJsonFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = jsonKvs.Read(testKey2, &readValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if readValue != writtenValue {
+		t.Errorf("Read pair (%v, %v) does not match the written pair (%v, %v)",
+			testKey2, readValue, testKey2, writtenValue)
+	}
+}
+
+// Tests that records only hold the changes to the previous value and are replayed correctly.
+func TestJournalRecordsChanges(t *testing.T) {
+	var writtenValue = map[string]*testType1{
+		"a": {strings.Repeat("a", 1024), 1},
+		"b": {strings.Repeat("b", 1024), 2},
+		"c": {"c", 3},
+	}
+	var readValue map[string]*testType1
+
+	defer cleanupJournalFiles()
+
+	kvs, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs.Write(testKey1, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	info, err := os.Stat(testJournalFileName + journalExtension)
+	if err != nil {
+		t.Fatalf("Failed to stat journal %v", err)
+	}
+
+	// Change one entry, add one and remove one.
+	writtenValue["a"].Field2 = 10
+	writtenValue["d"] = &testType1{"d", 4}
+	delete(writtenValue, "c")
+
+	if err = kvs.Write(testKey1, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	buf, err := ioutil.ReadFile(testJournalFileName + journalExtension)
+	if err != nil {
+		t.Fatalf("Failed to read journal %v", err)
+	}
+
+	record := string(buf[info.Size():])
+	if strings.Contains(record, "aaaa") || strings.Contains(record, "bbbb") {
+		t.Errorf("Journal record contains unchanged entries: %v", record)
+	}
+
+	// A member set to null cannot be expressed as a change, so the whole value is recorded.
+	writtenValue["b"] = nil
+
+	if err = kvs.Write(testKey1, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	kvs2, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs2.Read(testKey1, &readValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if !reflect.DeepEqual(readValue, writtenValue) {
+		t.Errorf("Read value %v does not match the written value %v", readValue, writtenValue)
+	}
+}
+
+// Tests that a torn record at the end of the journal is ignored.
+func TestJournalTornRecordIsIgnored(t *testing.T) {
+	var writtenValue = testType1{"test", 42}
+	var readValue testType1
+
+	defer cleanupJournalFiles()
+
+	kvs, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs.Write(testKey1, &writtenValue); err != nil {
+		t.Fatalf("Failed to write to store %v", err)
+	}
+
+	// Simulate a crash in the middle of appending a record.
+	file, err := os.OpenFile(testJournalFileName+journalExtension, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatalf("Failed to open journal %v", err)
+	}
+
+	file.WriteString(`{"key":"key1","value":{"Fiel`)
+	file.Close()
+
+	kvs2, err := NewJournalFileStore(testJournalFileName)
+	if err != nil {
+		t.Fatalf("Failed to create KeyValueStore %v\n", err)
+	}
+
+	if err = kvs2.Read(testKey1, &readValue); err != nil {
+		t.Fatalf("Failed to read from store %v", err)
+	}
+
+	if readValue != writtenValue {
+		t.Errorf("Read pair (%v, %v) does not match the written pair (%v, %v)",
+			testKey1, readValue, testKey1, writtenValue)
+	}
+}
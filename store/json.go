@@ -109,21 +109,12 @@ func (kvs *jsonFileStore) Flush() error {
 
 // Lock-free flush for internal callers.
 func (kvs *jsonFileStore) flush() error {
-	file, err := os.Create(kvs.fileName)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
 	buf, err := json.MarshalIndent(&kvs.data, "", "\t")
 	if err != nil {
 		return err
 	}
 
-	if _, err := file.Write(buf); err != nil {
-		return err
-	}
-	return nil
+	return writeFileAtomic(kvs.fileName, buf)
 }
 
 // Lock locks the store for exclusive access.
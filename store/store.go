@@ -26,4 +26,5 @@ var (
 	ErrStoreNotLocked                 = fmt.Errorf("store is not locked")
 	ErrTimeoutLockingStore            = fmt.Errorf("timed out locking store")
 	ErrNonBlockingLockIsAlreadyLocked = fmt.Errorf("attempted to perform non-blocking lock on an already locked store")
+	ErrInvalidBackend                 = fmt.Errorf("invalid store backend")
 )
@@ -0,0 +1,354 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+)
+
+// Sink types.
+const (
+	SinkTypeHostAgent = "hostagent"
+	SinkTypeFile      = "file"
+	SinkTypeOTLP      = "otlp"
+	SinkTypeWebhook   = "webhook"
+)
+
+const (
+	// Default timeout of HTTP sinks.
+	defaultSinkTimeout = 10 * time.Second
+	// Service name reported to OTLP collectors.
+	otlpServiceName = "azure-vnet-telemetry"
+)
+
+// SinkConfig - configuration of a telemetry sink
+type SinkConfig struct {
+	Type             string            `json:"type"`
+	URL              string            `json:"url,omitempty"`
+	Path             string            `json:"path,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	TimeoutInSeconds int               `json:"timeoutInSeconds,omitempty"`
+}
+
+// Sink is a destination for buffered telemetry reports.
+type Sink interface {
+	// Name returns the name of the sink for logging.
+	Name() string
+	// MaxPayloadSize returns the maximum payload size in bytes the sink accepts, or 0 if unlimited.
+	MaxPayloadSize() int
+	// Send sends a payload of reports.
+	Send(payload *Buffer) error
+}
+
+// NewSink creates a telemetry sink from its configuration.
+func NewSink(config SinkConfig) (Sink, error) {
+	timeout := defaultSinkTimeout
+	if config.TimeoutInSeconds > 0 {
+		timeout = time.Duration(config.TimeoutInSeconds) * time.Second
+	}
+
+	switch config.Type {
+	case SinkTypeHostAgent:
+		url := config.URL
+		if url == "" {
+			url = azureHostReportURL
+		}
+		return NewHostAgentSink(url), nil
+
+	case SinkTypeFile:
+		if config.Path == "" {
+			return nil, fmt.Errorf("[Telemetry] File sink requires a path")
+		}
+		return NewFileSink(config.Path), nil
+
+	case SinkTypeOTLP:
+		if config.URL == "" {
+			return nil, fmt.Errorf("[Telemetry] OTLP sink requires a url")
+		}
+		return NewOTLPSink(config.URL, config.Headers, timeout), nil
+
+	case SinkTypeWebhook:
+		if config.URL == "" {
+			return nil, fmt.Errorf("[Telemetry] Webhook sink requires a url")
+		}
+		return NewWebhookSink(config.URL, config.Headers, timeout), nil
+
+	default:
+		return nil, fmt.Errorf("[Telemetry] Invalid sink type %s", config.Type)
+	}
+}
+
+// NewSinks creates the telemetry sinks from their configuration, skipping invalid ones.
+func NewSinks(configs []SinkConfig) []Sink {
+	var sinks []Sink
+
+	for _, config := range configs {
+		sink, err := NewSink(config)
+		if err != nil {
+			log.Logf("[Telemetry] Skipping sink %+v: %v", config, err)
+			continue
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	return sinks
+}
+
+// httpSink posts payloads as a JSON encoded Buffer.
+type httpSink struct {
+	name           string
+	url            string
+	headers        map[string]string
+	maxPayloadSize int
+	client         *http.Client
+}
+
+// NewHostAgentSink creates a sink posting payloads to the host net agent on wireserver.
+// Payloads are limited to MaxPayloadSize bytes.
+func NewHostAgentSink(url string) Sink {
+	return &httpSink{
+		name:           SinkTypeHostAgent,
+		url:            url,
+		maxPayloadSize: MaxPayloadSize,
+		client:         &http.Client{Timeout: defaultSinkTimeout},
+	}
+}
+
+// NewWebhookSink creates a sink posting payloads to a generic HTTP endpoint.
+func NewWebhookSink(url string, headers map[string]string, timeout time.Duration) Sink {
+	return &httpSink{
+		name:    SinkTypeWebhook,
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Name returns the name of the sink.
+func (s *httpSink) Name() string {
+	return s.name
+}
+
+// MaxPayloadSize returns the maximum payload size of the sink.
+func (s *httpSink) MaxPayloadSize() int {
+	return s.maxPayloadSize
+}
+
+// Send posts a payload.
+func (s *httpSink) Send(payload *Buffer) error {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
+		return fmt.Errorf("[Telemetry] Encode buffer error %v", err)
+	}
+
+	return post(s.client, s.url, s.headers, &body)
+}
+
+// fileSink appends reports to a file as JSON lines.
+type fileSink struct {
+	path string
+	sync.Mutex
+}
+
+// Record written by the file sink.
+type fileRecord struct {
+	Type   string      `json:"type"`
+	Report interface{} `json:"report"`
+}
+
+// NewFileSink creates a sink appending each report to a local file as a line of JSON.
+func NewFileSink(path string) Sink {
+	return &fileSink{path: path}
+}
+
+// Name returns the name of the sink.
+func (s *fileSink) Name() string {
+	return SinkTypeFile
+}
+
+// MaxPayloadSize returns the maximum payload size of the sink.
+func (s *fileSink) MaxPayloadSize() int {
+	return 0
+}
+
+// Send appends the reports of a payload to the file.
+func (s *fileSink) Send(payload *Buffer) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, report := range payload.getReports() {
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("[Telemetry] Encode report error %v", err)
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(lines.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// otlpSink exports reports as log records with the OTLP/HTTP JSON encoding.
+type otlpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// OTLP log export request, encoded as JSON.
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Body         otlpAnyValue   `json:"body"`
+	Attributes   []otlpKeyValue `json:"attributes"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// NewOTLPSink creates a sink exporting reports to an OTLP/HTTP logs endpoint, such as
+// http://localhost:4318/v1/logs. Each report is a log record whose body is the JSON encoded report.
+func NewOTLPSink(url string, headers map[string]string, timeout time.Duration) Sink {
+	return &otlpSink{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Name returns the name of the sink.
+func (s *otlpSink) Name() string {
+	return SinkTypeOTLP
+}
+
+// MaxPayloadSize returns the maximum payload size of the sink.
+func (s *otlpSink) MaxPayloadSize() int {
+	return 0
+}
+
+// Send exports the reports of a payload.
+func (s *otlpSink) Send(payload *Buffer) error {
+	request, err := newOTLPLogsRequest(payload, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(request); err != nil {
+		return fmt.Errorf("[Telemetry] Encode OTLP request error %v", err)
+	}
+
+	return post(s.client, s.url, s.headers, &body)
+}
+
+// Returns the OTLP log export request for a payload.
+func newOTLPLogsRequest(payload *Buffer, now time.Time) (*otlpLogsRequest, error) {
+	hostName, _ := os.Hostname()
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	var records []otlpLogRecord
+	for _, report := range payload.getReports() {
+		b, err := json.Marshal(report.Report)
+		if err != nil {
+			return nil, fmt.Errorf("[Telemetry] Encode report error %v", err)
+		}
+
+		records = append(records, otlpLogRecord{
+			TimeUnixNano: timestamp,
+			Body:         otlpAnyValue{StringValue: string(b)},
+			Attributes:   []otlpKeyValue{{Key: "report.type", Value: otlpAnyValue{StringValue: report.Type}}},
+		})
+	}
+
+	return &otlpLogsRequest{
+		ResourceLogs: []otlpResourceLogs{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{
+						{Key: "service.name", Value: otlpAnyValue{StringValue: otlpServiceName}},
+						{Key: "host.name", Value: otlpAnyValue{StringValue: hostName}},
+					},
+				},
+				ScopeLogs: []otlpScopeLogs{
+					{
+						Scope:      otlpScope{Name: "github.com/Azure/azure-container-networking/telemetry"},
+						LogRecords: records,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// Posts a JSON body to a URL.
+func post(client *http.Client, url string, headers map[string]string, body *bytes.Buffer) error {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", ContentType)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("[Telemetry] HTTP Post returned error %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("[Telemetry] HTTP Post returned statuscode %d", resp.StatusCode)
+	}
+
+	return nil
+}
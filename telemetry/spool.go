@@ -0,0 +1,431 @@
+// Copyright 2018 Microsoft. All rights reserved.
+// MIT License
+
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-container-networking/log"
+	"github.com/Azure/azure-container-networking/platform"
+)
+
+const (
+	// Default path of the spool file.
+	defaultSpoolPath = platform.CNIRuntimePath + "azure-vnet-telemetry.spool"
+	// Default maximum size of the spool file in bytes.
+	defaultSpoolMaxSize = 4 * 1024 * 1024
+	// Default maximum age of spooled reports.
+	defaultSpoolMaxAge = 24 * time.Hour
+	// Number of acknowledgements after which the spool file is compacted.
+	spoolCompactThreshold = 256
+	// Maximum size of a single spool record.
+	spoolMaxRecordSize = 1024 * 1024
+)
+
+// SpoolConfig - configuration of the on-disk report spool
+type SpoolConfig struct {
+	Disabled        bool   `json:"disabled,omitempty"`
+	Path            string `json:"path,omitempty"`
+	MaxSizeInBytes  int64  `json:"maxSizeInBytes,omitempty"`
+	MaxAgeInSeconds int    `json:"maxAgeInSeconds,omitempty"`
+}
+
+// Spool keeps the reports that have not been delivered to the sinks yet on disk, so that they
+// survive telemetry service restarts. The spool file is an append-only log of JSON records.
+// Report records are acknowledged by appending an ack record with the same sequence number
+// once delivered, and the file is periodically compacted to the pending reports.
+type Spool struct {
+	path         string
+	maxSize      int64
+	maxAge       time.Duration
+	records      []*spoolRecord
+	keys         map[string]bool
+	size         int64
+	numAcks      int
+	lastSequence uint64
+	sync.Mutex
+}
+
+// spoolRecord is a single entry in the spool file.
+// Records without a type or report only carry the last sequence number across compactions.
+type spoolRecord struct {
+	Sequence  uint64          `json:"seq"`
+	Type      string          `json:"type,omitempty"`
+	Key       string          `json:"key,omitempty"`
+	SpooledAt int64           `json:"spooledAt,omitempty"`
+	Report    json.RawMessage `json:"report,omitempty"`
+	Acked     bool            `json:"acked,omitempty"`
+}
+
+// NewSpool opens the spool with the given configuration and loads its pending reports.
+func NewSpool(config SpoolConfig) (*Spool, error) {
+	spool := &Spool{
+		path:    config.Path,
+		maxSize: config.MaxSizeInBytes,
+		maxAge:  time.Duration(config.MaxAgeInSeconds) * time.Second,
+	}
+
+	if spool.path == "" {
+		spool.path = defaultSpoolPath
+	}
+
+	if spool.maxSize <= 0 {
+		spool.maxSize = defaultSpoolMaxSize
+	}
+
+	if spool.maxAge <= 0 {
+		spool.maxAge = defaultSpoolMaxAge
+	}
+
+	if err := spool.load(); err != nil {
+		return nil, err
+	}
+
+	return spool, nil
+}
+
+// LastSequence returns the highest sequence number ever spooled.
+func (spool *Spool) LastSequence() uint64 {
+	spool.Lock()
+	defer spool.Unlock()
+
+	return spool.lastSequence
+}
+
+// Contains returns whether a report with the given deduplication key is pending.
+func (spool *Spool) Contains(key string) bool {
+	spool.Lock()
+	defer spool.Unlock()
+
+	return key != "" && spool.keys[key]
+}
+
+// Add spools a report with the given sequence number.
+func (spool *Spool) Add(sequence uint64, reportType string, key string, report interface{}) error {
+	spool.Lock()
+	defer spool.Unlock()
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	record := &spoolRecord{
+		Sequence:  sequence,
+		Type:      reportType,
+		Key:       key,
+		SpooledAt: time.Now().Unix(),
+		Report:    b,
+	}
+
+	if err := spool.append(record); err != nil {
+		return err
+	}
+
+	spool.records = append(spool.records, record)
+	if key != "" {
+		spool.keys[key] = true
+	}
+
+	if sequence > spool.lastSequence {
+		spool.lastSequence = sequence
+	}
+
+	if spool.size > spool.maxSize {
+		return spool.compact()
+	}
+
+	return nil
+}
+
+// Ack marks the reports with the given sequence numbers as delivered.
+func (spool *Spool) Ack(sequences []uint64) error {
+	spool.Lock()
+	defer spool.Unlock()
+
+	acked := make(map[uint64]bool)
+	for _, sequence := range sequences {
+		if err := spool.append(&spoolRecord{Sequence: sequence, Acked: true}); err != nil {
+			return err
+		}
+		acked[sequence] = true
+		spool.numAcks++
+	}
+
+	var records []*spoolRecord
+	for _, record := range spool.records {
+		if acked[record.Sequence] {
+			delete(spool.keys, record.Key)
+		} else {
+			records = append(records, record)
+		}
+	}
+	spool.records = records
+
+	if spool.numAcks >= spoolCompactThreshold {
+		return spool.compact()
+	}
+
+	return nil
+}
+
+// Pending returns up to max pending reports in the order they were spooled, skipping expired ones.
+func (spool *Spool) Pending(max int) []interface{} {
+	spool.Lock()
+	defer spool.Unlock()
+
+	var reports []interface{}
+	expiry := time.Now().Add(-spool.maxAge).Unix()
+
+	for _, record := range spool.records {
+		if len(reports) >= max {
+			break
+		}
+
+		if record.SpooledAt < expiry {
+			continue
+		}
+
+		report, err := decodeReport(record.Type, record.Report)
+		if err != nil {
+			log.Logf("[Telemetry] Skipping invalid spooled report %d: %v", record.Sequence, err)
+			continue
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports
+}
+
+// load reads the pending reports from the spool file and compacts it.
+func (spool *Spool) load() error {
+	spool.records = nil
+	spool.keys = make(map[string]bool)
+
+	file, err := os.Open(spool.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	pending := make(map[uint64]*spoolRecord)
+	var order []uint64
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, spoolMaxRecordSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record spoolRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// Torn records are left behind by a crash during append.
+			log.Logf("[Telemetry] Ignoring corrupt record in spool %s: %v", spool.path, err)
+			continue
+		}
+
+		if record.Sequence > spool.lastSequence {
+			spool.lastSequence = record.Sequence
+		}
+
+		switch {
+		case record.Acked:
+			delete(pending, record.Sequence)
+		case record.Type != "":
+			if _, ok := pending[record.Sequence]; !ok {
+				order = append(order, record.Sequence)
+			}
+			r := record
+			pending[record.Sequence] = &r
+		}
+	}
+
+	err = scanner.Err()
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// Replay pending reports once, dropping duplicates left behind by clients retrying.
+	for _, sequence := range order {
+		record, ok := pending[sequence]
+		if !ok || (record.Key != "" && spool.keys[record.Key]) {
+			continue
+		}
+
+		spool.records = append(spool.records, record)
+		if record.Key != "" {
+			spool.keys[record.Key] = true
+		}
+	}
+
+	log.Logf("[Telemetry] Loaded %d pending reports from spool %s", len(spool.records), spool.path)
+
+	return spool.compact()
+}
+
+// append adds a record to the end of the spool file.
+func (spool *Spool) append(record *spoolRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	buf = append(buf, '\n')
+
+	file, err := os.OpenFile(spool.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Write(buf); err != nil {
+		return err
+	}
+
+	spool.size += int64(len(buf))
+
+	return nil
+}
+
+// compact rewrites the spool file with the pending reports, dropping expired reports and the
+// oldest reports over the size limit. The dropped reports show up as gaps in the sequence numbers.
+func (spool *Spool) compact() error {
+	expiry := time.Now().Add(-spool.maxAge).Unix()
+
+	var lines [][]byte
+	var size int64
+	var records []*spoolRecord
+	dropped := 0
+
+	// Keep the newest reports that fit, leaving room for the sequence record.
+	marker, err := json.Marshal(&spoolRecord{Sequence: spool.lastSequence})
+	if err != nil {
+		return err
+	}
+	marker = append(marker, '\n')
+	size = int64(len(marker))
+
+	for i := len(spool.records) - 1; i >= 0; i-- {
+		record := spool.records[i]
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		if record.SpooledAt < expiry || size+int64(len(line)) > spool.maxSize {
+			delete(spool.keys, record.Key)
+			dropped++
+			continue
+		}
+
+		lines = append([][]byte{line}, lines...)
+		records = append([]*spoolRecord{record}, records...)
+		size += int64(len(line))
+	}
+
+	if dropped > 0 {
+		log.Logf("[Telemetry] Dropped %d expired or excess reports from spool %s", dropped, spool.path)
+	}
+
+	tmpPath := spool.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(marker, bytes.Join(lines, nil)...))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err = os.Rename(tmpPath, spool.path); err != nil {
+		return err
+	}
+
+	spool.records = records
+	spool.size = size
+	spool.numAcks = 0
+
+	return nil
+}
+
+// Returns the type and deduplication key of a report. The key identifies a report by its type,
+// timestamp and content, so that reports sent twice are spooled once. Reports without a timestamp
+// have no key and are never deduplicated.
+func getReportKey(report interface{}) (string, string, error) {
+	var reportType, timestamp string
+
+	switch r := report.(type) {
+	case DNCReport:
+		reportType, timestamp = dnc, r.Timestamp
+	case CNIReport:
+		reportType, timestamp = cni, r.Timestamp
+	case CNSReport:
+		reportType, timestamp = cns, r.Timestamp
+	case NPMReport:
+		reportType, timestamp = npm, r.Timestamp
+	default:
+		return "", "", fmt.Errorf("[Telemetry] Invalid report type %T", report)
+	}
+
+	if timestamp == "" {
+		return reportType, "", nil
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		return "", "", err
+	}
+
+	h := fnv.New64a()
+	h.Write(b)
+
+	return reportType, fmt.Sprintf("%s/%s/%x", reportType, timestamp, h.Sum64()), nil
+}
+
+// Decodes a report of the given type.
+func decodeReport(reportType string, b []byte) (interface{}, error) {
+	var err error
+
+	switch reportType {
+	case dnc:
+		var report DNCReport
+		err = json.Unmarshal(b, &report)
+		return report, err
+	case cni:
+		var report CNIReport
+		err = json.Unmarshal(b, &report)
+		return report, err
+	case cns:
+		var report CNSReport
+		err = json.Unmarshal(b, &report)
+		return report, err
+	case npm:
+		var report NPMReport
+		err = json.Unmarshal(b, &report)
+		return report, err
+	default:
+		return nil, fmt.Errorf("[Telemetry] Invalid report type %s", reportType)
+	}
+}
@@ -121,6 +121,7 @@ type CNIReport struct {
 	SystemDetails       SystemInfo
 	InterfaceDetails    InterfaceInfo
 	BridgeDetails       BridgeInfo
+	SequenceNumber      uint64
 	Metadata            Metadata `json:"compute"`
 }
 
@@ -135,6 +136,7 @@ type CNSReport struct {
 	Timestamp       string
 	UUID            string
 	Errorcode       string
+	SequenceNumber  uint64
 	Metadata        Metadata `json:"compute"`
 }
 
@@ -145,6 +147,16 @@ type ClusterState struct {
 	NwPolicyCount int
 }
 
+// DriftState contains the differences between the desired and live azure-npm state found by the last reconciliation.
+type DriftState struct {
+	MissingIpsets        int
+	StaleIpsets          int
+	MissingIpsetEntries  int
+	StaleIpsetEntries    int
+	MissingIptablesRules int
+	StaleIptablesRules   int
+}
+
 // NPMReport structure.
 type NPMReport struct {
 	IsNewInstance     bool
@@ -158,25 +170,28 @@ type NPMReport struct {
 	UpTime            string
 	Timestamp         string
 	ClusterState      ClusterState
+	DriftState        DriftState
+	SequenceNumber    uint64
 	Metadata          Metadata `json:"compute"`
 }
 
 // DNCReport structure.
 type DNCReport struct {
-	IsNewInstance bool
-	CPUUsage      string
-	MemoryUsage   string
-	Processes     string
-	EventMessage  string
-	PartitionKey  string
-	Allocations   string
-	Timestamp     string
-	NumberOfNodes int
-	NumberOfNCs   int
-	Orchestrator  string
-	ContainerType string
-	Errorcode     string
-	Metadata      Metadata `json:"compute"`
+	IsNewInstance  bool
+	CPUUsage       string
+	MemoryUsage    string
+	Processes      string
+	EventMessage   string
+	PartitionKey   string
+	Allocations    string
+	Timestamp      string
+	NumberOfNodes  int
+	NumberOfNCs    int
+	Orchestrator   string
+	ContainerType  string
+	Errorcode      string
+	SequenceNumber uint64
+	Metadata       Metadata `json:"compute"`
 }
 
 // ReportManager structure.
@@ -295,7 +310,7 @@ func (report *CNIReport) GetInterfaceDetails(queryUrl string) {
 	if resp.StatusCode != http.StatusOK {
 		errMsg := fmt.Sprintf("Error while getting interface details. http code :%d", resp.StatusCode)
 		report.InterfaceDetails.ErrorMessage = errMsg
-		log.Logf(errMsg)
+		log.Logf("%s", errMsg)
 		return
 	}
 
@@ -6,11 +6,14 @@ package telemetry
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -305,3 +308,386 @@ func TestSetReportState(t *testing.T) {
 		t.Errorf("Error removing telemetry file due to %v", err)
 	}
 }
+
+func TestNewSink(t *testing.T) {
+	validConfigs := []SinkConfig{
+		{Type: SinkTypeHostAgent},
+		{Type: SinkTypeFile, Path: "telemetry.jsonl"},
+		{Type: SinkTypeOTLP, URL: "http://localhost:4318/v1/logs"},
+		{Type: SinkTypeWebhook, URL: "http://localhost/telemetry", TimeoutInSeconds: 5},
+	}
+
+	for _, config := range validConfigs {
+		sink, err := NewSink(config)
+		if err != nil {
+			t.Errorf("NewSink failed for %+v: %v", config, err)
+		} else if sink.Name() != config.Type {
+			t.Errorf("NewSink returned sink %s for %+v", sink.Name(), config)
+		}
+	}
+
+	invalidConfigs := []SinkConfig{
+		{Type: "invalid"},
+		{Type: SinkTypeFile},
+		{Type: SinkTypeOTLP},
+		{Type: SinkTypeWebhook},
+	}
+
+	for _, config := range invalidConfigs {
+		if _, err := NewSink(config); err == nil {
+			t.Errorf("NewSink didn't fail for invalid config %+v", config)
+		}
+	}
+
+	if sinks := NewSinks(append(validConfigs, invalidConfigs...)); len(sinks) != len(validConfigs) {
+		t.Errorf("NewSinks returned %d sinks, expected %d", len(sinks), len(validConfigs))
+	}
+}
+
+func TestSendToSinks(t *testing.T) {
+	var webhookPayloads []Buffer
+	var otlpRequests []otlpLogsRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/webhook":
+			var payload Buffer
+			json.NewDecoder(r.Body).Decode(&payload)
+			webhookPayloads = append(webhookPayloads, payload)
+		case "/v1/logs":
+			var request otlpLogsRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			otlpRequests = append(otlpRequests, request)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "telemetry")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	headers := map[string]string{"Authorization": "Bearer token"}
+	buffer := NewTelemetryBuffer("")
+	buffer.SetSinks([]Sink{
+		NewFileSink(file.Name()),
+		NewWebhookSink(server.URL+"/webhook", headers, time.Second),
+		NewOTLPSink(server.URL+"/v1/logs", headers, time.Second),
+	})
+
+	buffer.buffer.CNIReports = append(buffer.buffer.CNIReports, sampleCniReport, sampleCniReport)
+	buffer.buffer.NPMReports = append(buffer.buffer.NPMReports, NPMReport{NpmVersion: "v1"})
+
+	if err := buffer.sendToSinks(); err != nil {
+		t.Fatalf("sendToSinks failed: %v", err)
+	}
+
+	// Sinks without a payload size limit get all reports at once.
+	if !buffer.buffer.isEmpty() {
+		t.Errorf("Buffer not emptied: %+v", buffer.buffer)
+	}
+
+	content, _ := ioutil.ReadFile(file.Name())
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines in file sink, got %q", content)
+	}
+
+	var record struct {
+		Type   string
+		Report CNIReport
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil || record.Type != cni || record.Report.EventMessage != sampleCniReport.EventMessage {
+		t.Errorf("Unexpected file sink record %s, err:%v", lines[0], err)
+	}
+
+	if len(webhookPayloads) != 1 || len(webhookPayloads[0].CNIReports) != 2 || len(webhookPayloads[0].NPMReports) != 1 {
+		t.Errorf("Unexpected webhook payloads %+v", webhookPayloads)
+	}
+
+	if len(otlpRequests) != 1 || len(otlpRequests[0].ResourceLogs[0].ScopeLogs[0].LogRecords) != 3 {
+		t.Errorf("Unexpected OTLP requests %+v", otlpRequests)
+	}
+
+	// Nothing is sent for an empty buffer.
+	if err := buffer.sendToSinks(); err != nil || len(webhookPayloads) != 1 {
+		t.Errorf("Empty buffer was sent, err:%v", err)
+	}
+
+	// Failures are reported.
+	buffer.SetSinks([]Sink{NewWebhookSink(server.URL+"/webhook", nil, time.Second)})
+	buffer.buffer.CNIReports = append(buffer.buffer.CNIReports, sampleCniReport)
+	if err := buffer.sendToSinks(); err == nil {
+		t.Errorf("sendToSinks didn't fail for unauthorized webhook")
+	}
+}
+
+func TestSendToSinksMaxPayloadSize(t *testing.T) {
+	var payloads []Buffer
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Buffer
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	buffer := NewTelemetryBuffer(server.URL)
+	buffer.SetSinks([]Sink{NewHostAgentSink(server.URL), NewWebhookSink(server.URL, nil, time.Second)})
+
+	reportSize := len(mustMarshal(t, sampleCniReport))
+	count := MaxPayloadSize/reportSize + 2
+	for i := 0; i < count; i++ {
+		buffer.buffer.CNIReports = append(buffer.buffer.CNIReports, sampleCniReport)
+	}
+
+	buffer.sendToSinks()
+
+	// The host agent limits the payload of all sinks.
+	expected := MaxPayloadSize / reportSize
+	if len(payloads) != 2 || len(payloads[0].CNIReports) != expected || len(payloads[1].CNIReports) != expected {
+		t.Errorf("Expected two payloads of %d reports, got %+v", expected, payloads)
+	}
+
+	if len(buffer.buffer.CNIReports) != count-expected {
+		t.Errorf("Expected %d reports left in buffer, got %d", count-expected, len(buffer.buffer.CNIReports))
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to marshal %+v: %v", v, err)
+	}
+
+	return b
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := SpoolConfig{Path: dir + "/azure-vnet-telemetry.spool"}
+	spool, err := NewSpool(config)
+	if err != nil {
+		t.Fatalf("NewSpool failed: %v", err)
+	}
+
+	reportType, key, err := getReportKey(sampleCniReport)
+	if err != nil || reportType != cni || key == "" {
+		t.Fatalf("getReportKey returned %s %s %v", reportType, key, err)
+	}
+
+	npmReport := NPMReport{NpmVersion: "v1", Timestamp: "2019-02-27 17:44:47"}
+	_, npmKey, _ := getReportKey(npmReport)
+
+	spool.Add(1, cni, key, setSequenceNumber(sampleCniReport, 1))
+	spool.Add(2, npm, npmKey, setSequenceNumber(npmReport, 2))
+	spool.Add(3, npm, "", setSequenceNumber(NPMReport{NpmVersion: "v2"}, 3))
+	spool.Ack([]uint64{2})
+
+	if !spool.Contains(key) || spool.Contains(npmKey) {
+		t.Errorf("Unexpected pending keys %+v", spool.keys)
+	}
+
+	// Reopening the spool replays the pending reports and keeps the sequence number.
+	spool, err = NewSpool(config)
+	if err != nil {
+		t.Fatalf("NewSpool failed to reopen spool: %v", err)
+	}
+
+	if spool.LastSequence() != 3 {
+		t.Errorf("Expected last sequence 3, got %d", spool.LastSequence())
+	}
+
+	pending := spool.Pending(MaxNumReports)
+	if len(pending) != 2 || pending[0].(CNIReport).SequenceNumber != 1 || pending[1].(NPMReport).NpmVersion != "v2" {
+		t.Errorf("Unexpected pending reports %+v", pending)
+	}
+
+	// The sequence number survives acknowledging and compacting all reports.
+	spool.Ack([]uint64{1, 3})
+	spool.compact()
+
+	spool, _ = NewSpool(config)
+	if spool.LastSequence() != 3 || len(spool.Pending(MaxNumReports)) != 0 {
+		t.Errorf("Expected empty spool at sequence 3, got %d %+v", spool.LastSequence(), spool.records)
+	}
+
+	// The oldest reports are dropped when the spool exceeds its size limit.
+	config.MaxSizeInBytes = 4096
+	spool, _ = NewSpool(config)
+	for i := uint64(4); i < 10; i++ {
+		spool.Add(i, cni, "", setSequenceNumber(sampleCniReport, i))
+	}
+
+	pending = spool.Pending(MaxNumReports)
+	if len(pending) == 0 || pending[len(pending)-1].(CNIReport).SequenceNumber != 9 || pending[0].(CNIReport).SequenceNumber == 4 {
+		t.Errorf("Oldest reports not dropped: %+v", spool.records)
+	}
+
+	if info, _ := os.Stat(config.Path); info.Size() > config.MaxSizeInBytes {
+		t.Errorf("Spool size %d exceeds limit", info.Size())
+	}
+
+	// Expired reports are not replayed.
+	for _, record := range spool.records {
+		record.SpooledAt -= int64(defaultSpoolMaxAge/time.Second) + 1
+	}
+
+	if pending = spool.Pending(MaxNumReports); len(pending) != 0 {
+		t.Errorf("Expired reports returned: %+v", pending)
+	}
+}
+
+func TestSendToSinksWithSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	available := false
+	var payloads []Buffer
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var payload Buffer
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	config := SpoolConfig{Path: dir + "/azure-vnet-telemetry.spool"}
+	spool, _ := NewSpool(config)
+
+	buffer := NewTelemetryBuffer("")
+	buffer.SetSinks([]Sink{NewWebhookSink(server.URL, nil, time.Second)})
+	buffer.SetSpool(spool)
+
+	buffer.push(sampleCniReport)
+	buffer.push(sampleCniReport)
+	buffer.push(NPMReport{NpmVersion: "v1"})
+
+	// Duplicate reports are dropped without using a sequence number.
+	if buffer.sequence != 2 {
+		t.Errorf("Expected sequence 2, got %d", buffer.sequence)
+	}
+
+	// Reports are kept while the sink is unavailable.
+	if err := buffer.sendToSinks(); err == nil {
+		t.Errorf("sendToSinks didn't fail for unavailable sink")
+	}
+
+	if len(buffer.backlogs[0]) != 1 || len(buffer.backlogs[0][0].CNIReports) != 1 || len(buffer.backlogs[0][0].NPMReports) != 1 {
+		t.Errorf("Reports not kept for the sink: %+v", buffer.backlogs)
+	}
+
+	// The telemetry service restarts and replays the spool.
+	spool, _ = NewSpool(config)
+	buffer = NewTelemetryBuffer("")
+	buffer.SetSinks([]Sink{NewWebhookSink(server.URL, nil, time.Second)})
+	buffer.SetSpool(spool)
+
+	buffer.push(NPMReport{NpmVersion: "v2"})
+	if buffer.sequence != 3 {
+		t.Errorf("Expected sequence 3 after restart, got %d", buffer.sequence)
+	}
+
+	available = true
+	if err := buffer.sendToSinks(); err != nil {
+		t.Fatalf("sendToSinks failed: %v", err)
+	}
+
+	if len(payloads) != 1 || len(payloads[0].CNIReports) != 1 || len(payloads[0].NPMReports) != 2 {
+		t.Fatalf("Unexpected payloads %+v", payloads)
+	}
+
+	if payloads[0].CNIReports[0].SequenceNumber != 1 {
+		t.Errorf("Unexpected sequence number %d", payloads[0].CNIReports[0].SequenceNumber)
+	}
+
+	if pending := spool.Pending(MaxNumReports); len(pending) != 0 {
+		t.Errorf("Delivered reports still pending: %+v", pending)
+	}
+}
+
+func TestSendToSinksPartialFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	available := false
+	payloads := make(map[string][]Buffer)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/failing" && !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var payload Buffer
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads[r.URL.Path] = append(payloads[r.URL.Path], payload)
+	}))
+	defer server.Close()
+
+	spool, _ := NewSpool(SpoolConfig{Path: dir + "/azure-vnet-telemetry.spool"})
+
+	buffer := NewTelemetryBuffer("")
+	buffer.SetSinks([]Sink{
+		NewWebhookSink(server.URL+"/healthy", nil, time.Second),
+		NewWebhookSink(server.URL+"/failing", nil, time.Second),
+	})
+	buffer.SetSpool(spool)
+
+	buffer.push(NPMReport{NpmVersion: "v1"})
+	if err := buffer.sendToSinks(); err == nil {
+		t.Errorf("sendToSinks didn't fail for unavailable sink")
+	}
+
+	buffer.push(NPMReport{NpmVersion: "v2"})
+	buffer.sendToSinks()
+
+	// The healthy sink receives each report once, while the failing sink keeps them.
+	if len(payloads["/healthy"]) != 2 || len(payloads["/failing"]) != 0 || len(buffer.backlogs[1]) != 2 {
+		t.Fatalf("Unexpected payloads %+v, backlogs %+v", payloads, buffer.backlogs)
+	}
+
+	if pending := spool.Pending(MaxNumReports); len(pending) != 2 {
+		t.Errorf("Reports undelivered to a sink not pending: %+v", pending)
+	}
+
+	// The failing sink recovers and receives the reports in order.
+	available = true
+	if err := buffer.sendToSinks(); err != nil {
+		t.Fatalf("sendToSinks failed: %v", err)
+	}
+
+	failing := payloads["/failing"]
+	if len(payloads["/healthy"]) != 2 || len(failing) != 2 || failing[0].NPMReports[0].NpmVersion != "v1" || failing[1].NPMReports[0].NpmVersion != "v2" {
+		t.Errorf("Unexpected payloads %+v", payloads)
+	}
+
+	if pending := spool.Pending(MaxNumReports); len(pending) != 0 {
+		t.Errorf("Delivered reports still pending: %+v", pending)
+	}
+}
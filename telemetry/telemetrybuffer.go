@@ -5,7 +5,6 @@ package telemetry
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -27,6 +26,8 @@ import (
 // TelemetryConfig - telemetry config read by telemetry service
 type TelemetryConfig struct {
 	ReportToHostIntervalInSeconds time.Duration `json:"reportToHostIntervalInSeconds"`
+	Sinks                         []SinkConfig  `json:"sinks,omitempty"`
+	Spool                         SpoolConfig   `json:"spool"`
 }
 
 // FdName - file descriptor name
@@ -58,6 +59,10 @@ type TelemetryBuffer struct {
 	connections        []net.Conn
 	azureHostReportURL string
 	buffer             Buffer
+	sinks              []Sink
+	backlogs           [][]Buffer
+	spool              *Spool
+	sequence           uint64
 	FdExists           bool
 	Connected          bool
 	data               chan interface{}
@@ -77,10 +82,14 @@ type Buffer struct {
 func NewTelemetryBuffer(hostReportURL string) *TelemetryBuffer {
 	var tb TelemetryBuffer
 
-	if hostReportURL == "" {
+	tb.azureHostReportURL = hostReportURL
+	if tb.azureHostReportURL == "" {
 		tb.azureHostReportURL = azureHostReportURL
 	}
 
+	tb.sinks = []Sink{NewHostAgentSink(tb.azureHostReportURL)}
+	tb.backlogs = make([][]Buffer, len(tb.sinks))
+
 	tb.data = make(chan interface{}, MaxNumReports)
 	tb.cancel = make(chan bool, 1)
 	tb.connections = make([]net.Conn, 0)
@@ -92,6 +101,28 @@ func NewTelemetryBuffer(hostReportURL string) *TelemetryBuffer {
 	return &tb
 }
 
+// SetSinks - set the sinks the buffered reports are sent to, replacing the host net agent
+func (tb *TelemetryBuffer) SetSinks(sinks []Sink) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	tb.sinks = sinks
+	tb.backlogs = make([][]Buffer, len(sinks))
+}
+
+// SetSpool - keep undelivered reports in the given spool and replay its pending reports
+func (tb *TelemetryBuffer) SetSpool(spool *Spool) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	tb.spool = spool
+	if sequence := spool.LastSequence(); sequence > tb.sequence {
+		tb.sequence = sequence
+	}
+
+	tb.refill()
+}
+
 func remove(s []net.Conn, i int) []net.Conn {
 	if len(s) > 0 && i < len(s) {
 		s[i] = s[len(s)-1]
@@ -202,14 +233,15 @@ func (tb *TelemetryBuffer) BufferAndPushData(intervalms time.Duration) {
 		for {
 			select {
 			case <-interval:
-				// Send buffer to host and clear cache when sent successfully
-				// To-do : if we hit max slice size in buffer, write to disk and process the logs on disk on future sends
+				// Send buffer to sinks and clear cache when sent successfully
+				// Reports that did not fit in the buffer are picked up from the spool once it drains
 				tb.mutex.Lock()
-				tb.sendToHost()
+				tb.refill()
+				tb.sendToSinks()
 				tb.mutex.Unlock()
 			case report := <-tb.data:
 				tb.mutex.Lock()
-				tb.buffer.push(report)
+				tb.push(report)
 				tb.mutex.Unlock()
 			case <-tb.cancel:
 				log.Logf("[Telemetry] server cancel event")
@@ -276,9 +308,171 @@ func (tb *TelemetryBuffer) Close() {
 	tb.connections = make([]net.Conn, 0)
 }
 
-// sendToHost - send buffer to host
-func (tb *TelemetryBuffer) sendToHost() error {
-	buf := Buffer{
+// sendToSinks - send a payload of the buffer to all sinks
+// Each sink keeps a backlog of the payloads it failed to receive, which are retried in order
+// before it receives new payloads. Other sinks are not sent the same payload again.
+func (tb *TelemetryBuffer) sendToSinks() error {
+	if len(tb.sinks) == 0 {
+		return nil
+	}
+
+	var lastErr error
+	var settled []Buffer
+
+	for i, sink := range tb.sinks {
+		for len(tb.backlogs[i]) > 0 {
+			payload := tb.backlogs[i][0]
+			if err := sink.Send(&payload); err != nil {
+				log.Logf("[Telemetry] Resending buffer to sink %s failed: %v", sink.Name(), err)
+				lastErr = err
+				break
+			}
+
+			tb.backlogs[i] = tb.backlogs[i][1:]
+			settled = append(settled, payload)
+		}
+	}
+
+	// The payload must fit the sink with the smallest limit.
+	maxPayloadSize := 0
+	for _, sink := range tb.sinks {
+		if size := sink.MaxPayloadSize(); size > 0 && (maxPayloadSize == 0 || size < maxPayloadSize) {
+			maxPayloadSize = size
+		}
+	}
+
+	payload := tb.buffer.pop(maxPayloadSize)
+	if !payload.isEmpty() {
+		log.Logf("Sending buffer %+v", payload)
+
+		for i, sink := range tb.sinks {
+			// Sinks still failing to receive older payloads get this one after them.
+			if len(tb.backlogs[i]) > 0 {
+				settled = append(settled, tb.addToBacklog(i, payload)...)
+				continue
+			}
+
+			if err := sink.Send(&payload); err != nil {
+				log.Logf("[Telemetry] Sending buffer to sink %s failed: %v", sink.Name(), err)
+				lastErr = err
+				settled = append(settled, tb.addToBacklog(i, payload)...)
+			}
+		}
+
+		settled = append(settled, payload)
+	}
+
+	tb.ack(settled)
+
+	return lastErr
+}
+
+// addToBacklog - keep a payload for a sink that failed to receive it, dropping the oldest
+// payloads of the sink beyond MaxNumReports reports. Returns the dropped payloads.
+func (tb *TelemetryBuffer) addToBacklog(i int, payload Buffer) []Buffer {
+	backlog := append(tb.backlogs[i], payload)
+
+	numReports := 0
+	for _, p := range backlog {
+		numReports += len(p.getSequenceNumbers())
+	}
+
+	var dropped []Buffer
+	for numReports > MaxNumReports && len(backlog) > 1 {
+		dropped = append(dropped, backlog[0])
+		numReports -= len(backlog[0].getSequenceNumbers())
+		backlog = backlog[1:]
+	}
+
+	if len(dropped) > 0 {
+		log.Logf("[Telemetry] Dropped %d payloads undelivered to sink %s", len(dropped), tb.sinks[i].Name())
+	}
+
+	tb.backlogs[i] = backlog
+
+	return dropped
+}
+
+// ack - acknowledge the spooled reports of the given payloads no longer pending for any sink
+func (tb *TelemetryBuffer) ack(payloads []Buffer) {
+	if tb.spool == nil || len(payloads) == 0 {
+		return
+	}
+
+	pending := make(map[uint64]bool)
+	for _, backlog := range tb.backlogs {
+		for _, payload := range backlog {
+			for _, sequence := range payload.getSequenceNumbers() {
+				pending[sequence] = true
+			}
+		}
+	}
+
+	var sequences []uint64
+	for _, payload := range payloads {
+		for _, sequence := range payload.getSequenceNumbers() {
+			if !pending[sequence] {
+				pending[sequence] = true
+				sequences = append(sequences, sequence)
+			}
+		}
+	}
+
+	if len(sequences) == 0 {
+		return
+	}
+
+	if err := tb.spool.Ack(sequences); err != nil {
+		log.Logf("[Telemetry] Failed to acknowledge spooled reports: %v", err)
+	}
+}
+
+// push - assign the next sequence number to a report, spool it and add it to the buffer
+func (tb *TelemetryBuffer) push(report interface{}) {
+	reportType, key, err := getReportKey(report)
+	if err != nil {
+		log.Logf("%v", err)
+		return
+	}
+
+	if tb.spool != nil && tb.spool.Contains(key) {
+		log.Logf("[Telemetry] Dropping duplicate %s report %s", reportType, key)
+		return
+	}
+
+	tb.sequence++
+	report = setSequenceNumber(report, tb.sequence)
+
+	if tb.spool != nil {
+		if err := tb.spool.Add(tb.sequence, reportType, key, report); err != nil {
+			log.Logf("[Telemetry] Failed to spool report %d: %v", tb.sequence, err)
+		}
+	}
+
+	tb.buffer.push(report)
+}
+
+// refill - load pending reports from the spool once the buffer and the backlogs of all sinks are empty
+func (tb *TelemetryBuffer) refill() {
+	if tb.spool == nil || !tb.buffer.isEmpty() {
+		return
+	}
+
+	for _, backlog := range tb.backlogs {
+		if len(backlog) > 0 {
+			return
+		}
+	}
+
+	for _, report := range tb.spool.Pending(MaxNumReports) {
+		tb.buffer.push(report)
+	}
+}
+
+// pop - remove and return reports from the buffer in a round-robin manner,
+// up to maxPayloadSize bytes of JSON, or all reports if maxPayloadSize is 0
+func (buf *Buffer) pop(maxPayloadSize int) Buffer {
+	payload := Buffer{
 		DNCReports: make([]DNCReport, 0),
 		CNIReports: make([]CNIReport, 0),
 		NPMReports: make([]NPMReport, 0),
@@ -286,13 +480,13 @@ func (tb *TelemetryBuffer) sendToHost() error {
 	}
 
 	seed := rand.NewSource(time.Now().UnixNano())
-	i, payloadSize, maxPayloadSizeReached := rand.New(seed).Intn(reflect.ValueOf(&buf).Elem().NumField()), 0, false
+	i, payloadSize, maxPayloadSizeReached := rand.New(seed).Intn(reflect.ValueOf(&payload).Elem().NumField()), 0, false
 	isDNCReportsEmpty, isCNIReportsEmpty, isCNSReportsEmpty, isNPMReportsEmpty := false, false, false, false
 	for {
 		// craft payload in a round-robin manner.
 		switch i % 4 {
 		case 0:
-			reportLen := len(tb.buffer.DNCReports)
+			reportLen := len(buf.DNCReports)
 			if reportLen == 0 || isDNCReportsEmpty {
 				isDNCReportsEmpty = true
 				break
@@ -302,18 +496,18 @@ func (tb *TelemetryBuffer) sendToHost() error {
 				isDNCReportsEmpty = true
 			}
 
-			report := tb.buffer.DNCReports[0]
+			report := buf.DNCReports[0]
 			if bytes, err := json.Marshal(report); err == nil {
 				payloadSize += len(bytes)
-				if payloadSize > MaxPayloadSize {
+				if maxPayloadSize > 0 && payloadSize > maxPayloadSize {
 					maxPayloadSizeReached = true
 					break
 				}
 			}
-			buf.DNCReports = append(buf.DNCReports, report)
-			tb.buffer.DNCReports = tb.buffer.DNCReports[1:]
+			payload.DNCReports = append(payload.DNCReports, report)
+			buf.DNCReports = buf.DNCReports[1:]
 		case 1:
-			reportLen := len(tb.buffer.CNIReports)
+			reportLen := len(buf.CNIReports)
 			if reportLen == 0 || isCNIReportsEmpty {
 				isCNIReportsEmpty = true
 				break
@@ -323,18 +517,18 @@ func (tb *TelemetryBuffer) sendToHost() error {
 				isCNIReportsEmpty = true
 			}
 
-			report := tb.buffer.CNIReports[0]
+			report := buf.CNIReports[0]
 			if bytes, err := json.Marshal(report); err == nil {
 				payloadSize += len(bytes)
-				if payloadSize > MaxPayloadSize {
+				if maxPayloadSize > 0 && payloadSize > maxPayloadSize {
 					maxPayloadSizeReached = true
 					break
 				}
 			}
-			buf.CNIReports = append(buf.CNIReports, report)
-			tb.buffer.CNIReports = tb.buffer.CNIReports[1:]
+			payload.CNIReports = append(payload.CNIReports, report)
+			buf.CNIReports = buf.CNIReports[1:]
 		case 2:
-			reportLen := len(tb.buffer.CNSReports)
+			reportLen := len(buf.CNSReports)
 			if reportLen == 0 || isCNSReportsEmpty {
 				isCNSReportsEmpty = true
 				break
@@ -344,18 +538,18 @@ func (tb *TelemetryBuffer) sendToHost() error {
 				isCNSReportsEmpty = true
 			}
 
-			report := tb.buffer.CNSReports[0]
+			report := buf.CNSReports[0]
 			if bytes, err := json.Marshal(report); err == nil {
 				payloadSize += len(bytes)
-				if payloadSize > MaxPayloadSize {
+				if maxPayloadSize > 0 && payloadSize > maxPayloadSize {
 					maxPayloadSizeReached = true
 					break
 				}
 			}
-			buf.CNSReports = append(buf.CNSReports, report)
-			tb.buffer.CNSReports = tb.buffer.CNSReports[1:]
+			payload.CNSReports = append(payload.CNSReports, report)
+			buf.CNSReports = buf.CNSReports[1:]
 		case 3:
-			reportLen := len(tb.buffer.NPMReports)
+			reportLen := len(buf.NPMReports)
 			if reportLen == 0 || isNPMReportsEmpty {
 				isNPMReportsEmpty = true
 				break
@@ -365,16 +559,16 @@ func (tb *TelemetryBuffer) sendToHost() error {
 				isNPMReportsEmpty = true
 			}
 
-			report := tb.buffer.NPMReports[0]
+			report := buf.NPMReports[0]
 			if bytes, err := json.Marshal(report); err == nil {
 				payloadSize += len(bytes)
-				if payloadSize > MaxPayloadSize {
+				if maxPayloadSize > 0 && payloadSize > maxPayloadSize {
 					maxPayloadSizeReached = true
 					break
 				}
 			}
-			buf.NPMReports = append(buf.NPMReports, report)
-			tb.buffer.NPMReports = tb.buffer.NPMReports[1:]
+			payload.NPMReports = append(payload.NPMReports, report)
+			buf.NPMReports = buf.NPMReports[1:]
 		}
 
 		if isDNCReportsEmpty && isCNIReportsEmpty && isCNSReportsEmpty && isNPMReportsEmpty {
@@ -388,25 +582,7 @@ func (tb *TelemetryBuffer) sendToHost() error {
 		i++
 	}
 
-	httpc := &http.Client{}
-	var body bytes.Buffer
-	log.Logf("Sending buffer %+v", buf)
-	if err := json.NewEncoder(&body).Encode(buf); err != nil {
-		log.Logf("[Telemetry] Encode buffer error %v", err)
-	}
-	resp, err := httpc.Post(tb.azureHostReportURL, ContentType, &body)
-	log.Logf("[Telemetry] Got response %v", resp)
-	if err != nil {
-		return fmt.Errorf("[Telemetry] HTTP Post returned error %v", err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("[Telemetry] HTTP Post returned statuscode %d", resp.StatusCode)
-	}
-
-	return nil
+	return payload
 }
 
 // push - push the report (x) to corresponding slice
@@ -453,6 +629,71 @@ func (buf *Buffer) push(x interface{}) {
 	}
 }
 
+// getSequenceNumbers - return the sequence numbers of the reports in the buffer
+func (buf *Buffer) getSequenceNumbers() []uint64 {
+	var sequences []uint64
+
+	for _, report := range buf.DNCReports {
+		sequences = append(sequences, report.SequenceNumber)
+	}
+	for _, report := range buf.CNIReports {
+		sequences = append(sequences, report.SequenceNumber)
+	}
+	for _, report := range buf.CNSReports {
+		sequences = append(sequences, report.SequenceNumber)
+	}
+	for _, report := range buf.NPMReports {
+		sequences = append(sequences, report.SequenceNumber)
+	}
+
+	return sequences
+}
+
+// setSequenceNumber - return a copy of the report with the given sequence number
+func setSequenceNumber(report interface{}, sequence uint64) interface{} {
+	switch r := report.(type) {
+	case DNCReport:
+		r.SequenceNumber = sequence
+		return r
+	case CNIReport:
+		r.SequenceNumber = sequence
+		return r
+	case CNSReport:
+		r.SequenceNumber = sequence
+		return r
+	case NPMReport:
+		r.SequenceNumber = sequence
+		return r
+	}
+
+	return report
+}
+
+// isEmpty - whether the buffer holds no reports
+func (buf *Buffer) isEmpty() bool {
+	return len(buf.DNCReports) == 0 && len(buf.CNIReports) == 0 && len(buf.NPMReports) == 0 && len(buf.CNSReports) == 0
+}
+
+// getReports - return the reports of the buffer along with their type
+func (buf *Buffer) getReports() []fileRecord {
+	var reports []fileRecord
+
+	for _, report := range buf.DNCReports {
+		reports = append(reports, fileRecord{Type: dnc, Report: report})
+	}
+	for _, report := range buf.CNIReports {
+		reports = append(reports, fileRecord{Type: cni, Report: report})
+	}
+	for _, report := range buf.CNSReports {
+		reports = append(reports, fileRecord{Type: cns, Report: report})
+	}
+	for _, report := range buf.NPMReports {
+		reports = append(reports, fileRecord{Type: npm, Report: report})
+	}
+
+	return reports
+}
+
 // reset - reset buffer slices and sets payloadSize to 0
 func (buf *Buffer) reset() {
 	buf.DNCReports = nil